@@ -99,6 +99,12 @@ func CopyExpr(e Expr) Expr {
 		}
 		return &Match{CopyExpr(e.Value), cases, defaultCase, e.inferred}
 
+	case *Pack:
+		return &Pack{CopyExpr(e.Value), e.As, e.inferred}
+
+	case *Unpack:
+		return &Unpack{e.Var, CopyExpr(e.Value), CopyExpr(e.Body), e.inferred}
+
 	case *ControlFlow:
 		next := NewControlFlow(e.Name, e.Locals...)
 		blocks := make([]Block, len(e.Blocks))
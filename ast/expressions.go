@@ -38,6 +38,8 @@
 //   RecordEmpty:     empty record
 //   Variant:         tagged (ad-hoc) variant
 //   Match:           variant-matching switch
+//   Pack:            packing a value with an existential type
+//   Unpack:          unpacking a value with an existential type
 package ast
 
 import (
@@ -61,6 +63,8 @@ var (
 	_ Expr = (*RecordEmpty)(nil)
 	_ Expr = (*Variant)(nil)
 	_ Expr = (*Match)(nil)
+	_ Expr = (*Pack)(nil)
+	_ Expr = (*Unpack)(nil)
 )
 
 // Expr is the base for all expressions.
@@ -83,6 +87,8 @@ var (
 //   RecordEmpty:     empty record
 //   Variant:         tagged (ad-hoc) variant
 //   Match:           variant-matching switch
+//   Pack:            packing a value with an existential type
+//   Unpack:          unpacking a value with an existential type
 type Expr interface {
 	// Name of the syntax-type of the expression.
 	ExprName() string
@@ -220,6 +226,14 @@ func (e *Func) ArgType(index int) types.Type { return types.RealType(e.inferred.
 // Get the inferred (or assigned) return type of e.
 func (e *Func) RetType() types.Type { return types.RealType(e.inferred.Return) }
 
+// Get the inferred (or assigned) effect row of e, or nil if effects are not tracked for e.
+func (e *Func) Effects() types.Type {
+	if e.inferred.Effects == nil {
+		return nil
+	}
+	return types.RealType(e.inferred.Effects)
+}
+
 // Let-binding: `let a = 1 in e`
 type Let struct {
 	Var   string
@@ -408,3 +422,39 @@ func (e *Pipe) Type() types.Type { return types.RealType(e.inferred) }
 
 // Assign a type to e. Type assignments should occur indirectly, during inference.
 func (e *Pipe) SetType(t types.Type) { e.inferred = t }
+
+// Packing a value with an existential type: `pack {state = 0, step = inc} as exists 'a. {state : 'a, step : 'a -> 'a}`
+type Pack struct {
+	Value Expr
+	// Existential type of the packed value. The hidden types of quantified type-variables are determined by Value.
+	As       *types.Existential
+	inferred types.Type
+}
+
+// "Pack"
+func (e *Pack) ExprName() string { return "Pack" }
+
+// Get the inferred (or assigned) type of e.
+func (e *Pack) Type() types.Type { return types.RealType(e.inferred) }
+
+// Assign a type to e. Type assignments should occur indirectly, during inference.
+func (e *Pack) SetType(t types.Type) { e.inferred = t }
+
+// Unpacking a value with an existential type: `unpack p = plugin in p.step(p.state)`
+//
+// Hidden types of the packed value are replaced by skolem constants within the body, which may not escape the body.
+type Unpack struct {
+	Var      string
+	Value    Expr
+	Body     Expr
+	inferred types.Type
+}
+
+// "Unpack"
+func (e *Unpack) ExprName() string { return "Unpack" }
+
+// Get the inferred (or assigned) type of e.
+func (e *Unpack) Type() types.Type { return types.RealType(e.inferred) }
+
+// Assign a type to e. Type assignments should occur indirectly, during inference.
+func (e *Unpack) SetType(t types.Type) { e.inferred = t }
@@ -26,6 +26,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/wdamron/poly/types"
 )
 
 func ExprString(e Expr) string {
@@ -227,6 +229,30 @@ func exprString(sb *strings.Builder, simple bool, e Expr) {
 			exprString(sb, false, e.Default.Value)
 		}
 		sb.WriteString(" }")
+
+	case *Pack:
+		if simple {
+			sb.WriteByte('(')
+		}
+		sb.WriteString("pack ")
+		exprString(sb, true, e.Value)
+		sb.WriteString(" as ")
+		sb.WriteString(types.TypeString(e.As))
+		if simple {
+			sb.WriteByte(')')
+		}
+
+	case *Unpack:
+		if simple {
+			sb.WriteByte('(')
+		}
+		sb.WriteString("unpack ")
+		bindingString(sb, e.Var, e.Value)
+		sb.WriteString(" in ")
+		exprString(sb, false, e.Body)
+		if simple {
+			sb.WriteByte(')')
+		}
 	}
 }
 
@@ -22,13 +22,39 @@
 
 package ast
 
+// Call f for e and each nested expression, in pre-order. Called functions, matched values, and the sources of pipelines are
+// visited before arguments, cases, and steps.
 func WalkExpr(e Expr, f func(Expr)) {
 	switch e := e.(type) {
 	case *Var, *Literal, *RecordEmpty:
 		f(e)
 
+	case *Deref:
+		f(e)
+		WalkExpr(e.Ref, f)
+
+	case *DerefAssign:
+		f(e)
+		WalkExpr(e.Ref, f)
+		WalkExpr(e.Value, f)
+
+	case *ControlFlow:
+		f(e)
+		for _, step := range e.Entry.Sequence {
+			WalkExpr(step, f)
+		}
+		for _, block := range e.Blocks {
+			for _, step := range block.Sequence {
+				WalkExpr(step, f)
+			}
+		}
+		for _, step := range e.Return.Sequence {
+			WalkExpr(step, f)
+		}
+
 	case *Call:
 		f(e)
+		WalkExpr(e.Func, f)
 		for _, arg := range e.Args {
 			WalkExpr(arg, f)
 		}
@@ -38,7 +64,8 @@ func WalkExpr(e Expr, f func(Expr)) {
 		WalkExpr(e.Body, f)
 
 	case *Pipe:
-		f(e.Source)
+		f(e)
+		WalkExpr(e.Source, f)
 		for _, step := range e.Sequence {
 			WalkExpr(step, f)
 		}
@@ -76,6 +103,7 @@ func WalkExpr(e Expr, f func(Expr)) {
 
 	case *Match:
 		f(e)
+		WalkExpr(e.Value, f)
 		for _, v := range e.Cases {
 			WalkExpr(v.Value, f)
 		}
@@ -83,6 +111,15 @@ func WalkExpr(e Expr, f func(Expr)) {
 			WalkExpr(e.Default.Value, f)
 		}
 
+	case *Pack:
+		f(e)
+		WalkExpr(e.Value, f)
+
+	case *Unpack:
+		f(e)
+		WalkExpr(e.Value, f)
+		WalkExpr(e.Body, f)
+
 	case nil:
 
 	default:
@@ -0,0 +1,72 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Command poly-lsp is a language server for expressions in the syntax printed by ast.ExprString.
+//
+// The server communicates over stdin and stdout. Documents are type-checked within an environment which
+// declares a small set of builtin functions.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/wdamron/poly"
+	"github.com/wdamron/poly/lsp"
+	"github.com/wdamron/poly/syntax"
+)
+
+var builtins = [][2]string{
+	{"true", "bool"},
+	{"false", "bool"},
+	{"not", "bool -> bool"},
+	{"add", "(int, int) -> int"},
+	{"sub", "(int, int) -> int"},
+	{"mul", "(int, int) -> int"},
+	{"concat", "(string, string) -> string"},
+	{"eq", "('a, 'a) -> bool"},
+	{"if", "(bool, 'a, 'a) -> 'a"},
+	{"ref", "'a -> ref['a]"},
+}
+
+func newEnv() *poly.TypeEnv {
+	env := poly.NewTypeEnv(nil)
+	for _, b := range builtins {
+		t, err := syntax.ParseType(b[1], env)
+		if err != nil {
+			panic(err)
+		}
+		env.Declare(b[0], t)
+	}
+	return env
+}
+
+func main() {
+	server := lsp.NewServer(lsp.Config{
+		Frontend: lsp.FrontendFunc(syntax.Parse),
+		NewEnv:   newEnv,
+	})
+	if err := server.Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
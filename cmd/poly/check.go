@@ -0,0 +1,210 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/wdamron/poly/syntax"
+	"github.com/wdamron/poly/types"
+)
+
+// Prefix of comments which record the expected types of top-level bindings, in golden mode:
+//
+//   let id(x) = x
+//   //: id : 'a -> 'a
+const goldenPrefix = "//:"
+
+type checker struct {
+	prelude string
+	golden  bool
+	update  bool
+	out     io.Writer
+}
+
+// Run the check command with the given arguments. The exit status will be returned.
+func runCheck(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.SetOutput(out)
+	c := &checker{out: out}
+	flags.StringVar(&c.prelude, "prelude", "", "load declarations from a file before checking each file")
+	flags.BoolVar(&c.golden, "golden", false, "compare the types of top-level bindings with expected types recorded in "+goldenPrefix+" comments")
+	flags.BoolVar(&c.update, "update", false, "update expected types recorded in "+goldenPrefix+" comments (implies -golden)")
+	flags.Usage = func() {
+		fmt.Fprintln(out, "usage: poly check [-prelude file] [-golden] [-update] files...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	c.golden = c.golden || c.update
+	status := 0
+	for _, file := range flags.Args() {
+		if !c.checkFile(file) {
+			status = 1
+		}
+	}
+	return status
+}
+
+// golden is the set of expected types recorded after a top-level declaration.
+type golden struct {
+	// Byte range of the comment lines within the source text
+	start, end int
+	types      map[string]string
+}
+
+// Type-check a file, reporting errors (and mismatched expected types in golden mode). False will be returned if any errors were found.
+func (c *checker) checkFile(file string) bool {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+		return false
+	}
+	src := string(data)
+	s := newSession()
+	if c.prelude != "" {
+		if _, err := s.load(c.prelude); err != nil {
+			fmt.Fprintln(c.out, err)
+			return false
+		}
+	}
+	decls, sm, err := syntax.ParseFile(src, s.env)
+	if err != nil {
+		if serr, ok := err.(*syntax.Error); ok {
+			err = &sourceError{File: file, Src: src, Span: serr.Span, Err: errors.New(serr.Message)}
+		}
+		fmt.Fprintln(c.out, err)
+		return false
+	}
+
+	ok := true
+	var edits []edit
+	for _, d := range decls {
+		bindings, err := s.declare(d, sm)
+		if err != nil {
+			if serr, isSourceErr := err.(*sourceError); isSourceErr {
+				serr.File, serr.Src = file, src
+			}
+			fmt.Fprintln(c.out, err)
+			ok = false
+			continue
+		}
+		if _, isLet := d.(*syntax.LetDecl); !isLet || !c.golden {
+			continue
+		}
+		g := parseGolden(src, d.DeclSpan().End)
+		if c.update {
+			edits = append(edits, edit{g.start, g.end, goldenLines(bindings)})
+			continue
+		}
+		for _, b := range bindings {
+			actual := types.TypeString(b.Type)
+			line, col := position(src, d.DeclSpan().Start)
+			pos := fmt.Sprintf("%s:%d:%d: ", file, line, col)
+			switch expected, found := g.types[b.Name]; {
+			case !found:
+				fmt.Fprintf(c.out, "%sMissing expected type for %s : %s\n", pos, b.Name, actual)
+				ok = false
+			case expected != actual:
+				fmt.Fprintf(c.out, "%sMismatched type for %s: expected %s, found %s\n", pos, b.Name, expected, actual)
+				ok = false
+			}
+		}
+	}
+
+	if c.update && len(edits) != 0 {
+		updated := applyEdits(src, edits)
+		if updated != src {
+			if err := ioutil.WriteFile(file, []byte(updated), 0644); err != nil {
+				fmt.Fprintln(c.out, err)
+				return false
+			}
+		}
+	}
+	return ok
+}
+
+// Parse the expected-type comments on the lines following a declaration which ends at offset.
+func parseGolden(src string, offset int) golden {
+	start := len(src)
+	if i := strings.IndexByte(src[offset:], '\n'); i >= 0 {
+		start = offset + i + 1
+	}
+	g := golden{start: start, end: start, types: make(map[string]string)}
+	for g.end < len(src) {
+		lineEnd := len(src)
+		if i := strings.IndexByte(src[g.end:], '\n'); i >= 0 {
+			lineEnd = g.end + i + 1
+		}
+		line := strings.TrimSpace(src[g.end:lineEnd])
+		if !strings.HasPrefix(line, goldenPrefix) {
+			break
+		}
+		entry := strings.TrimSpace(line[len(goldenPrefix):])
+		if i := strings.Index(entry, " : "); i >= 0 {
+			g.types[strings.TrimSpace(entry[:i])] = strings.TrimSpace(entry[i+3:])
+		}
+		g.end = lineEnd
+	}
+	return g
+}
+
+func goldenLines(bindings []binding) string {
+	var sb strings.Builder
+	for _, b := range bindings {
+		sb.WriteString(goldenPrefix + " " + b.Name + " : " + types.TypeString(b.Type) + "\n")
+	}
+	return sb.String()
+}
+
+// edit replaces a byte range within source text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// Apply non-overlapping edits, in order of their positions.
+func applyEdits(src string, edits []edit) string {
+	var sb strings.Builder
+	last := 0
+	for _, e := range edits {
+		sb.WriteString(src[last:e.start])
+		if e.start == len(src) && !strings.HasSuffix(src, "\n") {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(e.text)
+		last = e.end
+	}
+	sb.WriteString(src[last:])
+	return sb.String()
+}
@@ -0,0 +1,115 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testdataPrelude = "testdata/prelude.poly"
+
+func TestCheckGolden(t *testing.T) {
+	var out strings.Builder
+	if status := runCheck([]string{"-prelude", testdataPrelude, "-golden", "testdata/inference.poly"}, &out); status != 0 {
+		t.Fatalf("check failed with status %d:\n%s", status, out.String())
+	}
+}
+
+func writeTemp(t *testing.T, dir, src string) string {
+	file := filepath.Join(dir, "test.poly")
+	if err := ioutil.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestCheckErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "poly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := writeTemp(t, dir, "let one = 1\n\nlet bad = add(one, \"s\")\nlet worse = (\n")
+	var out strings.Builder
+	if status := runCheck([]string{"-prelude", testdataPrelude, file}, &out); status != 1 {
+		t.Fatalf("expected status 1, found %d:\n%s", status, out.String())
+	}
+	if !strings.HasPrefix(out.String(), file+":5:1: ") {
+		t.Fatalf("expected a syntax error at 5:1, found:\n%s", out.String())
+	}
+
+	file = writeTemp(t, dir, "let one = 1\n\nlet bad = add(one, \"s\")\nlet two = add(one, one)\n")
+	out.Reset()
+	if status := runCheck([]string{"-prelude", testdataPrelude, file}, &out); status != 1 {
+		t.Fatalf("expected status 1, found %d:\n%s", status, out.String())
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 1 || !strings.HasPrefix(lines[0], file+":3:") {
+		t.Fatalf("expected a single type error on line 3, found:\n%s", out.String())
+	}
+}
+
+func TestCheckUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "poly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := writeTemp(t, dir, "let id(x) = x\n//: id : int -> int\n\nlet one = id(1)\n// not an expected type\nlet two = add(one, one)")
+	var out strings.Builder
+	if status := runCheck([]string{"-prelude", testdataPrelude, "-golden", file}, &out); status != 1 {
+		t.Fatalf("expected status 1, found %d:\n%s", status, out.String())
+	}
+	for _, expected := range []string{
+		file + ":1:1: Mismatched type for id: expected int -> int, found 'a -> 'a\n",
+		file + ":4:1: Missing expected type for one : int\n",
+		file + ":6:1: Missing expected type for two : int\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatalf("missing %q in output:\n%s", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	if status := runCheck([]string{"-prelude", testdataPrelude, "-update", file}, &out); status != 0 {
+		t.Fatalf("update failed with status %d:\n%s", status, out.String())
+	}
+	updated, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "let id(x) = x\n//: id : 'a -> 'a\n\nlet one = id(1)\n//: one : int\n// not an expected type\nlet two = add(one, one)\n//: two : int\n"
+	if string(updated) != expected {
+		t.Fatalf("expected updated source:\n%s\nfound:\n%s", expected, updated)
+	}
+
+	out.Reset()
+	if status := runCheck([]string{"-prelude", testdataPrelude, "-golden", file}, &out); status != 0 {
+		t.Fatalf("check failed after update with status %d:\n%s", status, out.String())
+	}
+}
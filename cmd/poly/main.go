@@ -0,0 +1,63 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Command poly is an interactive environment for exploring type inference.
+//
+// Expressions and types use the syntax printed by ast.ExprString and types.TypeString (see the syntax package).
+// Top-level let-bindings and other declarations extend a persistent type environment.
+//
+// Usage:
+//
+//   poly [-prelude file]                                  start a read-eval-print loop
+//   poly check [-prelude file] [-golden] [-update] files  type-check files
+//
+// In golden mode, the inferred type of each top-level binding is compared with the expected type recorded in a comment
+// on the lines following the binding. Expected types are updated with -update:
+//
+//   let id(x) = x
+//   //: id : 'a -> 'a
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:], os.Stdout))
+	}
+
+	prelude := flag.String("prelude", "", "load declarations from a file before starting")
+	flag.Parse()
+
+	s := newSession()
+	if *prelude != "" {
+		if _, err := s.load(*prelude); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	r := &repl{s: s, out: os.Stdout}
+	r.run(os.Stdin, true)
+}
@@ -0,0 +1,263 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/wdamron/poly/syntax"
+	"github.com/wdamron/poly/types"
+)
+
+const replHelp = `Enter an expression to print its type, or a declaration to extend the environment:
+
+  let f(x) = e                 declare a top-level binding (with "and" for mutual recursion)
+  f : type                     declare the type of a variable
+  class Name 'a { m : type }   declare a type-class (with "extends A, B" for super-classes)
+  instance Name type { m = f } declare an instance of a type-class
+
+Commands:
+
+  :type <expr>                 print the type of an expression
+  :kind <type>                 print the kind of a type
+  :instances <class>           list the instances of a type-class
+  :env                         list declared bindings and type-classes
+  :explain <class> <type>      explain instance resolution for a type
+  :load <file>                 load declarations from a file
+  :help                        print this message
+  :quit                        exit
+`
+
+type repl struct {
+	s   *session
+	out io.Writer
+}
+
+// Run a read-eval-print loop, reading input from in until EOF or :quit. Incomplete input is continued on the next line, and
+// input which is still incomplete at EOF is reported as a parse error.
+func (r *repl) run(in io.Reader, prompt bool) {
+	scanner := bufio.NewScanner(in)
+	var pending string
+	for {
+		if prompt {
+			if pending == "" {
+				fmt.Fprint(r.out, "poly> ")
+			} else {
+				fmt.Fprint(r.out, "  ... ")
+			}
+		}
+		if !scanner.Scan() {
+			if pending != "" {
+				// unfinished input is reported as a parse error:
+				r.print(r.s.eval("", strings.TrimSuffix(pending, "\n")))
+			}
+			return
+		}
+		src := pending + scanner.Text()
+		if strings.TrimSpace(src) == "" {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(src), ":") {
+			if done, ok := r.command(strings.TrimSpace(src)); ok {
+				pending = ""
+				if done {
+					return
+				}
+				continue
+			}
+		}
+		results, err := r.s.eval("", src)
+		if serr, ok := err.(*sourceError); ok && serr.Span.Start >= len(src) && len(results) == 0 {
+			// incomplete input:
+			pending = src + "\n"
+			continue
+		}
+		pending = ""
+		r.print(results, err)
+	}
+}
+
+func (r *repl) print(results []binding, err error) {
+	for _, b := range results {
+		if b.Name == "" {
+			fmt.Fprintln(r.out, types.TypeString(b.Type))
+		} else {
+			fmt.Fprintln(r.out, b.Name+" : "+types.TypeString(b.Type))
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, "error: "+err.Error())
+	}
+}
+
+// Run a meta-command. The second result is false if the input is not a command (such as a variant expression `:A x`).
+func (r *repl) command(line string) (quit bool, ok bool) {
+	name, arg := line[1:], ""
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i+1:])
+	}
+	var err error
+	switch name {
+	case "quit", "q":
+		return true, true
+	case "help", "h":
+		fmt.Fprint(r.out, replHelp)
+	case "type", "t":
+		var results []binding
+		results, err = r.typeOf(arg)
+		r.print(results, nil)
+	case "kind", "k":
+		err = r.kind(arg)
+	case "instances":
+		err = r.instances(arg)
+	case "env":
+		r.listEnv()
+	case "explain":
+		err = r.explain(arg)
+	case "load":
+		var results []binding
+		results, err = r.s.load(arg)
+		r.print(results, nil)
+	default:
+		return false, false
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, "error: "+err.Error())
+	}
+	return false, true
+}
+
+// Infer the type of an expression without declaring bindings.
+func (r *repl) typeOf(src string) ([]binding, error) {
+	e, sm, err := syntax.Parse(src, r.s.env)
+	if err != nil {
+		return nil, err
+	}
+	t, err := r.s.infer(e, sm, syntax.Span{Start: 0, End: len(src)})
+	if err != nil {
+		err.(*sourceError).Src = src
+		return nil, err
+	}
+	return []binding{{Type: t}}, nil
+}
+
+func (r *repl) kind(src string) error {
+	t, err := syntax.ParseType(src, r.s.env)
+	if err != nil {
+		return err
+	}
+	k, err := r.s.env.CheckKind(t)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, types.TypeString(t)+" :: "+types.KindString(k))
+	return nil
+}
+
+func (r *repl) typeClass(name string) (*types.TypeClass, error) {
+	tc := r.s.env.LookupTypeClass(name)
+	if tc == nil {
+		return nil, errors.New("Type-class " + name + " is not declared")
+	}
+	return tc, nil
+}
+
+func (r *repl) instances(name string) error {
+	tc, err := r.typeClass(name)
+	if err != nil {
+		return err
+	}
+	for _, inst := range tc.InstanceList() {
+		fmt.Fprintln(r.out, "instance "+tc.Name+" "+types.TypeString(inst.Param))
+	}
+	return nil
+}
+
+func (r *repl) explain(arg string) error {
+	i := strings.IndexAny(arg, " \t")
+	if i < 0 {
+		return errors.New("Usage: :explain <class> <type>")
+	}
+	tc, err := r.typeClass(arg[:i])
+	if err != nil {
+		return err
+	}
+	t, err := syntax.ParseType(strings.TrimSpace(arg[i+1:]), r.s.env)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(r.out, r.s.env.ExplainInstance(tc, t).String())
+	return nil
+}
+
+func (r *repl) listEnv() {
+	bindings := make(map[string]types.Type)
+	classes := make(map[string]*types.TypeClass)
+	for env := r.s.env; env != nil; env = env.Parent {
+		for name, t := range env.Types {
+			if _, shadowed := bindings[name]; !shadowed {
+				bindings[name] = t
+			}
+		}
+		for name, tc := range env.TypeClasses {
+			if _, shadowed := classes[name]; !shadowed {
+				classes[name] = tc
+			}
+		}
+	}
+	for _, name := range sortedKeys(bindings) {
+		fmt.Fprintln(r.out, name+" : "+types.TypeString(bindings[name]))
+	}
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tc := classes[name]
+		line := "class " + name
+		if len(tc.SuperClasses()) != 0 {
+			var supers []string
+			for _, super := range tc.SuperClasses() {
+				supers = append(supers, super.Name)
+			}
+			sort.Strings(supers)
+			line += " extends " + strings.Join(supers, ", ")
+		}
+		fmt.Fprintln(r.out, line)
+	}
+}
+
+func sortedKeys(m map[string]types.Type) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,144 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPrelude = `// builtins
+add : (int, int) -> int
+eqInt : (int, int) -> bool
+showInt : int -> string
+ref : 'a -> ref['a]
+choose : ('a, 'a) -> 'a
+
+class Eq 'a { eq : ('a, 'a) -> bool }
+class Show 'a { show : 'a -> string }
+instance Eq int { eq = eqInt }
+instance Show int { show = showInt }
+`
+
+func runREPL(t *testing.T, input string) string {
+	dir, err := ioutil.TempDir("", "poly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	prelude := filepath.Join(dir, "prelude.poly")
+	if err := ioutil.WriteFile(prelude, []byte(testPrelude), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := newSession()
+	if _, err := s.load(prelude); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	r := &repl{s: s, out: &out}
+	r.run(strings.NewReader(input), false)
+	return out.String()
+}
+
+func TestREPL(t *testing.T) {
+	out := runREPL(t, strings.Join([]string{
+		"let id(x) = x",
+		"id(add(1, 2))",
+		"let double(x) = add(x,",
+		"  x)",
+		"let isEven(n) = isOdd(n) and isOdd(n) = isEven(n)",
+		"fn (x) -> eq(x, x)",
+		":type fn (x, y) -> eq(x, y)",
+		":kind ref[int]",
+		":instances Eq",
+		":explain Eq int",
+		"add(1, \"s\")",
+		"let r = ref(1)",
+		":A 1",
+		":quit",
+		"id",
+	}, "\n"))
+
+	for _, expected := range []string{
+		"id : 'a -> 'a\n",
+		"int\n",
+		"double : int -> int\n",
+		"isEven : 'a -> 'b\nisOdd : 'a -> 'b\n",
+		"Eq 'a => 'a -> bool\n",
+		"Eq 'a => ('a, 'a) -> bool\n",
+		"ref[int] :: *\n",
+		"instance Eq int\n",
+		"Resolving type-class Eq for int:\n",
+		"error: 1:",
+		"r : ref[int]\n",
+		"[A : int | 'a]\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("missing %q in output:\n%s", expected, out)
+		}
+	}
+	if strings.Count(out, "'a -> 'a\n") != 1 {
+		t.Fatalf("input after :quit was evaluated:\n%s", out)
+	}
+}
+
+func TestREPLEnv(t *testing.T) {
+	out := runREPL(t, "let one = 1\n:env\n")
+	for _, expected := range []string{
+		"add : (int, int) -> int\n",
+		"one : int\n",
+		"show : Show 'a => 'a -> string\n",
+		"class Eq\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("missing %q in output:\n%s", expected, out)
+		}
+	}
+}
+
+func TestREPLPreludeTypeVars(t *testing.T) {
+	// Type-variables are scoped to each declaration of the prelude:
+	out := runREPL(t, ":type choose\nchoose(1, 2)\nlet s = choose(\"a\", \"b\")\n")
+	for _, expected := range []string{
+		"('a, 'a) -> 'a\n",
+		"int\n",
+		"s : string\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("missing %q in output:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "weak") || strings.Contains(out, "error") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
+
+func TestREPLUnfinishedInput(t *testing.T) {
+	out := runREPL(t, "let one = 1\nbogus(")
+	if !strings.Contains(out, "one : int\n") || !strings.Contains(out, "error: ") {
+		t.Fatalf("expected an error for unfinished input:\n%s", out)
+	}
+}
@@ -0,0 +1,232 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/wdamron/poly"
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/syntax"
+	"github.com/wdamron/poly/types"
+)
+
+// session is a persistent type environment, extended by top-level declarations.
+type session struct {
+	env *poly.TypeEnv
+}
+
+func newSession() *session {
+	return &session{env: poly.NewTypeEnv(nil)}
+}
+
+// binding is the inferred type of a top-level binding or expression. Expressions have no name.
+type binding struct {
+	Name string
+	Type types.Type
+}
+
+// sourceError is an error at a position within source text.
+type sourceError struct {
+	File string
+	Src  string
+	Span syntax.Span
+	Err  error
+}
+
+func (err *sourceError) Error() string {
+	line, col := position(err.Src, err.Span.Start)
+	pos := strconv.Itoa(line) + ":" + strconv.Itoa(col)
+	if err.File != "" {
+		pos = err.File + ":" + pos
+	}
+	return pos + ": " + err.Err.Error()
+}
+
+// Get the 1-based line and column (in characters) of a byte offset within src.
+func position(src string, offset int) (line, col int) {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	line, lineStart := 1, 0
+	for i := 0; i < offset; i++ {
+		if src[i] == '\n' {
+			line, lineStart = line+1, i+1
+		}
+	}
+	return line, utf8.RuneCountInString(src[lineStart:offset]) + 1
+}
+
+// Parse and declare all declarations within src. Types of top-level bindings and expressions will be returned in order.
+func (s *session) eval(file, src string) ([]binding, error) {
+	decls, sm, err := syntax.ParseFile(src, s.env)
+	if err != nil {
+		if serr, ok := err.(*syntax.Error); ok {
+			return nil, &sourceError{File: file, Src: src, Span: serr.Span, Err: errors.New(serr.Message)}
+		}
+		return nil, err
+	}
+	var results []binding
+	for _, d := range decls {
+		bindings, err := s.declare(d, sm)
+		results = append(results, bindings...)
+		if err != nil {
+			if serr, ok := err.(*sourceError); ok {
+				serr.File, serr.Src = file, src
+			}
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// Load and declare all declarations within a file.
+func (s *session) load(file string) ([]binding, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return s.eval(file, string(src))
+}
+
+// Declare a top-level declaration within the session's environment.
+func (s *session) declare(d syntax.Decl, sm *syntax.SourceMap) ([]binding, error) {
+	fail := func(span syntax.Span, err error) error { return &sourceError{Span: span, Err: err} }
+
+	switch d := d.(type) {
+	case *syntax.LetDecl:
+		t, err := s.infer(letBody(d.Bindings), sm, d.Span)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]binding, len(d.Bindings))
+		if len(d.Bindings) == 1 {
+			results[0] = binding{d.Bindings[0].Var, t}
+		} else {
+			// grouped bindings are inferred together, as fields of a record:
+			labels, _, err := types.FlattenRowType(t.(*types.Record).Row)
+			if err != nil {
+				return nil, fail(d.Span, err)
+			}
+			for i, b := range d.Bindings {
+				ts, _ := labels.Get(b.Var)
+				results[i] = binding{b.Var, ts.Get(0)}
+			}
+		}
+		for _, b := range results {
+			s.env.Declare(b.Name, b.Type)
+		}
+		return results, nil
+
+	case *syntax.ExprDecl:
+		t, err := s.infer(d.Expr, sm, d.Span)
+		if err != nil {
+			return nil, err
+		}
+		return []binding{{Type: t}}, nil
+
+	case *syntax.SigDecl:
+		if _, err := s.env.CheckKind(d.Type); err != nil {
+			return nil, fail(d.Span, err)
+		}
+		s.env.Declare(d.Name, d.Type)
+		return []binding{{d.Name, s.env.Lookup(d.Name)}}, nil
+
+	case *syntax.ClassDecl:
+		supers := make([]*types.TypeClass, len(d.Super))
+		for i, name := range d.Super {
+			if supers[i] = s.env.LookupTypeClass(name); supers[i] == nil {
+				return nil, fail(d.Span, errors.New("Type-class "+name+" is not declared"))
+			}
+		}
+		var methodErr error
+		_, err := s.env.DeclareTypeClass(d.Name, func(param *types.Var) types.MethodSet {
+			methods := make(types.MethodSet, len(d.Methods))
+			vars := map[string]*types.Var{d.Param: param}
+			for _, m := range d.Methods {
+				t, err := syntax.ParseTypeWithVars(m.Type, s.env, vars)
+				if err != nil {
+					if methodErr == nil {
+						methodErr = fail(m.TypeSpan, err)
+					}
+					continue
+				}
+				arrow, ok := t.(*types.Arrow)
+				if !ok {
+					if methodErr == nil {
+						methodErr = fail(m.TypeSpan, errors.New("Method "+m.Name+" must be a function"))
+					}
+					continue
+				}
+				methods[m.Name] = arrow
+			}
+			return methods
+		}, supers...)
+		if methodErr != nil {
+			return nil, methodErr
+		}
+		if err != nil {
+			return nil, fail(d.Span, err)
+		}
+		return nil, nil
+
+	case *syntax.InstanceDecl:
+		tc := s.env.LookupTypeClass(d.Class)
+		if tc == nil {
+			return nil, fail(d.Span, errors.New("Type-class "+d.Class+" is not declared"))
+		}
+		if _, err := s.env.DeclareInstance(tc, d.Type, d.Methods); err != nil {
+			return nil, fail(d.Span, err)
+		}
+		return nil, nil
+	}
+	return nil, errors.New("Unsupported declaration")
+}
+
+// Create an expression which infers the types of top-level bindings: `let f = ... in f`, or `let f = ... and g = ... in {f = f, g = g}`
+func letBody(bindings []ast.LetBinding) ast.Expr {
+	if len(bindings) == 1 {
+		return &ast.Let{Var: bindings[0].Var, Value: bindings[0].Value, Body: &ast.Var{Name: bindings[0].Var}}
+	}
+	record := &ast.RecordExtend{Record: &ast.RecordEmpty{}}
+	for _, b := range bindings {
+		record.Labels = append(record.Labels, ast.LabelValue{Label: b.Var, Value: &ast.Var{Name: b.Var}})
+	}
+	return &ast.LetGroup{Vars: bindings, Body: record}
+}
+
+// Infer the type of an expression, reporting errors at the span of the invalid sub-expression (or the declaration).
+func (s *session) infer(e ast.Expr, sm *syntax.SourceMap, span syntax.Span) (types.Type, error) {
+	ctx := poly.NewContext()
+	t, err := ctx.Infer(e, s.env)
+	if err != nil {
+		if invalid, ok := sm.Spans[ctx.InvalidExpr()]; ok {
+			span = invalid
+		}
+		return nil, &sourceError{Span: span, Err: err}
+	}
+	return t, nil
+}
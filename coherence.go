@@ -0,0 +1,327 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/wdamron/poly/types"
+)
+
+// InstanceConflict is a pair of overlapping type-class instances declared within separate type-environments.
+type InstanceConflict struct {
+	Existing *types.Instance
+	Imported *types.Instance
+}
+
+// CoherenceError is returned when overlapping type-class instances would be visible within a single type-environment.
+type CoherenceError struct {
+	Conflicts []InstanceConflict
+}
+
+func (err *CoherenceError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("Found overlapping instances:")
+	for i, c := range err.Conflicts {
+		if i > 0 {
+			sb.WriteByte(';')
+		}
+		sb.WriteString(" type-class ")
+		sb.WriteString(c.Imported.TypeClass.Name)
+		sb.WriteString(" instance ")
+		sb.WriteString(types.TypeString(c.Imported.Param))
+		sb.WriteString(" overlaps with ")
+		sb.WriteString(c.Existing.TypeClass.Name)
+		sb.WriteString(" instance ")
+		sb.WriteString(types.TypeString(c.Existing.Param))
+	}
+	return sb.String()
+}
+
+// Get the name of the module which declares the type-environment. If the type-environment does not declare
+// a module, the module of its parent environment(s) will be returned.
+func (e *TypeEnv) ModuleName() string {
+	for env := e; env != nil; env = env.Parent {
+		if env.Module != "" {
+			return env.Module
+		}
+	}
+	return ""
+}
+
+// Declare a named type constructor within the type environment. Instances for types constructed with the
+// type constructor may be declared within the module of the type environment.
+func (e *TypeEnv) DeclareTypeConstructor(name string) *types.Const {
+	e.checkMutable()
+	if e.typeConstructors == nil {
+		e.typeConstructors = make(map[string]bool)
+	}
+	e.typeConstructors[name] = true
+	return &types.Const{Name: name}
+}
+
+// Check if an instance is visible within the type environment. Instances are visible within the declaring type-environment,
+// its child environments, and environments which import it.
+func (e *TypeEnv) InstanceVisible(inst *types.Instance) bool {
+	if inst.Env == nil {
+		return true
+	}
+	declaring, ok := inst.Env.(*TypeEnv)
+	if !ok {
+		return true
+	}
+	return e.sees(declaring)
+}
+
+// Import the instances visible within another type-environment into the type environment. The instances
+// must not overlap with instances which are already visible within the type environment; conflicting instances
+// will be reported with a *CoherenceError, and no instances will be imported.
+func (e *TypeEnv) Import(other *TypeEnv) error {
+	if e.frozen {
+		return errFrozen
+	}
+	if err := e.CheckCoherence(other); err != nil {
+		return err
+	}
+	e.imports = append(e.imports, other)
+	invalidateVisibility()
+	return nil
+}
+
+// Check if the instances visible within another type-environment overlap with instances visible within the
+// type environment. Conflicting instances will be reported with a *CoherenceError.
+func (e *TypeEnv) CheckCoherence(other *TypeEnv) error {
+	if e.frozen {
+		return NewTypeEnv(e).CheckCoherence(other)
+	}
+	classes := make(map[uint]*types.TypeClass)
+	e.collectTypeClasses(classes, make(map[*TypeEnv]bool))
+	other.collectTypeClasses(classes, make(map[*TypeEnv]bool))
+	overlays := other.appendClassOverlays(append(types.ClassOverlays(nil), e.classOverlays()...), nil)
+	var conflicts []InstanceConflict
+	for _, tc := range classes {
+		for _, imported := range overlays.InstanceList(tc) {
+			if !other.InstanceVisible(imported) || e.InstanceVisible(imported) {
+				continue
+			}
+			visible := func(inst *types.Instance) bool { return inst != imported && e.InstanceVisible(inst) }
+			if existing := e.findOverlappingInstance(tc, imported.Param, visible); existing != nil {
+				conflicts = append(conflicts, InstanceConflict{Existing: existing, Imported: imported})
+			}
+		}
+	}
+	e.common.VarTracker.FlattenLinks()
+	e.common.VarTracker.Reset()
+	if len(conflicts) != 0 {
+		return &CoherenceError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// visibilityRevision is incremented when any type-environment imports another type-environment or adds an overlay, which
+// invalidates the cached visibility of mutable type-environments.
+var visibilityRevision uint64
+
+func invalidateVisibility() { atomic.AddUint64(&visibilityRevision, 1) }
+
+// envVisibility contains the type-environments and overlays which are visible within a type-environment, through parent
+// environments or imports. The visibility of a frozen type-environment is computed once, when the environment is frozen.
+type envVisibility struct {
+	revision uint64
+	visible  map[*TypeEnv]bool
+	overlays types.ClassOverlays
+}
+
+// Get the cached visibility of the type environment, recomputing the visibility if any type-environment has since imported
+// another type-environment or added an overlay.
+func (e *TypeEnv) visibility() *envVisibility {
+	if e.frozen {
+		return e.cachedVisibility
+	}
+	revision := atomic.LoadUint64(&visibilityRevision)
+	if v := e.cachedVisibility; v != nil && v.revision == revision {
+		return v
+	}
+	v := &envVisibility{revision: revision, visible: make(map[*TypeEnv]bool)}
+	e.collectVisibility(v)
+	e.cachedVisibility = v
+	return v
+}
+
+func (e *TypeEnv) collectVisibility(v *envVisibility) {
+	for env := e; env != nil && !v.visible[env]; env = env.Parent {
+		v.visible[env] = true
+		if env.overlay != nil {
+			v.overlays = append(v.overlays, env.overlay)
+		}
+		for _, imported := range env.imports {
+			imported.collectVisibility(v)
+		}
+	}
+}
+
+// Check if a type-environment is visible from the type environment, through parent environments or imports.
+func (e *TypeEnv) sees(target *TypeEnv) bool {
+	for env := e; env != nil; env = env.Parent {
+		if env == target {
+			return true
+		}
+		// Parent environments without imports are compared directly, so child environments of a frozen environment
+		// do not compute their own visibility:
+		if env.frozen || len(env.imports) != 0 {
+			return env.visibility().visible[target]
+		}
+	}
+	return false
+}
+
+// Get the overlays of type-class relations which are visible within the type environment, through parent environments or imports.
+// The overlays are cached and must not be modified.
+func (e *TypeEnv) classOverlays() types.ClassOverlays {
+	if !e.frozen && e.overlay == nil && len(e.imports) == 0 {
+		if e.Parent == nil {
+			return nil
+		}
+		return e.Parent.classOverlays()
+	}
+	return e.visibility().overlays
+}
+
+func (e *TypeEnv) appendClassOverlays(overlays types.ClassOverlays, seen map[*TypeEnv]bool) types.ClassOverlays {
+	for env := e; env != nil; env = env.Parent {
+		if env.overlay != nil {
+			overlays = append(overlays, env.overlay)
+		}
+		if len(env.imports) == 0 {
+			continue
+		}
+		if seen == nil {
+			seen = make(map[*TypeEnv]bool)
+		}
+		if seen[env] {
+			return overlays
+		}
+		seen[env] = true
+		for _, imported := range env.imports {
+			overlays = imported.appendClassOverlays(overlays, seen)
+		}
+	}
+	return overlays
+}
+
+// Get the overlay for type-class relations added within the type environment, or nil if type-classes should be modified directly.
+// Type-classes which may be shared with a frozen environment (through parent environments or imports) must not be modified.
+func (e *TypeEnv) writableOverlay() *types.ClassOverlay {
+	if e.overlay == nil && e.seesFrozen(nil) {
+		e.overlay = types.NewClassOverlay()
+		invalidateVisibility()
+	}
+	return e.overlay
+}
+
+// Check if a frozen type-environment is visible from the type environment, through parent environments or imports.
+func (e *TypeEnv) seesFrozen(seen map[*TypeEnv]bool) bool {
+	for env := e; env != nil; env = env.Parent {
+		if env.frozen {
+			return true
+		}
+		if len(env.imports) == 0 {
+			continue
+		}
+		if seen == nil {
+			seen = make(map[*TypeEnv]bool)
+		}
+		if seen[env] {
+			return false
+		}
+		seen[env] = true
+		for _, imported := range env.imports {
+			if imported.seesFrozen(seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *TypeEnv) collectTypeClasses(classes map[uint]*types.TypeClass, seen map[*TypeEnv]bool) {
+	for env := e; env != nil && !seen[env]; env = env.Parent {
+		seen[env] = true
+		for _, tc := range env.TypeClasses {
+			classes[tc.Id] = tc
+		}
+		for _, imported := range env.imports {
+			imported.collectTypeClasses(classes, seen)
+		}
+	}
+}
+
+// Find the type-environment which declares a type-class, through parent environments or imports.
+func (e *TypeEnv) typeClassEnv(tc *types.TypeClass, seen map[*TypeEnv]bool) *TypeEnv {
+	for env := e; env != nil && !seen[env]; env = env.Parent {
+		seen[env] = true
+		if env.TypeClasses[tc.Name] == tc {
+			return env
+		}
+		for _, imported := range env.imports {
+			if declaring := imported.typeClassEnv(tc, seen); declaring != nil {
+				return declaring
+			}
+		}
+	}
+	return nil
+}
+
+// Find the type-environment which declares a type constructor, through parent environments or imports.
+func (e *TypeEnv) typeConstructorEnv(name string, seen map[*TypeEnv]bool) *TypeEnv {
+	for env := e; env != nil && !seen[env]; env = env.Parent {
+		seen[env] = true
+		if env.typeConstructors[name] {
+			return env
+		}
+		for _, imported := range env.imports {
+			if declaring := imported.typeConstructorEnv(name, seen); declaring != nil {
+				return declaring
+			}
+		}
+	}
+	return nil
+}
+
+// Orphan instances are declared within a named module, separately from both the type-class and the type constructor of the instance type.
+func (e *TypeEnv) isOrphanInstance(tc *types.TypeClass, param types.Type) bool {
+	module := e.ModuleName()
+	if module == "" {
+		return false
+	}
+	if env := e.typeClassEnv(tc, make(map[*TypeEnv]bool)); env != nil && env.ModuleName() == module {
+		return false
+	}
+	if name := headName(param); name != "" {
+		if env := e.typeConstructorEnv(name, make(map[*TypeEnv]bool)); env != nil && env.ModuleName() == module {
+			return false
+		}
+	}
+	return true
+}
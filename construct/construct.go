@@ -47,6 +47,26 @@ func TSize(size int) types.Size {
 	return types.Size(size)
 }
 
+// Size expression for the sum of sizes: `array[int, n + m]`
+func TSizeAdd(args ...types.Type) *types.SizeExpr {
+	return types.NewSizeAdd(args...)
+}
+
+// Size expression for the product of a size constant and a size: `array[int, 2 * n]`
+func TSizeMul(factor int, arg types.Type) *types.SizeExpr {
+	return types.NewSizeMul(factor, arg)
+}
+
+// Size expression for the maximum of sizes: `array[int, max(n, m)]`
+func TSizeMax(args ...types.Type) *types.SizeExpr {
+	return types.NewSizeMax(args...)
+}
+
+// Unit of measure: `float[m/s]`
+func TMeasure(factors ...types.MeasureFactor) *types.Measure {
+	return types.NewMeasure(factors...)
+}
+
 // Recursive link to a type.
 func TRecursiveLink(rec *types.Recursive, name string) *types.RecursiveLink {
 	return &types.RecursiveLink{Recursive: rec, Index: rec.Indexes[name]}
@@ -65,6 +85,16 @@ func TRef(deref types.Type) *types.App {
 	return types.NewRef(deref)
 }
 
+// Existential type: `exists 'a. {state : 'a, step : 'a -> 'a}`
+func TExists(vars []*types.Var, body types.Type) *types.Existential {
+	return types.NewExistential(vars, body)
+}
+
+// Read-only reference type: `readref[int]`
+func TReadRef(deref types.Type) *types.App {
+	return types.NewReadRef(deref)
+}
+
 // Function type: `(int, int) -> int`
 func TArrow(args []types.Type, ret types.Type) *types.Arrow {
 	return &types.Arrow{Args: args, Return: ret}
@@ -85,6 +115,11 @@ func TArrow3(arg1, arg2, arg3 types.Type, ret types.Type) *types.Arrow {
 	return &types.Arrow{Args: []types.Type{arg1, arg2, arg3}, Return: ret}
 }
 
+// Effect row: `<io, read | 'e>`
+func TEffects(rest types.Type, effects ...string) types.Type {
+	return types.NewEffectRow(rest, effects...)
+}
+
 // Type-class method type: `('a, int) -> 'a`
 func TMethod(typeClass *types.TypeClass, name string) *types.Method {
 	return &types.Method{TypeClass: typeClass, Name: name}
@@ -243,3 +278,13 @@ func Match(value ast.Expr, cases []ast.MatchCase, defaultCase *ast.MatchCase) *a
 func MatchCase(label string, varName string, value ast.Expr) ast.MatchCase {
 	return ast.MatchCase{Label: label, Var: varName, Value: value}
 }
+
+// Packing a value with an existential type: `pack {state = 0, step = inc} as exists 'a. {state : 'a, step : 'a -> 'a}`
+func Pack(value ast.Expr, as *types.Existential) *ast.Pack {
+	return &ast.Pack{Value: value, As: as}
+}
+
+// Unpacking a value with an existential type: `unpack p = plugin in p.step(p.state)`
+func Unpack(varName string, value ast.Expr, body ast.Expr) *ast.Unpack {
+	return &ast.Unpack{Var: varName, Value: value, Body: body}
+}
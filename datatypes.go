@@ -0,0 +1,346 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/wdamron/poly/types"
+)
+
+// DataConstructor is a named constructor for an algebraic data type.
+type DataConstructor struct {
+	Name   string
+	Fields []types.Type
+	// Labels for the fields (optional). If Labels is empty, the fields of constructors with multiple fields will be labeled
+	// by position (_0, _1, ...).
+	Labels []string
+}
+
+// DataTypeDecl is a declaration of an algebraic data type within a group of mutually-recursive data types.
+type DataTypeDecl struct {
+	Name         string
+	Params       []*types.Var
+	Constructors []DataConstructor
+}
+
+// DataType is an algebraic data type declared within a type-environment.
+type DataType struct {
+	Name string
+	// Type is the generic nominal type, aliasing a variant-type with a label for each constructor.
+	Type         *types.App
+	Constructors []DataConstructor
+	// Recursive is the recursive type-group which contains the data type.
+	Recursive *types.Recursive
+}
+
+// Declare an algebraic data type within the type environment. This is a shortcut for declaring a group containing
+// a single data type with DeclareDataTypeGroup.
+func (e *TypeEnv) DeclareDataType(name string, params []*types.Var, constructors ...DataConstructor) (*DataType, error) {
+	dts, err := e.DeclareDataTypeGroup(DataTypeDecl{Name: name, Params: params, Constructors: constructors})
+	if err != nil {
+		return nil, err
+	}
+	return dts[0], nil
+}
+
+// Declare a group of (mutually-recursive) algebraic data types within the type environment.
+//
+// Each data type will be declared as a nominal type application which aliases a variant-type, with a label for each
+// of its constructors. The aliased type may be used in match expressions. Each constructor will be declared as a function
+// from its fields to the data type. Constructors without fields will be declared as values of the data type.
+// Constructors with a single unlabeled field will be represented by the type of the field within the variant-type; other
+// constructors will be represented by a record of their fields.
+//
+// Field types may refer to data types within the group by name, using type constants or type applications of the
+// declared type-parameters (e.g. `list['a]` within `list['a]`). params should contain generic type-variables.
+func (e *TypeEnv) DeclareDataTypeGroup(decls ...DataTypeDecl) ([]*DataType, error) {
+	if e.frozen {
+		return nil, errFrozen
+	}
+	if len(decls) == 0 {
+		return nil, errors.New("Empty data type group")
+	}
+	var params []*types.Var
+	paramIndexes := make(map[uint]int)
+	declIndexes := make(map[string]int, len(decls))
+	constructors := make(map[string]bool)
+	kc := newKindChecker(e)
+	for i, decl := range decls {
+		if _, ok := declIndexes[decl.Name]; ok || e.LookupKind(decl.Name) != nil {
+			return nil, errors.New("Type " + decl.Name + " is already declared")
+		}
+		declIndexes[decl.Name] = i
+		kinds := make([]types.Kind, len(decl.Params))
+		for j, tv := range decl.Params {
+			if _, ok := paramIndexes[tv.Id()]; !ok {
+				paramIndexes[tv.Id()] = len(params)
+				params = append(params, tv)
+			}
+			kinds[j], _ = kc.infer(tv)
+		}
+		var kind types.Kind = types.Star
+		if len(kinds) != 0 {
+			kind = &types.ArrowKind{Params: kinds, Result: types.Star}
+		}
+		kc.consts[decl.Name] = kind
+		for _, c := range decl.Constructors {
+			if constructors[c.Name] {
+				return nil, errors.New("Data constructor " + c.Name + " is already declared")
+			}
+			constructors[c.Name] = true
+			if len(c.Labels) != 0 && len(c.Labels) != len(c.Fields) {
+				return nil, errors.New("Data constructor " + c.Name + " must have a label for each field")
+			}
+		}
+	}
+	for _, decl := range decls {
+		for _, c := range decl.Constructors {
+			for _, field := range c.Fields {
+				if err := kc.check(field, types.Star); err != nil {
+					return nil, err
+				}
+				if err := checkRegularRecursion(decls, declIndexes, field); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	consts := make([]*types.Const, len(decls))
+	for i, decl := range decls {
+		consts[i] = e.DeclareKind(decl.Name, defaultKind(kc.consts[decl.Name]))
+	}
+	bind := func(rec *types.Recursive) {
+		s := dataSubst{decls: decls, declIndexes: declIndexes, paramIndexes: paramIndexes, rec: rec}
+		aliases := make([]*types.App, len(decls))
+		for i, decl := range decls {
+			appParams := make([]types.Type, len(decl.Params))
+			for j, tv := range decl.Params {
+				appParams[j] = rec.Params[paramIndexes[tv.Id()]]
+			}
+			aliases[i] = &types.App{Const: consts[i], Params: appParams}
+			rec.AddType(decl.Name, aliases[i])
+		}
+		for i, decl := range decls {
+			m := make(map[string]types.Type, len(decl.Constructors))
+			for _, c := range decl.Constructors {
+				m[c.Name] = constructorPayload(c, s.fields(c))
+			}
+			aliases[i].Underlying = &types.Variant{Row: &types.RowExtend{Labels: types.NewFlatTypeMap(m), Row: types.RowEmptyPointer}}
+		}
+	}
+	rec := e.NewRecursive(params, bind)
+
+	s := dataSubst{decls: decls, declIndexes: declIndexes, paramIndexes: paramIndexes, rec: rec}
+	dts := make([]*DataType, len(decls))
+	for i, decl := range decls {
+		dt := &DataType{Name: decl.Name, Type: rec.Types[i], Constructors: decl.Constructors, Recursive: rec}
+		for _, c := range decl.Constructors {
+			if len(c.Fields) == 0 {
+				e.Declare(c.Name, dt.Type)
+				continue
+			}
+			e.Declare(c.Name, &types.Arrow{Args: s.fields(c), Return: dt.Type})
+		}
+		if e.dataTypes == nil {
+			e.dataTypes = make(map[string]*DataType)
+		}
+		e.dataTypes[decl.Name] = dt
+		dts[i] = dt
+	}
+	return dts, nil
+}
+
+// Lookup a declared data type in the environment or its parent environment(s).
+func (e *TypeEnv) LookupDataType(name string) *DataType {
+	if dt, ok := e.dataTypes[name]; ok {
+		return dt
+	}
+	if e.Parent == nil {
+		return nil
+	}
+	return e.Parent.LookupDataType(name)
+}
+
+func constructorPayload(c DataConstructor, fields []types.Type) types.Type {
+	switch {
+	case len(fields) == 0:
+		return types.NewUnit()
+	case len(fields) == 1 && len(c.Labels) == 0:
+		return fields[0]
+	}
+	m := make(map[string]types.Type, len(fields))
+	for i, field := range fields {
+		if len(c.Labels) != 0 {
+			m[c.Labels[i]] = field
+		} else {
+			m["_"+strconv.Itoa(i)] = field
+		}
+	}
+	return &types.Record{Row: &types.RowExtend{Labels: types.NewFlatTypeMap(m), Row: types.RowEmptyPointer}}
+}
+
+// References to data types within a group must be applied to the declared type-parameters of the referenced data type.
+func checkRegularRecursion(decls []DataTypeDecl, declIndexes map[string]int, t types.Type) error {
+	var err error
+	visitDataRefs(t, func(name string, params []types.Type) {
+		decl := decls[declIndexes[name]]
+		if len(params) != len(decl.Params) {
+			err = errors.New("Invalid reference to data type " + name + " within data type group")
+			return
+		}
+		for i, param := range params {
+			if tv, ok := types.RealType(param).(*types.Var); !ok || tv.Id() != decl.Params[i].Id() {
+				err = errors.New("Non-regular reference to data type " + name + " within data type group")
+				return
+			}
+		}
+	}, declIndexes)
+	return err
+}
+
+func visitDataRefs(t types.Type, visit func(name string, params []types.Type), declIndexes map[string]int) {
+	switch t := types.RealType(t).(type) {
+	case *types.Const:
+		if _, ok := declIndexes[t.Name]; ok {
+			visit(t.Name, nil)
+		}
+	case *types.App:
+		if c, ok := types.RealType(t.Const).(*types.Const); ok {
+			if _, ok := declIndexes[c.Name]; ok {
+				visit(c.Name, t.Params)
+			}
+		}
+		for _, param := range t.Params {
+			visitDataRefs(param, visit, declIndexes)
+		}
+	case *types.Arrow:
+		for _, arg := range t.Args {
+			visitDataRefs(arg, visit, declIndexes)
+		}
+		visitDataRefs(t.Return, visit, declIndexes)
+	case *types.Record:
+		visitDataRefs(t.Row, visit, declIndexes)
+	case *types.Variant:
+		visitDataRefs(t.Row, visit, declIndexes)
+	case *types.RowExtend:
+		t.Labels.Range(func(label string, ts types.TypeList) bool {
+			ts.Range(func(i int, t types.Type) bool {
+				visitDataRefs(t, visit, declIndexes)
+				return true
+			})
+			return true
+		})
+		visitDataRefs(t.Row, visit, declIndexes)
+	}
+}
+
+// Substitution of type-parameters and data type references within the fields of data constructors.
+type dataSubst struct {
+	decls        []DataTypeDecl
+	declIndexes  map[string]int
+	paramIndexes map[uint]int
+	rec          *types.Recursive
+}
+
+func (s *dataSubst) fields(c DataConstructor) []types.Type {
+	fields := make([]types.Type, len(c.Fields))
+	for i, field := range c.Fields {
+		fields[i] = s.subst(field)
+	}
+	return fields
+}
+
+func (s *dataSubst) subst(t types.Type) types.Type {
+	switch t := types.RealType(t).(type) {
+	case *types.Var:
+		if index, ok := s.paramIndexes[t.Id()]; ok {
+			return s.rec.Params[index]
+		}
+		return t
+	case *types.Const:
+		if index, ok := s.declIndexes[t.Name]; ok {
+			return &types.RecursiveLink{Recursive: s.rec, Index: index}
+		}
+		return t
+	case *types.App:
+		if c, ok := types.RealType(t.Const).(*types.Const); ok {
+			if index, ok := s.declIndexes[c.Name]; ok {
+				return &types.RecursiveLink{Recursive: s.rec, Index: index}
+			}
+		}
+		params := make([]types.Type, len(t.Params))
+		for i, param := range t.Params {
+			params[i] = s.subst(param)
+		}
+		var underlying types.Type
+		if t.Underlying != nil {
+			underlying = s.subst(t.Underlying)
+		}
+		return &types.App{Const: s.subst(t.Const), Params: params, Underlying: underlying}
+	case *types.Arrow:
+		args := make([]types.Type, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = s.subst(arg)
+		}
+		var effects types.Type
+		if t.Effects != nil {
+			effects = s.subst(t.Effects)
+		}
+		return &types.Arrow{Args: args, Return: s.subst(t.Return), Effects: effects}
+	case *types.SizeExpr:
+		args := make([]types.Type, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = s.subst(arg)
+		}
+		return &types.SizeExpr{Op: t.Op, Args: args}
+	case *types.Measure:
+		factors := make([]types.MeasureFactor, len(t.Factors))
+		for i, f := range t.Factors {
+			factors[i] = types.MeasureFactor{Unit: s.subst(f.Unit), Exponent: f.Exponent}
+		}
+		return &types.Measure{Factors: factors}
+	case *types.Existential:
+		return &types.Existential{Vars: t.Vars, Body: s.subst(t.Body), Flags: t.Flags}
+	case *types.Record:
+		return &types.Record{Row: s.subst(t.Row)}
+	case *types.Variant:
+		return &types.Variant{Row: s.subst(t.Row)}
+	case *types.RowExtend:
+		mb := t.Labels.Builder()
+		t.Labels.Range(func(label string, ts types.TypeList) bool {
+			lb := ts.Builder()
+			ts.Range(func(i int, t types.Type) bool {
+				lb.Set(i, s.subst(t))
+				return true
+			})
+			mb.Set(label, lb.Build())
+			return true
+		})
+		return &types.RowExtend{Labels: mb.Build(), Row: s.subst(t.Row)}
+	default:
+		return t
+	}
+}
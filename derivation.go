@@ -0,0 +1,458 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/types"
+)
+
+// TypingDerivation is a node within the typing derivation tree for an expression. Each node records the typing rule applied
+// to an expression, the type-environment entries consulted, the constraints generated, and the resulting type. Premises are
+// the derivations for sub-expressions, in the order they were inferred.
+//
+// Types within a derivation are printed with the substitution found by the completed inference. Constraints are printed when
+// they are generated.
+type TypingDerivation struct {
+	// Rule is the typing rule applied to the expression:
+	//
+	//   * "Lit" for literals
+	//   * "Var/Inst" for variables, which are instantiated from the type-environment
+	//   * "App" for function calls
+	//   * "Abs" for function abstractions
+	//   * "Let/Gen" for let-bindings, which are generalized
+	//   * "LetRec/Gen" for grouped (mutually-recursive) let-bindings, which are generalized
+	//   * "Record-select", "Record-extend", "Record-restrict" and "Record-empty" for record operations
+	//   * "Variant" and "Match" for variant construction and matching
+	//   * "Deref" and "Assign" for reference dereferencing and assignment
+	//   * "Pipe/Gen", "Control-flow", "Pack" and "Unpack" for pipes, control-flow, and existential types
+	Rule  string
+	Expr  ast.Expr
+	Level uint
+	// Env lists the type-environment entries consulted for the expression.
+	Env []EnvEntry
+	// Constraints lists the constraints generated for the expression, in order.
+	Constraints []TypingConstraint
+	// Generalized lists the types generalized for bindings (or the root expression), in order.
+	Generalized []types.Type
+	// Type is the type inferred for the expression, or nil.
+	Type types.Type
+	// Err is the error which caused inference to fail for the expression, or nil.
+	Err      error
+	Premises []*TypingDerivation
+}
+
+// EnvEntry is a variable and its type within a type-environment.
+type EnvEntry struct {
+	Name string
+	Type types.Type
+}
+
+// TypingConstraint is a constraint generated during inference.
+type TypingConstraint struct {
+	// Kind is "unify" for unification of two types, "instance" when an instance of a type-class is selected for a type,
+	// or "defer" when instance matching is deferred until after inference.
+	Kind string
+	// Text is the constraint printed when it was generated, such as `'a ~ int` or `Show int`.
+	Text string
+	// Instance is the selected instance for "instance" constraints, or nil.
+	Instance *types.Instance
+	// Err is the reason unification failed for "unify" constraints, or nil.
+	Err error
+}
+
+// Typing derivations may be constructed during inference, for teaching or for auditing inferred types. Derivations are
+// constructed by observing inference (see SetObserver); grouped let-bindings are inferred sequentially while derivations
+// are enabled.
+//
+// By default, typing derivations are not constructed.
+func (ti *InferenceContext) EnableDerivations(enabled bool) { ti.derive = enabled }
+
+// Get the typing derivation tree for the root expression of the most recent inference, or nil if derivations are not enabled.
+// The derivation is constructed even if inference fails.
+func (ti *InferenceContext) Derivation() *TypingDerivation { return ti.derivation }
+
+func typingRule(e ast.Expr) string {
+	switch e.(type) {
+	case *ast.Literal:
+		return "Lit"
+	case *ast.Var:
+		return "Var/Inst"
+	case *ast.Call:
+		return "App"
+	case *ast.Func:
+		return "Abs"
+	case *ast.Let:
+		return "Let/Gen"
+	case *ast.LetGroup:
+		return "LetRec/Gen"
+	case *ast.RecordSelect:
+		return "Record-select"
+	case *ast.RecordExtend:
+		return "Record-extend"
+	case *ast.RecordRestrict:
+		return "Record-restrict"
+	case *ast.RecordEmpty:
+		return "Record-empty"
+	case *ast.Variant:
+		return "Variant"
+	case *ast.Match:
+		return "Match"
+	case *ast.Deref:
+		return "Deref"
+	case *ast.DerefAssign:
+		return "Assign"
+	case *ast.Pipe:
+		return "Pipe/Gen"
+	case *ast.ControlFlow:
+		return "Control-flow"
+	case *ast.Pack:
+		return "Pack"
+	case *ast.Unpack:
+		return "Unpack"
+	}
+	return e.ExprName()
+}
+
+// derivationBuilder constructs a typing derivation tree from inference events.
+type derivationBuilder struct {
+	root     *TypingDerivation
+	stack    []*TypingDerivation
+	unifying int // index of the pending unification constraint for the current derivation
+}
+
+func (b *derivationBuilder) current() *TypingDerivation {
+	if len(b.stack) != 0 {
+		return b.stack[len(b.stack)-1]
+	}
+	// events after the root expression is inferred (generalization and deferred constraints) belong to the root:
+	return b.root
+}
+
+func (b *derivationBuilder) EnterExpr(e ast.Expr, level uint) {
+	d := &TypingDerivation{Rule: typingRule(e), Expr: e, Level: level}
+	if parent := b.current(); parent != nil {
+		parent.Premises = append(parent.Premises, d)
+	} else {
+		b.root = d
+	}
+	b.stack = append(b.stack, d)
+}
+
+func (b *derivationBuilder) LeaveExpr(e ast.Expr, t types.Type, err error) {
+	d := b.stack[len(b.stack)-1]
+	d.Type, d.Err = t, err
+	b.stack = b.stack[:len(b.stack)-1]
+}
+
+func (b *derivationBuilder) Lookup(name string, t types.Type) {
+	if d := b.current(); d != nil {
+		d.Env = append(d.Env, EnvEntry{Name: name, Type: t})
+	}
+}
+
+func (b *derivationBuilder) EnterUnify(x, y types.Type) {
+	if d := b.current(); d != nil {
+		b.unifying = len(d.Constraints)
+		d.Constraints = append(d.Constraints, TypingConstraint{Kind: "unify", Text: types.TypeString(x) + " ~ " + types.TypeString(y)})
+	}
+}
+
+func (b *derivationBuilder) LeaveUnify(x, y types.Type, err error) {
+	if d := b.current(); d != nil && err != nil {
+		d.Constraints[b.unifying].Err = err
+	}
+}
+
+func (b *derivationBuilder) Instantiate(level uint, generic, instance types.Type) {}
+
+func (b *derivationBuilder) Generalize(level uint, t types.Type) {
+	if d := b.current(); d != nil {
+		d.Generalized = append(d.Generalized, t)
+	}
+}
+
+func (b *derivationBuilder) SelectInstance(tc *types.TypeClass, t types.Type, inst *types.Instance) {
+	if d := b.current(); d != nil {
+		d.Constraints = append(d.Constraints, TypingConstraint{Kind: "instance", Text: tc.Name + " " + types.TypeString(t), Instance: inst})
+	}
+}
+
+func (b *derivationBuilder) DeferConstraint(tc *types.TypeClass, t types.Type, e ast.Expr) {
+	if d := b.current(); d != nil {
+		d.Constraints = append(d.Constraints, TypingConstraint{Kind: "defer", Text: tc.Name + " " + types.TypeString(t)})
+	}
+}
+
+// teeObserver forwards inference events to two observers.
+type teeObserver struct{ a, b InferenceObserver }
+
+func (o teeObserver) EnterExpr(e ast.Expr, level uint) {
+	o.a.EnterExpr(e, level)
+	o.b.EnterExpr(e, level)
+}
+
+func (o teeObserver) LeaveExpr(e ast.Expr, t types.Type, err error) {
+	o.a.LeaveExpr(e, t, err)
+	o.b.LeaveExpr(e, t, err)
+}
+
+func (o teeObserver) Lookup(name string, t types.Type) {
+	o.a.Lookup(name, t)
+	o.b.Lookup(name, t)
+}
+
+func (o teeObserver) EnterUnify(x, y types.Type) {
+	o.a.EnterUnify(x, y)
+	o.b.EnterUnify(x, y)
+}
+
+func (o teeObserver) LeaveUnify(x, y types.Type, err error) {
+	o.a.LeaveUnify(x, y, err)
+	o.b.LeaveUnify(x, y, err)
+}
+
+func (o teeObserver) Instantiate(level uint, generic, instance types.Type) {
+	o.a.Instantiate(level, generic, instance)
+	o.b.Instantiate(level, generic, instance)
+}
+
+func (o teeObserver) Generalize(level uint, t types.Type) {
+	o.a.Generalize(level, t)
+	o.b.Generalize(level, t)
+}
+
+func (o teeObserver) SelectInstance(tc *types.TypeClass, t types.Type, inst *types.Instance) {
+	o.a.SelectInstance(tc, t, inst)
+	o.b.SelectInstance(tc, t, inst)
+}
+
+func (o teeObserver) DeferConstraint(tc *types.TypeClass, t types.Type, e ast.Expr) {
+	o.a.DeferConstraint(tc, t, e)
+	o.b.DeferConstraint(tc, t, e)
+}
+
+// JSON representation of a typing derivation
+type derivationJSON struct {
+	Rule        string            `json:"rule"`
+	Expr        string            `json:"expr"`
+	Level       uint              `json:"level"`
+	Env         []envEntryJSON    `json:"env,omitempty"`
+	Constraints []constraintJSON  `json:"constraints,omitempty"`
+	Generalized []string          `json:"generalized,omitempty"`
+	Type        string            `json:"type,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	Premises    []*derivationJSON `json:"premises,omitempty"`
+}
+
+type envEntryJSON struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type constraintJSON struct {
+	Kind     string `json:"kind"`
+	Text     string `json:"text"`
+	Instance string `json:"instance,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Encode the derivation tree as JSON. Each node is an object with "rule", "expr", "level", "env", "constraints",
+// "generalized", "type", "error" and "premises" fields; types and expressions are printed as strings.
+func (d *TypingDerivation) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(d.toJSON()); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+func (d *TypingDerivation) toJSON() *derivationJSON {
+	out := &derivationJSON{Rule: d.Rule, Expr: ast.ExprString(d.Expr), Level: d.Level, Type: typeString(d.Type), Error: errorString(d.Err)}
+	for _, entry := range d.Env {
+		out.Env = append(out.Env, envEntryJSON{Name: entry.Name, Type: types.TypeString(entry.Type)})
+	}
+	for _, c := range d.Constraints {
+		cj := constraintJSON{Kind: c.Kind, Text: c.Text, Error: errorString(c.Err)}
+		if c.Instance != nil {
+			cj.Instance = c.Instance.TypeClass.Name + " " + types.TypeString(c.Instance.Param)
+		}
+		out.Constraints = append(out.Constraints, cj)
+	}
+	for _, t := range d.Generalized {
+		out.Generalized = append(out.Generalized, types.TypeString(t))
+	}
+	for _, p := range d.Premises {
+		out.Premises = append(out.Premises, p.toJSON())
+	}
+	return out
+}
+
+// Print the derivation tree as a LaTeX proof tree, using the `\infer` command from the proof package (`\usepackage{proof}`).
+// The proof tree must be placed within math mode. Consulted environment entries, constraints and generalized types are
+// printed as premises, along with the derivations for sub-expressions.
+func (d *TypingDerivation) LaTeX() string {
+	var sb strings.Builder
+	d.latex(&sb, 0)
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
+func (d *TypingDerivation) latex(sb *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+	sb.WriteString(indent)
+	sb.WriteString(`\infer[\textsc{`)
+	sb.WriteString(latexEscape(d.Rule))
+	sb.WriteString(`}]{\Gamma \vdash \texttt{`)
+	sb.WriteString(latexEscape(ast.ExprString(d.Expr)))
+	sb.WriteString(`} : `)
+	if d.Err != nil {
+		sb.WriteString(`\text{error: `)
+		sb.WriteString(latexEscape(d.Err.Error()))
+		sb.WriteString(`}`)
+	} else {
+		sb.WriteString(`\texttt{`)
+		sb.WriteString(latexEscape(typeString(d.Type)))
+		sb.WriteString(`}`)
+	}
+	sb.WriteString("}{")
+	premises := 0
+	premise := func(leaf bool) {
+		if premises > 0 {
+			sb.WriteString(" &")
+		}
+		sb.WriteByte('\n')
+		if leaf {
+			sb.WriteString(indent)
+			sb.WriteString("  ")
+		}
+		premises++
+	}
+	for _, entry := range d.Env {
+		premise(true)
+		sb.WriteString(`\texttt{`)
+		sb.WriteString(latexEscape(entry.Name + " : " + types.TypeString(entry.Type)))
+		sb.WriteString(`} \in \Gamma`)
+	}
+	for _, p := range d.Premises {
+		premise(false)
+		p.latex(sb, depth+1)
+	}
+	for _, c := range d.Constraints {
+		premise(true)
+		sb.WriteString(`\texttt{`)
+		sb.WriteString(latexEscape(c.Text))
+		sb.WriteString(`}`)
+		switch {
+		case c.Kind == "defer":
+			sb.WriteString(` \text{ (deferred)}`)
+		case c.Err != nil:
+			sb.WriteString(` \text{ (failed)}`)
+		}
+	}
+	for _, t := range d.Generalized {
+		premise(true)
+		sb.WriteString(`\mathrm{gen}(\texttt{`)
+		sb.WriteString(latexEscape(types.TypeString(t)))
+		sb.WriteString(`})`)
+	}
+	if premises > 0 {
+		sb.WriteByte('\n')
+		sb.WriteString(indent)
+	}
+	sb.WriteString("}")
+}
+
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`, `{`, `\{`, `}`, `\}`, `$`, `\$`, `&`, `\&`, `#`, `\#`,
+	`^`, `\textasciicircum{}`, `_`, `\_`, `%`, `\%`, `~`, `\textasciitilde{}`,
+)
+
+func latexEscape(s string) string { return latexEscaper.Replace(s) }
+
+// Print the derivation tree as a nested Markdown list. Each item names the typing rule applied to an expression and the
+// resulting type, followed by the consulted environment entries, the derivations for sub-expressions, the generated
+// constraints and the generalized types.
+func (d *TypingDerivation) Markdown() string {
+	var sb strings.Builder
+	d.markdown(&sb, 0)
+	return sb.String()
+}
+
+func (d *TypingDerivation) markdown(sb *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+	sb.WriteString(indent)
+	sb.WriteString("- **")
+	sb.WriteString(d.Rule)
+	sb.WriteString("** ")
+	sb.WriteString(markdownCode(ast.ExprString(d.Expr)))
+	if d.Err != nil {
+		sb.WriteString(" failed: ")
+		sb.WriteString(d.Err.Error())
+	} else {
+		sb.WriteString(" : ")
+		sb.WriteString(markdownCode(typeString(d.Type)))
+	}
+	sb.WriteByte('\n')
+	for _, entry := range d.Env {
+		sb.WriteString(indent)
+		sb.WriteString("  - env: ")
+		sb.WriteString(markdownCode(entry.Name + " : " + types.TypeString(entry.Type)))
+		sb.WriteByte('\n')
+	}
+	for _, p := range d.Premises {
+		p.markdown(sb, depth+1)
+	}
+	for _, c := range d.Constraints {
+		sb.WriteString(indent)
+		sb.WriteString("  - ")
+		sb.WriteString(c.Kind)
+		sb.WriteString(": ")
+		sb.WriteString(markdownCode(c.Text))
+		if c.Err != nil {
+			sb.WriteString(" failed: ")
+			sb.WriteString(c.Err.Error())
+		}
+		sb.WriteByte('\n')
+	}
+	for _, t := range d.Generalized {
+		sb.WriteString(indent)
+		sb.WriteString("  - generalize: ")
+		sb.WriteString(markdownCode(types.TypeString(t)))
+		sb.WriteByte('\n')
+	}
+}
+
+// Wrap s within a code span, using a longer delimiter if s contains backticks.
+func markdownCode(s string) string {
+	if strings.IndexByte(s, '`') < 0 {
+		return "`" + s + "`"
+	}
+	return "`` " + s + " ``"
+}
@@ -0,0 +1,405 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"errors"
+
+	"github.com/wdamron/poly/types"
+)
+
+// Deriver synthesizes method implementations for a derived type-class instance.
+//
+// A deriver should return a mapping from method names to names of their implementations within the type-environment.
+// Implementations which are not declared within the type-environment will be declared with the specialized method
+// types of the derivation.
+type Deriver func(d *Derivation) (methodNames map[string]string, err error)
+
+// Derivation describes the structure of a type for which a type-class instance is being derived.
+type Derivation struct {
+	TypeClass *types.TypeClass
+	// Type is the generalized instance type. Instance constraints will be added to type-parameters which
+	// require them (the constrained context of the instance).
+	Type types.Type
+	// Variant is true if the structure of Type is a variant-type, or false if it is a record type.
+	Variant bool
+	// Fields are the labeled fields of the record or variant structure, sorted by label.
+	Fields []DerivedField
+	// Methods maps the names of all methods for the type-class and its super-classes to function-types
+	// specialized for the instance type.
+	Methods types.MethodSet
+}
+
+// DerivedField is a labeled field within the structure of a derived instance type.
+type DerivedField struct {
+	Label string
+	Type  types.Type
+	// Recursive is true if the field refers back to the type being derived or another type within its recursive
+	// type-group.
+	Recursive bool
+}
+
+// Register a structural deriver for a type-class within the type environment.
+func (e *TypeEnv) RegisterDeriver(tc *types.TypeClass, deriver Deriver) {
+	e.checkMutable()
+	if e.derivers == nil {
+		e.derivers = make(map[*types.TypeClass]Deriver)
+	}
+	e.derivers[tc] = deriver
+}
+
+// Lookup a registered deriver for a type-class in the environment or its parent environment(s).
+func (e *TypeEnv) LookupDeriver(tc *types.TypeClass) Deriver {
+	if d, ok := e.derivers[tc]; ok {
+		return d
+	}
+	if e.Parent == nil {
+		return nil
+	}
+	return e.Parent.LookupDeriver(tc)
+}
+
+// Derive an instance of a type-class for a record type, variant type, or aliased type with an underlying record or
+// variant type (including types within recursive type-groups).
+//
+// The fields of the type will be walked to synthesize the constrained context for the instance: type-parameters
+// used within fields will be constrained to the type-class, nested record and variant types will be walked, and all
+// other fields must have matching instances. Fields which refer back to the derived type are assumed to satisfy the
+// type-class, and the structures of other types within its recursive type-group are walked in place. The deriver registered for the
+// type-class will be called to name the method implementations, and the instance will be declared with DeclareInstance.
+//
+// The type-class which the instance implements will be modified to add an instance entry. Within child environments of a frozen
+// type-environment, the instance entry is added to an overlay which is only visible within the child environment, and the
+// type-class will not be modified.
+func (e *TypeEnv) DeriveInstance(tc *types.TypeClass, t types.Type) (*types.Instance, error) {
+	if e.frozen {
+		return nil, errFrozen
+	}
+	deriver := e.LookupDeriver(tc)
+	if deriver == nil {
+		return nil, errors.New("No deriver is registered for type-class " + tc.Name)
+	}
+	d, err := e.derive(tc, t)
+	e.common.VarTracker.FlattenLinks()
+	e.common.VarTracker.Reset()
+	if err != nil {
+		return nil, err
+	}
+	methodNames, err := deriver(d)
+	if err != nil {
+		return nil, err
+	}
+	var declared []string
+	for name := range methodNames {
+		if _, ok := d.Methods[name]; !ok {
+			return nil, errors.New("Derived method " + name + " is not a method of type-class " + tc.Name)
+		}
+	}
+	for name, implName := range methodNames {
+		if e.Lookup(implName) == nil {
+			e.Declare(implName, d.Methods[name])
+			declared = append(declared, implName)
+		}
+	}
+	inst, err := e.DeclareInstance(tc, d.Type, methodNames)
+	if err != nil {
+		// Implementations are only declared for the instance if it is declared successfully:
+		for _, implName := range declared {
+			e.Remove(implName)
+		}
+		return nil, err
+	}
+	return inst, nil
+}
+
+func (e *TypeEnv) derive(tc *types.TypeClass, t types.Type) (*Derivation, error) {
+	t = types.RealType(t)
+	group, index := recursiveGroup(t)
+	if link, ok := t.(*types.RecursiveLink); ok {
+		t = link.Link()
+	}
+	switch t.(type) {
+	case *types.App, *types.Record, *types.Variant:
+		// ok
+	default:
+		return nil, errors.New("Cannot derive type-class " + tc.Name + " for type " + types.TypeString(t))
+	}
+	param := e.common.Instantiate(types.TopLevel+1, t)
+	d := &Derivation{TypeClass: tc}
+	// The declared structure is walked alongside the instantiated structure. Links within the declared structure to
+	// types within the recursive type-group of the derived type are assumed to satisfy the type-class, and the structures
+	// of other types within the group are walked once:
+	visited := map[int]bool{index: true}
+	isGroupLink := func(declared types.Type) (*types.RecursiveLink, bool) {
+		link, ok := types.RealType(declared).(*types.RecursiveLink)
+		return link, ok && group != nil && link.Recursive == group
+	}
+	fieldErr := func(label string, ft types.Type, err error) error {
+		return errors.New("Cannot derive type-class " + tc.Name + " for field " + label + " of type " + types.TypeString(ft) + ": " + err.Error())
+	}
+	var walk func(label string, declared, ft types.Type, variant bool) error
+	walkStructure := func(declared, t types.Type, visit func(label string, declared, ft types.Type, variant bool) error) error {
+		declaredLabels, variant, err := structureLabels(declared)
+		if err != nil {
+			return err
+		}
+		labels, _, err := structureLabels(t)
+		if err != nil {
+			return err
+		}
+		declaredLabels.Range(func(label string, declaredTypes types.TypeList) bool {
+			ts, _ := labels.Get(label)
+			declaredTypes.Range(func(i int, declared types.Type) bool {
+				err = visit(label, declared, ts.Get(i), variant)
+				return err == nil
+			})
+			return err == nil
+		})
+		return err
+	}
+	walk = func(label string, declared, ft types.Type, variant bool) error {
+		if link, ok := isGroupLink(declared); ok {
+			if visited[link.Index] {
+				return nil
+			}
+			visited[link.Index] = true
+			instantiated, ok := types.RealType(ft).(*types.RecursiveLink)
+			if !ok {
+				return fieldErr(label, ft, errors.New("type is not a link within a recursive type-group"))
+			}
+			if err := walkStructure(link.Link(), instantiated.Link(), walk); err != nil {
+				return fieldErr(label, ft, err)
+			}
+			return nil
+		}
+		switch types.RealType(ft).(type) {
+		case *types.Unit:
+			// Variant cases without values do not require instances:
+			if variant {
+				return nil
+			}
+		case *types.Record, *types.Variant:
+			// Nested record and variant types are walked structurally:
+			if err := walkStructure(declared, ft, walk); err != nil {
+				return fieldErr(label, ft, err)
+			}
+			return nil
+		}
+		// Constrain type-parameters or find matching instances for the field type:
+		tv := e.common.VarTracker.New(types.TopLevel + 1)
+		tv.AddConstraint(types.InstanceConstraint{TypeClass: tc})
+		if err := e.common.Unify(tv, ft); err != nil {
+			return fieldErr(label, ft, err)
+		}
+		return nil
+	}
+	_, variant, err := structureLabels(t)
+	if err != nil {
+		return nil, errors.New("Cannot derive type-class " + tc.Name + " for type " + types.TypeString(t) + ": " + err.Error())
+	}
+	d.Variant = variant
+	err = walkStructure(t, param, func(label string, declared, ft types.Type, variant bool) error {
+		_, recursive := isGroupLink(declared)
+		d.Fields = append(d.Fields, DerivedField{Label: label, Type: ft, Recursive: recursive})
+		return walk(label, declared, ft, variant)
+	})
+	if err != nil {
+		if len(d.Fields) == 0 {
+			return nil, errors.New("Cannot derive type-class " + tc.Name + " for type " + types.TypeString(t) + ": " + err.Error())
+		}
+		return nil, err
+	}
+	// Instantiated recursive type-groups must be re-generalized with the constrained type-parameters:
+	markRecursiveGroups(param, make(map[*types.Recursive]bool))
+	d.Type = GeneralizeRefs(param)
+	for i := range d.Fields {
+		d.Fields[i].Type = types.RealType(d.Fields[i].Type)
+	}
+	d.Methods = make(types.MethodSet)
+	seen := make(map[uint]bool)
+	var specialize func(tc *types.TypeClass)
+	specialize = func(tc *types.TypeClass) {
+		if seen[tc.Id] {
+			return
+		}
+		seen[tc.Id] = true
+		tv, isVar := tc.Param.(*types.Var)
+		for name, method := range tc.Methods {
+			if isVar {
+				method = e.common.InstantiateWith(types.TopLevel+1, method, tv.Id(), d.Type).(*types.Arrow)
+			}
+			d.Methods[name] = GeneralizeRefs(method).(*types.Arrow)
+		}
+		for _, super := range tc.SuperClasses() {
+			specialize(super)
+		}
+	}
+	specialize(tc)
+	return d, nil
+}
+
+// Get the labels of the record or variant structure of a type, or of the underlying type of an aliased type.
+func structureLabels(t types.Type) (labels types.TypeMap, variant bool, err error) {
+	structure := types.RealType(t)
+	if app, ok := structure.(*types.App); ok {
+		structure = types.RealType(app.Underlying)
+		if link, ok := structure.(*types.RecursiveLink); ok {
+			structure = types.RealType(link.Link().(*types.App).Underlying)
+		}
+	}
+	var row types.Type
+	switch structure := structure.(type) {
+	case *types.Record:
+		row = structure.Row
+	case *types.Variant:
+		row, variant = structure.Row, true
+	default:
+		return labels, false, errors.New("type has no record or variant structure")
+	}
+	labels, rest, err := types.FlattenRowType(row)
+	if err != nil {
+		return labels, variant, err
+	}
+	if _, ok := rest.(*types.RowEmpty); !ok {
+		return labels, variant, errors.New("type has an open row")
+	}
+	return labels, variant, nil
+}
+
+// Get the name of the type constant at the head of a type or type application, if any.
+func headName(t types.Type) string {
+	t = types.RealType(t)
+	if link, ok := t.(*types.RecursiveLink); ok {
+		t = link.Link()
+	}
+	switch t := t.(type) {
+	case *types.Const:
+		return t.Name
+	case *types.App:
+		if c, ok := types.RealType(t.Const).(*types.Const); ok {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// Get the recursive type-group and index of a link or aliased type within a recursive type-group, if any.
+func recursiveGroup(t types.Type) (*types.Recursive, int) {
+	switch t := types.RealType(t).(type) {
+	case *types.RecursiveLink:
+		return t.Recursive, t.Index
+	case *types.App:
+		if t.Underlying == nil {
+			return nil, 0
+		}
+		return findGroup(t, t.Underlying, make(map[types.Type]bool))
+	}
+	return nil, 0
+}
+
+// Find a link within t to a recursive type-group which contains app.
+func findGroup(app *types.App, t types.Type, seen map[types.Type]bool) (group *types.Recursive, index int) {
+	t = types.RealType(t)
+	if seen[t] {
+		return nil, 0
+	}
+	seen[t] = true
+	switch t := t.(type) {
+	case *types.RecursiveLink:
+		for i, member := range t.Recursive.Types {
+			if member == app {
+				return t.Recursive, i
+			}
+		}
+	case *types.App:
+		for _, param := range t.Params {
+			if group, index = findGroup(app, param, seen); group != nil {
+				return
+			}
+		}
+	case *types.Arrow:
+		for _, arg := range t.Args {
+			if group, index = findGroup(app, arg, seen); group != nil {
+				return
+			}
+		}
+		return findGroup(app, t.Return, seen)
+	case *types.Record:
+		return findGroup(app, t.Row, seen)
+	case *types.Variant:
+		return findGroup(app, t.Row, seen)
+	case *types.RowExtend:
+		t.Labels.Range(func(label string, ts types.TypeList) bool {
+			ts.Range(func(i int, t types.Type) bool {
+				group, index = findGroup(app, t, seen)
+				return group == nil
+			})
+			return group == nil
+		})
+		if group == nil {
+			return findGroup(app, t.Row, seen)
+		}
+	}
+	return
+}
+
+// Flag all recursive type-groups reachable from t for generalization.
+func markRecursiveGroups(t types.Type, seen map[*types.Recursive]bool) {
+	switch t := types.RealType(t).(type) {
+	case *types.RecursiveLink:
+		if seen[t.Recursive] {
+			return
+		}
+		seen[t.Recursive] = true
+		t.Recursive.Flags |= types.NeedsGeneralization
+		for _, alias := range t.Recursive.Types {
+			markRecursiveGroups(alias, seen)
+		}
+	case *types.App:
+		markRecursiveGroups(t.Const, seen)
+		for _, param := range t.Params {
+			markRecursiveGroups(param, seen)
+		}
+		if t.Underlying != nil {
+			markRecursiveGroups(t.Underlying, seen)
+		}
+	case *types.Arrow:
+		for _, arg := range t.Args {
+			markRecursiveGroups(arg, seen)
+		}
+		markRecursiveGroups(t.Return, seen)
+	case *types.Record:
+		markRecursiveGroups(t.Row, seen)
+	case *types.Variant:
+		markRecursiveGroups(t.Row, seen)
+	case *types.RowExtend:
+		t.Labels.Range(func(label string, ts types.TypeList) bool {
+			ts.Range(func(i int, t types.Type) bool {
+				markRecursiveGroups(t, seen)
+				return true
+			})
+			return true
+		})
+		markRecursiveGroups(t.Row, seen)
+	}
+}
@@ -0,0 +1,189 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/wdamron/poly/types"
+)
+
+// InstanceResolution is a trace of instance resolution for a type-class constraint and a candidate type.
+//
+// Instances are visited in the same order as during inference: instances of sub-classes are visited before instances
+// of their super-classes, and the search stops when overlapping instances are found. All instances are visited,
+// including instances which the instance index filters out during inference.
+type InstanceResolution struct {
+	TypeClass *types.TypeClass
+	// Type is the candidate type, instantiated for resolution.
+	Type types.Type
+	// Classes lists the (sub-)classes of TypeClass in the order their instances were visited.
+	Classes []*types.TypeClass
+	// Candidates lists all instances visited during resolution, in order.
+	Candidates []InstanceCandidate
+	// Selected is the matching instance, if exactly one instance (or one chain of sub-class instances) matched.
+	Selected *types.Instance
+	// Propagated is true if the candidate type is a type-variable; the constraint would be propagated to the type-variable.
+	Propagated bool
+	// Overlapping is true if multiple unrelated instances matched. The match may be deferred when deferred instance-matching is enabled.
+	Overlapping bool
+	// Err is the error which would be reported during inference, or nil.
+	Err error
+}
+
+// InstanceCandidate is an instance visited during instance resolution.
+type InstanceCandidate struct {
+	Instance *types.Instance
+	// Visible is false if the instance is not visible within the type-environment; invisible instances are not unified.
+	Visible bool
+	// Unified is true if the instance type unified with the candidate type.
+	Unified bool
+	// UnifyErr is the reason the instance type did not unify with the candidate type.
+	UnifyErr error
+	// OverlapsWith is the previously matched instance which this instance overlaps with (the previously matched instance's
+	// type-class is not a sub-class of this instance's type-class), or nil.
+	OverlapsWith *types.Instance
+}
+
+// Explain the resolution of an instance of the type-class for t within the type environment. The resolution mirrors
+// instance matching during inference, without modifying the type-class. Type-variables within t will be generalized.
+func (e *TypeEnv) ExplainInstance(tc *types.TypeClass, t types.Type) *InstanceResolution {
+	if e.frozen {
+		return NewTypeEnv(e).ExplainInstance(tc, t)
+	}
+	const level = types.TopLevel + 1
+	res := &InstanceResolution{TypeClass: tc, Type: e.common.Instantiate(level, GeneralizeRefs(t))}
+	defer func() {
+		e.common.VarTracker.FlattenLinks()
+		e.common.VarTracker.Reset()
+	}()
+	if _, ok := res.Type.(*types.Var); ok {
+		res.Propagated = true
+		return res
+	}
+	var firstMatch, lastMatch *types.Instance
+	var lastClass *types.TypeClass
+	e.classOverlays().FindInstance(tc, func(inst *types.Instance) (done bool) {
+		if inst.TypeClass != lastClass {
+			lastClass = inst.TypeClass
+			res.Classes = append(res.Classes, lastClass)
+		}
+		c := InstanceCandidate{Instance: inst, Visible: e.InstanceVisible(inst)}
+		if c.Visible {
+			c.UnifyErr = e.common.CheckUnify(res.Type, e.common.Instantiate(level, inst.Param))
+			c.Unified = c.UnifyErr == nil
+		}
+		if c.Unified {
+			// Sub-classes are visited first:
+			if lastMatch != nil && !lastMatch.TypeClass.HasSuperClass(inst.TypeClass) {
+				c.OverlapsWith, res.Overlapping = lastMatch, true
+			}
+			if firstMatch == nil {
+				firstMatch = inst
+			}
+			lastMatch = inst
+		}
+		res.Candidates = append(res.Candidates, c)
+		return res.Overlapping
+	})
+	switch {
+	case firstMatch == nil:
+		res.Err = errors.New("No matching instance found for type-class " + tc.Name)
+	case res.Overlapping:
+		res.Err = errors.New("Instance cannot be determined from the context for type-class " + tc.Name)
+	default:
+		res.Selected = firstMatch
+	}
+	return res
+}
+
+func (res *InstanceResolution) String() string {
+	var sb strings.Builder
+	sb.WriteString("Resolving type-class ")
+	sb.WriteString(res.TypeClass.Name)
+	sb.WriteString(" for ")
+	sb.WriteString(types.TypeString(res.Type))
+	sb.WriteString(":\n")
+	if res.Propagated {
+		sb.WriteString("  constraint is propagated to the type-variable\n")
+		return sb.String()
+	}
+	if len(res.Classes) != 0 {
+		sb.WriteString("  visited type-classes: ")
+		for i, tc := range res.Classes {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(tc.Name)
+		}
+		sb.WriteByte('\n')
+	}
+	for i, c := range res.Candidates {
+		sb.WriteString("  ")
+		sb.WriteString(strconv.Itoa(i + 1))
+		sb.WriteString(". ")
+		sb.WriteString(c.Instance.TypeClass.Name)
+		sb.WriteString(" instance ")
+		sb.WriteString(types.TypeString(c.Instance.Param))
+		switch {
+		case !c.Visible:
+			sb.WriteString(": not visible")
+		case !c.Unified:
+			sb.WriteString(": not unified (")
+			sb.WriteString(c.UnifyErr.Error())
+			sb.WriteByte(')')
+		default:
+			sb.WriteString(": unified")
+		}
+		if c.OverlapsWith != nil {
+			sb.WriteString(", overlaps with ")
+			sb.WriteString(c.OverlapsWith.TypeClass.Name)
+			sb.WriteString(" instance ")
+			sb.WriteString(types.TypeString(c.OverlapsWith.Param))
+			sb.WriteString(" (")
+			sb.WriteString(c.Instance.TypeClass.Name)
+			sb.WriteString(" is not a super-class of ")
+			sb.WriteString(c.OverlapsWith.TypeClass.Name)
+			sb.WriteByte(')')
+		}
+		sb.WriteByte('\n')
+	}
+	switch {
+	case res.Selected != nil:
+		sb.WriteString("  selected ")
+		sb.WriteString(res.Selected.TypeClass.Name)
+		sb.WriteString(" instance ")
+		sb.WriteString(types.TypeString(res.Selected.Param))
+		sb.WriteByte('\n')
+	case res.Err != nil:
+		sb.WriteString("  ")
+		sb.WriteString(res.Err.Error())
+		if res.Overlapping {
+			sb.WriteString(" (matching may be deferred when deferred instance-matching is enabled)")
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
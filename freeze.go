@@ -0,0 +1,134 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"errors"
+
+	"github.com/benbjohnson/immutable"
+	"github.com/wdamron/poly/internal/typeutil"
+	"github.com/wdamron/poly/types"
+)
+
+var errFrozen = errors.New("Type-environment is frozen")
+
+// Freeze the type-environment, its parent environment(s), and imported environments. The frozen type-environment is an immutable
+// snapshot which may be shared across threads; declarations within a frozen type-environment will fail (or panic, for methods
+// which do not return errors).
+//
+// Environments are frozen in place: the returned environment is e, and the parent and imported environments of e will also
+// reject declarations after e is frozen.
+//
+// Child environments of a frozen type-environment (see NewTypeEnv) are cheap to create and may be used for inference within
+// separate threads. Declarations within a child environment are not visible within the frozen environment or its other children;
+// instances and sub-classes declared for type-classes of the frozen environment are stored within the child environment, and the
+// type-classes will not be modified. Inference within a frozen type-environment will
+// occur within a temporary child environment.
+//
+// Bindings of a frozen type-environment are stored within a persistent map which is shared with frozen parent environments,
+// so lookups do not walk the chain of parent environments. Bindings must not contain weakly-polymorphic (unbound) type-variables,
+// which would be linked during inference.
+//
+// The Types and TypeClasses maps of a frozen type-environment must not be modified.
+func (e *TypeEnv) Freeze() (*TypeEnv, error) {
+	if err := e.checkFreezable(make(map[*TypeEnv]bool)); err != nil {
+		return nil, err
+	}
+	e.freeze()
+	return e, nil
+}
+
+// Check if the type-environment is frozen.
+func (e *TypeEnv) Frozen() bool { return e.frozen }
+
+func (e *TypeEnv) checkMutable() {
+	if e.frozen {
+		panic(errFrozen)
+	}
+}
+
+func (e *TypeEnv) checkFreezable(seen map[*TypeEnv]bool) error {
+	for env := e; env != nil && !env.frozen && !seen[env]; env = env.Parent {
+		seen[env] = true
+		for name, t := range env.Types {
+			if hasUnboundVars(t) {
+				return errors.New("Binding " + name + " has a weakly-polymorphic type " + types.TypeString(t) + " which cannot be frozen")
+			}
+		}
+		for _, imported := range env.imports {
+			if err := imported.checkFreezable(seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *TypeEnv) freeze() {
+	if e.frozen {
+		return
+	}
+	e.frozen = true
+	bindings, classes := immutable.NewMap(nil), immutable.NewMap(nil)
+	if e.Parent != nil {
+		e.Parent.freeze()
+		bindings, classes = e.Parent.frozenTypes, e.Parent.frozenClasses
+	}
+	for _, imported := range e.imports {
+		imported.freeze()
+	}
+	b := immutable.NewMapBuilder(bindings)
+	for name, t := range e.Types {
+		// Flags are updated before bindings are shared, so inference will not modify the bindings:
+		b.Set(name, typeutil.UpdateFlags(t))
+	}
+	e.frozenTypes = b.Map()
+	b = immutable.NewMapBuilder(classes)
+	for name, tc := range e.TypeClasses {
+		b.Set(name, tc)
+	}
+	e.frozenClasses = b.Map()
+	// Parent and imported environments are frozen, so the visibility of the frozen environment will not change:
+	e.cachedVisibility = &envVisibility{visible: make(map[*TypeEnv]bool)}
+	e.collectVisibility(e.cachedVisibility)
+}
+
+// Check if t contains unbound (non-generic) type-variables.
+func hasUnboundVars(t types.Type) bool {
+	found, seen := false, make(map[types.Type]bool)
+	var visit func(t types.Type)
+	visit = func(t types.Type) {
+		t = types.RealType(t)
+		if found || seen[t] {
+			return
+		}
+		seen[t] = true
+		if tv, ok := t.(*types.Var); ok && tv.IsUnboundVar() {
+			found = true
+			return
+		}
+		typeChildren(t, visit)
+	}
+	visit(t)
+	return found
+}
@@ -27,14 +27,30 @@ import (
 
 	"github.com/wdamron/poly/ast"
 	"github.com/wdamron/poly/internal/astutil"
+	"github.com/wdamron/poly/internal/typeutil"
 	"github.com/wdamron/poly/types"
 )
 
 func (ti *InferenceContext) infer(env *TypeEnv, level uint, e ast.Expr) (ret types.Type, err error) {
 	current := env.common.CurrentExpr
 	env.common.CurrentExpr = e
-	ret, err = ti.inferCurrentExpr(env, level)
+	if ti.observer != nil {
+		ti.observer.EnterExpr(e, level)
+		ret, err = ti.inferCurrentExpr(env, level)
+		ti.observer.LeaveExpr(e, ret, err)
+	} else {
+		ret, err = ti.inferCurrentExpr(env, level)
+	}
 	env.common.CurrentExpr = current
+	if ti.interrupted {
+		return ret, ti.err
+	}
+	if (err == nil || env.common.Interrupted) && ti.isLimited() {
+		if lerr := ti.checkLimits(env, ret); lerr != nil {
+			ti.interrupted, ti.invalid, ti.err = true, e, lerr
+			return ret, lerr
+		}
+	}
 	return
 }
 
@@ -50,6 +66,9 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 				if vt == nil {
 					return nil, errors.New("Variable " + name + " is not defined")
 				}
+				if ti.observer != nil {
+					ti.observer.Lookup(name, vt)
+				}
 				using[i] = vt
 			}
 		}
@@ -59,7 +78,7 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 			ti.invalid, ti.err = e, err
 			return t, err
 		}
-		t = env.common.Instantiate(level, t)
+		t = env.internGround(ti.instantiate(env, level, t))
 		if ti.annotate {
 			e.SetType(t)
 		}
@@ -77,7 +96,10 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 			ti.invalid, ti.err = e, errors.New("Variable "+e.Name+" is not defined")
 			return nil, ti.err
 		}
-		t = env.common.Instantiate(level, t)
+		if ti.observer != nil {
+			ti.observer.Lookup(e.Name, t)
+		}
+		t = ti.instantiate(env, level, t)
 		if ti.annotate {
 			e.SetType(t)
 			e.SetScope(scope)
@@ -89,13 +111,22 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 		if err != nil {
 			return nil, err
 		}
+		// Read-only references may be dereferenced. Type-variables are unified with mutable reference-types:
 		tv := env.common.VarTracker.New(level)
-		tv.SetWeak()
-		if err := env.common.Unify(types.NewRef(tv), t); err != nil {
+		ref := types.NewRef(tv)
+		if app, ok := types.RealType(t).(*types.App); ok && types.IsReadRefType(app) {
+			ref = types.NewReadRef(tv)
+		}
+		if err := ti.unify(env, ref, t); err != nil {
+			ti.invalid, ti.err = e, err
+			return t, err
+		}
+		if err := ti.perform(env, level, types.NewEffectRow(nil, types.ReadEffect)); err != nil {
 			ti.invalid, ti.err = e, err
 			return t, err
 		}
 		t = types.RealType(tv)
+		ti.expansive = append(ti.expansive, t)
 		if ti.annotate {
 			e.SetType(t)
 		}
@@ -106,9 +137,13 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 		if err != nil {
 			return ref, err
 		}
+		if app, ok := types.RealType(ref).(*types.App); ok && types.IsReadRefType(app) {
+			err := errors.New("Read-only reference cannot be assigned")
+			ti.invalid, ti.err = e, err
+			return ref, err
+		}
 		tv := env.common.VarTracker.New(level)
-		tv.SetWeak()
-		if err := env.common.Unify(types.NewRef(tv), ref); err != nil {
+		if err := ti.unify(env, types.NewRef(tv), ref); err != nil {
 			ti.invalid, ti.err = e, err
 			return ref, err
 		}
@@ -116,11 +151,16 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 		if err != nil {
 			return ref, err
 		}
-		if err := env.common.Unify(tv, val); err != nil {
+		if err := ti.unify(env, tv, val); err != nil {
+			ti.invalid, ti.err = e, err
+			return ref, err
+		}
+		if err := ti.perform(env, level, types.NewEffectRow(nil, types.WriteEffect)); err != nil {
 			ti.invalid, ti.err = e, err
 			return ref, err
 		}
 		ref = types.RealType(ref)
+		ti.expansive = append(ti.expansive, ref)
 		if ti.annotate {
 			e.SetType(ref)
 		}
@@ -143,7 +183,7 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 		env.common.PushVarScope(e.As)
 		for _, step := range e.Sequence {
 			// Reassign the placeholder:
-			env.Assign(e.As, GeneralizeAtLevel(level, t))
+			env.Assign(e.As, ti.generalize(level, t))
 			t, err = ti.infer(env, level, step)
 		}
 		if ti.annotate && err != nil {
@@ -161,6 +201,9 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 		env.common.EnterScope(e)
 		t, err := ti.inferControlFlow(env, level, e)
 		env.common.LeaveScope()
+		if err == nil {
+			ti.expansive = append(ti.expansive, t)
+		}
 		return t, err
 
 	case *ast.Let:
@@ -180,20 +223,26 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 			if err != nil {
 				goto RestoreScope
 			}
-			if err := env.common.Unify(varType, t); err != nil {
+			if err := ti.unify(env, varType, t); err != nil {
 				ti.invalid, ti.err = e, err
 				goto RestoreScope
 			}
-			GeneralizeAtLevel(level, varType)
+			ti.generalize(level, varType)
 		default:
+			expansive := len(ti.expansive)
 			t, err := ti.infer(env, level+1, binding)
 			if err != nil {
 				env.common.LeaveScope()
 				return nil, err
 			}
+			// Type-variables which are shared with mutable state created by the binding may not be generalized:
+			for _, et := range ti.expansive[expansive:] {
+				const weak = false
+				env.common.RestrictExpansive(level, et, weak)
+			}
 			// Begin a new scope:
 			stashed = env.common.Stash(env, e.Var)
-			env.Assign(e.Var, GeneralizeAtLevel(level, t))
+			env.Assign(e.Var, ti.generalize(level, t))
 		}
 		// Infer the body type:
 		t, _ = ti.infer(env, level, e.Body)
@@ -213,7 +262,7 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 		return t, err
 
 	case *ast.Func:
-		args := make([]types.Type, len(e.ArgNames))
+		t := typeutil.NewArrow(len(e.ArgNames))
 		stashed := 0
 		vars := env.common.VarTracker.NewList(level, len(e.ArgNames))
 		tv, tail := vars.Head(), vars.Tail()
@@ -221,12 +270,20 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 		env.common.EnterScope(e)
 		for i, name := range e.ArgNames {
 			stashed += env.common.Stash(env, name)
-			args[i] = tv
+			t.Args[i] = tv
 			env.Assign(name, tv)
 			env.common.PushVarScope(name)
 			tv, tail = tail.Head(), tail.Tail()
 		}
+		// Effects within the body are tracked separately from the enclosing expression. Effects of functions which do not
+		// perform effects are not tracked:
+		outerEffects := ti.effects
+		ti.effects = nil
+		// Expansive expressions within the body are not evaluated until the function is called:
+		expansive := len(ti.expansive)
 		ret, err := ti.infer(env, level, e.Body)
+		effects := ti.effects
+		ti.effects, ti.expansive = outerEffects, ti.expansive[:expansive]
 		for _, name := range e.ArgNames {
 			env.Remove(name)
 			env.common.PopVarScope(name)
@@ -234,7 +291,7 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 		// Restore the parent scope:
 		env.common.LeaveScope()
 		env.common.Unstash(env, stashed)
-		t := &types.Arrow{Args: args, Return: ret}
+		t.Return, t.Effects = ret, effects
 		if ti.annotate {
 			e.SetType(t)
 		}
@@ -259,7 +316,13 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 			if err != nil {
 				return nil, err
 			}
-			if err := env.common.Unify(args[i], ta); err != nil {
+			if err := ti.coerce(env, args[i], ta); err != nil {
+				ti.invalid, ti.err = e, err
+				return nil, err
+			}
+		}
+		if arrow.Effects != nil {
+			if err := ti.perform(env, level, arrow.Effects); err != nil {
 				ti.invalid, ti.err = e, err
 				return nil, err
 			}
@@ -269,6 +332,7 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 			e.SetFuncType(arrow)
 			e.SetType(ret)
 		}
+		ti.expansive = append(ti.expansive, ret)
 		return ret, nil
 
 	case *ast.RecordEmpty:
@@ -314,7 +378,7 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 		if err != nil {
 			return nil, err
 		}
-		if err := env.common.Unify(&types.Record{Row: rowType}, recordType); err != nil {
+		if err := ti.unify(env, &types.Record{Row: rowType}, recordType); err != nil {
 			ti.invalid, ti.err = e, err
 			return nil, err
 		}
@@ -338,7 +402,7 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 		if err != nil {
 			return nil, err
 		}
-		if err := env.common.Unify(variantType, t); err != nil {
+		if err := ti.unify(env, variantType, t); err != nil {
 			ti.invalid, ti.err = e, err
 			return nil, err
 		}
@@ -387,7 +451,7 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 		if err != nil {
 			return nil, err
 		}
-		if err := env.common.Unify(matchType, &types.Variant{Row: casesRow}); err != nil {
+		if err := ti.unify(env, matchType, &types.Variant{Row: casesRow}); err != nil {
 			ti.invalid, ti.err = e, err
 			return nil, err
 		}
@@ -395,6 +459,69 @@ func (ti *InferenceContext) inferCurrentExpr(env *TypeEnv, level uint) (ret type
 			e.SetType(retType)
 		}
 		return retType, nil
+
+	case *ast.Pack:
+		if e.As == nil {
+			ti.invalid, ti.err = e, errors.New("Packed value must be annotated with an existential type")
+			return nil, ti.err
+		}
+		typeutil.UpdateFlags(e.As)
+		ex := ti.instantiate(env, level, e.As).(*types.Existential)
+		t, err := ti.infer(env, level, e.Value)
+		if err != nil {
+			return nil, err
+		}
+		// Quantified type-variables are replaced by hidden types, which are determined by the packed value:
+		hidden := make([]types.Type, len(ex.Vars))
+		for i := range hidden {
+			hidden[i] = env.common.VarTracker.New(level)
+		}
+		if err := ti.unify(env, env.common.OpenExistential(level, ex, hidden), t); err != nil {
+			ti.invalid, ti.err = e, err
+			return nil, err
+		}
+		if ti.annotate {
+			e.SetType(ex)
+		}
+		return ex, nil
+
+	case *ast.Unpack:
+		t, err := ti.infer(env, level, e.Value)
+		if err != nil {
+			return nil, err
+		}
+		ex, ok := types.RealType(t).(*types.Existential)
+		if !ok {
+			ti.invalid, ti.err = e, errors.New("Unpacked value must have an existential type, found "+types.TypeString(t))
+			return nil, ti.err
+		}
+		// Hidden types are replaced by skolem constants, which are defined within the scope of the body:
+		skolems := make([]types.Type, len(ex.Vars))
+		for i := range skolems {
+			skolems[i] = env.common.NewSkolem(level + 1)
+		}
+		env.common.EnterScope(e)
+		env.common.PushVarScope(e.Var)
+		stashed := env.common.Stash(env, e.Var)
+		env.Assign(e.Var, env.common.OpenExistential(level+1, ex, skolems))
+		t, err = ti.infer(env, level+1, e.Body)
+		// Restore the parent scope:
+		env.Remove(e.Var)
+		env.common.Unstash(env, stashed)
+		env.common.PopVarScope(e.Var)
+		env.common.LeaveScope()
+		if err != nil {
+			return nil, err
+		}
+		// Skolem constants may not escape the body:
+		if err := env.common.LeaveSkolemScope(level, t); err != nil {
+			ti.invalid, ti.err = e, err
+			return nil, err
+		}
+		if ti.annotate {
+			e.SetType(t)
+		}
+		return t, nil
 	}
 
 	e := env.common.CurrentExpr
@@ -421,7 +548,7 @@ func (ti *InferenceContext) splitRecord(env *TypeEnv, level uint, recordExpr ast
 	if err != nil {
 		return nil, nil, err
 	}
-	if err = env.common.Unify(paramType, recordType); err != nil {
+	if err = ti.unify(env, paramType, recordType); err != nil {
 		return nil, nil, err
 	}
 	restType = &types.Record{Row: rowType}
@@ -438,6 +565,11 @@ func (ti *InferenceContext) matchFuncType(env *TypeEnv, argc int, t types.Type)
 		}
 		return t, nil
 
+	case *types.RecursiveLink:
+		if t.Recursive.IsEquiRecursive() {
+			return ti.matchFuncType(env, argc, t.Recursive.Types[t.Index].Underlying)
+		}
+
 	case *types.Var:
 		switch {
 		case t.IsLinkVar():
@@ -451,6 +583,9 @@ func (ti *InferenceContext) matchFuncType(env *TypeEnv, argc int, t types.Type)
 				tv, tail = tail.Head(), tail.Tail()
 			}
 			arrow := &types.Arrow{Args: args, Return: tv}
+			if ti.trackEffects {
+				arrow.Effects = env.common.VarTracker.New(t.Level())
+			}
 			t.SetLink(arrow)
 			return arrow, nil
 		default:
@@ -461,6 +596,30 @@ func (ti *InferenceContext) matchFuncType(env *TypeEnv, argc int, t types.Type)
 	return nil, errors.New("Unexpected type " + t.TypeName() + " for applied function")
 }
 
+// Add effects to the effect row of the function body (or root expression) being inferred. Closed effect rows are opened,
+// so effects performed by a called function do not restrict the effects of the caller.
+func (ti *InferenceContext) perform(env *TypeEnv, level uint, effects types.Type) error {
+	if !ti.trackEffects {
+		return nil
+	}
+	labels, rest, err := types.FlattenRowType(effects)
+	if err != nil {
+		return err
+	}
+	if _, ok := rest.(*types.RowEmpty); ok {
+		if labels.Len() == 0 {
+			return nil
+		}
+		effects = &types.RowExtend{Row: env.common.VarTracker.New(level), Labels: labels}
+	}
+	// The effect row is created for the first effect performed:
+	if ti.effects == nil {
+		ti.effects = effects
+		return nil
+	}
+	return ti.unify(env, ti.effects, effects)
+}
+
 // https://github.com/tomprimozic/type-systems/blob/master/extensible_rows2/infer.ml#L287
 //
 // infer_cases env level return_ty rest_row_ty cases = match cases with
@@ -477,7 +636,7 @@ func (ti *InferenceContext) inferCases(env *TypeEnv, level uint, retType, rowTyp
 	vars := env.common.VarTracker.NewList(level, len(cases))
 	tv, tail := vars.Head(), vars.Tail()
 	for i := len(cases) - 1; i >= 0; i-- {
-		c := cases[i]
+		c := &cases[i]
 		// Infer the return expression for the case with the variable-name temporarily bound in the environment:
 		variantType := tv
 		// Begin a new scope:
@@ -494,7 +653,7 @@ func (ti *InferenceContext) inferCases(env *TypeEnv, level uint, retType, rowTyp
 			return nil, err
 		}
 		// Ensure all cases have matching return types:
-		if err := env.common.Unify(retType, t); err != nil {
+		if err := ti.unify(env, retType, t); err != nil {
 			return nil, err
 		}
 		// Extend the accumulated record:
@@ -522,63 +681,23 @@ func (ti *InferenceContext) inferLetGroup(env *TypeEnv, level uint, e *ast.LetGr
 	for _, v := range e.Vars {
 		env.common.PushVarScope(v.Var)
 	}
-	stashed, sccs := 0, ti.analysis.SCC[ti.letGroupCount]
+	groupNum := ti.letGroupCount
+	stashed, graph, sccs := 0, &ti.analysis.Graphs[groupNum], ti.analysis.SCC[groupNum]
 	ti.letGroupCount++
 	// Grouped let-bindings are sorted into strongly-connected components, then type-checked in dependency order:
-	for _, scc := range sccs {
-		// Add fresh type-variables for bindings:
-		vars := env.common.VarTracker.NewList(level+1, len(scc))
-		tv, tail := vars.Head(), vars.Tail()
-		// Begin a new scope:
-		for _, bindNum := range scc {
-			v := e.Vars[bindNum]
-			stashed += env.common.Stash(env, v.Var)
-			env.Assign(v.Var, tv)
-			tv, tail = tail.Head(), tail.Tail()
+	if ti.workers > 1 && !ti.parallel && ti.observer == nil && len(sccs) > 1 {
+		if err := ti.inferComponentsParallel(env, level, e, graph, sccs, &stashed); err != nil {
+			return nil, err
 		}
-		// Infer types:
-		tv, tail = vars.Head(), vars.Tail()
-		for _, bindNum := range scc {
-			v := e.Vars[bindNum]
-			var isFunc bool
-			// To prevent self-references within non-function types, stash/remove the type-variable:
-			if _, isFunc = v.Value.(*ast.Func); !isFunc {
-				exists := false
-				for i := 0; i < stashed; i++ {
-					existing := env.common.EnvStash[len(env.common.EnvStash)-(1+i)]
-					if existing.Name == v.Var {
-						env.Assign(v.Var, existing.Type)
-						exists = true
-						break
-					}
-				}
-				if !exists {
-					env.Remove(v.Var)
-				}
-			}
-			t, err := ti.infer(env, level+1, v.Value)
-			if err != nil {
-				return nil, err
-			}
-			if err := env.common.Unify(tv, t); err != nil {
-				ti.invalid, ti.err = e, err
+	} else {
+		for _, scc := range sccs {
+			if err := ti.inferComponent(env, level, e, graph.Nested, scc, &stashed); err != nil {
 				return nil, err
 			}
-			// Restore the previously stashed/removed type-variable:
-			if !isFunc {
-				env.Assign(v.Var, tv)
-			}
-			tv, tail = tail.Head(), tail.Tail()
-		}
-		// Generalize types:
-		tv, tail = vars.Head(), vars.Tail()
-		for _, bindNum := range scc {
-			v := e.Vars[bindNum]
-			env.Assign(v.Var, GeneralizeAtLevel(level, tv))
-			tv, tail = tail.Head(), tail.Tail()
 		}
 	}
 
+	ti.letGroupCount = graph.Nested[len(e.Vars)]
 	t, err := ti.infer(env, level, e.Body)
 	// Restore the parent scope:
 	for _, v := range e.Vars {
@@ -600,6 +719,64 @@ func (ti *InferenceContext) inferLetGroup(env *TypeEnv, level uint, e *ast.LetGr
 	return t, err
 }
 
+// Infer and generalize types for a strongly-connected component of grouped let-bindings.
+func (ti *InferenceContext) inferComponent(env *TypeEnv, level uint, e *ast.LetGroup, nested []int, scc []int, stashed *int) error {
+	// Add fresh type-variables for bindings:
+	vars := env.common.VarTracker.NewList(level+1, len(scc))
+	tv, tail := vars.Head(), vars.Tail()
+	// Begin a new scope:
+	for _, bindNum := range scc {
+		v := e.Vars[bindNum]
+		*stashed += env.common.Stash(env, v.Var)
+		env.Assign(v.Var, tv)
+		tv, tail = tail.Head(), tail.Tail()
+	}
+	// Infer types:
+	tv, tail = vars.Head(), vars.Tail()
+	for _, bindNum := range scc {
+		v := e.Vars[bindNum]
+		var isFunc bool
+		// To prevent self-references within non-function types, stash/remove the type-variable:
+		if _, isFunc = v.Value.(*ast.Func); !isFunc {
+			exists := false
+			for i := 0; i < *stashed; i++ {
+				existing := env.common.EnvStash[len(env.common.EnvStash)-(1+i)]
+				if existing.Name == v.Var {
+					env.Assign(v.Var, existing.Type)
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				env.Remove(v.Var)
+			}
+		}
+		// Let-groups are numbered in the order they appear, which may differ from dependency order:
+		ti.letGroupCount = nested[bindNum]
+		t, err := ti.infer(env, level+1, v.Value)
+		if err != nil {
+			return err
+		}
+		if err := ti.unify(env, tv, t); err != nil {
+			ti.invalid, ti.err = e, err
+			return err
+		}
+		// Restore the previously stashed/removed type-variable:
+		if !isFunc {
+			env.Assign(v.Var, tv)
+		}
+		tv, tail = tail.Head(), tail.Tail()
+	}
+	// Generalize types:
+	tv, tail = vars.Head(), vars.Tail()
+	for _, bindNum := range scc {
+		v := e.Vars[bindNum]
+		env.Assign(v.Var, ti.generalize(level, tv))
+		tv, tail = tail.Head(), tail.Tail()
+	}
+	return nil
+}
+
 // Loops are detected through SCC analysis and inferred as recursive functions. Blocks are inferred in dependency order.
 func (ti *InferenceContext) inferControlFlow(env *TypeEnv, level uint, e *ast.ControlFlow) (ret types.Type, err error) {
 	// Evaluate all sub-expressions in a new scope with local variables bound to mutable references:
@@ -670,7 +847,7 @@ func (ti *InferenceContext) inferControlFlow(env *TypeEnv, level uint, e *ast.Co
 		}
 		// Check consistent usage of locals across loop iterations:
 		for i, ref := range refs {
-			if err := env.common.Unify(ref, tmpRefs[i]); err != nil {
+			if err := ti.unify(env, ref, tmpRefs[i]); err != nil {
 				ti.invalid, ti.err = e, err
 				return nil, err
 			}
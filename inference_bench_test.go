@@ -23,6 +23,7 @@
 package poly_test
 
 import (
+	"strconv"
 	"testing"
 
 	. "github.com/wdamron/poly"
@@ -104,6 +105,64 @@ func BenchmarkRecursiveLet(b *testing.B) { // ~1900 ns/op
 	}
 }
 
+func BenchmarkFrozenRecursiveLet(b *testing.B) {
+	shared := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	shared.Declare("add", TArrow2(TConst("int"), TConst("int"), TConst("int")))
+	A := shared.NewGenericVar()
+	shared.Declare("if", TArrow3(TConst("bool"), A, A, A))
+	shared.Declare("somebool", TConst("bool"))
+	env, err := shared.Freeze()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	expr := Func1("x",
+		Let("f",
+			Func1("x",
+				Call(
+					Var("if"),
+					Var("somebool"),
+					Var("x"),
+					Call(Var("f"), Call(Var("add"), Var("x"), Var("x"))),
+				),
+			),
+			Call(Var("f"), Var("x")),
+		))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		ty, err := ctx.Infer(expr, env)
+		if err != nil || ty == nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGroundCalls(b *testing.B) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	env.Declare("add", TArrow2(TConst("int"), TConst("int"), TConst("int")))
+	env.Declare("one", TConst("int"))
+
+	add, one := Var("add"), Var("one")
+	expr := Call(add, Call(add, one, one), one)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		ty, err := ctx.Infer(expr, env)
+		if err != nil || ty == nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkInstanceLookups(t *testing.B) { // ~15000 ns/op
 	env := NewTypeEnv(nil)
 	ctx := NewContext()
@@ -185,3 +244,89 @@ func BenchmarkInstanceLookups(t *testing.B) { // ~15000 ns/op
 		}
 	}
 }
+
+// Instance lookups for a type-class with many record and nested type-application instances:
+func BenchmarkIndexedInstanceLookups(b *testing.B) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	Show, err := env.DeclareTypeClass("Show", func(param *types.Var) types.MethodSet {
+		return types.MethodSet{"show": TArrow1(param, TConst("string"))}
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	list := TConst("List")
+	for i := 0; i < 200; i++ {
+		n := strconv.Itoa(i)
+		record := TRecordFlat(map[string]types.Type{"x" + n: TConst("int"), "y": TConst("int")})
+		env.Declare("show_record"+n, TArrow1(record, TConst("string")))
+		if _, err := env.DeclareInstance(Show, record, map[string]string{"show": "show_record" + n}); err != nil {
+			b.Fatal(err)
+		}
+		app := TApp(list, TApp(TConst("T"+n), TConst("int")))
+		env.Declare("show_list"+n, TArrow1(app, TConst("string")))
+		if _, err := env.DeclareInstance(Show, app, map[string]string{"show": "show_list" + n}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	env.Declare("somerecord", TRecordFlat(map[string]types.Type{"x150": TConst("int"), "y": TConst("int")}))
+	env.Declare("somelist", TApp(list, TApp(TConst("T150"), TConst("int"))))
+
+	exprs := []ast.Expr{Call(Var("show"), Var("somerecord")), Call(Var("show"), Var("somelist"))}
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		for _, expr := range exprs {
+			if ty, err := ctx.Infer(expr, env); err != nil || ty == nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// A generated module with many grouped let-bindings of ground function types:
+//
+//   let f0 = fn (x) -> add(x, norm(origin)), f1 = fn (p) -> translate(p, origin), f2 = fn (x) -> f0(f0(x)), ...
+func benchmarkGeneratedModule(b *testing.B, interner *types.Interner) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+	env.SetInterner(interner)
+
+	point := func() types.Type { return TRecordFlat(map[string]types.Type{"x": TConst("int"), "y": TConst("int")}) }
+	env.Declare("add", TArrow2(TConst("int"), TConst("int"), TConst("int")))
+	env.Declare("origin", point())
+	env.Declare("norm", TArrow1(point(), TConst("int")))
+	env.Declare("translate", TArrow2(point(), point(), point()))
+
+	f := func(i int) string { return "f" + strconv.Itoa(i) }
+	bindings := make([]ast.LetBinding, 300)
+	for i := range bindings {
+		var value ast.Expr
+		switch i % 3 {
+		case 0:
+			value = Func1("x", Call(Var("add"), Var("x"), Call(Var("norm"), Var("origin"))))
+		case 1:
+			value = Func1("p", Call(Var("translate"), Var("p"), Var("origin")))
+		case 2:
+			value = Func1("x", Call(Var(f(i-2)), Call(Var(f(i-2)), Var("x"))))
+		}
+		bindings[i] = ast.LetBinding{Var: f(i), Value: value}
+	}
+	expr := LetGroup(bindings, Var(f(len(bindings)-1)))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		ty, err := ctx.Infer(expr, env)
+		if err != nil || ty == nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGeneratedModule(b *testing.B) { benchmarkGeneratedModule(b, nil) }
+
+func BenchmarkGeneratedModuleInterned(b *testing.B) { benchmarkGeneratedModule(b, types.NewInterner()) }
@@ -23,10 +23,12 @@
 package poly
 
 import (
+	"context"
 	"errors"
 
 	"github.com/wdamron/poly/ast"
 	"github.com/wdamron/poly/internal/astutil"
+	"github.com/wdamron/poly/internal/typeutil"
 	"github.com/wdamron/poly/types"
 )
 
@@ -36,12 +38,28 @@ import (
 type InferenceContext struct {
 	annotate      bool
 	canDeferMatch bool
+	equiRecursive bool
+	trackEffects  bool
 	analyzed      bool
 	needsReset    bool
 
 	rootExpr      ast.Expr
 	analysis      *astutil.Analysis
 	letGroupCount int
+	effects       types.Type // effect row for the function body (or root expression) being inferred
+	rootEffects   types.Type
+	expansive     []types.Type // types of expansive expressions (which may create mutable state) outside of function bodies
+
+	limits      Limits
+	ctx         context.Context // context for cancellation, or nil
+	interrupted bool            // set when a limit is exceeded or inference is cancelled
+
+	workers  int  // maximum number of goroutines for inferring let-groups in parallel
+	parallel bool // set while the components of a let-group are inferred in parallel
+
+	observer   InferenceObserver // receives events during inference, or nil
+	derive     bool              // construct typing derivations during inference
+	derivation *TypingDerivation // typing derivation for the most recent inference
 
 	err     error
 	invalid ast.Expr
@@ -56,6 +74,13 @@ func (ti *InferenceContext) reset() {
 		ti.analyzed = false
 	}
 	ti.rootExpr, ti.err, ti.invalid, ti.letGroupCount, ti.needsReset = nil, nil, nil, 0, false
+	ti.interrupted = false
+	ti.effects, ti.rootEffects = nil, nil
+	ti.derivation = nil
+	for i := range ti.expansive {
+		ti.expansive[i] = nil
+	}
+	ti.expansive = ti.expansive[:0]
 }
 
 // Reset the state of the context. The context will be reset automatically before inference.
@@ -73,6 +98,26 @@ func (ti *InferenceContext) Reset() {
 // By default, deferred instance-matching is disabled.
 func (ti *InferenceContext) EnableDeferredInstanceMatching(enabled bool) { ti.canDeferMatch = enabled }
 
+// Equi-recursive types may be inferred for expressions which would otherwise require implicitly recursive types,
+// such as self-application: `fn (o) -> o.self(o)`. Equi-recursive types are equivalent to their unrolled types,
+// and are printed as `(... as 'a)`.
+//
+// By default, equi-recursive types are not inferred.
+func (ti *InferenceContext) EnableEquiRecursiveTypes(enabled bool) { ti.equiRecursive = enabled }
+
+// Effect rows may be inferred for function types, such as `int -> ref[int] ! <write | 'a>`, from dereferences, assignments,
+// and calls to functions with declared effects. Higher-order functions which are declared without effects are instantiated
+// with an effect row which is shared by their function arguments and results, so effects of function arguments propagate
+// to their callers.
+//
+// By default, effects are not inferred.
+func (ti *InferenceContext) EnableEffects(enabled bool) { ti.trackEffects = enabled }
+
+// Get the effect row for the root expression of the most recent inference, such as `<read, write | '_0>`, or an empty
+// row if the root expression does not perform effects (or effects are not enabled). Effects of the root expression exclude effects within function
+// bodies, which are included in the functions' types.
+func (ti *InferenceContext) Effects() types.Type { return ti.rootEffects }
+
 // Get the error which caused inference to fail.
 func (ti *InferenceContext) Error() error { return ti.err }
 
@@ -82,8 +127,8 @@ func (ti *InferenceContext) InvalidExpr() ast.Expr { return ti.invalid }
 // Infer the type of expr within env.
 //
 // A type-environment cannot be used concurrently for inference; to share a type-environment
-// across threads, create a new type-environment for each thread which inherits from the
-// shared environment.
+// across threads, freeze the shared environment (see TypeEnv.Freeze) and create a new
+// type-environment for each thread which inherits from the frozen environment.
 func (ti *InferenceContext) Infer(expr ast.Expr, env *TypeEnv) (types.Type, error) {
 	nocopy := true
 	_, t, err := ti.inferRoot(expr, env, nocopy)
@@ -93,8 +138,8 @@ func (ti *InferenceContext) Infer(expr ast.Expr, env *TypeEnv) (types.Type, erro
 // Infer the type of expr within env. The type-annotated copy of expr will be returned.
 //
 // A type-environment cannot be used concurrently for inference; to share a type-environment
-// across threads, create a new type-environment for each thread which inherits from the
-// shared environment.
+// across threads, freeze the shared environment (see TypeEnv.Freeze) and create a new
+// type-environment for each thread which inherits from the frozen environment.
 func (ti *InferenceContext) Annotate(expr ast.Expr, env *TypeEnv) (ast.Expr, error) {
 	nocopy := false
 	ti.annotate = true
@@ -107,8 +152,8 @@ func (ti *InferenceContext) Annotate(expr ast.Expr, env *TypeEnv) (ast.Expr, err
 // All sub-expressions of expr must have unique addresses.
 //
 // A type-environment cannot be used concurrently for inference; to share a type-environment
-// across threads, create a new type-environment for each thread which inherits from the
-// shared environment.
+// across threads, freeze the shared environment (see TypeEnv.Freeze) and create a new
+// type-environment for each thread which inherits from the frozen environment.
 func (ti *InferenceContext) AnnotateDirect(expr ast.Expr, env *TypeEnv) error {
 	nocopy := true
 	ti.annotate = true
@@ -124,22 +169,64 @@ func (ti *InferenceContext) inferRoot(root ast.Expr, env *TypeEnv, nocopy bool)
 	if !nocopy {
 		root = ast.CopyExpr(root)
 	}
+	temporary := env.frozen
+	if temporary {
+		env = NewTypeEnv(env)
+	}
 	if ti.needsReset {
 		ti.reset()
 	}
 	ti.rootExpr, env.common.TrackScopes, env.common.DeferredConstraintsEnabled = root, ti.annotate, ti.canDeferMatch
+	env.common.EquiRecursiveTypes, env.common.TrackEffects = ti.equiRecursive, ti.trackEffects
+	env.common.MaxUnifySteps = ti.limits.UnificationSteps
+	if ti.ctx != nil {
+		env.common.Done = ti.ctx.Done()
+	}
+	observer := ti.observer
+	var derivation *derivationBuilder
+	if ti.derive {
+		derivation = &derivationBuilder{}
+		if observer != nil {
+			ti.observer = teeObserver{derivation, observer}
+		} else {
+			ti.observer = derivation
+		}
+	}
+	if ti.observer != nil {
+		env.common.InstanceSelected, env.common.ConstraintDeferred = ti.observer.SelectInstance, ti.observer.DeferConstraint
+	}
+	ti.effects = nil
 	t, err := ti.infer(env, types.TopLevel+1, root)
 	if err != nil {
 		goto Cleanup
 	}
 	if invalid, err := env.common.ApplyDeferredConstraints(); err != nil {
-		ti.invalid, ti.err = invalid, err
+		ti.invalid, ti.err = invalid, ti.interruptedError(env, err)
 		goto Cleanup
 	}
 	env.common.VarTracker.FlattenLinks()
-	t = Generalize(t)
+	// See "Relaxing the Value Restriction" (Jacques Garrigue). Type-variables which are shared with mutable state created
+	// during evaluation are weakly-polymorphic; all other type-variables may be generalized:
+	for _, et := range ti.expansive {
+		const weak = true
+		env.common.RestrictExpansive(types.TopLevel, et, weak)
+	}
+	t, ti.rootEffects = env.internGround(typeutil.GeneralizeRelaxed(types.TopLevel, t)), types.RowEmptyPointer
+	if ti.effects != nil {
+		// Effect rows of called functions may be shared with the root effect row, so it is not generalized:
+		ti.rootEffects = types.RealType(ti.effects)
+	}
+	if ti.observer != nil {
+		ti.observer.Generalize(types.TopLevel, t)
+	}
 Cleanup:
+	if derivation != nil {
+		ti.derivation, ti.observer = derivation.root, observer
+	}
 	env.common.Reset()
+	if temporary {
+		env.common.VarTracker.Release()
+	}
 	ti.needsReset, ti.rootExpr = true, nil
 	return root, t, ti.err
 }
@@ -23,7 +23,11 @@
 package poly_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -44,6 +48,22 @@ func mustInfer(t *testing.T, env *TypeEnv, ctx *InferenceContext, expr ast.Expr,
 	}
 }
 
+// Check that an inferred type applies a type constructor to a single weakly-polymorphic type-variable, independent of
+// the id of the type-variable.
+func mustInferWeak(t *testing.T, env *TypeEnv, ctx *InferenceContext, expr ast.Expr, constructor string) {
+	ty, err := ctx.Infer(expr, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, ok := types.RealType(ty).(*types.App)
+	if !ok || types.TypeString(app.Const) != constructor || len(app.Params) != 1 {
+		t.Fatalf("type: %s", types.TypeString(ty))
+	}
+	if tv, ok := types.RealType(app.Params[0]).(*types.Var); !ok || !tv.IsWeakVar() || tv.IsGenericVar() {
+		t.Fatalf("expected a weakly-polymorphic type-variable, found %s", types.TypeString(ty))
+	}
+}
+
 func TestUnit(t *testing.T) {
 	ty := TArrow1(TConst("int"), TUnit())
 	if types.TypeString(ty) != "int -> ()" {
@@ -104,6 +124,183 @@ func TestSizes(t *testing.T) {
 	}
 }
 
+func TestSizeArithmetic(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	array := func(elem types.Type, size types.Type) *types.App { return TApp(TConst("array"), elem, size) }
+
+	a, n, m := env.NewGenericVar(), env.NewGenericSize(), env.NewGenericSize()
+	env.Declare("concat", TArrow2(array(a, n), array(a, m), array(a, TSizeAdd(n, m))))
+	a, n = env.NewGenericVar(), env.NewGenericSize()
+	env.Declare("halve", TArrow1(array(a, TSizeMul(2, n)), array(a, n)))
+	a, n = env.NewGenericVar(), env.NewGenericSize()
+	env.Declare("push", TArrow1(array(a, n), array(a, TSizeAdd(n, TSize(1)))))
+	a, n, m = env.NewGenericVar(), env.NewGenericSize(), env.NewGenericSize()
+	env.Declare("zipLongest", TArrow2(array(a, n), array(a, m), array(a, TSizeMax(n, m))))
+
+	env.Declare("xs", array(TConst("int"), TSize(8)))
+	env.Declare("ys", array(TConst("int"), TSize(16)))
+	env.Declare("zs", array(TConst("int"), TSize(7)))
+
+	mustInfer(t, env, ctx, Var("concat"), "(size 'b, size 'c) => (array['a, 'b], array['a, 'c]) -> array['a, 'b + 'c]")
+	mustInfer(t, env, ctx, Call(Var("concat"), Var("xs"), Var("ys")), "array[int, 24]")
+	mustInfer(t, env, ctx, Call(Var("halve"), Var("ys")), "array[int, 8]")
+	mustInfer(t, env, ctx, Call(Var("halve"), Call(Var("concat"), Var("xs"), Var("xs"))), "array[int, 8]")
+	mustInfer(t, env, ctx, Call(Var("zipLongest"), Var("xs"), Var("ys")), "array[int, 16]")
+	if _, err := ctx.Infer(Call(Var("halve"), Var("zs")), env); err == nil {
+		t.Fatalf("expected error for odd size")
+	}
+
+	// sizes are solved during unification:
+	mustInfer(t, env, ctx, Func1("x", Call(Var("concat"), Var("x"), Var("x"))), "size 'b => array['a, 'b] -> array['a, 2 * 'b]")
+	mustInfer(t, env, ctx, Func1("x", Call(Var("halve"), Call(Var("push"), Var("x")))), "size 'b => array['a, 2 * 'b + 1] -> array['a, 'b + 1]")
+	mustInfer(t, env, ctx, Func1("x", Call(Var("halve"), Call(Var("push"), Call(Var("push"), Var("x"))))), "size 'b => array['a, 2 * 'b] -> array['a, 'b + 1]")
+	mustInfer(t, env, ctx, Func1("x", Call(Var("concat"), Call(Var("push"), Var("x")), Var("xs"))), "size 'a => array[int, 'a] -> array[int, 'a + 9]")
+	if _, err := ctx.Infer(Call(Var("halve"), Call(Var("push"), Call(Var("concat"), Var("xs"), Var("xs")))), env); err == nil {
+		t.Fatalf("expected error for unsolvable size equation")
+	}
+
+	sizeVars := map[string]types.Type{"n": env.NewGenericSize(), "m": env.NewGenericSize()}
+	size, err := types.ParseSize("2 * (n + 1) + max('m, 4)", func(name string) types.Type { return sizeVars[name] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := types.TypeString(size); s != "(size 'a, size 'b) => 2 * 'a + max('b, 4) + 2" {
+		t.Fatalf("size: %s", s)
+	}
+	if _, err = types.ParseSize("n * m", func(name string) types.Type { return sizeVars[name] }); err == nil {
+		t.Fatalf("expected error for non-linear size expression")
+	}
+}
+
+func TestSizeBounds(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	array := func(size types.Type) *types.App { return TApp(TConst("array"), TConst("int"), size) }
+	buf := func(size types.Type) *types.App { return TApp(TConst("buf"), size) }
+	index := func(size types.Type) *types.App { return TApp(TConst("index"), size) }
+
+	n := env.NewGenericSize()
+	types.NewSizeBound(types.SizeLessOrEqual, n, TSize(64))
+	env.Declare("fixed", TArrow1(array(n), buf(n)))
+	n, m := env.NewGenericSize(), env.NewGenericSize()
+	types.NewSizeBound(types.SizeLess, m, n)
+	env.Declare("at", TArrow2(buf(n), index(m), TConst("int")))
+	n = env.NewGenericSize()
+	env.Declare("push", TArrow1(array(n), array(TSizeAdd(n, TSize(1)))))
+
+	env.Declare("xs", array(TSize(8)))
+	env.Declare("ys", array(TSize(64)))
+	env.Declare("zs", array(TSize(80)))
+	env.Declare("b", buf(TSize(16)))
+	env.Declare("i", index(TSize(4)))
+	env.Declare("j", index(TSize(16)))
+
+	mustInfer(t, env, ctx, Var("fixed"), "(size 'a, 'a <= 64) => array[int, 'a] -> buf['a]")
+	mustInfer(t, env, ctx, Var("at"), "(size 'a, size 'b, 'b < 'a) => (buf['a], index['b]) -> int")
+	mustInfer(t, env, ctx, Call(Var("fixed"), Var("xs")), "buf[8]")
+	mustInfer(t, env, ctx, Call(Var("fixed"), Var("ys")), "buf[64]")
+	mustInfer(t, env, ctx, Call(Var("at"), Var("b"), Var("i")), "int")
+
+	_, err := ctx.Infer(Call(Var("fixed"), Var("zs")), env)
+	if boundErr, ok := err.(*types.SizeBoundError); !ok {
+		t.Fatalf("expected size bound error, found %v", err)
+	} else if boundErr.Error() != "Size bound is not satisfied: 80 <= 64" {
+		t.Fatalf("error: %s", boundErr.Error())
+	}
+	if _, err = ctx.Infer(Call(Var("at"), Var("b"), Var("j")), env); err == nil {
+		t.Fatalf("expected size bound error")
+	} else if _, ok := err.(*types.SizeBoundError); !ok {
+		t.Fatalf("expected size bound error, found %v", err)
+	}
+
+	// bounds are propagated through unification and generalization:
+	mustInfer(t, env, ctx, Func1("x", Call(Var("fixed"), Var("x"))), "(size 'a, 'a <= 64) => array[int, 'a] -> buf['a]")
+	mustInfer(t, env, ctx, Func1("x", Call(Var("fixed"), Call(Var("push"), Var("x")))), "(size 'a, 'a + 1 <= 64) => array[int, 'a] -> buf['a + 1]")
+	expr := Let("f", Func1("x", Call(Var("fixed"), Call(Var("push"), Var("x")))), Call(Var("f"), Var("xs")))
+	mustInfer(t, env, ctx, expr, "buf[9]")
+	expr = Let("f", Func1("x", Call(Var("fixed"), Call(Var("push"), Var("x")))), Call(Var("f"), Var("ys")))
+	if _, err = ctx.Infer(expr, env); err == nil {
+		t.Fatalf("expected size bound error")
+	} else if _, ok := err.(*types.SizeBoundError); !ok {
+		t.Fatalf("expected size bound error, found %v", err)
+	}
+}
+
+func TestUnitsOfMeasure(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	for _, name := range []string{"m", "s", "kg"} {
+		if _, err := env.DeclareBaseUnit(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := env.DeclareBaseUnit("m"); err == nil {
+		t.Fatalf("expected error for redeclared unit")
+	}
+	unit := func(s string, vars map[string]*types.Var) *types.Measure {
+		m, err := env.ParseUnit(s, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	if err := env.DeclareUnit("N", unit("kg*m/s^2", nil)); err != nil {
+		t.Fatal(err)
+	}
+	float := func(m types.Type) *types.App { return TApp(TConst("float"), m) }
+
+	vars := map[string]*types.Var{}
+	env.Declare("mul", TArrow2(float(unit("'u", vars)), float(unit("'v", vars)), float(unit("'u*'v", vars))))
+	vars = map[string]*types.Var{}
+	env.Declare("div", TArrow2(float(unit("'u", vars)), float(unit("'v", vars)), float(unit("'u/'v", vars))))
+	vars = map[string]*types.Var{}
+	env.Declare("add", TArrow2(float(unit("'u", vars)), float(unit("'u", vars)), float(unit("'u", vars))))
+	vars = map[string]*types.Var{}
+	env.Declare("sqrt", TArrow1(float(unit("'u^2", vars)), float(unit("'u", vars))))
+
+	env.Declare("distance", float(unit("m", nil)))
+	env.Declare("time", float(unit("s", nil)))
+	env.Declare("speed", float(unit("m/s", nil)))
+	env.Declare("area", float(unit("m^2", nil)))
+	env.Declare("mass", float(unit("kg", nil)))
+	env.Declare("force", float(unit("N", nil)))
+	env.Declare("ratio", float(unit("1", nil)))
+
+	mustInfer(t, env, ctx, Var("div"), "(measure 'a, measure 'b) => (float['a], float['b]) -> float['a/'b]")
+	mustInfer(t, env, ctx, Var("force"), "float[kg*m/s^2]")
+	mustInfer(t, env, ctx, Var("ratio"), "float[1]")
+	mustInfer(t, env, ctx, Call(Var("div"), Var("distance"), Var("time")), "float[m/s]")
+	mustInfer(t, env, ctx, Call(Var("div"), Var("ratio"), Var("time")), "float[1/s]")
+	mustInfer(t, env, ctx, Call(Var("mul"), Var("speed"), Var("time")), "float[m]")
+	mustInfer(t, env, ctx, Call(Var("add"), Var("distance"), Call(Var("mul"), Var("speed"), Var("time"))), "float[m]")
+	mustInfer(t, env, ctx, Call(Var("div"), Var("mass"), Call(Var("mul"), Var("distance"), Var("time"))), "float[kg/(m*s)]")
+	mustInfer(t, env, ctx, Call(Var("sqrt"), Var("area")), "float[m]")
+	mustInfer(t, env, ctx, Call(Var("add"), Var("force"), Call(Var("div"), Call(Var("mul"), Var("mass"), Var("speed")), Var("time"))), "float[kg*m/s^2]")
+	if _, err := ctx.Infer(Call(Var("add"), Var("distance"), Var("time")), env); err == nil {
+		t.Fatalf("expected error for mismatched units")
+	}
+	if _, err := ctx.Infer(Call(Var("sqrt"), Var("distance")), env); err == nil {
+		t.Fatalf("expected error for mismatched units")
+	}
+
+	// unit type-variables are generalized:
+	mustInfer(t, env, ctx, Func1("x", Call(Var("div"), Call(Var("mul"), Var("x"), Var("x")), Var("x"))), "measure 'a => float['a] -> float['a]")
+	mustInfer(t, env, ctx, Func1("x", Call(Var("mul"), Var("x"), Var("speed"))), "measure 'a => float['a] -> float[m*'a/s]")
+	mustInfer(t, env, ctx, Func2("x", "y", Call(Var("add"), Call(Var("mul"), Var("x"), Var("x")), Call(Var("mul"), Var("y"), Var("y")))),
+		"measure 'a => (float['a], float['a]) -> float['a^2]")
+	// solved by introducing a fresh unit type-variable:
+	mustInfer(t, env, ctx, Func2("x", "y", Call(Var("add"), Call(Var("mul"), Var("x"), Var("x")), Call(Var("mul"), Var("y"), Call(Var("mul"), Var("y"), Var("y"))))),
+		"measure 'a => (float['a^3], float['a^2]) -> float['a^6]")
+
+	if kind, err := env.CheckKind(unit("N/'u", map[string]*types.Var{})); err != nil || types.KindString(kind) != "measure" {
+		t.Fatalf("expected measure kind")
+	}
+}
+
 func TestRefs(t *testing.T) {
 	env := NewTypeEnv(nil)
 	ctx := NewContext()
@@ -173,6 +370,44 @@ func TestAliases(t *testing.T) {
 	mustInfer(t, env, ctx, Call(Var("append"), Var("someints2"), Var("someints3")), "slice[int]")
 }
 
+func TestWalkExpr(t *testing.T) {
+	// match get(r) { :A a -> pipe $ = *a |> *$ = one }
+	expr := Match(Call(Var("get"), Var("r")), []ast.MatchCase{
+		MatchCase("A", "a", Pipe("$", Deref(Var("a")), DerefAssign(Var("$"), Var("one")))),
+	}, nil)
+	var visited []string
+	ast.WalkExpr(expr, func(e ast.Expr) {
+		if v, ok := e.(*ast.Var); ok {
+			visited = append(visited, v.Name)
+		} else {
+			visited = append(visited, e.ExprName())
+		}
+	})
+	// Called functions, matched values, and pipelines (followed by their sources) are visited:
+	expected := []string{"Match", "Call", "get", "r", "Pipe", "Deref", "a", "DerefAssign", "$", "one"}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Fatalf("expected %v, found %v", expected, visited)
+	}
+}
+
+func TestSiblingScopeAnnotations(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	// Scopes of sibling functions are not shared after the scope of the first function is left:
+	first, second := Func1("a", Var("a")), Func1("b", Var("b"))
+	expr := Let("f", first, Let("g", second, Var("g")))
+	if err := ctx.AnnotateDirect(expr, env); err != nil {
+		t.Fatal(err)
+	}
+	if scope := first.Body.(*ast.Var).Scope(); scope == nil || scope.Expr != first {
+		t.Fatalf("wrong scope annotation for a")
+	}
+	if scope := second.Body.(*ast.Var).Scope(); scope == nil || scope.Expr != second {
+		t.Fatalf("wrong scope annotation for b")
+	}
+}
+
 func TestVariableScopeAnnotations(t *testing.T) {
 	env := NewTypeEnv(nil)
 	ctx := NewContext()
@@ -359,6 +594,96 @@ func TestControlFlow(t *testing.T) {
 	}
 }
 
+func TestNominalTypes(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	intType := TConst("int")
+	env.Declare("someint", intType)
+	env.Declare("add", TArrow2(intType, intType, intType))
+
+	userId, err := env.DeclareNewtype("UserId", nil, intType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Declare("someuser", userId)
+
+	mustInfer(t, env, ctx, Var("UserId"), "int -> UserId")
+	mustInfer(t, env, ctx, Call(Var("UserId"), Var("someint")), "UserId")
+	mustInfer(t, env, ctx, Call(Var("unUserId"), Var("someuser")), "int")
+	mustInfer(t, env, ctx, Call(Var("add"), Call(Var("unUserId"), Var("someuser")), Var("someint")), "int")
+	if _, err = ctx.Infer(Call(Var("add"), Var("someuser"), Var("someint")), env); err == nil {
+		t.Fatalf("expected newtype not to unify with its representation")
+	}
+	if _, err = env.DeclareNewtype("UserId", nil, intType); err == nil {
+		t.Fatalf("expected error for duplicate type")
+	}
+
+	// generic newtypes:
+	a := env.NewGenericVar()
+	if _, err = env.DeclareNewtype("Box", []*types.Var{a}, TRecordFlat(map[string]types.Type{"value": a})); err != nil {
+		t.Fatal(err)
+	}
+	mustInfer(t, env, ctx, Var("Box"), "{value : 'a} -> Box['a]")
+	mustInfer(t, env, ctx, RecordSelect(Call(Var("unBox"), Call(Var("Box"), RecordExtend(nil, LabelValue("value", Var("someint"))))), "value"), "int")
+	if kind, err := env.CheckKind(TConst("Box")); err != nil || types.KindString(kind) != "* -> *" {
+		t.Fatalf("unexpected kind for Box")
+	}
+
+	// opaque types:
+	lib := NewTypeEnv(env)
+	lib.Module = "lib"
+	handle, err := lib.DeclareOpaque("Handle", nil, TRecordFlat(map[string]types.Type{"fd": intType}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib.Declare("open", TArrow1(intType, handle))
+	lib.Declare("fd", TArrow1(handle, intType))
+
+	// the underlying type is visible within the module:
+	mustInfer(t, lib, ctx, RecordSelect(Call(Var("open"), Var("someint")), "fd"), "int")
+	mustInfer(t, lib, ctx, Var("open"), "int -> Handle")
+
+	inner := NewTypeEnv(lib)
+	mustInfer(t, inner, ctx, RecordSelect(Call(Var("open"), Var("someint")), "fd"), "int")
+
+	// the underlying type is hidden outside of the module:
+	client := NewTypeEnv(lib)
+	client.Module = "client"
+	mustInfer(t, client, ctx, Call(Var("fd"), Call(Var("open"), Var("someint"))), "int")
+	if _, err = ctx.Infer(RecordSelect(Call(Var("open"), Var("someint")), "fd"), client); err == nil {
+		t.Fatalf("expected opaque type to hide its underlying type")
+	}
+	if _, err = ctx.Infer(Call(Var("fd"), RecordExtend(nil, LabelValue("fd", Var("someint")))), client); err == nil {
+		t.Fatalf("expected opaque type not to unify with its underlying type")
+	}
+
+	// outside of a named module, the underlying type is visible within the declaring environment and its child environments,
+	// including after the declaring environment is frozen:
+	unnamed := NewTypeEnv(nil)
+	unnamed.Declare("someint", intType)
+	token, err := unnamed.DeclareOpaque("Token", nil, TRecordFlat(map[string]types.Type{"id": intType}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unnamed.Declare("token", TArrow1(intType, token))
+	selectId := RecordSelect(Call(Var("token"), Var("someint")), "id")
+	mustInfer(t, unnamed, ctx, selectId, "int")
+	mustInfer(t, NewTypeEnv(unnamed), ctx, selectId, "int")
+	importer := NewTypeEnv(nil)
+	if err := importer.Import(unnamed); err != nil {
+		t.Fatal(err)
+	}
+	if !importer.IsOpaque("Token") {
+		t.Fatalf("expected opaque type to hide its underlying type within importing environments")
+	}
+	if _, err := unnamed.Freeze(); err != nil {
+		t.Fatal(err)
+	}
+	mustInfer(t, unnamed, ctx, selectId, "int")
+	mustInfer(t, NewTypeEnv(unnamed), ctx, selectId, "int")
+}
+
 func TestRecursiveTypes(t *testing.T) {
 	env := NewTypeEnv(nil)
 	ctx := NewContext()
@@ -401,6 +726,87 @@ func TestRecursiveTypes(t *testing.T) {
 	mustInfer(t, env, ctx, expr, "string")
 }
 
+func TestDataTypes(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	intType := TConst("int")
+	env.Declare("someint", intType)
+
+	a := env.NewGenericVar()
+	list, err := env.DeclareDataType("list", []*types.Var{a},
+		DataConstructor{Name: "Nil"},
+		DataConstructor{Name: "Cons", Fields: []types.Type{a, TApp(TConst("list"), a)}, Labels: []string{"head", "tail"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.LookupDataType("list") != list {
+		t.Fatalf("expected declared data type")
+	}
+
+	mustInfer(t, env, ctx, Var("Nil"), "list['a]")
+	mustInfer(t, env, ctx, Var("Cons"), "('a, list['a]) -> list['a]")
+	mustInfer(t, env, ctx, Call(Var("Cons"), Var("someint"), Var("Nil")), "list[int]")
+	mustInfer(t, env, ctx, Call(Var("Cons"), Var("someint"), Call(Var("Cons"), Var("someint"), Var("Nil"))), "list[int]")
+
+	// let head_or = fn (xs, x) -> match xs { :Cons c -> c.head | :Nil _ -> x }
+	headOr := Func2("xs", "x", Match(Var("xs"),
+		[]ast.MatchCase{
+			{Label: "Cons", Var: "c", Value: RecordSelect(Var("c"), "head")},
+			{Label: "Nil", Var: "_", Value: Var("x")},
+		}, nil))
+	mustInfer(t, env, ctx, headOr, "([Cons : {head : 'a | 'b}, Nil : 'c], 'a) -> 'a")
+	mustInfer(t, env, ctx, Call(headOr, Call(Var("Cons"), Var("someint"), Var("Nil")), Var("someint")), "int")
+	tail := Match(Call(Var("Cons"), Var("someint"), Var("Nil")),
+		[]ast.MatchCase{
+			{Label: "Cons", Var: "c", Value: RecordSelect(Var("c"), "tail")},
+			{Label: "Nil", Var: "_", Value: Var("Nil")},
+		}, nil)
+	mustInfer(t, env, ctx, tail, "list[int]")
+
+	// nominal data types do not unify with other data types of the same structure:
+	b := env.NewGenericVar()
+	if _, err = env.DeclareDataType("stack", []*types.Var{b},
+		DataConstructor{Name: "Empty"},
+		DataConstructor{Name: "Push", Fields: []types.Type{b, TApp(TConst("stack"), b)}, Labels: []string{"head", "tail"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ctx.Infer(Call(Var("Cons"), Var("someint"), Var("Empty")), env); err == nil {
+		t.Fatalf("expected nominal data types not to unify")
+	}
+
+	// mutually-recursive data types:
+	c := env.NewGenericVar()
+	if _, err = env.DeclareDataTypeGroup(
+		DataTypeDecl{Name: "tree", Params: []*types.Var{c}, Constructors: []DataConstructor{
+			{Name: "Node", Fields: []types.Type{c, TApp(TConst("forest"), c)}},
+		}},
+		DataTypeDecl{Name: "forest", Params: []*types.Var{c}, Constructors: []DataConstructor{
+			{Name: "Leaf"},
+			{Name: "Trees", Fields: []types.Type{TApp(TConst("tree"), c), TApp(TConst("forest"), c)}},
+		}},
+	); err != nil {
+		t.Fatal(err)
+	}
+	mustInfer(t, env, ctx, Var("Node"), "('a, forest['a]) -> tree['a]")
+	node := Call(Var("Node"), Var("someint"), Call(Var("Trees"), Call(Var("Node"), Var("someint"), Var("Leaf")), Var("Leaf")))
+	mustInfer(t, env, ctx, node, "tree[int]")
+	mustInfer(t, env, ctx, Match(node, []ast.MatchCase{{Label: "Node", Var: "n", Value: RecordSelect(Var("n"), "_1")}}, nil), "forest[int]")
+
+	// invalid declarations:
+	d := env.NewGenericVar()
+	if _, err = env.DeclareDataType("nested", []*types.Var{d},
+		DataConstructor{Name: "Nested", Fields: []types.Type{TApp(TConst("nested"), TApp(TConst("list"), d))}}); err == nil {
+		t.Fatalf("expected error for non-regular data type")
+	}
+	if _, err = env.DeclareDataType("bad", nil, DataConstructor{Name: "Bad", Fields: []types.Type{TApp(TConst("list"))}}); err == nil {
+		t.Fatalf("expected kind error for constructor field")
+	}
+	if _, err = env.DeclareDataType("list", nil, DataConstructor{Name: "Other"}); err == nil {
+		t.Fatalf("expected error for duplicate data type")
+	}
+}
+
 func TestMutuallyRecursiveTypes(t *testing.T) {
 	env := NewTypeEnv(nil)
 	ctx := NewContext()
@@ -478,6 +884,99 @@ func TestGenericMutuallyRecursiveTypes(t *testing.T) {
 	mustInfer(t, env, ctx, expr, "cycle[bool, int]")
 }
 
+func TestRecursiveEquivalence(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	newList := func(env *TypeEnv, tail string) *types.Recursive {
+		return env.NewSimpleRecursive([]*types.Var{env.NewGenericVar()}, func(rec *types.Recursive, self *types.RecursiveLink) {
+			a := rec.Params[0]
+			rec.AddType("list", TAlias(TApp(TConst("list"), a),
+				TRecordFlat(map[string]types.Type{"head": a, tail: self})))
+		})
+	}
+
+	// lists declared independently within separate type-environments:
+	listA, listB := newList(env, "tail"), newList(NewTypeEnv(nil), "tail")
+	if listA.Matches(listB) || !types.RecursiveEquivalent(listA, listB) {
+		t.Fatalf("expected structurally equivalent recursive types")
+	}
+	if types.HashRecursive(listA) != types.HashRecursive(listB) {
+		t.Fatalf("expected equal hashes for structurally equivalent recursive types")
+	}
+
+	env.Declare("xs", listA.WithParams(env, TConst("int")).GetType("list"))
+	env.Declare("length", TArrow1(listB.WithParams(env, env.NewGenericVar()).GetType("list"), TConst("int")))
+	mustInfer(t, env, ctx, Call(Var("length"), Var("xs")), "int")
+	mustInfer(t, env, ctx, RecordSelect(RecordSelect(Var("xs"), "tail"), "head"), "int")
+
+	// lists declared within a child type-environment will be interned as the canonical list:
+	child := NewTypeEnv(env)
+	listC := newList(child, "tail")
+	if !listC.Matches(listA) || listC.Canonical != listA {
+		t.Fatalf("expected interned recursive type")
+	}
+	if listB.Canonical != listB || child.InternRecursive(listB) != listB {
+		t.Fatalf("expected recursive type to remain interned within its own type-environment")
+	}
+
+	// structurally distinct lists:
+	listD := newList(child, "next")
+	if types.RecursiveEquivalent(listA, listD) || listD.Canonical != listD {
+		t.Fatalf("expected structurally distinct recursive types")
+	}
+	child.Declare("ys", listD.WithParams(child, TConst("int")).GetType("list"))
+	if _, err := ctx.Infer(Call(Var("length"), Var("ys")), child); err == nil {
+		t.Fatalf("expected error for structurally distinct recursive types")
+	}
+}
+
+func TestEquiRecursiveTypes(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	env.Declare("someint", TConst("int"))
+
+	// fn (o) -> o.self(o)
+	selfApply := Func1("o", Call(RecordSelect(Var("o"), "self"), Var("o")))
+	if _, err := ctx.Infer(selfApply, env); err == nil || !strings.Contains(err.Error(), "Implicitly recursive types") {
+		t.Fatalf("expected implicitly recursive type error, found: %v", err)
+	}
+
+	ctx.EnableEquiRecursiveTypes(true)
+	mustInfer(t, env, ctx, selfApply, "{self : ({self : 'a -> 'b | 'c} as 'a) -> 'b | 'c} -> 'b")
+
+	// fn (x) -> x(x)
+	mustInfer(t, env, ctx, Func1("x", Call(Var("x"), Var("x"))), "(('a -> 'b as 'a) -> 'b) -> 'b")
+
+	// let f = fn (o) -> o.self(o) in f({self = fn (o) -> someint})
+	obj := RecordExtend(nil, LabelValue("self", Func1("o", Var("someint"))))
+	mustInfer(t, env, ctx, Let("f", selfApply, Call(Var("f"), obj)), "int")
+
+	// generalized equi-recursive types are instantiated for each use:
+	var expr ast.Expr = Let("f", selfApply,
+		RecordExtend(nil,
+			LabelValue("a", Call(Var("f"), obj)),
+			LabelValue("b", Call(Var("f"), RecordExtend(nil, LabelValue("self", Func1("o", Var("o")))))),
+		))
+	mustInfer(t, env, ctx, expr, "{a : int, b : ({self : ({self : 'b -> 'a} as 'b) -> 'a} as 'a)}")
+
+	// equi-recursive types unify coinductively:
+	// fn (x, y) -> let _ = x(x) in let _ = y(y) in same(x, y)
+	a := env.NewGenericVar()
+	env.Declare("same", TArrow2(a, a, a))
+	expr = Func2("x", "y",
+		Let("_", Call(Var("x"), Var("x")),
+			Let("_", Call(Var("y"), Var("y")),
+				Call(Var("same"), Var("x"), Var("y")))))
+	mustInfer(t, env, ctx, expr, "(('a -> 'b as 'a) -> 'b, ('c -> 'b as 'c) -> 'b) -> ('a -> 'b as 'a) -> 'b")
+
+	// binders are only in scope within their `(... as 'a)` form:
+	// fn (x) -> let _ = x(x) in x
+	expr = Func1("x", Let("_", Call(Var("x"), Var("x")), Var("x")))
+	mustInfer(t, env, ctx, expr, "(('a -> 'b as 'a) -> 'b) -> ('a -> 'b as 'a) -> 'b")
+}
+
 func TestRecursiveLet(t *testing.T) {
 	env := NewTypeEnv(nil)
 	ctx := NewContext()
@@ -900,6 +1399,108 @@ func TestHigherKindedTypes(t *testing.T) {
 	}
 }
 
+func TestKinds(t *testing.T) {
+	env := NewTypeEnv(nil)
+
+	intType := env.DeclareKind("int", types.Star)
+	list := env.DeclareKind("List", types.NewConstructorKind(types.Star))
+
+	kindOf := func(t types.Type) (string, error) {
+		k, err := env.CheckKind(t)
+		if err != nil {
+			return "", err
+		}
+		return types.KindString(k), nil
+	}
+	for _, tc := range []struct {
+		t    types.Type
+		kind string
+	}{
+		{TApp(list, intType), "*"},
+		{list, "* -> *"},
+		{TConst("ref"), "* -> *"},
+		{TSize(8), "size"},
+		{TApp(TConst("array"), intType, TSize(8)), "*"},
+		{TRowExtend(nil, TypeMap(map[string]types.Type{"a": intType})), "row"},
+		{TArrow1(TApp(list, env.NewGenericVar()), intType), "*"},
+	} {
+		kind, err := kindOf(tc.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kind != tc.kind {
+			t.Fatalf("kind of %s: %s", types.TypeString(tc.t), kind)
+		}
+	}
+
+	for _, bad := range []types.Type{
+		TApp(intType, intType),
+		TApp(list, list),
+		TApp(list, intType, intType),
+		TArrow1(list, intType),
+		TRecord(intType),
+	} {
+		if _, err := env.CheckKind(bad); err == nil {
+			t.Fatalf("expected kind error for %s", types.TypeString(bad))
+		} else if _, ok := err.(*KindError); !ok {
+			t.Fatalf("expected kind error, found: %s", err.Error())
+		}
+	}
+
+	// inferred kinds of undeclared type constructors must be consistent within a type:
+	if _, err := env.CheckKind(TArrow1(TApp(TConst("Vec"), intType), TConst("Vec"))); err == nil {
+		t.Fatalf("expected kind error for inconsistent type constructor")
+	}
+
+	if err := env.DeclareChecked("bad", TArrow1(list, intType)); err == nil {
+		t.Fatalf("expected kind error for declaration")
+	}
+	if env.Lookup("bad") != nil {
+		t.Fatalf("unexpected declaration of ill-kinded type")
+	}
+	if err := env.DeclareChecked("list_len", TArrow1(TApp(list, env.NewGenericVar()), intType)); err != nil {
+		t.Fatal(err)
+	}
+
+	// type-class parameters:
+	Functor, err := env.DeclareTypeClass("Functor", func(f *types.Var) types.MethodSet {
+		f.SetWeak()
+		f.RestrictConstVar()
+		a, b := env.NewGenericVar(), env.NewGenericVar()
+		return types.MethodSet{
+			"fmap": TArrow2(TArrow1(a, b), TApp(f, a), TApp(f, b)),
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if types.KindString(Functor.ParamKind) != "* -> *" {
+		t.Fatalf("Functor kind: %s", types.KindString(Functor.ParamKind))
+	}
+	if _, err = env.DeclareTypeClass("Bad", func(param *types.Var) types.MethodSet {
+		return types.MethodSet{
+			"bad": TArrow1(param, intType),
+		}
+	}, Functor); err == nil {
+		t.Fatalf("expected kind error for super-class parameter")
+	}
+	if env.LookupTypeClass("Bad") != nil {
+		t.Fatalf("unexpected declaration of ill-kinded type-class")
+	}
+
+	env.Declare("int_map", TArrow2(TArrow1(intType, intType), intType, intType))
+	if _, err = env.DeclareInstance(Functor, intType, map[string]string{"fmap": "int_map"}); err == nil {
+		t.Fatalf("expected kind error for instance")
+	} else if _, ok := err.(*KindError); !ok {
+		t.Fatalf("expected kind error, found: %s", err.Error())
+	}
+	a, b := env.NewGenericVar(), env.NewGenericVar()
+	env.Declare("list_map", TArrow2(TArrow1(a, b), TApp(list, a), TApp(list, b)))
+	if _, err = env.DeclareInstance(Functor, list, map[string]string{"fmap": "list_map"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestUnionTypeClasses(t *testing.T) {
 	env := NewTypeEnv(nil)
 	ctx := NewContext()
@@ -988,66 +1589,543 @@ func TestDeferredInstanceMatching(t *testing.T) {
 	}
 }
 
-func TestConstraints(t *testing.T) {
-	env := NewTypeEnv(nil)
-	ctx := NewContext()
+func TestInstanceIndex(t *testing.T) {
+	list, pair, option := TConst("List"), TConst("Pair"), TConst("Option")
+	intType, boolType := TConst("int"), TConst("bool")
+	Super := types.NewTypeClass(1, "Super", TVar(0, types.TopLevel), nil)
+	Sub := types.NewTypeClass(2, "Sub", TVar(0, types.TopLevel), nil)
+	Super.AddSubClass(Sub)
+
+	instances := []*types.Instance{
+		Super.AddInstance(TApp(list, TApp(pair, intType, TVar(1, 1))), nil, nil),
+		Super.AddInstance(TApp(list, TApp(pair, boolType, TVar(1, 1))), nil, nil),
+		Super.AddInstance(TApp(list, TVar(1, 1)), nil, nil),
+		Super.AddInstance(TApp(list, TApp(option, intType)), nil, nil),
+		Super.AddInstance(TRecordFlat(map[string]types.Type{"x": intType}), nil, nil),
+		Super.AddInstance(TRecord(TRowExtend(TVar(1, 1), TypeMap(map[string]types.Type{"x": intType}))), nil, nil),
+		Super.AddInstance(TRecordFlat(map[string]types.Type{"x": boolType, "y": intType}), nil, nil),
+		Super.AddInstance(TApp(TConst("Map"), intType), nil, nil),
+		Sub.AddInstance(TApp(list, TApp(pair, intType, TVar(1, 1))), nil, nil),
+	}
+	match := func(param types.Type, expected ...int) {
+		t.Helper()
+		var visited []int
+		Super.MatchInstance(param, func(inst *types.Instance) bool {
+			for i := range instances {
+				if instances[i] == inst {
+					visited = append(visited, i)
+				}
+			}
+			return false
+		})
+		if !reflect.DeepEqual(visited, expected) {
+			t.Fatalf("expected instances %v for %s, found %v", expected, types.TypeString(param), visited)
+		}
+	}
 
-	// type hierarchy
+	match(TApp(list, TApp(pair, intType, TConst("string"))), 8, 0, 2)
+	match(TApp(list, TApp(pair, TVar(2, 1), intType)), 8, 0, 1, 2)
+	match(TApp(list, TApp(option, boolType)), 2)
+	match(TApp(list, TApp(option, TVar(2, 1))), 2, 3)
+	match(TRecordFlat(map[string]types.Type{"x": intType}), 4, 5)
+	match(TRecordFlat(map[string]types.Type{"x": intType, "y": intType}), 5)
+	match(TRecord(TRowExtend(TVar(2, 1), TypeMap(map[string]types.Type{"x": TVar(3, 1)}))), 4, 5, 6)
+	match(TRecord(TRowExtend(TVar(2, 1), TypeMap(map[string]types.Type{"y": intType}))), 5, 6)
+	match(TApp(TConst("Map"), boolType))
 
-	intType, shortType, floatType, boolType := TConst("int"), TConst("short"), TConst("float"), TConst("bool")
-	intVecType := TApp(TConst("vec"), intType)
+	Super.RemoveInstance(instances[2])
+	match(TApp(list, TApp(option, boolType)))
+	match(TApp(list, TApp(option, intType)), 3)
+}
 
-	Add, err := env.DeclareTypeClass("Add", func(param *types.Var) types.MethodSet {
-		return types.MethodSet{
-			"+": TArrow2(param, param, param),
-		}
+func TestExplainInstance(t *testing.T) {
+	env := NewTypeEnv(nil)
+
+	objA := TRecordFlat(map[string]types.Type{"x": TConst("A")})
+	objB := TRecordFlat(map[string]types.Type{"x": TConst("B")})
+
+	HasX, err := env.DeclareUnionTypeClass("HasX", nil, map[string]types.Type{
+		"A": objA,
+		"B": objB,
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
-	adderVecType := TApp(TConst("vec"), env.NewQualifiedVar(types.InstanceConstraint{Add}))
-	if types.TypeString(adderVecType) != "Add 'a => vec['a]" {
-		t.Fatalf("invalid vec string: %s", types.TypeString(adderVecType))
+
+	res := env.ExplainInstance(HasX, objA)
+	if res.Err != nil || res.Selected == nil || types.TypeString(res.Selected.Param) != "{x : A}" {
+		t.Fatalf("expected selected instance: %s", res)
+	}
+	if len(res.Candidates) != 2 || len(res.Classes) != 1 {
+		t.Fatalf("expected 2 visited instances: %s", res)
 	}
 
-	Int, err := env.DeclareTypeClass("Int", func(param *types.Var) types.MethodSet {
-		return types.MethodSet{
-			"&": TArrow2(param, param, param),
+	res = env.ExplainInstance(HasX, TRecordFlat(map[string]types.Type{"x": TConst("C")}))
+	if res.Selected != nil || res.Err == nil || !strings.Contains(res.Err.Error(), "No matching instance") {
+		t.Fatalf("expected missing instance: %s", res)
+	}
+	for _, c := range res.Candidates {
+		if c.Unified || c.UnifyErr == nil {
+			t.Fatalf("expected unification errors: %s", res)
 		}
-	}, Add) // implements/subsumes Add
-	if err != nil {
-		t.Fatal(err)
 	}
 
-	env.Declare("int_add", TArrow2(intType, intType, intType))
-	env.Declare("int_and", TArrow2(intType, intType, intType))
-	env.Declare("short_add", TArrow2(shortType, shortType, shortType))
-	env.Declare("short_and", TArrow2(shortType, shortType, shortType))
-	env.Declare("float_add", TArrow2(floatType, floatType, floatType))
-	env.Declare("vec_add", TArrow2(adderVecType, adderVecType, adderVecType))
-	env.Declare("int_vec_add", TArrow2(intVecType, intVecType, intVecType))
-	env.Declare("bad_bool_add", TArrow2(boolType, intType, boolType))
-
-	if _, err := env.DeclareInstance(Int, intType, map[string]string{"+": "int_add", "&": "int_and"}); err != nil {
-		t.Fatal(err)
+	res = env.ExplainInstance(HasX, TRecordFlat(map[string]types.Type{"x": env.NewGenericVar()}))
+	if !res.Overlapping || res.Candidates[1].OverlapsWith != res.Candidates[0].Instance {
+		t.Fatalf("expected overlapping instances: %s", res)
 	}
-	if _, err := env.DeclareInstance(Int, shortType, map[string]string{"+": "short_add", "&": "short_and"}); err != nil {
-		t.Fatal(err)
+	if !strings.Contains(res.String(), "Instance cannot be determined from the context") {
+		t.Fatalf("expected context error: %s", res)
 	}
-	if _, err := env.DeclareInstance(Add, floatType, map[string]string{"+": "float_add"}); err != nil {
+
+	res = env.ExplainInstance(HasX, env.NewGenericVar())
+	if !res.Propagated || res.Err != nil {
+		t.Fatalf("expected propagated constraint: %s", res)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	Show, err := env.DeclareTypeClass("Show", func(param *types.Var) types.MethodSet {
+		return types.MethodSet{"show": TArrow1(param, TConst("string"))}
+	})
+	if err != nil {
 		t.Fatal(err)
 	}
-	if _, err := env.DeclareInstance(Add, adderVecType, map[string]string{"+": "vec_add"}); err != nil {
+	env.Declare("show_int", TArrow1(TConst("int"), TConst("string")))
+	if _, err = env.DeclareInstance(Show, TConst("int"), map[string]string{"show": "show_int"}); err != nil {
 		t.Fatal(err)
 	}
-	// detect overlapping instances:
-	if _, err := env.DeclareInstance(Add, intVecType, map[string]string{"+": "int_vec_add"}); err == nil {
-		t.Fatalf("expected instance-overlap error")
+	env.Declare("one", TConst("int"))
+	expr := Let("id", Func1("x", Var("x")), Call(Var("show"), Call(Var("id"), Var("one"))))
+
+	var log strings.Builder
+	tracer := NewTracer(&log)
+	ctx.SetObserver(tracer)
+	if _, err := ctx.Infer(expr, env); err != nil || tracer.Err() != nil {
+		t.Fatal(err, tracer.Err())
+	}
+	for _, expected := range []string{
+		"Let: let id(x) = x in show(id(one)) (level 1)\n",
+		"\n  Func: fn (x) -> x (level 2)\n    Var: x (level 2)\n      lookup x : '_4\n    Var : '_4\n",
+		"\n  generalize at level 1: 'a -> 'a\n",
+		"\n      Var: id (level 1)\n        lookup id : 'a -> 'a\n        instantiate 'a -> 'a => '_6 -> '_6\n",
+		"\n    unify Show '_5 => '_5 ~ int\n    select Show instance int for int\n      => int\n",
+		"\nLet : string\ngeneralize at level 0: string\n",
+	} {
+		if !strings.Contains(log.String(), expected) {
+			t.Fatalf("expected %q in trace:\n%s", expected, log.String())
+		}
 	}
 
-	env.Declare("somebool", boolType)
-	env.Declare("someint", intType)
-	env.Declare("someshort", shortType)
+	var stream strings.Builder
+	ctx.SetObserver(NewJSONTracer(&stream))
+	if _, err := ctx.Infer(Call(Var("show"), Var("show")), env); err == nil {
+		t.Fatalf("expected error")
+	}
+	ctx.SetObserver(nil)
+	lines := strings.Split(strings.TrimSpace(stream.String()), "\n")
+	depth, failed := 0, false
+	for _, line := range lines {
+		var event struct {
+			Event, Expr, Error string
+			Depth              int
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+		switch event.Event {
+		case "enter":
+			if event.Depth != depth {
+				t.Fatalf("unexpected depth for %s", line)
+			}
+			depth++
+		case "leave":
+			depth--
+			if event.Depth != depth {
+				t.Fatalf("unexpected depth for %s", line)
+			}
+		case "unified":
+			failed = failed || event.Error != ""
+		}
+	}
+	if depth != 0 || !failed || !strings.Contains(lines[len(lines)-1], `"event":"leave","depth":0,"expr":"Call","error":`) {
+		t.Fatalf("unexpected JSON events:\n%s", stream.String())
+	}
+}
+
+func TestDerivation(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	Show, err := env.DeclareTypeClass("Show", func(param *types.Var) types.MethodSet {
+		return types.MethodSet{"show": TArrow1(param, TConst("string"))}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Declare("show_int", TArrow1(TConst("int"), TConst("string")))
+	if _, err = env.DeclareInstance(Show, TConst("int"), map[string]string{"show": "show_int"}); err != nil {
+		t.Fatal(err)
+	}
+	env.Declare("one", TConst("int"))
+	expr := Let("id", Func1("x", Var("x")), Call(Var("show"), Call(Var("id"), Var("one"))))
+
+	var log strings.Builder
+	ctx.SetObserver(NewTracer(&log))
+	ctx.EnableDerivations(true)
+	if _, err := ctx.Infer(expr, env); err != nil {
+		t.Fatal(err)
+	}
+	d := ctx.Derivation()
+	if log.Len() == 0 || d == nil {
+		t.Fatalf("expected trace and derivation")
+	}
+	expected := strings.Join([]string{
+		"- **Let/Gen** `let id(x) = x in show(id(one))` : `string`",
+		"  - **Abs** `fn (x) -> x` : `'a -> 'a`",
+		"    - **Var/Inst** `x` : `'a`",
+		"      - env: `x : 'a`",
+		"  - **App** `show(id(one))` : `string`",
+		"    - **Var/Inst** `show` : `int -> string`",
+		"      - env: `show : Show 'a => 'a -> string`",
+		"    - **App** `id(one)` : `int`",
+		"      - **Var/Inst** `id` : `int -> int`",
+		"        - env: `id : 'a -> 'a`",
+		"      - **Var/Inst** `one` : `int`",
+		"        - env: `one : int`",
+		"      - unify: `'_6 ~ int`",
+		"    - unify: `Show '_5 => '_5 ~ int`",
+		"    - instance: `Show int`",
+		"  - unify: `'_3 ~ '_4 -> '_4`",
+		"  - generalize: `'a -> 'a`",
+		"  - generalize: `string`",
+		"",
+	}, "\n")
+	if d.Markdown() != expected {
+		t.Fatalf("unexpected derivation:\n%s", d.Markdown())
+	}
+
+	latex := d.LaTeX()
+	for _, expected := range []string{
+		"\\infer[\\textsc{Let/Gen}]{\\Gamma \\vdash \\texttt{let id(x) = x in show(id(one))} : \\texttt{string}}{\n",
+		"\\texttt{show : Show 'a => 'a -> string} \\in \\Gamma\n",
+		"\\texttt{'\\_6 \\textasciitilde{} int}\n",
+		"\\mathrm{gen}(\\texttt{'a -> 'a}) &\n",
+	} {
+		if !strings.Contains(latex, expected) {
+			t.Fatalf("expected %q in LaTeX derivation:\n%s", expected, latex)
+		}
+	}
+	if strings.Count(latex, "{")-strings.Count(latex, "\\{") != strings.Count(latex, "}")-strings.Count(latex, "\\}") {
+		t.Fatalf("unbalanced LaTeX derivation:\n%s", latex)
+	}
+
+	var tree struct {
+		Rule, Expr, Type string
+		Premises         []struct {
+			Rule        string
+			Constraints []struct{ Kind, Text, Instance string }
+		}
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &tree); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Rule != "Let/Gen" || tree.Type != "string" || len(tree.Premises) != 2 || tree.Premises[1].Rule != "App" ||
+		len(tree.Premises[1].Constraints) != 2 || tree.Premises[1].Constraints[1].Instance != "Show int" {
+		t.Fatalf("unexpected JSON derivation: %s", b)
+	}
+
+	// Derivations are constructed for failed inference:
+	ctx.SetObserver(nil)
+	if _, err := ctx.Infer(Call(Var("show"), Var("show")), env); err == nil {
+		t.Fatalf("expected error")
+	}
+	d = ctx.Derivation()
+	if d.Rule != "App" || d.Err == nil || len(d.Constraints) != 1 || d.Constraints[0].Err == nil {
+		t.Fatalf("unexpected derivation for failed inference:\n%s", d.Markdown())
+	}
+	ctx.EnableDerivations(false)
+	ctx.Infer(expr, env)
+	if ctx.Derivation() != nil {
+		t.Fatalf("expected no derivation")
+	}
+}
+
+func TestDeriveInstances(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	Show, err := env.DeclareTypeClass("Show", func(param *types.Var) types.MethodSet {
+		return types.MethodSet{
+			"show": TArrow1(param, TConst("string")),
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Declare("show_int", TArrow1(TConst("int"), TConst("string")))
+	if _, err = env.DeclareInstance(Show, TConst("int"), map[string]string{"show": "show_int"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var derived []*Derivation
+	env.RegisterDeriver(Show, func(d *Derivation) (map[string]string, error) {
+		derived = append(derived, d)
+		return map[string]string{"show": "show_" + strconv.Itoa(len(derived))}, nil
+	})
+
+	// record alias:
+	point := TAlias(TApp(TConst("point")), TRecordFlat(map[string]types.Type{"x": TConst("int"), "y": TConst("int")}))
+	if _, err = env.DeriveInstance(Show, point); err != nil {
+		t.Fatal(err)
+	}
+	if len(derived[0].Fields) != 2 || derived[0].Variant {
+		t.Fatalf("invalid derivation for point")
+	}
+	if s := types.TypeString(derived[0].Methods["show"]); s != "point -> string" {
+		t.Fatalf("invalid derived method type: %s", s)
+	}
+	env.Declare("somepoint", point)
+	mustInfer(t, env, ctx, Call(Var("show"), Var("somepoint")), "string")
+	mustInfer(t, env, ctx, Var("show_1"), "point -> string")
+
+	// recursive list with a nested record:
+	params := []*types.Var{env.NewGenericVar()}
+	list := env.NewSimpleRecursive(params, func(rec *types.Recursive, self *types.RecursiveLink) {
+		a := rec.Params[0]
+		rec.AddType("list", TAlias(TApp(TConst("list"), a),
+			TVariant(TRowExtend(nil, TypeMap(map[string]types.Type{"Nil": TUnit(), "Cons": TRecordFlat(map[string]types.Type{"head": a, "tail": self})})))))
+	})
+	if _, err = env.DeriveInstance(Show, list.GetType("list")); err != nil {
+		t.Fatal(err)
+	}
+	if s := types.TypeString(derived[len(derived)-1].Type); s != "Show 'a => list['a]" {
+		t.Fatalf("invalid derived instance type: %s", s)
+	}
+	env.Declare("someintlists", list.WithParams(env, TConst("int")).GetType("list"))
+	mustInfer(t, env, ctx, Call(Var("show"), Var("someintlists")), "string")
+
+	// recursive list:
+	cons := env.NewSimpleRecursive([]*types.Var{env.NewGenericVar()}, func(rec *types.Recursive, self *types.RecursiveLink) {
+		a := rec.Params[0]
+		rec.AddType("conslist", TAlias(TApp(TConst("conslist"), a),
+			TVariant(TRowExtend(nil, TypeMap(map[string]types.Type{"Nil": TConst("int"), "Cons": a, "Tail": self})))))
+	})
+	if _, err = env.DeriveInstance(Show, cons.GetType("conslist")); err != nil {
+		t.Fatal(err)
+	}
+	d := derived[len(derived)-1]
+	if !d.Variant || len(d.Fields) != 3 {
+		t.Fatalf("invalid derivation for conslist")
+	}
+	if s := types.TypeString(d.Type); s != "Show 'a => conslist['a]" {
+		t.Fatalf("invalid derived instance type: %s", s)
+	}
+	env.Declare("someintlist", cons.WithParams(env, TConst("int")).GetType("conslist"))
+	mustInfer(t, env, ctx, Call(Var("show"), Var("someintlist")), "string")
+
+	// nested lists are not recursive fields:
+	lists := TAlias(TApp(TConst("lists")), TRecordFlat(map[string]types.Type{"xs": list.WithParams(env, list.WithParams(env, TConst("int")).GetType("list")).GetType("list")}))
+	if _, err = env.DeriveInstance(Show, lists); err != nil {
+		t.Fatal(err)
+	}
+	if d = derived[len(derived)-1]; len(d.Fields) != 1 || d.Fields[0].Recursive {
+		t.Fatalf("invalid derivation for lists")
+	}
+
+	// mutually-recursive data types:
+	c := env.NewGenericVar()
+	if _, err = env.DeclareDataTypeGroup(
+		DataTypeDecl{Name: "tree", Params: []*types.Var{c}, Constructors: []DataConstructor{
+			{Name: "Node", Fields: []types.Type{c, TApp(TConst("forest"), c)}},
+		}},
+		DataTypeDecl{Name: "forest", Params: []*types.Var{c}, Constructors: []DataConstructor{
+			{Name: "Leaf"},
+			{Name: "Trees", Fields: []types.Type{TApp(TConst("tree"), c), TApp(TConst("forest"), c)}},
+		}},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = env.DeriveInstance(Show, env.LookupDataType("tree").Type); err != nil {
+		t.Fatal(err)
+	}
+	if s := types.TypeString(derived[len(derived)-1].Type); s != "Show 'a => tree['a]" {
+		t.Fatalf("invalid derived instance type: %s", s)
+	}
+	mustInfer(t, env, ctx, Call(Var("show"), Call(Var("Node"), Var("somepoint"), Var("Leaf"))), "string")
+
+	// recursive links nested deeply within the structure:
+	deep := env.NewSimpleRecursive([]*types.Var{env.NewGenericVar()}, func(rec *types.Recursive, self *types.RecursiveLink) {
+		var nested types.Type = TVariant(TRowExtend(nil, TypeMap(map[string]types.Type{"End": TUnit(), "More": self})))
+		for i := 0; i < 20; i++ {
+			nested = TRecordFlat(map[string]types.Type{"inner": nested})
+		}
+		rec.AddType("deep", TAlias(TApp(TConst("deep"), rec.Params[0]), TRecordFlat(map[string]types.Type{"value": rec.Params[0], "nested": nested})))
+	})
+	if _, err = env.DeriveInstance(Show, deep.GetType("deep")); err != nil {
+		t.Fatal(err)
+	}
+	if d = derived[len(derived)-1]; d.Variant || len(d.Fields) != 2 {
+		t.Fatalf("invalid derivation for deep")
+	}
+
+	// missing instance for a field:
+	pair := TAlias(TApp(TConst("pair")), TRecordFlat(map[string]types.Type{"x": TConst("int"), "y": TConst("bool")}))
+	if _, err = env.DeriveInstance(Show, pair); err == nil {
+		t.Fatalf("expected missing-instance error")
+	}
+
+	// overlapping instance:
+	if _, err = env.DeriveInstance(Show, point); err == nil {
+		t.Fatalf("expected overlapping-instance error")
+	}
+	if env.Lookup("show_"+strconv.Itoa(len(derived))) != nil {
+		t.Fatalf("expected implementations of overlapping instance not to be declared")
+	}
+}
+
+func TestInstanceCoherence(t *testing.T) {
+	prelude := NewTypeEnv(nil)
+	prelude.Module = "prelude"
+	ctx := NewContext()
+
+	Show, err := prelude.DeclareTypeClass("Show", func(param *types.Var) types.MethodSet {
+		return types.MethodSet{
+			"show": TArrow1(param, TConst("string")),
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prelude.Declare("show_int", TArrow1(TConst("int"), TConst("string")))
+	if _, err = prelude.DeclareInstance(Show, TConst("int"), map[string]string{"show": "show_int"}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := NewTypeEnv(prelude), NewTypeEnv(prelude)
+	a.Module, b.Module = "a", "b"
+	for _, env := range []*TypeEnv{a, b} {
+		point := env.DeclareTypeConstructor("point")
+		env.Declare("somepoint", point)
+		env.Declare("show_point", TArrow1(point, TConst("string")))
+		if _, err = env.DeclareInstance(Show, point, map[string]string{"show": "show_point"}); err != nil {
+			t.Fatal(err)
+		}
+		mustInfer(t, env, ctx, Call(Var("show"), Var("somepoint")), "string")
+	}
+
+	// instances are not visible within parent environments:
+	prelude.Declare("somepoint", TConst("point"))
+	if _, err = ctx.Infer(Call(Var("show"), Var("somepoint")), prelude); err == nil {
+		t.Fatalf("expected missing instance within parent environment")
+	}
+
+	// orphan instances:
+	a.Declare("show_bool", TArrow1(TConst("bool"), TConst("string")))
+	if _, err = a.DeclareInstance(Show, TConst("bool"), map[string]string{"show": "show_bool"}); err == nil {
+		t.Fatalf("expected orphan instance error")
+	}
+	if !strings.Contains(err.Error(), "Orphan instance") {
+		t.Fatalf("expected orphan instance error, found: %s", err.Error())
+	}
+
+	// failed instances are removed from the type-class:
+	a.DeclareTypeConstructor("bad")
+	a.Declare("show_bad", TArrow1(TConst("bad"), TConst("int")))
+	if _, err = a.DeclareInstance(Show, TConst("bad"), map[string]string{"show": "show_bad"}); err == nil {
+		t.Fatalf("expected invalid-instance error")
+	}
+	if len(Show.Instances) != 3 {
+		t.Fatalf("expected 3 instances, found %d", len(Show.Instances))
+	}
+	a.Declare("somebad", TConst("bad"))
+	if _, err = ctx.Infer(Call(Var("show"), Var("somebad")), a); err == nil {
+		t.Fatalf("expected missing instance for removed instance")
+	}
+
+	// combining environments:
+	c := NewTypeEnv(prelude)
+	if err = c.Import(a); err != nil {
+		t.Fatal(err)
+	}
+	err = c.Import(b)
+	coherenceErr, ok := err.(*CoherenceError)
+	if !ok {
+		t.Fatalf("expected coherence error, found: %v", err)
+	}
+	if len(coherenceErr.Conflicts) != 1 || types.TypeString(coherenceErr.Conflicts[0].Imported.Param) != "point" {
+		t.Fatalf("unexpected conflicts: %s", coherenceErr.Error())
+	}
+	mustInfer(t, c, ctx, Call(Var("show"), Var("somepoint")), "string")
+}
+
+func TestConstraints(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	// type hierarchy
+
+	intType, shortType, floatType, boolType := TConst("int"), TConst("short"), TConst("float"), TConst("bool")
+	intVecType := TApp(TConst("vec"), intType)
+
+	Add, err := env.DeclareTypeClass("Add", func(param *types.Var) types.MethodSet {
+		return types.MethodSet{
+			"+": TArrow2(param, param, param),
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adderVecType := TApp(TConst("vec"), env.NewQualifiedVar(types.InstanceConstraint{Add}))
+	if types.TypeString(adderVecType) != "Add 'a => vec['a]" {
+		t.Fatalf("invalid vec string: %s", types.TypeString(adderVecType))
+	}
+
+	Int, err := env.DeclareTypeClass("Int", func(param *types.Var) types.MethodSet {
+		return types.MethodSet{
+			"&": TArrow2(param, param, param),
+		}
+	}, Add) // implements/subsumes Add
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.Declare("int_add", TArrow2(intType, intType, intType))
+	env.Declare("int_and", TArrow2(intType, intType, intType))
+	env.Declare("short_add", TArrow2(shortType, shortType, shortType))
+	env.Declare("short_and", TArrow2(shortType, shortType, shortType))
+	env.Declare("float_add", TArrow2(floatType, floatType, floatType))
+	env.Declare("vec_add", TArrow2(adderVecType, adderVecType, adderVecType))
+	env.Declare("int_vec_add", TArrow2(intVecType, intVecType, intVecType))
+	env.Declare("bad_bool_add", TArrow2(boolType, intType, boolType))
+
+	if _, err := env.DeclareInstance(Int, intType, map[string]string{"+": "int_add", "&": "int_and"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DeclareInstance(Int, shortType, map[string]string{"+": "short_add", "&": "short_and"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DeclareInstance(Add, floatType, map[string]string{"+": "float_add"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DeclareInstance(Add, adderVecType, map[string]string{"+": "vec_add"}); err != nil {
+		t.Fatal(err)
+	}
+	// detect overlapping instances:
+	if _, err := env.DeclareInstance(Add, intVecType, map[string]string{"+": "int_vec_add"}); err == nil {
+		t.Fatalf("expected instance-overlap error")
+	}
+
+	env.Declare("somebool", boolType)
+	env.Declare("someint", intType)
+	env.Declare("someshort", shortType)
 	env.Declare("somefloat", floatType)
 	env.Declare("someintvec", TApp(TConst("vec"), intType))
 	env.Declare("somefloatvec", TApp(TConst("vec"), floatType))
@@ -1142,3 +2220,685 @@ func TestConstraints(t *testing.T) {
 		t.Fatalf("expected invalid-method error")
 	}
 }
+
+func TestEffects(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	env.Declare("print", &types.Arrow{Args: []types.Type{TConst("string")}, Return: types.UnitPointer, Effects: TEffects(nil, "io")})
+	env.Declare("msg", TConst("string"))
+	env.Declare("counter", TRef(TConst("int")))
+	env.Declare("name", TRef(TConst("string")))
+
+	// Effects are not inferred by default:
+	mustInfer(t, env, ctx, Func1("x", Deref(Var("counter"))), "'a -> int")
+	if ctx.Effects() != types.RowEmptyPointer {
+		t.Fatalf("expected no effects at the root")
+	}
+
+	ctx.EnableEffects(true)
+	mustInfer(t, env, ctx, Func1("x", Deref(Var("counter"))), "'a -> int ! <read | 'b>")
+	mustInfer(t, env, ctx, Func1("x", DerefAssign(Var("counter"), Var("x"))), "int -> ref[int] ! <write | 'a>")
+	mustInfer(t, env, ctx, Func1("x", Call(Var("print"), Deref(Var("name")))), "'a -> () ! <io, read | 'b>")
+	mustInfer(t, env, ctx, Func1("x", Var("x")), "'a -> 'a")
+
+	// Effects of a called function propagate to the caller:
+	apply := Func2("f", "x", Call(Var("f"), Var("x")))
+	mustInfer(t, env, ctx, apply, "('a -> 'b ! <| 'c>, 'a) -> 'b ! <| 'c>")
+	expr := Let("apply", apply, Func1("x", Call(Var("apply"), Var("print"), Var("x"))))
+	mustInfer(t, env, ctx, expr, "string -> () ! <io | 'a>")
+
+	// Untracked effects of declared functions are instantiated as effect rows for each use:
+	a, b := env.NewGenericVar(), env.NewGenericVar()
+	env.Declare("apply", TArrow2(TArrow1(a, b), a, b))
+	mustInfer(t, env, ctx, Func1("x", Call(Var("apply"), Var("print"), Var("x"))), "string -> () ! <io | 'a>")
+	mustInfer(t, env, ctx, Var("apply"), "('a -> 'b ! <| 'c>, 'a) -> 'b ! <| 'c>")
+
+	// First-order functions declared without effects are not instantiated:
+	env.Declare("add", TArrow2(TConst("int"), TConst("int"), TConst("int")))
+	if ty, err := ctx.Infer(Var("add"), env); err != nil || ty != env.Lookup("add") {
+		t.Fatalf("expected the declared type of a first-order function to be shared, found %v", ty)
+	}
+
+	// Effects of the root expression are tracked separately:
+	mustInfer(t, env, ctx, Call(Var("print"), Var("msg")), "()")
+	labels, _ := types.EffectLabels(ctx.Effects())
+	if len(labels) != 1 || labels[0] != "io" {
+		t.Fatalf("expected io effect at the root, found %v", labels)
+	}
+
+	fn := Func1("x", DerefAssign(Var("name"), Var("x")))
+	annotated, err := ctx.Annotate(fn, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels, _ = types.EffectLabels(annotated.(*ast.Func).Effects())
+	if len(labels) != 1 || labels[0] != types.WriteEffect {
+		t.Fatalf("expected write effect for the annotated function, found %v", labels)
+	}
+}
+
+func TestRelaxedValueRestriction(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+	ctx.EnableEffects(true)
+
+	a := env.NewGenericVar()
+	env.Declare("new", TArrow(nil, TRef(a)))
+	a = env.NewGenericVar()
+	env.Declare("make_list", TArrow(nil, TApp(TConst("list"), a)))
+	a = env.NewGenericVar()
+	env.Declare("make_cell", TArrow(nil, TApp(TConst("cell"), a)))
+	a = env.NewGenericVar()
+	env.Declare("set", TArrow2(TApp(TConst("cell"), a), a, TUnit()))
+	a, b := env.NewGenericVar(), env.NewGenericVar()
+	env.Declare("pair", TArrow2(a, b, TApp(TConst("pair"), a, b)))
+	env.Declare("1", TConst("int"))
+	env.Declare("true", TConst("bool"))
+
+	// Functions are values, so type-variables within mutable reference-types are generalized:
+	mustInfer(t, env, ctx, Func1("r", Deref(Var("r"))), "ref['a] -> 'a ! <read | 'b>")
+	mustInfer(t, env, ctx, Func2("r", "x", DerefAssign(Var("r"), Var("x"))), "(ref['a], 'a) -> ref['a] ! <write | 'b>")
+
+	// Type-variables which only occur covariantly are generalized for expansive expressions:
+	mustInfer(t, env, ctx, Call(Var("make_list")), "list['a]")
+	mustInfer(t, env, ctx, Let("xs", Call(Var("make_list")), Call(Var("pair"), Var("xs"), Var("xs"))), "pair[list['a], list['b]]")
+
+	// Type-variables within mutable reference-types are not generalized for expansive expressions:
+	mustInferWeak(t, env, ctx, Call(Var("new")), "ref")
+	expr := Let("r", Call(Var("new")), Call(Var("pair"), DerefAssign(Var("r"), Var("1")), DerefAssign(Var("r"), Var("true"))))
+	if _, err := ctx.Infer(expr, env); err == nil {
+		t.Fatalf("expected an error for a mutable reference assigned different types")
+	}
+
+	if err := env.DeclareVariance("cell", types.Invariant); err != nil {
+		t.Fatal(err)
+	}
+	if vs := env.LookupVariance("cell"); len(vs) != 1 || vs[0] != types.Invariant {
+		t.Fatalf("expected an invariant parameter for cell, found %v", vs)
+	}
+	mustInferWeak(t, env, ctx, Call(Var("make_cell")), "cell")
+	expr = Let("c", Call(Var("make_cell")), Call(Var("pair"), Call(Var("set"), Var("c"), Var("1")), Call(Var("set"), Var("c"), Var("true"))))
+	if _, err := ctx.Infer(expr, env); err == nil {
+		t.Fatalf("expected an error for an invariant cell assigned different types")
+	}
+
+	env.DeclareKind("box", types.NewConstructorKind(types.Star))
+	if err := env.DeclareVariance("box", types.Covariant, types.Covariant); err == nil {
+		t.Fatalf("expected an error for mismatched variances")
+	}
+}
+
+func TestReadOnlyRefs(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+	ctx.EnableEffects(true)
+
+	a := env.NewGenericVar()
+	env.Declare("new", TArrow(nil, TRef(a)))
+	a = env.NewGenericVar()
+	env.Declare("new_readonly", TArrow(nil, TReadRef(a)))
+	a = env.NewGenericVar()
+	env.Declare("read", TArrow1(TReadRef(a), a))
+	env.Declare("counter", TRef(TConst("int")))
+	env.Declare("view", TReadRef(TConst("int")))
+	env.Declare("one", TConst("int"))
+
+	mustInfer(t, env, ctx, Deref(Var("view")), "int")
+	mustInfer(t, env, ctx, Func1("x", Deref(Var("view"))), "'a -> int ! <read | 'b>")
+
+	// Mutable references are coerced to read-only references:
+	mustInfer(t, env, ctx, Call(Var("read"), Var("counter")), "int")
+	mustInfer(t, env, ctx, Call(Var("read"), Var("view")), "int")
+
+	// Unresolved references are dereferenced as mutable references, regardless of the order of dereferences and assignments:
+	mustInfer(t, env, ctx, Func1("r", Let("x", Deref(Var("r")), DerefAssign(Var("r"), Var("one")))), "ref[int] -> ref[int] ! <read, write | 'a>")
+	mustInfer(t, env, ctx, Func1("r", Let("x", DerefAssign(Var("r"), Var("one")), Deref(Var("r")))), "ref[int] -> int ! <read, write | 'a>")
+	getField := Func1("p", Deref(RecordSelect(Var("p"), "r")))
+	mustInfer(t, env, ctx, Let("f", getField, Call(Var("f"), RecordExtend(nil, LabelValue("r", Var("counter"))))), "int")
+
+	// Read-only references cannot be assigned:
+	if _, err := ctx.Infer(DerefAssign(Var("view"), Deref(Var("counter"))), env); err == nil {
+		t.Fatalf("expected an error for assignment to a read-only reference")
+	}
+	// Read-only references cannot be coerced to mutable references:
+	if _, err := ctx.Infer(DerefAssign(Call(Var("new_readonly")), Deref(Var("counter"))), env); err == nil {
+		t.Fatalf("expected an error for assignment to a read-only reference")
+	}
+
+	// Read-only references are covariant, so they do not require the value restriction:
+	mustInfer(t, env, ctx, Call(Var("new_readonly")), "readref['a]")
+	mustInferWeak(t, env, ctx, Call(Var("new")), "ref")
+}
+
+func TestExistentials(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	env.Declare("0", TConst("int"))
+	env.Declare("inc", TArrow1(TConst("int"), TConst("int")))
+	env.Declare("show", TArrow1(TConst("int"), TConst("string")))
+	env.Declare("not", TArrow1(TConst("bool"), TConst("bool")))
+	a := env.NewGenericVar()
+	env.Declare("eq", TArrow2(a, a, TConst("bool")))
+
+	a = env.NewGenericVar()
+	plugin := TExists([]*types.Var{a}, TRecord(TRowExtend(types.RowEmptyPointer, TypeMap(map[string]types.Type{
+		"state": a,
+		"step":  TArrow1(a, a),
+		"show":  TArrow1(a, TConst("string")),
+	}))))
+	value := RecordExtend(nil, LabelValue("state", Var("0")), LabelValue("step", Var("inc")), LabelValue("show", Var("show")))
+	mustInfer(t, env, ctx, Pack(value, plugin), "exists 'a. {show : 'a -> string, state : 'a, step : 'a -> 'a}")
+
+	// The hidden type must be consistent within the packed value:
+	invalid := RecordExtend(nil, LabelValue("state", Var("0")), LabelValue("step", Var("not")), LabelValue("show", Var("show")))
+	if _, err := ctx.Infer(Pack(invalid, plugin), env); err == nil {
+		t.Fatalf("expected an error for an inconsistent hidden type")
+	}
+
+	env.Declare("plugin", plugin)
+	p := Var("p")
+	expr := Unpack("p", Var("plugin"), Call(RecordSelect(p, "show"), Call(RecordSelect(p, "step"), RecordSelect(p, "state"))))
+	mustInfer(t, env, ctx, expr, "string")
+	expr = Unpack("p", Var("plugin"), Let("s", Call(RecordSelect(p, "step"), RecordSelect(p, "state")), Call(Var("eq"), Var("s"), RecordSelect(p, "state"))))
+	mustInfer(t, env, ctx, expr, "bool")
+
+	// The hidden type cannot escape the body of the unpack expression:
+	if _, err := ctx.Infer(Unpack("p", Var("plugin"), RecordSelect(p, "state")), env); err == nil {
+		t.Fatalf("expected an error for an escaping hidden type")
+	}
+	if _, err := ctx.Infer(Func1("x", Unpack("p", Var("plugin"), Call(Var("eq"), Var("x"), RecordSelect(p, "state")))), env); err == nil {
+		t.Fatalf("expected an error for a hidden type escaping through a type-variable")
+	}
+	// The hidden type is distinct from all other types:
+	if _, err := ctx.Infer(Unpack("p", Var("plugin"), Call(Var("inc"), RecordSelect(p, "state"))), env); err == nil {
+		t.Fatalf("expected an error for a hidden type used as an int")
+	}
+	// Unpacked values must have existential types:
+	if _, err := ctx.Infer(Unpack("p", Var("0"), Var("p")), env); err == nil {
+		t.Fatalf("expected an error for unpacking a non-existential value")
+	}
+
+	// Existential types are equivalent up to renaming of quantified type-variables:
+	b := env.NewGenericVar()
+	other := TExists([]*types.Var{b}, TRecord(TRowExtend(types.RowEmptyPointer, TypeMap(map[string]types.Type{
+		"state": b,
+		"step":  TArrow1(b, b),
+		"show":  TArrow1(b, TConst("string")),
+	}))))
+	a = env.NewGenericVar()
+	env.Declare("pair", TArrow2(a, a, TApp(TConst("list"), a)))
+	mustInfer(t, env, ctx, Call(Var("pair"), Var("plugin"), Pack(value, other)), "list[exists 'a. {show : 'a -> string, state : 'a, step : 'a -> 'a}]")
+}
+
+func TestLimits(t *testing.T) {
+	env := NewTypeEnv(nil)
+	ctx := NewContext()
+
+	env.Declare("1", TConst("int"))
+	a := env.NewGenericVar()
+	env.Declare("dup", TArrow1(a, TApp(TConst("pair"), a, a)))
+
+	// Types double in depth with each nested let-binding:
+	//
+	//   let f0 = fn (x) -> dup(x) in let f1 = fn (x) -> f0(f0(x)) in ... fN(1)
+	nested := func(n int) ast.Expr {
+		var expr ast.Expr = Call(Var("f"+strconv.Itoa(n)), Var("1"))
+		for i := n; i > 0; i-- {
+			f := Var("f" + strconv.Itoa(i-1))
+			expr = Let("f"+strconv.Itoa(i), Func1("x", Call(f, Call(f, Var("x")))), expr)
+		}
+		return Let("f0", Func1("x", Call(Var("dup"), Var("x"))), expr)
+	}
+
+	expr := nested(4)
+	expectLimit := func(kind LimitKind) {
+		t.Helper()
+		_, err := ctx.Infer(expr, env)
+		if lerr, ok := err.(*LimitError); !ok || lerr.Kind != kind {
+			t.Fatalf("expected a %s limit error, found: %v", kind, err)
+		}
+		if ctx.InvalidExpr() == nil {
+			t.Fatalf("expected invalid expression to be retained")
+		}
+	}
+	ctx.SetLimits(Limits{TypeSize: 1000})
+	expectLimit(TypeSizeLimit)
+	ctx.SetLimits(Limits{TypeDepth: 10})
+	expectLimit(TypeDepthLimit)
+	ctx.SetLimits(Limits{TypeVars: 15})
+	expectLimit(TypeVarLimit)
+	// Exponentially large types are not fully traversed within a single expression:
+	expr = nested(6)
+	ctx.SetLimits(Limits{UnificationSteps: 100000})
+	expectLimit(UnificationStepLimit)
+
+	// The context remains usable after a limit is exceeded:
+	ctx.SetLimits(Limits{TypeSize: 10, TypeDepth: 10, UnificationSteps: 10, TypeVars: 10})
+	mustInfer(t, env, ctx, Call(Var("dup"), Var("1")), "pair[int, int]")
+
+	// Inference stops when the context is cancelled:
+	ctx.SetLimits(Limits{})
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ctx.InferWithContext(cancelled, expr, env); err != context.Canceled {
+		t.Fatalf("expected cancellation, found: %v", err)
+	}
+	ty, err := ctx.InferWithContext(context.Background(), Call(Var("dup"), Var("1")), env)
+	if err != nil || types.TypeString(ty) != "pair[int, int]" {
+		t.Fatalf("type: %s, error: %v", types.TypeString(ty), err)
+	}
+
+	// Deferred instance constraints are limited per inference:
+	objA := TRecordFlat(map[string]types.Type{"x": TConst("A")})
+	objB := TRecordFlat(map[string]types.Type{"x": TConst("B")})
+	HasX, err := env.DeclareUnionTypeClass("HasX", nil, map[string]types.Type{"A": objA, "B": objB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Declare("a_id", TArrow1(TConst("A"), TConst("A")))
+	hasX := env.NewQualifiedVar(types.InstanceConstraint{TypeClass: HasX})
+	env.Declare("obj_id", TArrow1(hasX, hasX))
+	ctx.EnableDeferredInstanceMatching(true)
+
+	// fn (x, y) -> let _ = obj_id({x = x}) in let _ = obj_id({x = y}) in let _ = a_id(x) in a_id(y)
+	expr = Func2("x", "y",
+		Let("_", Call(Var("obj_id"), RecordExtend(RecordEmpty(), LabelValue("x", Var("x")))),
+			Let("_", Call(Var("obj_id"), RecordExtend(RecordEmpty(), LabelValue("x", Var("y")))),
+				Let("_", Call(Var("a_id"), Var("x")), Call(Var("a_id"), Var("y"))))))
+	ctx.SetLimits(Limits{DeferredConstraints: 1})
+	expectLimit(DeferredConstraintLimit)
+	ctx.SetLimits(Limits{DeferredConstraints: 2})
+	if _, err = ctx.Infer(expr, env); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFrozenTypeEnv(t *testing.T) {
+	shared := NewTypeEnv(nil)
+	shared.Declare("someint", TConst("int"))
+	shared.Declare("show_int", TArrow1(TConst("int"), TConst("string")))
+	shared.Declare("show_bool", TArrow1(TConst("bool"), TConst("string")))
+	shared.Declare("true", TConst("bool"))
+	Show, err := shared.DeclareTypeClass("Show", func(param *types.Var) types.MethodSet {
+		return types.MethodSet{"show": TArrow1(param, TConst("string"))}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = shared.DeclareInstance(Show, TConst("int"), map[string]string{"show": "show_int"}); err != nil {
+		t.Fatal(err)
+	}
+	a := shared.NewGenericVar()
+	if _, err = shared.DeclareDataType("list", []*types.Var{a},
+		DataConstructor{Name: "Nil"},
+		DataConstructor{Name: "Cons", Fields: []types.Type{a, TApp(TConst("list"), a)}, Labels: []string{"head", "tail"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Weakly-polymorphic bindings cannot be frozen:
+	weak := NewTypeEnv(shared)
+	weak.DeclareWeak("r", TRef(weak.NewVar(types.TopLevel+1)))
+	if _, err := weak.Freeze(); err == nil {
+		t.Fatalf("expected an error for freezing a weakly-polymorphic binding")
+	}
+	if weak.Frozen() || shared.Frozen() {
+		t.Fatalf("expected environments to remain mutable after a failed freeze")
+	}
+
+	frozen, err := shared.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := frozen.DeclareInstance(Show, TConst("bool"), map[string]string{"show": "show_bool"}); err == nil {
+		t.Fatalf("expected an error for declaring an instance within a frozen type-environment")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected a panic for declaring a binding within a frozen type-environment")
+			}
+		}()
+		frozen.Declare("x", TConst("int"))
+	}()
+	// Inference within a frozen type-environment occurs within a temporary child environment:
+	ctx := NewContext()
+	mustInfer(t, frozen, ctx, Let("x", Var("someint"), Call(Var("show"), Var("x"))), "string")
+	if frozen.Lookup("x") != nil {
+		t.Fatalf("expected inference to leave the frozen type-environment unchanged")
+	}
+
+	const threads = 8
+	errs := make(chan error, threads)
+	for i := 0; i < threads; i++ {
+		go func(i int) {
+			errs <- func() error {
+				env := NewTypeEnv(frozen)
+				ctx := NewContext()
+				name := "value" + strconv.Itoa(i)
+				env.Declare(name, TConst("bool"))
+				// Instances and sub-classes declared within children of the frozen environment are only visible within the child:
+				if i%2 == 0 {
+					if _, err := env.DeclareInstance(Show, TConst("bool"), map[string]string{"show": "show_bool"}); err != nil {
+						return err
+					}
+				}
+				Pretty, err := env.DeclareTypeClass("Pretty", func(param *types.Var) types.MethodSet {
+					return types.MethodSet{"pretty": TArrow1(param, TConst("string"))}
+				}, Show)
+				if err != nil {
+					return err
+				}
+				if _, err := env.DeclareInstance(Pretty, TConst("int"), map[string]string{"pretty": "show_int", "show": "show_int"}); err != nil {
+					return err
+				}
+				for j := 0; j < 50; j++ {
+					exprs := []ast.Expr{
+						Call(Var("show"), Var("someint")),
+						Call(Var("pretty"), Var("someint")),
+						Call(Var("Cons"), Var(name), Call(Var("Cons"), Var("true"), Var("Nil"))),
+						Func1("x", Call(Var("show"), Var("x"))),
+					}
+					for _, expr := range exprs {
+						if _, err := ctx.Annotate(expr, env); err != nil {
+							return err
+						}
+					}
+					_, err := ctx.Infer(Call(Var("show"), Var(name)), env)
+					if visible := i%2 == 0; visible != (err == nil) {
+						return errors.New("unexpected visibility of instance Show bool: " + strconv.Itoa(i))
+					}
+				}
+				return nil
+			}()
+		}(i)
+	}
+	for i := 0; i < threads; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ctx.Infer(Call(Var("show"), Var("true")), frozen); err == nil {
+		t.Fatalf("expected instances declared within child environments to be hidden from the frozen environment")
+	}
+	// Type-classes of the frozen environment are not modified by child environments:
+	if instances := Show.InstanceList(); len(instances) != 1 {
+		t.Fatalf("expected 1 instance of Show after declarations within child environments, found %d", len(instances))
+	}
+	if subs := Show.SubClasses(); len(subs) != 0 {
+		t.Fatalf("expected no sub-classes of Show after declarations within child environments, found %d", len(subs))
+	}
+	parent := NewTypeEnv(frozen)
+	if _, err := parent.DeclareInstance(Show, TConst("bool"), map[string]string{"show": "show_bool"}); err != nil {
+		t.Fatal(err)
+	}
+	mustInfer(t, NewTypeEnv(parent), ctx, Call(Var("show"), Var("true")), "string")
+	if len(Show.InstanceList()) != 1 {
+		t.Fatalf("expected instances declared within child environments to be stored within the child environment")
+	}
+	// Frozen children share bindings with their frozen parents:
+	child := NewTypeEnv(frozen)
+	child.Declare("other", TConst("bool"))
+	if _, err := child.Freeze(); err != nil {
+		t.Fatal(err)
+	}
+	mustInfer(t, child, ctx, Call(Var("Cons"), Var("other"), Var("Nil")), "list[bool]")
+	mustInfer(t, child, ctx, Call(Var("show"), Var("someint")), "string")
+
+	// Instances become visible after an import, within environments which previously looked up instances:
+	other, importer := NewTypeEnv(frozen), NewTypeEnv(frozen)
+	if err := importer.Import(NewTypeEnv(frozen)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.DeclareInstance(Show, TConst("bool"), map[string]string{"show": "show_bool"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Infer(Call(Var("show"), Var("true")), importer); err == nil {
+		t.Fatalf("expected instance Show bool to be hidden before import")
+	}
+	if err := importer.Import(other); err != nil {
+		t.Fatal(err)
+	}
+	mustInfer(t, importer, ctx, Call(Var("show"), Var("true")), "string")
+
+	// Parent and imported environments are frozen in place:
+	base, imported := NewTypeEnv(nil), NewTypeEnv(nil)
+	derived := NewTypeEnv(base)
+	if err := derived.Import(imported); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := derived.Freeze(); err != nil || result != derived {
+		t.Fatalf("expected the type-environment to be frozen in place: %v", err)
+	}
+	if !base.Frozen() || !imported.Frozen() {
+		t.Fatalf("expected parent and imported environments to be frozen")
+	}
+	if err := base.Import(NewTypeEnv(nil)); err == nil {
+		t.Fatalf("expected an error for importing within a frozen parent environment")
+	}
+}
+
+func TestFrozenSharedTypes(t *testing.T) {
+	shared := NewTypeEnv(nil)
+	shared.Declare("norm", TArrow1(TRecordFlat(map[string]types.Type{"x": TConst("int")}), TConst("int")))
+	a := shared.NewGenericVar()
+	shared.Assign("pick", TArrow([]types.Type{TConst("int"), TRecordFlat(map[string]types.Type{"x": a})}, a))
+	frozen, err := shared.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Non-generic declared types are shared by all instantiations and must not be modified during inference:
+	const threads = 8
+	errs := make(chan error, threads)
+	for i := 0; i < threads; i++ {
+		go func() {
+			ctx := NewContext()
+			if _, err := ctx.Infer(Var("norm"), NewTypeEnv(frozen)); err != nil {
+				errs <- err
+				return
+			}
+			_, err := ctx.Infer(Var("pick"), NewTypeEnv(frozen))
+			errs <- err
+		}()
+	}
+	for i := 0; i < threads; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParallelLetGroups(t *testing.T) {
+	newEnv := func() *TypeEnv {
+		env := NewTypeEnv(nil)
+		env.Declare("1", TConst("int"))
+		a := env.NewGenericVar()
+		env.Declare("dup", TArrow1(a, TApp(TConst("pair"), a, a)))
+		env.DeclareWeak("r", TRef(env.NewVar(types.TopLevel+1)))
+		return env
+	}
+	f := func(i int) string { return "f" + strconv.Itoa(i) }
+	// Independent components, dependent components, cycles, non-function values, nested let-groups, and references
+	// to weakly-polymorphic variables:
+	group := func(n int, invalid ...int) ast.Expr {
+		bindings := make([]ast.LetBinding, n)
+		for i := range bindings {
+			var value ast.Expr
+			switch i % 7 {
+			case 0:
+				value = Func1("x", Call(Var("dup"), Var("x")))
+			case 1:
+				value = Func1("x", Call(Var(f(i-1)), Call(Var(f(i-1)), Var("x"))))
+			case 2:
+				value = Func1("x", Call(Var(f(i+1)), Var("x")))
+			case 3:
+				value = Func1("y", Call(Var(f(i-1)), Var("y")))
+			case 4:
+				value = Call(Var(f(i-4)), Var("1"))
+			case 5:
+				value = Func1("y", LetGroup([]ast.LetBinding{
+					{"h", Func1("z", Call(Var("g"), Var("z")))},
+					{"g", Func1("z", Call(Var(f(i-5)), Var("z")))},
+				}, Call(Var("h"), Var("y"))))
+			case 6:
+				value = Func1("x", RecordExtend(RecordEmpty(), ast.LabelValue{"a", Call(Var("dup"), Var("r"))}, ast.LabelValue{"b", Call(Var(f(i-6)), Var("x"))}))
+			}
+			bindings[i] = ast.LetBinding{Var: f(i), Value: value}
+		}
+		for _, i := range invalid {
+			bindings[i].Value = Func1("x", Call(Var("1"), Var("x")))
+		}
+		return LetGroup(bindings, Var(f(n-2)))
+	}
+	var varIds func(t types.Type, ids []uint) []uint
+	varIds = func(t types.Type, ids []uint) []uint {
+		switch t := types.RealType(t).(type) {
+		case *types.Var:
+			ids = append(ids, t.Id())
+		case *types.Arrow:
+			for _, arg := range t.Args {
+				ids = varIds(arg, ids)
+			}
+			ids = varIds(t.Return, ids)
+		case *types.App:
+			for _, param := range t.Params {
+				ids = varIds(param, ids)
+			}
+		}
+		return ids
+	}
+	type result struct {
+		types  []string
+		ids    [][]uint
+		nextId uint
+	}
+	annotate := func(workers int, expr ast.Expr) result {
+		env, ctx := newEnv(), NewContext()
+		ctx.EnableParallelInference(workers)
+		annotated, err := ctx.Annotate(expr, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r result
+		for _, v := range annotated.(*ast.LetGroup).Vars {
+			r.types = append(r.types, types.TypeString(v.Value.Type()))
+			r.ids = append(r.ids, varIds(v.Value.Type(), nil))
+		}
+		r.types = append(r.types, types.TypeString(annotated.Type()))
+		r.nextId = env.NextVarId()
+		return r
+	}
+
+	expr := group(140)
+	sequential, parallel := annotate(1, expr), annotate(4, expr)
+	if !reflect.DeepEqual(sequential, parallel) {
+		t.Fatalf("expected parallel inference to match sequential inference:\n%#+v\n%#+v", sequential, parallel)
+	}
+	if sequential.types[len(sequential.types)-1] != "'a -> pair['a, 'a]" {
+		t.Fatalf("type: %s", sequential.types[len(sequential.types)-1])
+	}
+
+	// The first invalid binding in dependency order is reported:
+	expr = group(140, 120, 8, 63)
+	var errs []string
+	var invalid []ast.Expr
+	for _, workers := range []int{1, 4} {
+		ctx := NewContext()
+		ctx.EnableParallelInference(workers)
+		if _, err := ctx.Infer(expr, newEnv()); err == nil {
+			t.Fatalf("expected an error for an invalid binding")
+		} else {
+			errs, invalid = append(errs, err.Error()), append(invalid, ctx.InvalidExpr())
+		}
+	}
+	if errs[0] != errs[1] || invalid[0] != invalid[1] {
+		t.Fatalf("expected parallel inference to fail like sequential inference: %v, %v", errs, invalid)
+	}
+}
+
+func TestInterning(t *testing.T) {
+	in := types.NewInterner()
+	a := TApp(TConst("list"), TArrow1(TConst("int"), TConst("string")))
+	b := TApp(TConst("list"), TArrow1(TConst("int"), TConst("string")))
+	if types.TypeHash(a) != types.TypeHash(b) {
+		t.Fatalf("expected equal hashes for structurally equal types")
+	}
+	if types.TypeHash(a) == types.TypeHash(TApp(TConst("list"), TArrow1(TConst("string"), TConst("int")))) {
+		t.Fatalf("expected distinct hashes for distinct types")
+	}
+	// Types nested within interned types are also interned:
+	if in.Intern(a) != a || in.Len() != 5 || in.Intern(b) != a || in.Len() != 5 {
+		t.Fatalf("expected structurally equal ground types to be interned as a single instance")
+	}
+	// Type-variables are not interned, but ground types within them are (within a copy):
+	tv := TVar(1, types.TopLevel)
+	c := TArrow1(TApp(TConst("list"), TArrow1(TConst("int"), TConst("string"))), tv)
+	if interned := in.Intern(c).(*types.Arrow); interned == c || interned.Args[0] != a || interned.Return != tv {
+		t.Fatalf("expected ground types within a type with type-variables to be interned")
+	}
+	if c.Args[0] == a {
+		t.Fatalf("expected interning not to modify types with type-variables")
+	}
+	// Mutable references are not interned with other type constants:
+	if in.Intern(TApp(TConst("ref"), TConst("int"))) == in.Intern(TRef(TConst("int"))) {
+		t.Fatalf("expected reference-types to be distinct from other type constants")
+	}
+
+	// Interned types are shared by declarations and inferred types:
+	env := NewTypeEnv(nil)
+	env.SetInterner(in)
+	env.Declare("ints", TApp(TConst("list"), TConst("int")))
+	env.Declare("head", TArrow1(TApp(TConst("list"), TConst("int")), TConst("int")))
+	ctx := NewContext()
+	ty, err := ctx.Infer(Call(Var("head"), Var("ints")), env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intLiteral := func(env types.TypeEnv, level uint, using []types.Type) (types.Type, error) { return TConst("int"), nil }
+	lit, err := ctx.Infer(Literal("0", nil, intLiteral), NewTypeEnv(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if types.TypeString(ty) != "int" || ty != lit || env.Lookup("ints").(*types.App).Params[0] != ty {
+		t.Fatalf("expected inferred ground types to be interned")
+	}
+
+	// Interning does not modify types shared by frozen type-environments, including types declared before the interner was set:
+	shared := NewTypeEnv(nil)
+	v := shared.NewGenericVar()
+	pairs := TApp(TConst("list"), TRecordFlat(map[string]types.Type{"key": TConst("int"), "value": TRef(TConst("int"))}))
+	shared.Assign("pairs", pairs)
+	shared.Declare("lookup", TArrow([]types.Type{TApp(TConst("list"), TRecordFlat(map[string]types.Type{"key": TConst("int"), "value": v})), TConst("int")}, v))
+	shared.SetInterner(types.NewInterner())
+	shared.Declare("keys", TArrow1(TApp(TConst("list"), TRecordFlat(map[string]types.Type{"key": TConst("int"), "value": v})), TApp(TConst("list"), TConst("int"))))
+	frozen, err := shared.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedLiteral := func(env types.TypeEnv, level uint, using []types.Type) (types.Type, error) { return pairs, nil }
+	const threads = 8
+	errs := make(chan error, threads)
+	for i := 0; i < threads; i++ {
+		go func() {
+			ctx := NewContext()
+			for _, expr := range []ast.Expr{
+				Call(Var("lookup"), Var("pairs"), Literal("0", nil, intLiteral)),
+				Call(Var("keys"), Literal("pairs", nil, sharedLiteral)),
+				Var("lookup"),
+			} {
+				if _, err := ctx.Infer(expr, NewTypeEnv(frozen)); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < threads; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
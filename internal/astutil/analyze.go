@@ -35,8 +35,9 @@ type StashedScope struct {
 }
 
 type Graph struct {
-	Verts map[string]int
-	Edges util.Graph
+	Verts  map[string]int
+	Edges  util.Graph
+	Nested []int // number of the first let-group nested within each binding, followed by the body
 }
 
 func (g *Graph) addVert(name string) bool {
@@ -237,6 +238,23 @@ func (a *Analysis) analyzeExpr(expr ast.Expr) error {
 		}
 		a.unstash(stashed)
 
+	case *ast.Pack:
+		if err := a.analyzeExpr(expr.Value); err != nil {
+			return err
+		}
+
+	case *ast.Unpack:
+		if err := a.analyzeExpr(expr.Value); err != nil {
+			return err
+		}
+		stashed := a.stash(expr.Var)
+		a.Scopes[expr.Var] = -1
+		if err := a.analyzeExpr(expr.Body); err != nil {
+			return err
+		}
+		delete(a.Scopes, expr.Var)
+		a.unstash(stashed)
+
 	case *ast.Let:
 		stashed := 0
 		_, isFunc := expr.Value.(*ast.Func)
@@ -261,8 +279,9 @@ func (a *Analysis) analyzeExpr(expr ast.Expr) error {
 	case *ast.LetGroup:
 		num := len(a.Graphs)
 		a.Graphs = append(a.Graphs, Graph{
-			Verts: make(map[string]int, len(expr.Vars)),
-			Edges: util.NewGraph(len(expr.Vars)),
+			Verts:  make(map[string]int, len(expr.Vars)),
+			Edges:  util.NewGraph(len(expr.Vars)),
+			Nested: make([]int, len(expr.Vars)+1),
 		})
 		a.CurrentVert = append(a.CurrentVert, -1)
 		graph := &a.Graphs[num]
@@ -277,6 +296,7 @@ func (a *Analysis) analyzeExpr(expr ast.Expr) error {
 		}
 		for i, v := range expr.Vars {
 			a.CurrentVert[num] = i
+			a.Graphs[num].Nested[i] = len(a.Graphs)
 			// Allow self-references within function types:
 			if _, isFunc := v.Value.(*ast.Func); isFunc {
 				if err := a.analyzeExpr(v.Value); err != nil {
@@ -303,6 +323,7 @@ func (a *Analysis) analyzeExpr(expr ast.Expr) error {
 			a.Scopes[v.Var] = num
 		}
 		a.CurrentVert[num] = -1
+		a.Graphs[num].Nested[len(expr.Vars)] = len(a.Graphs)
 		if err := a.analyzeExpr(expr.Body); err != nil {
 			return err
 		}
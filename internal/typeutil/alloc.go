@@ -0,0 +1,90 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package typeutil
+
+import (
+	"github.com/wdamron/poly/types"
+)
+
+// Function types and type applications with few arguments are allocated together with their argument lists.
+
+type arrow1 struct {
+	t    types.Arrow
+	args [1]types.Type
+}
+
+type arrow2 struct {
+	t    types.Arrow
+	args [2]types.Type
+}
+
+type arrow3 struct {
+	t    types.Arrow
+	args [3]types.Type
+}
+
+type app1 struct {
+	t      types.App
+	params [1]types.Type
+}
+
+type app2 struct {
+	t      types.App
+	params [2]types.Type
+}
+
+// Allocate a function type with the given number of (nil) arguments.
+func NewArrow(arity int) *types.Arrow {
+	switch arity {
+	case 0:
+		return &types.Arrow{Args: []types.Type{}}
+	case 1:
+		a := &arrow1{}
+		a.t.Args = a.args[:]
+		return &a.t
+	case 2:
+		a := &arrow2{}
+		a.t.Args = a.args[:]
+		return &a.t
+	case 3:
+		a := &arrow3{}
+		a.t.Args = a.args[:]
+		return &a.t
+	}
+	return &types.Arrow{Args: make([]types.Type, arity)}
+}
+
+// Allocate a type application with the given number of (nil) parameters.
+func NewApp(arity int) *types.App {
+	switch arity {
+	case 1:
+		a := &app1{}
+		a.t.Params = a.params[:]
+		return &a.t
+	case 2:
+		a := &app2{}
+		a.t.Params = a.params[:]
+		return &a.t
+	}
+	return &types.App{Params: make([]types.Type, arity)}
+}
@@ -23,6 +23,8 @@
 package typeutil
 
 import (
+	"errors"
+
 	"github.com/wdamron/poly/ast"
 	"github.com/wdamron/poly/types"
 )
@@ -41,6 +43,11 @@ type StashedLink struct {
 
 func (l *StashedLink) Restore() { *l.v = l.prev }
 
+// Assumed equality of an equi-recursive type with another type (during coinductive unification)
+type EquiAssumption struct {
+	A, B interface{}
+}
+
 // Used for deferred instance matching (when multiple instances match)
 type DeferredConstraint struct {
 	Var  *types.Var
@@ -48,20 +55,43 @@ type DeferredConstraint struct {
 }
 
 type CommonContext struct {
-	VarTracker          VarTracker              // type-variables generated during inference
-	EnvStash            []StashedType           // shadowed variables
-	LinkStash           []StashedLink           // stashed type-variables (during speculative unification)
-	InstLookup          map[uint]*types.Var     // instantiation lookup for generic type-variables
-	VarScopes           map[string][]*ast.Scope // map from variable name to defining scope and shadowed scopes (stacked)
-	ScopeStack          []ast.Scope             // stack of nested binding scopes during inference
-	DeferredConstraints []DeferredConstraint    // deferred instance matching (when multiple instances match)
-	CurrentExpr         ast.Expr                // added to deferred constraints during unification for debugging
+	VarTracker          VarTracker                            // type-variables generated during inference
+	EnvStash            []StashedType                         // shadowed variables
+	LinkStash           []StashedLink                         // stashed type-variables (during speculative unification)
+	InstLookup          map[uint]*types.Var                   // instantiation lookup for generic type-variables
+	RecLookup           map[*types.Recursive]*types.Recursive // instantiation lookup for equi-recursive types
+	BoundLookup         map[*types.SizeBound]*types.SizeBound // instantiation lookup for size bounds
+	UntrackedEffects    *types.Var                            // instantiated effect row for higher-order functions without tracked effects
+	UntrackedScope      bool                                  // set while instantiating a higher-order function without tracked effects
+	Assumptions         []EquiAssumption                      // assumed equalities during coinductive unification of equi-recursive types
+	RecStack            []*types.Recursive                    // equi-recursive types visited during level adjustment
+	ExistentialStack    []*types.Existential                  // existential types visited during level adjustment
+	VarScopes           map[string][]*ast.Scope               // map from variable name to defining scope and shadowed scopes (stacked)
+	ScopeStack          []*ast.Scope                          // stack of nested binding scopes during inference
+	DeferredConstraints []DeferredConstraint                  // deferred instance matching (when multiple instances match)
+	CurrentExpr         ast.Expr                              // added to deferred constraints during unification for debugging
+	InstanceVisible     func(*types.Instance) bool            // filter for instances visible within the type-environment
+	IsOpaque            func(name string) bool                // check if the underlying type of a type constructor is hidden within the type-environment
+	Variance            func(name string) []types.Variance    // lookup declared variances for parameters of a type constructor within the type-environment
+	ClassOverlays       func() types.ClassOverlays            // lookup overlays of type-class relations visible within the type-environment
+
+	// observers (called outside of speculative unification):
+	InstanceSelected   func(tc *types.TypeClass, t types.Type, inst *types.Instance) // called when a matching instance is selected, or nil
+	ConstraintDeferred func(tc *types.TypeClass, t types.Type, expr ast.Expr)        // called when instance matching is deferred, or nil
+
+	// limits:
+	MaxUnifySteps int             // maximum number of steps for unification, occurs-checks and instantiation, or 0 for no limit
+	UnifySteps    int             // steps taken during inference
+	Done          <-chan struct{} // closed when inference is cancelled, or nil
+	Interrupted   bool            // set when the step limit is exceeded or inference is cancelled
 
 	// modes:
 	Speculate                   bool // stash linked type-variables during unification
 	TrackScopes                 bool // track defining scopes for variables during inference
 	DeferredConstraintsEnabled  bool // allow deferred unification when multiple instances match
 	CheckingDeferredConstraints bool // prevent additional deferred constraints
+	EquiRecursiveTypes          bool // infer equi-recursive types for cyclic unification
+	TrackEffects                bool // instantiate effect rows for higher-order functions without tracked effects
 
 	// initial space:
 	_envStash            [32]StashedType
@@ -75,13 +105,17 @@ func (ctx *CommonContext) Init() {
 	}
 	ctx.EnvStash, ctx.LinkStash = ctx._envStash[:0], ctx._linkStash[:0]
 	ctx.InstLookup = make(map[uint]*types.Var, 16)
+	ctx.RecLookup = make(map[*types.Recursive]*types.Recursive)
+	ctx.BoundLookup = make(map[*types.SizeBound]*types.SizeBound)
 	ctx.DeferredConstraints = ctx._deferredConstraints[:0]
 	ctx.VarScopes = make(map[string][]*ast.Scope)
 }
 
 func (ctx *CommonContext) Reset() {
 	ctx.VarTracker.Reset()
-	ctx.TrackScopes, ctx.DeferredConstraintsEnabled = false, false
+	ctx.TrackScopes, ctx.DeferredConstraintsEnabled, ctx.EquiRecursiveTypes, ctx.TrackEffects = false, false, false, false
+	ctx.MaxUnifySteps, ctx.UnifySteps, ctx.Done, ctx.Interrupted = 0, 0, nil, false
+	ctx.InstanceSelected, ctx.ConstraintDeferred = nil, nil
 	for i := range ctx._envStash {
 		ctx._envStash[i] = StashedType{}
 	}
@@ -99,10 +133,41 @@ func (ctx *CommonContext) Reset() {
 	ctx.ResetScopeStack()
 }
 
+// ErrInterrupted is returned by unification and occurs-checks after the step limit is exceeded or inference is cancelled.
+var ErrInterrupted = errors.New("Inference was interrupted")
+
+// Count a step of unification, an occurs-check or instantiation. Cancellation is checked periodically.
+func (ctx *CommonContext) step() error {
+	if ctx.Interrupted {
+		return ErrInterrupted
+	}
+	ctx.UnifySteps++
+	if ctx.MaxUnifySteps > 0 && ctx.UnifySteps > ctx.MaxUnifySteps {
+		ctx.Interrupted = true
+		return ErrInterrupted
+	}
+	if ctx.Done != nil && ctx.UnifySteps&255 == 0 {
+		select {
+		case <-ctx.Done:
+			ctx.Interrupted = true
+			return ErrInterrupted
+		default:
+		}
+	}
+	return nil
+}
+
 func (ctx *CommonContext) ClearInstantiationLookup() {
 	for k := range ctx.InstLookup {
 		delete(ctx.InstLookup, k)
 	}
+	for k := range ctx.RecLookup {
+		delete(ctx.RecLookup, k)
+	}
+	for k := range ctx.BoundLookup {
+		delete(ctx.BoundLookup, k)
+	}
+	ctx.UntrackedEffects, ctx.UntrackedScope = nil, false
 }
 
 // returns 1 if the variable was stashed, otherwise 0
@@ -150,9 +215,10 @@ func (ctx *CommonContext) EnterScope(expr ast.Expr) {
 	}
 	var parent *ast.Scope
 	if len(ctx.ScopeStack) != 0 {
-		parent = &ctx.ScopeStack[len(ctx.ScopeStack)-1]
+		parent = ctx.ScopeStack[len(ctx.ScopeStack)-1]
 	}
-	ctx.ScopeStack = append(ctx.ScopeStack, ast.Scope{expr, parent})
+	// scopes are allocated separately, since variables retain pointers to their scopes after the stack is popped:
+	ctx.ScopeStack = append(ctx.ScopeStack, &ast.Scope{Expr: expr, Parent: parent})
 }
 
 func (ctx *CommonContext) LeaveScope() {
@@ -163,7 +229,7 @@ func (ctx *CommonContext) LeaveScope() {
 
 func (ctx *CommonContext) PushVarScope(name string) {
 	if ctx.TrackScopes {
-		ctx.VarScopes[name] = append(ctx.VarScopes[name], &ctx.ScopeStack[len(ctx.ScopeStack)-1])
+		ctx.VarScopes[name] = append(ctx.VarScopes[name], ctx.ScopeStack[len(ctx.ScopeStack)-1])
 	}
 }
 
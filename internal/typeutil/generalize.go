@@ -29,11 +29,34 @@ import (
 func GeneralizeOpts(level uint, t types.Type, forceGeneralize, weak bool) types.Type {
 	// Path compression:
 	t = types.RealType(t)
-	visitTypeVars(level, t, forceGeneralize, weak)
+	const relaxed = false
+	visitTypeVars(level, t, forceGeneralize, weak, relaxed)
 	return t
 }
 
-func visitTypeVars(level uint, t types.Type, forceGeneralize, weak bool) (tf types.TypeFlags) {
+// Generalize unbound type-variables above level which are not weakly-polymorphic, including type-variables within mutable
+// reference-types. The relaxed value restriction should be applied to the types of expansive expressions before generalizing.
+func GeneralizeRelaxed(level uint, t types.Type) types.Type {
+	t = types.RealType(t)
+	const forceGeneralize, weak, relaxed = false, false, true
+	visitTypeVars(level, t, forceGeneralize, weak, relaxed)
+	return t
+}
+
+// Update the flags of composite types within t, without generalizing any type-variables.
+func UpdateFlags(t types.Type) types.Type {
+	t = types.RealType(t)
+	const level, forceGeneralize, weak, relaxed = ^uint(0), false, false, true
+	visitTypeVars(level, t, forceGeneralize, weak, relaxed)
+	return t
+}
+
+// TypeFlags for a type which contains unbound type-variables after generalization. The flag is only tracked during generalization.
+const containsUnboundVars types.TypeFlags = 1 << 8
+
+// Types declared within frozen type-environments are shared across threads, so flags and links are only written when they change;
+// generalization will not modify types which do not contain unbound type-variables once their flags have been updated.
+func visitTypeVars(level uint, t types.Type, forceGeneralize, weak, relaxed bool) (tf types.TypeFlags) {
 	switch t := t.(type) {
 	case *types.Unit:
 		return
@@ -41,11 +64,11 @@ func visitTypeVars(level uint, t types.Type, forceGeneralize, weak bool) (tf typ
 	case *types.Var:
 		switch {
 		case t.IsLinkVar():
-			return visitTypeVars(level, t.Link(), forceGeneralize, weak)
+			return visitTypeVars(level, t.Link(), forceGeneralize, weak, relaxed)
 		case t.IsGenericVar():
 			tf |= types.ContainsGenericVars
 			// Weak type-variables may not be re-generalized after instantiation:
-			if weak {
+			if weak && !t.IsWeakVar() {
 				t.SetWeak()
 			}
 		default: // weak or unbound
@@ -56,6 +79,13 @@ func visitTypeVars(level uint, t types.Type, forceGeneralize, weak bool) (tf typ
 			if t.LevelNum() > level && (forceGeneralize || (!weak && !t.IsWeakVar())) {
 				tf |= types.ContainsGenericVars
 				t.SetGeneric()
+				// Size expressions within size bounds may contain type-variables which do not occur elsewhere:
+				for _, bound := range t.SizeBounds() {
+					visitTypeVars(level, bound.Left, forceGeneralize, weak, relaxed)
+					visitTypeVars(level, bound.Right, forceGeneralize, weak, relaxed)
+				}
+			} else {
+				tf |= containsUnboundVars
 			}
 			// Weak type-variables may not be re-generalized after instantiation:
 			if weak {
@@ -76,63 +106,111 @@ func visitTypeVars(level uint, t types.Type, forceGeneralize, weak bool) (tf typ
 		}
 		rec.Flags &^= types.NeedsGeneralization // break cycles
 		for _, alias := range rec.Types {
-			tf |= visitTypeVars(level, alias, forceGeneralize, weak)
+			tf |= visitTypeVars(level, alias, forceGeneralize, weak, relaxed)
 		}
-		rec.Flags |= tf
+		setFlags(&rec.Flags, tf)
 		// back-propagate type-flags through links:
 		if tf&(types.ContainsGenericVars|types.ContainsRefs) != 0 {
 			for _, alias := range rec.Types {
-				visitTypeVars(level, alias, forceGeneralize, weak)
+				visitTypeVars(level, alias, forceGeneralize, weak, relaxed)
 			}
 		}
+		// Equi-recursive types may contain type-variables at any level, so they must be visited during each generalization
+		// until they do not contain unbound type-variables:
+		if rec.IsEquiRecursive() && tf&containsUnboundVars != 0 {
+			rec.Flags |= types.NeedsGeneralization
+		}
 
 	case *types.App:
 		if types.IsRefType(t) {
 			tf |= types.ContainsRefs
-			weak = true
+			if !relaxed {
+				weak = true
+			}
 		}
-		for i, param := range t.Params {
-			t.Params[i] = types.RealType(param)
-			tf |= visitTypeVars(level, t.Params[i], forceGeneralize, weak)
+		for i := range t.Params {
+			tf |= visitTypeVars(level, compress(&t.Params[i]), forceGeneralize, weak, relaxed)
 		}
-		t.Const = types.RealType(t.Const)
-		tf |= visitTypeVars(level, t.Const, forceGeneralize, weak)
+		tf |= visitTypeVars(level, compress(&t.Const), forceGeneralize, weak, relaxed)
 		if t.Underlying != nil {
-			t.Underlying = types.RealType(t.Underlying)
-			tf |= visitTypeVars(level, t.Underlying, forceGeneralize, weak)
+			tf |= visitTypeVars(level, compress(&t.Underlying), forceGeneralize, weak, relaxed)
 		}
-		t.Flags |= tf
+		setFlags(&t.Flags, tf)
+
+	case *types.SizeExpr:
+		for i := range t.Args {
+			tf |= visitTypeVars(level, compress(&t.Args[i]), forceGeneralize, weak, relaxed)
+		}
+		setFlags(&t.Flags, tf)
+
+	case *types.Measure:
+		for i := range t.Factors {
+			tf |= visitTypeVars(level, compress(&t.Factors[i].Unit), forceGeneralize, weak, relaxed)
+		}
+		setFlags(&t.Flags, tf)
+
+	case *types.Existential:
+		// Quantified type-variables are always generic:
+		tf |= visitTypeVars(level, compress(&t.Body), forceGeneralize, weak, relaxed) | types.ContainsGenericVars
+		setFlags(&t.Flags, tf)
 
 	case *types.Arrow:
-		for i, arg := range t.Args {
-			t.Args[i] = types.RealType(arg)
-			tf |= visitTypeVars(level, t.Args[i], forceGeneralize, weak)
+		for i := range t.Args {
+			tf |= visitTypeVars(level, compress(&t.Args[i]), forceGeneralize, weak, relaxed)
 		}
-		t.Return = types.RealType(t.Return)
-		tf |= visitTypeVars(level, t.Return, forceGeneralize, weak)
-		t.Flags |= tf
+		tf |= visitTypeVars(level, compress(&t.Return), forceGeneralize, weak, relaxed)
+		if t.Effects != nil {
+			tf |= visitTypeVars(level, compress(&t.Effects), forceGeneralize, weak, relaxed)
+		} else if types.IsHigherOrder(t) {
+			// Untracked effects of higher-order functions (and of their function arguments and results) may be instantiated
+			// as an effect row for each use:
+			tf |= types.ContainsGenericVars
+			for _, arg := range t.Args {
+				markUntracked(arg)
+			}
+			markUntracked(t.Return)
+		}
+		setFlags(&t.Flags, tf)
 
 	case *types.Record:
-		t.Row = types.RealType(t.Row)
-		tf |= visitTypeVars(level, t.Row, forceGeneralize, weak)
-		t.Flags |= tf
+		tf |= visitTypeVars(level, compress(&t.Row), forceGeneralize, weak, relaxed)
+		setFlags(&t.Flags, tf)
 
 	case *types.Variant:
-		t.Row = types.RealType(t.Row)
-		tf |= visitTypeVars(level, t.Row, forceGeneralize, weak)
-		t.Flags |= tf
+		tf |= visitTypeVars(level, compress(&t.Row), forceGeneralize, weak, relaxed)
+		setFlags(&t.Flags, tf)
 
 	case *types.RowExtend:
 		t.Labels.Range(func(label string, ts types.TypeList) bool {
 			ts.Range(func(i int, t types.Type) bool {
-				tf |= visitTypeVars(level, types.RealType(t), forceGeneralize, weak)
+				tf |= visitTypeVars(level, types.RealType(t), forceGeneralize, weak, relaxed)
 				return true
 			})
 			return true
 		})
-		t.Row = types.RealType(t.Row)
-		tf |= visitTypeVars(level, t.Row, forceGeneralize, weak)
-		t.Flags |= tf
+		tf |= visitTypeVars(level, compress(&t.Row), forceGeneralize, weak, relaxed)
+		setFlags(&t.Flags, tf)
 	}
 	return
 }
+
+// Mark a function argument or result without tracked effects, so it will be instantiated with an effect row.
+func markUntracked(t types.Type) {
+	if arrow, ok := t.(*types.Arrow); ok && arrow.Effects == nil {
+		setFlags(&arrow.Flags, types.ContainsGenericVars)
+	}
+}
+
+// Path compression for a child of a composite type.
+func compress(t *types.Type) types.Type {
+	if real := types.RealType(*t); real != *t {
+		*t = real
+	}
+	return *t
+}
+
+func setFlags(flags *types.TypeFlags, tf types.TypeFlags) {
+	if tf &^= containsUnboundVars; *flags&tf != tf {
+		*flags |= tf
+	}
+}
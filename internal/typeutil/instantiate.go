@@ -33,11 +33,78 @@ func (ctx *CommonContext) Instantiate(level uint, t types.Type) types.Type {
 	if !t.IsGeneric() {
 		return t
 	}
+	// Interrupted instantiation stops copying (inference will fail). Generic types must not escape instantiation,
+	// so a fresh type-variable is returned:
+	if (ctx.MaxUnifySteps != 0 || ctx.Done != nil) && ctx.step() != nil {
+		return ctx.VarTracker.New(level)
+	}
+	t = ctx.visitInstantiate(level, t)
+	ctx.ClearInstantiationLookup()
+	return t
+}
+
+// Instantiate t at a given level, substituting the generic type-variable with the given id for replacement.
+func (ctx *CommonContext) InstantiateWith(level uint, t types.Type, id uint, replacement types.Type) types.Type {
+	// Path compression:
+	t = types.RealType(t)
+	// Non-generic types can be shared:
+	if !t.IsGeneric() {
+		return t
+	}
+	tv := ctx.VarTracker.New(level)
+	tv.SetLink(replacement)
+	ctx.InstLookup[id] = tv
 	t = ctx.visitInstantiate(level, t)
 	ctx.ClearInstantiationLookup()
 	return t
 }
 
+// Open an existential type, substituting the given types for its quantified type-variables within its body.
+func (ctx *CommonContext) OpenExistential(level uint, t *types.Existential, with []types.Type) types.Type {
+	// Flags are not retained for instantiated types, so they must be updated before substituting quantified type-variables:
+	UpdateFlags(t.Body)
+	for i, tv := range t.Vars {
+		link := ctx.VarTracker.New(level)
+		link.SetLink(with[i])
+		ctx.InstLookup[tv.Id()] = link
+	}
+	body := ctx.visitInstantiate(level, t.Body)
+	ctx.ClearInstantiationLookup()
+	return body
+}
+
+// Equi-recursive types are instantiated by copying their unrolled types. Links to the same equi-recursive type will
+// point to the same instance.
+func (ctx *CommonContext) instantiateEquiRecursive(level uint, t *types.RecursiveLink) types.Type {
+	rec := t.Recursive
+	if next, ok := ctx.RecLookup[rec]; ok {
+		return &types.RecursiveLink{Recursive: next, Index: t.Index, Source: t}
+	}
+	next := &types.Recursive{
+		Source:  rec,
+		Types:   make([]*types.App, len(rec.Types)),
+		Names:   rec.Names,
+		Indexes: rec.Indexes,
+		Flags:   rec.Flags&^types.ContainsGenericVars | types.NeedsGeneralization,
+	}
+	ctx.RecLookup[rec] = next
+	for i, alias := range rec.Types {
+		next.Types[i] = ctx.visitInstantiate(level, alias).(*types.App)
+	}
+	return &types.RecursiveLink{Recursive: next, Index: t.Index, Source: t}
+}
+
+// Size bounds are shared between the type-variables they constrain, so each bound is instantiated once.
+func (ctx *CommonContext) instantiateSizeBound(level uint, bound *types.SizeBound) *types.SizeBound {
+	if next, ok := ctx.BoundLookup[bound]; ok {
+		return next
+	}
+	next := &types.SizeBound{Relation: bound.Relation}
+	ctx.BoundLookup[bound] = next
+	next.Left, next.Right = ctx.visitInstantiate(level, bound.Left), ctx.visitInstantiate(level, bound.Right)
+	return next
+}
+
 func (ctx *CommonContext) visitInstantiate(level uint, t types.Type) types.Type {
 	// Path compression:
 	t = types.RealType(t)
@@ -63,10 +130,20 @@ func (ctx *CommonContext) visitInstantiate(level uint, t types.Type) types.Type
 		copy(constraintsCopy, constraints)
 		next.SetConstraints(constraintsCopy)
 		ctx.InstLookup[t.Id()] = next
+		if bounds := t.SizeBounds(); len(bounds) != 0 {
+			boundsCopy := make([]*types.SizeBound, len(bounds))
+			for i, bound := range bounds {
+				boundsCopy[i] = ctx.instantiateSizeBound(level, bound)
+			}
+			next.SetSizeBounds(boundsCopy)
+		}
 		return next
 
 	case *types.RecursiveLink:
 		rec := t.Recursive
+		if rec.IsEquiRecursive() {
+			return ctx.instantiateEquiRecursive(level, t)
+		}
 		next := &types.Recursive{
 			Source:  rec,
 			Params:  make([]*types.Var, len(rec.Params)),
@@ -92,22 +169,70 @@ func (ctx *CommonContext) visitInstantiate(level uint, t types.Type) types.Type
 		return &types.RecursiveLink{Recursive: next, Index: t.Index, Source: t}
 
 	case *types.App:
-		params := make([]types.Type, len(t.Params))
+		app := NewApp(len(t.Params))
 		for i, param := range t.Params {
-			params[i] = ctx.visitInstantiate(level, param)
+			app.Params[i] = ctx.visitInstantiate(level, param)
 		}
-		var underlying types.Type
 		if t.Underlying != nil {
-			underlying = ctx.visitInstantiate(level, t.Underlying)
+			app.Underlying = ctx.visitInstantiate(level, t.Underlying)
 		}
-		return &types.App{Const: ctx.visitInstantiate(level, t.Const), Params: params, Underlying: underlying, Source: t}
+		app.Const, app.Source = ctx.visitInstantiate(level, t.Const), t
+		return app
 
-	case *types.Arrow:
+	case *types.SizeExpr:
 		args := make([]types.Type, len(t.Args))
 		for i, arg := range t.Args {
 			args[i] = ctx.visitInstantiate(level, arg)
 		}
-		return &types.Arrow{Args: args, Return: ctx.visitInstantiate(level, t.Return), Method: t.Method, Source: t}
+		return &types.SizeExpr{Op: t.Op, Args: args, Source: t}
+
+	case *types.Measure:
+		factors := make([]types.MeasureFactor, len(t.Factors))
+		for i, f := range t.Factors {
+			factors[i] = types.MeasureFactor{Unit: ctx.visitInstantiate(level, f.Unit), Exponent: f.Exponent}
+		}
+		return &types.Measure{Factors: factors, Source: t}
+
+	case *types.Arrow:
+		arrow := NewArrow(len(t.Args))
+		// When effects are tracked, higher-order functions without tracked effects share a fresh effect row with functions
+		// without tracked effects in their arguments and return types, so effects of function arguments propagate to their
+		// callers:
+		untracked := t.Effects == nil && ctx.TrackEffects && (ctx.UntrackedScope || types.IsHigherOrder(t))
+		outermost := untracked && !ctx.UntrackedScope
+		if outermost {
+			ctx.UntrackedScope = true
+		}
+		for i, arg := range t.Args {
+			arrow.Args[i] = ctx.visitInstantiate(level, arg)
+		}
+		arrow.Return, arrow.Method, arrow.Source = ctx.visitInstantiate(level, t.Return), t.Method, t
+		if t.Effects != nil {
+			arrow.Effects = ctx.visitInstantiate(level, t.Effects)
+			return arrow
+		}
+		if !untracked {
+			return arrow
+		}
+		if ctx.UntrackedEffects == nil {
+			ctx.UntrackedEffects = ctx.VarTracker.New(level)
+		}
+		arrow.Effects = ctx.UntrackedEffects
+		if outermost {
+			ctx.UntrackedScope, ctx.UntrackedEffects = false, nil
+		}
+		return arrow
+
+	case *types.Existential:
+		// Quantified type-variables are bound within the existential type, so they are not instantiated:
+		for _, tv := range t.Vars {
+			ctx.InstLookup[tv.Id()] = tv
+		}
+		body := ctx.visitInstantiate(level, t.Body)
+		for _, tv := range t.Vars {
+			delete(ctx.InstLookup, tv.Id())
+		}
+		return &types.Existential{Vars: t.Vars, Body: body, Source: t, Flags: t.Flags}
 
 	case *types.Method:
 		arrow := ctx.visitInstantiate(level, t.TypeClass.Methods[t.Name]).(*types.Arrow)
@@ -0,0 +1,147 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package typeutil
+
+import (
+	"github.com/wdamron/poly/types"
+)
+
+// See "Relaxing the Value Restriction" (Jacques Garrigue) -- https://caml.inria.fr/pub/papers/garrigue-value_restriction-fiflp04.pdf
+//
+// The type t of an expansive expression may contain type-variables which are shared with mutable state created during evaluation.
+// Unbound type-variables above level which occur within a contravariant or invariant position of a mutable type constructor within t
+// (such as a mutable reference-type) are lowered to level, so they will not be generalized at level. If weak is true, lowered
+// type-variables will also be marked as weakly-polymorphic.
+//
+// Type-variables which only occur within covariant positions may be safely generalized. Function types flip the variance of
+// their arguments, but closures are assumed not to capture mutable state which is not reflected in their types.
+func (ctx *CommonContext) RestrictExpansive(level uint, t types.Type, weak bool) {
+	r := restricter{ctx: ctx, level: level, weak: weak}
+	const mutable = false
+	r.visit(t, types.Covariant, mutable)
+}
+
+type restricter struct {
+	ctx   *CommonContext
+	level uint
+	weak  bool
+	seen  map[*types.Recursive]bool
+}
+
+func (r *restricter) visit(t types.Type, v types.Variance, mutable bool) {
+	if v == types.Bivariant {
+		return
+	}
+	switch t := t.(type) {
+	case *types.Var:
+		switch {
+		case t.IsLinkVar():
+			r.visit(t.Link(), v, mutable)
+		case t.IsUnboundVar() && mutable && v.IsConsumed() && t.LevelNum() > r.level:
+			t.SetLevelNum(r.level)
+			if r.weak {
+				t.SetWeak()
+			}
+		}
+
+	case *types.RecursiveLink:
+		rec := t.Recursive
+		if !rec.IsEquiRecursive() || r.seen[rec] {
+			return
+		}
+		if r.seen == nil {
+			r.seen = make(map[*types.Recursive]bool)
+		}
+		r.seen[rec] = true
+		for _, alias := range rec.Types {
+			r.visit(alias, v, mutable)
+		}
+
+	case *types.App:
+		// Parameters of type constructors without declared variances are assumed to be covariant. Parameters of
+		// higher-kinded type-variables may be instantiated with any type constructor, so they are assumed to be invariant:
+		defaultVariance, variances := types.Covariant, []types.Variance(nil)
+		switch c := types.RealType(t.Const).(type) {
+		case *types.Const:
+			switch {
+			case types.IsRefType(t):
+				variances = types.RefVariance
+			case types.IsReadRefType(t):
+				variances = types.ReadRefVariance
+			case r.ctx.Variance != nil:
+				variances = r.ctx.Variance(c.Name)
+			}
+		default:
+			defaultVariance = types.Invariant
+			r.visit(c, v.Compose(types.Invariant), true)
+		}
+		for i, param := range t.Params {
+			pv := defaultVariance
+			if i < len(variances) {
+				pv = variances[i]
+			}
+			r.visit(param, v.Compose(pv), mutable || pv.IsConsumed())
+		}
+		if t.Underlying != nil {
+			r.visit(t.Underlying, v, mutable)
+		}
+
+	case *types.Arrow:
+		for _, arg := range t.Args {
+			r.visit(arg, v.Flip(), mutable)
+		}
+		r.visit(t.Return, v, mutable)
+		if t.Effects != nil {
+			r.visit(t.Effects, v, mutable)
+		}
+
+	case *types.Existential:
+		r.visit(t.Body, v, mutable)
+
+	case *types.Record:
+		r.visit(t.Row, v, mutable)
+
+	case *types.Variant:
+		r.visit(t.Row, v, mutable)
+
+	case *types.RowExtend:
+		t.Labels.Range(func(label string, ts types.TypeList) bool {
+			ts.Range(func(i int, t types.Type) bool {
+				r.visit(t, v, mutable)
+				return true
+			})
+			return true
+		})
+		r.visit(t.Row, v, mutable)
+
+	case *types.SizeExpr:
+		for _, arg := range t.Args {
+			r.visit(arg, v, mutable)
+		}
+
+	case *types.Measure:
+		for _, f := range t.Factors {
+			r.visit(f.Unit, v, mutable)
+		}
+	}
+}
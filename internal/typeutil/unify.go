@@ -29,21 +29,32 @@ import (
 	"github.com/wdamron/poly/types"
 )
 
+var errImplicitlyRecursive = errors.New("Implicitly recursive types are not supported")
+var errSkolemEscape = errors.New("Hidden type of an existential type escapes its scope")
+
 // See "Efficient Generalization with Levels" (Oleg Kiselyov)
 // http://okmij.org/ftp/ML/generalization.html#levels
 //
 // This implementation follows the sound_eager algorithm.
 func (ctx *CommonContext) occursAdjustLevels(id, level uint, t types.Type) error {
+	if ctx.MaxUnifySteps != 0 || ctx.Done != nil {
+		if err := ctx.step(); err != nil {
+			return err
+		}
+	}
 	switch t := t.(type) {
 	case *types.Var:
 		switch {
 		case t.IsLinkVar():
 			return ctx.occursAdjustLevels(id, level, t.Link())
 		case t.IsGenericVar():
+			if ctx.isQuantified(t.Id()) {
+				return nil
+			}
 			return errors.New("Types must be instantiated before checking for recursion")
 		default: // weak or unbound
 			if t.Id() == id {
-				return errors.New("Implicitly recursive types are not supported")
+				return errImplicitlyRecursive
 			}
 			if t.LevelNum() > level {
 				if ctx.Speculate {
@@ -76,6 +87,11 @@ func (ctx *CommonContext) occursAdjustLevels(id, level uint, t types.Type) error
 				return err
 			}
 		}
+		if t.Effects != nil {
+			if err := ctx.occursAdjustLevels(id, level, t.Effects); err != nil {
+				return err
+			}
+		}
 		return ctx.occursAdjustLevels(id, level, t.Return)
 
 	case *types.Record:
@@ -98,11 +114,379 @@ func (ctx *CommonContext) occursAdjustLevels(id, level uint, t types.Type) error
 		}
 		return ctx.occursAdjustLevels(id, level, t.Row)
 
+	case *types.SizeExpr:
+		for _, arg := range t.Args {
+			if err := ctx.occursAdjustLevels(id, level, arg); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *types.Measure:
+		for _, f := range t.Factors {
+			if err := ctx.occursAdjustLevels(id, level, f.Unit); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *types.Skolem:
+		// Skolem constants may not be bound to type-variables outside of the scope where they are defined:
+		if t.Level > level {
+			return errSkolemEscape
+		}
+		return nil
+
+	case *types.Existential:
+		ctx.ExistentialStack = append(ctx.ExistentialStack, t)
+		err := ctx.occursAdjustLevels(id, level, t.Body)
+		ctx.ExistentialStack = ctx.ExistentialStack[:len(ctx.ExistentialStack)-1]
+		return err
+
+	case *types.RecursiveLink:
+		rec := t.Recursive
+		if !rec.IsEquiRecursive() {
+			return nil
+		}
+		for _, visiting := range ctx.RecStack {
+			if visiting == rec { // break cycles
+				return nil
+			}
+		}
+		ctx.RecStack = append(ctx.RecStack, rec)
+		err := ctx.occursAdjustLevels(id, level, rec.Types[t.Index])
+		ctx.RecStack = ctx.RecStack[:len(ctx.RecStack)-1]
+		return err
+
 	default:
 		return nil
 	}
 }
 
+// Size expressions are unified by solving a linear equation for one of the unknown sizes. Size expressions
+// which cannot be represented linearly (i.e. the maximum of unknown sizes) are unified structurally.
+func (ctx *CommonContext) unifySizes(a, b types.Type) error {
+	la, err := types.Linearize(a)
+	if err != nil {
+		return err
+	}
+	lb, err := types.Linearize(b)
+	if err != nil {
+		return err
+	}
+	diff := la.Sub(lb)
+	if len(diff.Terms) == 0 {
+		if diff.Constant != 0 {
+			return errors.New("Failed to unify sized types with different sizes")
+		}
+		return nil
+	}
+	for i, term := range diff.Terms {
+		tv, ok := term.Unknown.(*types.Var)
+		if !ok {
+			continue
+		}
+		if solution, ok := solveLinearSize(diff, i); ok {
+			return ctx.bindSize(tv, solution)
+		}
+	}
+	// If a solution would contain a negative constant, another unknown size may be offset by a constant, then solved again:
+	for i, term := range diff.Terms {
+		if _, ok := term.Unknown.(*types.Var); !ok || (term.Coefficient != 1 && term.Coefficient != -1) {
+			continue
+		}
+		if shifted, err := ctx.shiftLinearSize(diff, i); shifted || err != nil {
+			if err != nil {
+				return err
+			}
+			return ctx.unifySizes(a, b)
+		}
+	}
+	ea, okA := a.(*types.SizeExpr)
+	eb, okB := b.(*types.SizeExpr)
+	if okA && okB && ea.Op == eb.Op && len(ea.Args) == len(eb.Args) {
+		for i, arg := range ea.Args {
+			if err := ctx.Unify(arg, eb.Args[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.New("Failed to solve size equation")
+}
+
+// Solve diff = 0 for the unknown size at the given index. The solution must be a non-negative linear combination
+// of the remaining unknown sizes.
+func solveLinearSize(diff types.LinearSize, index int) (types.LinearSize, bool) {
+	c := diff.Terms[index].Coefficient
+	if diff.Constant%c != 0 {
+		return types.LinearSize{}, false
+	}
+	rest := types.LinearSize{Terms: make([]types.LinearTerm, 0, len(diff.Terms)-1), Constant: -diff.Constant / c}
+	for j, term := range diff.Terms {
+		if j == index {
+			continue
+		}
+		if term.Coefficient%c != 0 || term.Coefficient/c > 0 {
+			return types.LinearSize{}, false
+		}
+		rest.Terms = append(rest.Terms, types.LinearTerm{Unknown: term.Unknown, Coefficient: -term.Coefficient / c})
+	}
+	return rest, rest.Constant >= 0
+}
+
+// Offset an unknown size within the solution for the (unit) unknown size at the given index, so the solution's constant
+// will be non-negative: the unknown size is bound to a fresh size plus a constant.
+func (ctx *CommonContext) shiftLinearSize(diff types.LinearSize, index int) (bool, error) {
+	c := diff.Terms[index].Coefficient
+	offset := -diff.Constant * c
+	if offset >= 0 {
+		return false, nil
+	}
+	var shiftVar *types.Var
+	var shiftCoefficient int
+	for j, term := range diff.Terms {
+		coefficient := -term.Coefficient * c
+		if j == index {
+			continue
+		}
+		if coefficient < 0 {
+			return false, nil
+		}
+		if tv, ok := term.Unknown.(*types.Var); ok && shiftVar == nil {
+			shiftVar, shiftCoefficient = tv, coefficient
+		}
+	}
+	if shiftVar == nil {
+		return false, nil
+	}
+	fresh := ctx.VarTracker.New(shiftVar.LevelNum())
+	fresh.RestrictSizeVar()
+	shift := (-offset + shiftCoefficient - 1) / shiftCoefficient
+	return true, ctx.bindSize(shiftVar, types.LinearSize{Terms: []types.LinearTerm{{Unknown: fresh, Coefficient: 1}}, Constant: shift})
+}
+
+// Bind a size type-variable to the solution of a size equation.
+func (ctx *CommonContext) bindSize(tv *types.Var, solution types.LinearSize) error {
+	t, _ := solution.Type()
+	e, ok := t.(*types.SizeExpr)
+	if !ok {
+		return ctx.Unify(tv, t)
+	}
+	if tv.IsGenericVar() {
+		return errors.New("Generic type-variable was not instantiated before unification")
+	}
+	if ctx.Speculate {
+		ctx.StashLink(tv)
+	}
+	if err := ctx.occursAdjustLevels(tv.Id(), tv.LevelNum(), e); err != nil {
+		return err
+	}
+	// Unknown sizes within the solution are restricted to sizes:
+	for _, term := range solution.Terms {
+		if arg, ok := term.Unknown.(*types.Var); ok && !arg.IsRestrictedVar() {
+			if ctx.Speculate {
+				ctx.StashLink(arg)
+			}
+			arg.RestrictSizeVar()
+		}
+	}
+	if err := ctx.applyConstraints(tv, e); err != nil {
+		return err
+	}
+	tv.SetLink(e)
+	return ctx.applySizeBounds(tv)
+}
+
+// Check the size bounds for a linked type-variable. Bounds which contain unknown sizes are propagated to
+// the unknown size type-variables, to be checked when the sizes become concrete.
+func (ctx *CommonContext) applySizeBounds(tv *types.Var) error {
+	for _, bound := range tv.SizeBounds() {
+		satisfied, known, err := bound.Check()
+		if err != nil {
+			return err
+		}
+		if known {
+			if !satisfied {
+				return &types.SizeBoundError{Bound: bound}
+			}
+			continue
+		}
+		for _, v := range bound.Vars() {
+			if bound.AttachedTo(v) {
+				continue
+			}
+			if ctx.Speculate {
+				ctx.StashLink(v)
+			}
+			v.AddSizeBound(bound)
+		}
+	}
+	return nil
+}
+
+// Units of measure are unified modulo the equations of abelian groups, by solving a * b^-1 = 1 for unit type-variables.
+//
+// See "Types for Units-of-Measure: Theory and Practice" (Andrew Kennedy)
+func (ctx *CommonContext) unifyMeasures(a, b types.Type) error {
+	ma, err := asMeasure(a)
+	if err != nil {
+		return err
+	}
+	mb, err := asMeasure(b)
+	if err != nil {
+		return err
+	}
+	for {
+		m := ma.Mul(mb.Pow(-1)).Normalize()
+		if len(m.Factors) == 0 {
+			return nil
+		}
+		// find the unit type-variable with the smallest exponent:
+		var tv *types.Var
+		var x int
+		for _, f := range m.Factors {
+			if v, ok := f.Unit.(*types.Var); ok && (tv == nil || abs(f.Exponent) < abs(x)) {
+				tv, x = v, f.Exponent
+			}
+		}
+		if tv == nil {
+			return errors.New("Failed to unify units of measure " + types.TypeString(a) + " and " + types.TypeString(b))
+		}
+		varsDivisible, constsDivisible := true, true
+		for _, f := range m.Factors {
+			if _, ok := f.Unit.(*types.Var); ok {
+				varsDivisible = varsDivisible && f.Exponent%x == 0
+			} else {
+				constsDivisible = constsDivisible && f.Exponent%x == 0
+			}
+		}
+		if varsDivisible && !constsDivisible {
+			return errors.New("Failed to unify units of measure " + types.TypeString(a) + " and " + types.TypeString(b))
+		}
+		// If x divides all exponents, tv is solved. Otherwise, tv is bound to a fresh unit type-variable and the
+		// exponents of the remaining unit type-variables, which will be reduced before solving again.
+		var factors []types.MeasureFactor
+		if !varsDivisible {
+			fresh := ctx.VarTracker.New(tv.LevelNum())
+			fresh.RestrictMeasureVar()
+			factors = append(factors, types.MeasureFactor{Unit: fresh, Exponent: 1})
+		}
+		for _, f := range m.Factors {
+			if _, ok := f.Unit.(*types.Var); (varsDivisible || ok) && f.Unit != tv {
+				factors = append(factors, types.MeasureFactor{Unit: f.Unit, Exponent: -f.Exponent / x})
+			}
+		}
+		if err := ctx.bindMeasure(tv, types.NewMeasure(factors...).Normalize()); err != nil {
+			return err
+		}
+		if varsDivisible {
+			return nil
+		}
+	}
+}
+
+func asMeasure(t types.Type) (*types.Measure, error) {
+	switch t := t.(type) {
+	case *types.Measure:
+		return t, nil
+	case *types.Var:
+		if t.IsRestrictedVar() && !t.IsMeasureVar() {
+			return nil, errors.New("Failed to unify unit of measure with restricted type-variable")
+		}
+		return types.NewMeasure(types.MeasureFactor{Unit: t, Exponent: 1}), nil
+	}
+	return nil, errors.New("Failed to unify unit of measure with " + types.TypeName(t))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Bind a unit type-variable to a (normalized) unit of measure.
+func (ctx *CommonContext) bindMeasure(tv *types.Var, m *types.Measure) error {
+	if len(m.Factors) == 1 && m.Factors[0].Exponent == 1 {
+		if v, ok := m.Factors[0].Unit.(*types.Var); ok {
+			return ctx.Unify(tv, v)
+		}
+	}
+	if tv.IsGenericVar() {
+		return errors.New("Generic type-variable was not instantiated before unification")
+	}
+	if ctx.Speculate {
+		ctx.StashLink(tv)
+	}
+	if err := ctx.occursAdjustLevels(tv.Id(), tv.LevelNum(), m); err != nil {
+		return err
+	}
+	// Unit type-variables within the unit of measure are restricted to units:
+	for _, f := range m.Factors {
+		if v, ok := f.Unit.(*types.Var); ok && !v.IsRestrictedVar() {
+			if ctx.Speculate {
+				ctx.StashLink(v)
+			}
+			v.RestrictMeasureVar()
+		}
+	}
+	if err := ctx.applyConstraints(tv, m); err != nil {
+		return err
+	}
+	tv.SetLink(m)
+	return nil
+}
+
+// Bind a type-variable to an equi-recursive type, where the type-variable occurs within t.
+func (ctx *CommonContext) bindEquiRecursive(tv *types.Var, t types.Type) error {
+	if err := ctx.applyConstraints(tv, t); err != nil {
+		return err
+	}
+	level := tv.LevelNum()
+	rec := &types.Recursive{Flags: types.EquiRecursive | types.NeedsGeneralization}
+	rec.AddType("", &types.App{Const: &types.Const{Name: "rec"}, Underlying: t})
+	link := &types.RecursiveLink{Recursive: rec}
+	tv.SetLink(link)
+	// Occurrences of the type-variable now point back to the recursive type:
+	return ctx.occursAdjustLevels(tv.Id(), level, link)
+}
+
+// Equi-recursive types are unified coinductively: unification of an equi-recursive type with another type
+// is assumed to succeed while unifying their unrolled types.
+func (ctx *CommonContext) unifyEquiRecursive(a, b types.Type) error {
+	ka, kb := equiKey(a), equiKey(b)
+	for _, assumed := range ctx.Assumptions {
+		if (assumed.A == ka && assumed.B == kb) || (assumed.A == kb && assumed.B == ka) {
+			return nil
+		}
+	}
+	ctx.Assumptions = append(ctx.Assumptions, EquiAssumption{ka, kb})
+	err := ctx.Unify(unrollEquiRecursive(a), unrollEquiRecursive(b))
+	ctx.Assumptions = ctx.Assumptions[:len(ctx.Assumptions)-1]
+	return err
+}
+
+func isEquiRecursive(t types.Type) bool {
+	link, ok := t.(*types.RecursiveLink)
+	return ok && link.Recursive.IsEquiRecursive()
+}
+
+func unrollEquiRecursive(t types.Type) types.Type {
+	if link, ok := t.(*types.RecursiveLink); ok && link.Recursive.IsEquiRecursive() {
+		return link.Recursive.Types[link.Index].Underlying
+	}
+	return t
+}
+
+// Links to the same equi-recursive type may be distinct, so the recursive type-group identifies the link.
+func equiKey(t types.Type) interface{} {
+	if link, ok := t.(*types.RecursiveLink); ok && link.Recursive.IsEquiRecursive() {
+		return link.Recursive
+	}
+	return t
+}
+
 type UnifyTxn struct {
 	Speculate           bool
 	LinkStash           []StashedLink
@@ -131,6 +515,13 @@ func (ctx *CommonContext) CanUnify(a, b types.Type) bool {
 	return err == nil
 }
 
+func (ctx *CommonContext) CheckUnify(a, b types.Type) error {
+	txn := ctx.NewUnifyTxn()
+	err := ctx.Unify(a, b)
+	ctx.Rollback(txn)
+	return err
+}
+
 func (ctx *CommonContext) TryUnify(a, b types.Type) error {
 	txn := ctx.NewUnifyTxn()
 	if err := ctx.Unify(a, b); err != nil {
@@ -163,10 +554,18 @@ func (ctx *CommonContext) applyConstraints(a *types.Var, b types.Type) error {
 	bv, bIsVar := b.(*types.Var)
 	// Ensure size type-variables are only linked to size types (or other type-variables):
 	if a.IsSizeVar() && !bIsVar {
-		if _, ok := b.(types.Size); !ok {
+		switch b.(type) {
+		case types.Size, *types.SizeExpr:
+		default:
 			return errors.New("Failed to unify size type-variable with " + b.TypeName())
 		}
 	}
+	// Ensure unit type-variables are only linked to units of measure (or other type-variables):
+	if a.IsMeasureVar() && !bIsVar {
+		if _, ok := b.(*types.Measure); !ok {
+			return errors.New("Failed to unify unit type-variable with " + b.TypeName())
+		}
+	}
 	// Ensure constructor/constant type-variables are only linked to type constants (or other type-variables):
 	if a.IsConstVar() && !bIsVar {
 		if _, ok := b.(*types.Const); !ok {
@@ -194,6 +593,10 @@ func (ctx *CommonContext) applyConstraints(a *types.Var, b types.Type) error {
 		return nil
 	}
 	// Eliminate instance constraints (find a matching instance for each type-class):
+	var overlays types.ClassOverlays
+	if ctx.ClassOverlays != nil {
+		overlays = ctx.ClassOverlays()
+	}
 	for _, c := range acs {
 		// Overlapping instances are detected when they are declared. Overlap is only allowed
 		// between instances where one is a subclass of the other, and the search order ensures
@@ -201,7 +604,10 @@ func (ctx *CommonContext) applyConstraints(a *types.Var, b types.Type) error {
 		// overlap will be re-checked after inference during deferred unification (when enabled).
 		var firstMatch, lastMatch *types.Instance
 		overlapping := false
-		c.TypeClass.MatchInstance(b, func(inst *types.Instance) (done bool) {
+		overlays.MatchInstance(c.TypeClass, b, func(inst *types.Instance) (done bool) {
+			if ctx.InstanceVisible != nil && !ctx.InstanceVisible(inst) {
+				return false
+			}
 			if ctx.CanUnify(b, ctx.Instantiate(a.LevelNum(), inst.Param)) {
 				// Sub-classes are visited first:
 				if lastMatch != nil && !lastMatch.TypeClass.HasSuperClass(inst.TypeClass) {
@@ -226,17 +632,89 @@ func (ctx *CommonContext) applyConstraints(a *types.Var, b types.Type) error {
 			const forceGeneralize, weak = false, true
 			GeneralizeOpts(a.Level(), b, forceGeneralize, weak)
 			ctx.DeferredConstraints = append(ctx.DeferredConstraints, DeferredConstraint{a, ctx.CurrentExpr})
+			if ctx.ConstraintDeferred != nil && !ctx.Speculate {
+				ctx.ConstraintDeferred(c.TypeClass, b, ctx.CurrentExpr)
+			}
 			continue
 		}
 		// If only one matching instance is found, it can be safely unified with the candidate type (err should always be nil):
 		if err := ctx.Unify(b, ctx.Instantiate(a.LevelNum(), firstMatch.Param)); err != nil {
 			return err
 		}
+		if ctx.InstanceSelected != nil && !ctx.Speculate {
+			ctx.InstanceSelected(c.TypeClass, b, firstMatch)
+		}
 	}
 	return nil
 }
 
+// Check if the generic type-variable with the given id is quantified by an existential type being visited.
+func (ctx *CommonContext) isQuantified(id uint) bool {
+	for _, ex := range ctx.ExistentialStack {
+		if ex.Binds(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lower the binding-levels of type-variables within t to level, when leaving the scope where skolem constants were defined.
+// An error will be returned if t contains a skolem constant defined above level.
+func (ctx *CommonContext) LeaveSkolemScope(level uint, t types.Type) error {
+	const noVar = ^uint(0)
+	return ctx.occursAdjustLevels(noVar, level, types.RealType(t))
+}
+
+// Create a skolem constant which is defined within the scope at the given binding-level.
+func (ctx *CommonContext) NewSkolem(level uint) *types.Skolem {
+	sk := &types.Skolem{Id: ctx.VarTracker.NextId, Level: level}
+	ctx.VarTracker.NextId++
+	return sk
+}
+
+// Existential types are unified by opening both types with the same skolem constants, so the hidden types must be equivalent.
+func (ctx *CommonContext) unifyExistentials(a, b *types.Existential) error {
+	if len(a.Vars) != len(b.Vars) {
+		return errors.New("Cannot unify existential types with differing numbers of quantified type-variables")
+	}
+	skolems := make([]types.Type, len(a.Vars))
+	for i := range skolems {
+		skolems[i] = ctx.NewSkolem(skolemUnifyLevel)
+	}
+	// Any type-variable bound to a skolem constant would expose a hidden type:
+	return ctx.Unify(ctx.OpenExistential(skolemUnifyLevel, a, skolems), ctx.OpenExistential(skolemUnifyLevel, b, skolems))
+}
+
+// Skolem constants created during unification of existential types may not be bound to any type-variable.
+const skolemUnifyLevel = 1<<24 - 1
+
+// Opaque types are unified by name when their underlying types are hidden.
+func (ctx *CommonContext) isOpaque(app *types.App) bool {
+	if ctx.IsOpaque == nil {
+		return false
+	}
+	c, ok := types.RealType(app.Const).(*types.Const)
+	return ok && ctx.IsOpaque(c.Name)
+}
+
+// Unify an actual type with an expected type, such as the type of an argument with a parameter type. A mutable reference-type
+// may be coerced to an expected read-only reference-type, since read-only references are covariant in their referenced type.
+func (ctx *CommonContext) Coerce(expected, actual types.Type) error {
+	if e, ok := types.RealType(expected).(*types.App); ok && types.IsReadRefType(e) {
+		if a, ok := types.RealType(actual).(*types.App); ok && types.IsRefType(a) {
+			return ctx.Unify(e.Params[0], a.Params[0])
+		}
+	}
+	return ctx.Unify(expected, actual)
+}
+
 func (ctx *CommonContext) Unify(a, b types.Type) error {
+	if ctx.MaxUnifySteps != 0 || ctx.Done != nil {
+		if err := ctx.step(); err != nil {
+			return err
+		}
+	}
+
 	// Path compression:
 	a, b = types.RealType(a), types.RealType(b)
 
@@ -246,9 +724,12 @@ func (ctx *CommonContext) Unify(a, b types.Type) error {
 
 	// unify with recursive types:
 
+	if isEquiRecursive(a) || isEquiRecursive(b) {
+		return ctx.unifyEquiRecursive(a, b)
+	}
 	if a, ok := a.(*types.RecursiveLink); ok {
 		if b, ok := b.(*types.RecursiveLink); ok {
-			if !a.Recursive.Matches(b.Recursive) || a.Index != b.Index {
+			if a.Index != b.Index || !(a.Recursive.Matches(b.Recursive) || types.RecursiveEquivalent(a.Recursive.Root(), b.Recursive.Root())) {
 				return errors.New("Failed to unify recursive type links")
 			}
 			// All unifiable type-variables should occur within the recursive group's type-parameters.
@@ -267,6 +748,24 @@ func (ctx *CommonContext) Unify(a, b types.Type) error {
 		return ctx.Unify(a, b.Link())
 	}
 
+	// unify size expressions:
+
+	if _, ok := a.(*types.SizeExpr); ok {
+		return ctx.unifySizes(a, b)
+	}
+	if _, ok := b.(*types.SizeExpr); ok {
+		return ctx.unifySizes(a, b)
+	}
+
+	// unify units of measure:
+
+	if _, ok := a.(*types.Measure); ok {
+		return ctx.unifyMeasures(a, b)
+	}
+	if _, ok := b.(*types.Measure); ok {
+		return ctx.unifyMeasures(a, b)
+	}
+
 	// unify type variables:
 
 	avar, _ := a.(*types.Var)
@@ -310,7 +809,10 @@ func (ctx *CommonContext) Unify(a, b types.Type) error {
 		}
 		// prevent cyclical types:
 		if err := ctx.occursAdjustLevels(avar.Id(), avar.LevelNum(), b); err != nil {
-			return err
+			if err != errImplicitlyRecursive || !ctx.EquiRecursiveTypes {
+				return err
+			}
+			return ctx.bindEquiRecursive(avar, b)
 		}
 		// propagate or eliminate type-class constraints:
 		if err := ctx.applyConstraints(avar, b); err != nil {
@@ -318,7 +820,7 @@ func (ctx *CommonContext) Unify(a, b types.Type) error {
 		}
 
 		avar.SetLink(b)
-		return nil
+		return ctx.applySizeBounds(avar)
 	}
 
 	// unify aliased types:
@@ -326,10 +828,10 @@ func (ctx *CommonContext) Unify(a, b types.Type) error {
 	aliasA, _ := a.(*types.App)
 	aliasB, _ := b.(*types.App)
 	var underA, underB types.Type
-	if aliasA != nil && aliasA.Underlying != nil {
+	if aliasA != nil && aliasA.Underlying != nil && !ctx.isOpaque(aliasA) {
 		underA = aliasA.Underlying
 	}
-	if aliasB != nil && aliasB.Underlying != nil {
+	if aliasB != nil && aliasB.Underlying != nil && !ctx.isOpaque(aliasB) {
 		underB = aliasB.Underlying
 	}
 	switch {
@@ -418,6 +920,10 @@ func (ctx *CommonContext) Unify(a, b types.Type) error {
 		if err := ctx.Unify(a.Return, b.Return); err != nil {
 			return err
 		}
+		// Effects are only unified if they are tracked for both functions:
+		if a.Effects != nil && b.Effects != nil {
+			return ctx.Unify(a.Effects, b.Effects)
+		}
 		return nil
 
 	case *types.Record:
@@ -440,6 +946,16 @@ func (ctx *CommonContext) Unify(a, b types.Type) error {
 			return nil
 		}
 
+	case *types.Existential:
+		if b, ok := b.(*types.Existential); ok {
+			return ctx.unifyExistentials(a, b)
+		}
+
+	case *types.Skolem:
+		if _, ok := b.(*types.Skolem); ok {
+			return errors.New("Failed to unify distinct hidden types of existential types")
+		}
+
 	}
 
 	return errors.New("Failed to unify " + types.TypeName(a) + " with " + types.TypeName(b))
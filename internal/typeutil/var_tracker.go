@@ -23,6 +23,8 @@
 package typeutil
 
 import (
+	"sync"
+
 	"github.com/wdamron/poly/types"
 )
 
@@ -53,18 +55,78 @@ func (vs VarList) Tail() VarList {
 	return VarList{length: vs.length - 1, list: vs.list.tail}
 }
 
+// Type-variables are allocated in small blocks, since a block is retained while any of its type-variables are referenced
+// (e.g. by generalized types). Larger blocks were measured to slow down inference of small expressions.
+const varBlockSize = 8
+
+// varBlock holds the unused type-variables of a block within varBlocks.
+type varBlock struct{ vars []varList }
+
+// varBlocks is a pool of partially used blocks, released by type-variable trackers which are discarded. The type-variables
+// within a released block have not been referenced by any type.
+var varBlocks sync.Pool
+
 // VarTracker allocates type-variables and tracks allocations.
+//
+// Type-variables are allocated in blocks. Unused type-variables within the current block are retained after
+// a reset, since they have not been referenced by any type; trackers which are discarded may release their unused
+// type-variables to a shared pool (see Release).
 type VarTracker struct {
 	NextId uint
 	count  int
 	head   *varList
 	block  []varList
+	pooled *varBlock // holder of a block taken from varBlocks, reused when the tracker is released
 }
 
-func (vt *VarTracker) Reset() { vt.count, vt.head, vt.block = 0, nil, nil }
+func (vt *VarTracker) Reset() { vt.count, vt.head = 0, nil }
 
 func (vt *VarTracker) List() VarList { return VarList{length: vt.count, list: vt.head} }
 
+// Len returns the number of tracked type-variables.
+func (vt *VarTracker) Len() int { return vt.count }
+
+// Append moves the type-variables tracked by other into vt, as if they were allocated after the type-variables
+// already tracked by vt. The next id for vt is not modified. If vt has no unused type-variables, the unused
+// type-variables of other's current block are also moved into vt.
+func (vt *VarTracker) Append(other *VarTracker) {
+	if other.head == nil {
+		return
+	}
+	last := other.head
+	for last.tail != nil {
+		last = last.tail
+	}
+	last.tail, vt.head, vt.count = vt.head, other.head, vt.count+other.count
+	other.count, other.head = 0, nil
+	if len(vt.block) == 0 {
+		vt.block, other.block = other.block, nil
+	}
+}
+
+// Release the unused type-variables of the current block to a shared pool, for allocation within other trackers.
+// The tracker should be discarded, or reset before further allocations.
+func (vt *VarTracker) Release() {
+	if len(vt.block) == 0 {
+		return
+	}
+	b := vt.pooled
+	if b == nil {
+		b = &varBlock{}
+	}
+	b.vars, vt.block, vt.pooled = vt.block, nil, nil
+	varBlocks.Put(b)
+}
+
+// RenumberSince replaces the ids of type-variables tracked after the first n type-variables.
+func (vt *VarTracker) RenumberSince(n int, renumber func(id uint) uint) {
+	nd := vt.head
+	for i := vt.count; i > n; i-- {
+		nd.head.SetId(renumber(nd.head.Id()))
+		nd = nd.tail
+	}
+}
+
 func (vt *VarTracker) FlattenLinks() {
 	for nd := vt.head; nd != nil; nd = nd.tail {
 		nd.head.Flatten()
@@ -73,7 +135,11 @@ func (vt *VarTracker) FlattenLinks() {
 
 func (vt *VarTracker) New(level uint) *types.Var {
 	if len(vt.block) == 0 {
-		vt.block = make([]varList, 8)
+		if b, ok := varBlocks.Get().(*varBlock); ok {
+			vt.block, b.vars, vt.pooled = b.vars, nil, b
+		} else {
+			vt.block = make([]varList, varBlockSize)
+		}
 	}
 	nd := &vt.block[0]
 	tv := &nd.head
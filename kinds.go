@@ -0,0 +1,390 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"github.com/wdamron/poly/types"
+)
+
+// KindError is returned when a type is not well-kinded.
+type KindError struct {
+	// Type is the (sub-)type which is not well-kinded.
+	Type     types.Type
+	Expected types.Kind
+	Actual   types.Kind
+}
+
+func (err *KindError) Error() string {
+	return "Kind mismatch for type " + types.TypeString(err.Type) + ": expected " + types.KindString(err.Expected) + ", found " + types.KindString(err.Actual)
+}
+
+var builtinKinds = map[string]types.Kind{
+	types.RefType.Name:     types.NewConstructorKind(types.Star),
+	types.ReadRefType.Name: types.NewConstructorKind(types.Star),
+}
+
+// Declare a named type constructor with a kind within the type environment.
+//
+// Kinds of type constructors will be checked when declaring type-classes and instances, and when declaring types with DeclareChecked.
+// Kinds will be inferred for type constructors which are not declared.
+func (e *TypeEnv) DeclareKind(name string, kind types.Kind) *types.Const {
+	e.checkMutable()
+	if e.kinds == nil {
+		e.kinds = make(map[string]types.Kind)
+	}
+	e.kinds[name] = kind
+	return e.DeclareTypeConstructor(name)
+}
+
+// Lookup the declared kind of a type constructor in the environment or its parent environment(s). If the type constructor
+// has no declared kind, nil will be returned.
+func (e *TypeEnv) LookupKind(name string) types.Kind {
+	if env := e.typeConstructorEnv(name, make(map[*TypeEnv]bool)); env != nil {
+		if kind, ok := env.kinds[name]; ok {
+			return kind
+		}
+	}
+	return builtinKinds[name]
+}
+
+// Infer the kind of t within the type environment. Kinds of type-variables and undeclared type constructors will be inferred,
+// and a *KindError will be returned if t is not well-kinded.
+func (e *TypeEnv) CheckKind(t types.Type) (types.Kind, error) {
+	kc := newKindChecker(e)
+	return kc.infer(t)
+}
+
+// Declare a type for an identifier within the type environment, after checking that the type is well-kinded.
+//
+// Type-variables contained within mutable reference-types will be generalized.
+func (e *TypeEnv) DeclareChecked(name string, t types.Type) error {
+	if e.frozen {
+		return errFrozen
+	}
+	kc := newKindChecker(e)
+	if err := kc.check(t, types.Star); err != nil {
+		return err
+	}
+	e.Declare(name, t)
+	return nil
+}
+
+// Infer the kind of a type-class parameter from its method declarations. Unresolved kinds will default to `*`.
+func (e *TypeEnv) inferParamKind(param *types.Var, methods types.MethodSet, implements []*types.TypeClass) (types.Kind, error) {
+	kc := newKindChecker(e)
+	for _, arrow := range methods {
+		if err := kc.check(arrow, types.Star); err != nil {
+			return nil, err
+		}
+	}
+	kind, err := kc.infer(param)
+	if err != nil {
+		return nil, err
+	}
+	kind = defaultKind(kind)
+	for _, super := range implements {
+		if super.ParamKind != nil && !kc.unify(kind, super.ParamKind) {
+			return nil, &KindError{Type: param, Expected: super.ParamKind, Actual: kind}
+		}
+	}
+	return kind, nil
+}
+
+// Check that an instance type matches the kind of a type-class parameter.
+func (e *TypeEnv) checkInstanceKind(tc *types.TypeClass, param types.Type) error {
+	kc := newKindChecker(e)
+	kind, err := kc.infer(param)
+	if err != nil {
+		return err
+	}
+	if tc.ParamKind != nil && !kc.unify(kind, tc.ParamKind) {
+		return &KindError{Type: param, Expected: tc.ParamKind, Actual: kind}
+	}
+	return nil
+}
+
+type kindChecker struct {
+	env    *TypeEnv
+	vars   map[uint]types.Kind   // inferred kinds for type-variables
+	consts map[string]types.Kind // inferred kinds for undeclared type constructors
+	seen   map[*types.Recursive]bool
+	nextId uint
+}
+
+func newKindChecker(env *TypeEnv) *kindChecker {
+	return &kindChecker{
+		env:    env,
+		vars:   make(map[uint]types.Kind),
+		consts: make(map[string]types.Kind),
+		seen:   make(map[*types.Recursive]bool),
+	}
+}
+
+func (kc *kindChecker) newVar() *types.KindVar {
+	kc.nextId++
+	return &types.KindVar{Id: kc.nextId - 1}
+}
+
+func (kc *kindChecker) check(t types.Type, expected types.Kind) error {
+	kind, err := kc.infer(t)
+	if err != nil {
+		return err
+	}
+	if !kc.unify(kind, expected) {
+		return &KindError{Type: t, Expected: expected, Actual: kind}
+	}
+	return nil
+}
+
+func (kc *kindChecker) infer(t types.Type) (types.Kind, error) {
+	t = types.RealType(t)
+	switch t := t.(type) {
+	case *types.Unit, *types.Method:
+		return types.Star, nil
+
+	case types.Size:
+		return types.SizeKindPointer, nil
+
+	case *types.SizeExpr:
+		for _, arg := range t.Args {
+			if err := kc.check(arg, types.SizeKindPointer); err != nil {
+				return nil, err
+			}
+		}
+		return types.SizeKindPointer, nil
+
+	case *types.RowEmpty:
+		return types.RowKindPointer, nil
+
+	case *types.Measure:
+		return types.MeasureKindPointer, nil
+
+	case *types.Var:
+		if kind, ok := kc.vars[t.Id()]; ok {
+			return kind, nil
+		}
+		var kind types.Kind = kc.newVar()
+		switch {
+		case t.IsSizeVar():
+			kind = types.SizeKindPointer
+		case t.IsMeasureVar():
+			kind = types.MeasureKindPointer
+		}
+		kc.vars[t.Id()] = kind
+		return kind, nil
+
+	case *types.Const:
+		if kind := kc.env.LookupKind(t.Name); kind != nil {
+			return kind, nil
+		}
+		if kind, ok := kc.consts[t.Name]; ok {
+			return kind, nil
+		}
+		kind := kc.newVar()
+		kc.consts[t.Name] = kind
+		return kind, nil
+
+	case *types.App:
+		params := make([]types.Kind, len(t.Params))
+		for i, param := range t.Params {
+			kind, err := kc.infer(param)
+			if err != nil {
+				return nil, err
+			}
+			params[i] = kind
+		}
+		if len(params) == 0 {
+			// type constants may be aliased without parameters:
+			if err := kc.check(t.Const, types.Star); err != nil {
+				return nil, err
+			}
+		} else if err := kc.check(t.Const, &types.ArrowKind{Params: params, Result: types.Star}); err != nil {
+			return nil, err
+		}
+		if t.Underlying != nil {
+			if err := kc.check(t.Underlying, types.Star); err != nil {
+				return nil, err
+			}
+		}
+		return types.Star, nil
+
+	case *types.Skolem:
+		return types.Star, nil
+
+	case *types.Existential:
+		return types.Star, kc.check(t.Body, types.Star)
+
+	case *types.Arrow:
+		for _, arg := range t.Args {
+			if err := kc.check(arg, types.Star); err != nil {
+				return nil, err
+			}
+		}
+		if t.Effects != nil {
+			if err := kc.checkEffects(t.Effects); err != nil {
+				return nil, err
+			}
+		}
+		return types.Star, kc.check(t.Return, types.Star)
+
+	case *types.Record:
+		return types.Star, kc.check(t.Row, types.RowKindPointer)
+
+	case *types.Variant:
+		return types.Star, kc.check(t.Row, types.RowKindPointer)
+
+	case *types.RowExtend:
+		var err error
+		t.Labels.Range(func(label string, ts types.TypeList) bool {
+			ts.Range(func(i int, t types.Type) bool {
+				err = kc.check(t, types.Star)
+				return err == nil
+			})
+			return err == nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return types.RowKindPointer, kc.check(t.Row, types.RowKindPointer)
+
+	case *types.RecursiveLink:
+		rec := t.Recursive
+		if !kc.seen[rec] {
+			kc.seen[rec] = true
+			for _, alias := range rec.Types {
+				if err := kc.check(alias, types.Star); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return types.Star, nil
+	}
+	return types.Star, nil
+}
+
+// Effect rows are checked separately from other rows, so type-variables for effect rows have the `effect` kind.
+func (kc *kindChecker) checkEffects(row types.Type) error {
+	switch row := types.RealType(row).(type) {
+	case *types.RowEmpty:
+		return nil
+	case *types.Var:
+		return kc.check(row, types.EffectKindPointer)
+	case *types.RowExtend:
+		var err error
+		row.Labels.Range(func(label string, ts types.TypeList) bool {
+			ts.Range(func(i int, t types.Type) bool {
+				err = kc.check(t, types.Star)
+				return err == nil
+			})
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+		return kc.checkEffects(row.Row)
+	default:
+		kind, err := kc.infer(row)
+		if err != nil {
+			return err
+		}
+		return &KindError{Type: row, Expected: types.EffectKindPointer, Actual: kind}
+	}
+}
+
+func (kc *kindChecker) unify(a, b types.Kind) bool {
+	a, b = types.RealKind(a), types.RealKind(b)
+	if a == b {
+		return true
+	}
+	if av, ok := a.(*types.KindVar); ok {
+		if kindOccurs(av, b) {
+			return false
+		}
+		av.Link = b
+		return true
+	}
+	if bv, ok := b.(*types.KindVar); ok {
+		return kc.unify(bv, a)
+	}
+	switch a := a.(type) {
+	case *types.StarKind:
+		_, ok := b.(*types.StarKind)
+		return ok
+	case *types.SizeKind:
+		_, ok := b.(*types.SizeKind)
+		return ok
+	case *types.RowKind:
+		_, ok := b.(*types.RowKind)
+		return ok
+	case *types.MeasureKind:
+		_, ok := b.(*types.MeasureKind)
+		return ok
+	case *types.EffectKind:
+		_, ok := b.(*types.EffectKind)
+		return ok
+	case *types.ArrowKind:
+		b, ok := b.(*types.ArrowKind)
+		if !ok || len(a.Params) != len(b.Params) {
+			return false
+		}
+		for i, param := range a.Params {
+			if !kc.unify(param, b.Params[i]) {
+				return false
+			}
+		}
+		return kc.unify(a.Result, b.Result)
+	}
+	return false
+}
+
+func kindOccurs(kv *types.KindVar, k types.Kind) bool {
+	switch k := types.RealKind(k).(type) {
+	case *types.KindVar:
+		return k == kv
+	case *types.ArrowKind:
+		for _, param := range k.Params {
+			if kindOccurs(kv, param) {
+				return true
+			}
+		}
+		return kindOccurs(kv, k.Result)
+	}
+	return false
+}
+
+// Replace unresolved kind-variables with `*`.
+func defaultKind(k types.Kind) types.Kind {
+	switch k := types.RealKind(k).(type) {
+	case *types.KindVar:
+		k.Link = types.Star
+		return types.Star
+	case *types.ArrowKind:
+		params := make([]types.Kind, len(k.Params))
+		for i, param := range k.Params {
+			params[i] = defaultKind(param)
+		}
+		return &types.ArrowKind{Params: params, Result: defaultKind(k.Result)}
+	default:
+		return k
+	}
+}
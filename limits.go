@@ -0,0 +1,212 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/types"
+)
+
+// Limits bound the resources used during inference, so that untrusted expressions may be inferred safely.
+// A zero value for any limit disables the limit.
+type Limits struct {
+	// Maximum number of unification steps, including occurs-checks and instantiation of generic types
+	UnificationSteps int
+	// Maximum size (number of type nodes, with shared sub-types counted at each occurrence) of the type of any sub-expression
+	TypeSize int
+	// Maximum depth of the type of any sub-expression
+	TypeDepth int
+	// Maximum number of fresh type-variables
+	TypeVars int
+	// Maximum number of deferred type-class constraints
+	DeferredConstraints int
+}
+
+// LimitKind identifies a resource limit for inference.
+type LimitKind uint8
+
+const (
+	UnificationStepLimit LimitKind = iota + 1
+	TypeSizeLimit
+	TypeDepthLimit
+	TypeVarLimit
+	DeferredConstraintLimit
+)
+
+func (k LimitKind) String() string {
+	switch k {
+	case UnificationStepLimit:
+		return "unification steps"
+	case TypeSizeLimit:
+		return "type size"
+	case TypeDepthLimit:
+		return "type depth"
+	case TypeVarLimit:
+		return "type-variables"
+	case DeferredConstraintLimit:
+		return "deferred constraints"
+	}
+	return "unknown"
+}
+
+// LimitError is returned when inference exceeds a configured resource limit.
+type LimitError struct {
+	Kind  LimitKind
+	Limit int
+}
+
+func (err *LimitError) Error() string {
+	return "Inference exceeded the limit on " + err.Kind.String() + " (" + strconv.Itoa(err.Limit) + ")"
+}
+
+// Set resource limits for inference. Limits apply to each subsequent inference with the context.
+//
+// By default, inference is unlimited.
+func (ti *InferenceContext) SetLimits(limits Limits) { ti.limits = limits }
+
+// Get the resource limits for inference.
+func (ti *InferenceContext) Limits() Limits { return ti.limits }
+
+// Infer the type of expr within env. Inference will stop with ctx.Err() if ctx is cancelled, or with a *LimitError
+// if a resource limit is exceeded (see SetLimits).
+//
+// A type-environment cannot be used concurrently for inference; to share a type-environment
+// across threads, freeze the shared environment (see TypeEnv.Freeze) and create a new
+// type-environment for each thread which inherits from the frozen environment.
+func (ti *InferenceContext) InferWithContext(ctx context.Context, expr ast.Expr, env *TypeEnv) (types.Type, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ti.ctx = ctx
+	t, err := ti.Infer(expr, env)
+	ti.ctx = nil
+	return t, err
+}
+
+func (ti *InferenceContext) isLimited() bool {
+	return ti.limits != Limits{} || (ti.ctx != nil && ti.ctx.Done() != nil)
+}
+
+// Check for cancellation and exceeded limits after inferring the type t of a sub-expression.
+func (ti *InferenceContext) checkLimits(env *TypeEnv, t types.Type) error {
+	if ti.ctx != nil {
+		if err := ti.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	limits := ti.limits
+	if env.common.Interrupted {
+		return &LimitError{Kind: UnificationStepLimit, Limit: limits.UnificationSteps}
+	}
+	if limits.TypeVars > 0 && env.common.VarTracker.List().Len() > limits.TypeVars {
+		return &LimitError{Kind: TypeVarLimit, Limit: limits.TypeVars}
+	}
+	if limits.DeferredConstraints > 0 && len(env.common.DeferredConstraints) > limits.DeferredConstraints {
+		return &LimitError{Kind: DeferredConstraintLimit, Limit: limits.DeferredConstraints}
+	}
+	if t == nil {
+		return nil
+	}
+	if limits.TypeSize > 0 && typeSize(t, limits.TypeSize) > limits.TypeSize {
+		return &LimitError{Kind: TypeSizeLimit, Limit: limits.TypeSize}
+	}
+	if limits.TypeDepth > 0 && typeDepth(t, make(map[types.Type]int)) > limits.TypeDepth {
+		return &LimitError{Kind: TypeDepthLimit, Limit: limits.TypeDepth}
+	}
+	return nil
+}
+
+// Get the error for interrupted unification, after the step limit was exceeded or inference was cancelled.
+func (ti *InferenceContext) interruptedError(env *TypeEnv, err error) error {
+	if env.common.Interrupted {
+		return ti.checkLimits(env, nil)
+	}
+	return err
+}
+
+// Get the size of t, counting shared sub-types at each occurrence. Counting stops after max is exceeded.
+func typeSize(t types.Type, max int) int {
+	size := 0
+	var count func(t types.Type)
+	count = func(t types.Type) {
+		if size++; size > max {
+			return
+		}
+		typeChildren(t, count)
+	}
+	count(t)
+	return size
+}
+
+// Get the depth of t. Depths of shared sub-types are memoized.
+func typeDepth(t types.Type, memo map[types.Type]int) int {
+	t = types.RealType(t)
+	if d, ok := memo[t]; ok {
+		return d
+	}
+	max := 0
+	typeChildren(t, func(child types.Type) {
+		if d := typeDepth(child, memo); d > max {
+			max = d
+		}
+	})
+	memo[t] = max + 1
+	return max + 1
+}
+
+// Call f with each direct sub-type of t. Recursive links and aliased types are not followed.
+func typeChildren(t types.Type, f func(types.Type)) {
+	switch t := types.RealType(t).(type) {
+	case *types.App:
+		f(t.Const)
+		for _, param := range t.Params {
+			f(param)
+		}
+	case *types.Arrow:
+		for _, arg := range t.Args {
+			f(arg)
+		}
+		f(t.Return)
+		if t.Effects != nil {
+			f(t.Effects)
+		}
+	case *types.Record:
+		f(t.Row)
+	case *types.Variant:
+		f(t.Row)
+	case *types.RowExtend:
+		t.Labels.Range(func(label string, ts types.TypeList) bool {
+			ts.Range(func(i int, t types.Type) bool {
+				f(t)
+				return true
+			})
+			return true
+		})
+		f(t.Row)
+	case *types.Existential:
+		f(t.Body)
+	}
+}
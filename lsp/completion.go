@@ -0,0 +1,192 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package lsp
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wdamron/poly"
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/types"
+)
+
+// Placeholder variable which is inserted at the completion position before parsing
+const holeName = "__poly_completion__"
+
+// Complete the identifier at an offset within a document.
+//
+// The identifier is replaced by a hole (a literal with an unconstrained type), and the document is re-checked.
+// The type bound to the hole is the type expected at the position; variables which are visible at the hole
+// are offered as candidates when their types unify with the expected type.
+func (s *Server) complete(doc *document, offset int) *CompletionList {
+	list := &CompletionList{Items: []CompletionItem{}}
+	start, end := identBounds(doc.text, offset)
+	prefix := doc.text[start:offset]
+	text := doc.text[:start] + holeName + doc.text[end:]
+
+	env := s.newEnv()
+	expr, _, err := s.frontend.Parse(text, env)
+	if err != nil {
+		return list
+	}
+	var expected types.Type
+	candidates := make(map[string]types.Type)
+	hole := &ast.Literal{Syntax: prefix, Construct: func(tenv types.TypeEnv, level uint, using []types.Type) (types.Type, error) {
+		if env, ok := tenv.(*poly.TypeEnv); ok {
+			visibleBindings(env, candidates)
+		}
+		tv := tenv.NewVar(level)
+		expected = tv
+		return tv, nil
+	}}
+	root, ok := replaceHole(expr, hole)
+	if !ok {
+		return list
+	}
+	// errors after the hole may still constrain the expected type, and are not reported while completing:
+	poly.NewContext().Infer(root, env)
+	if expected == nil {
+		// the hole was not reached during inference:
+		visibleBindings(env, candidates)
+	}
+
+	var names []string
+	for name := range candidates {
+		if name != holeName && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := candidates[name]
+		if expected != nil {
+			if !env.CanUnify(env.Instantiate(types.TopLevel+1, types.RealType(expected)), env.Instantiate(types.TopLevel+1, t)) {
+				continue
+			}
+		}
+		list.Items = append(list.Items, CompletionItem{Label: name, Kind: CompletionVariable, Detail: types.TypeString(t)})
+	}
+	return list
+}
+
+// Collect the types of all variables visible within env.
+func visibleBindings(env *poly.TypeEnv, bindings map[string]types.Type) {
+	for ; env != nil; env = env.Parent {
+		for name, t := range env.Types {
+			if _, shadowed := bindings[name]; !shadowed {
+				bindings[name] = t
+			}
+		}
+	}
+}
+
+// Find the bounds of the identifier which contains (or ends at) offset.
+func identBounds(text string, offset int) (start, end int) {
+	start, end = offset, offset
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:start])
+		if !isIdentRune(r) {
+			break
+		}
+		start -= size
+	}
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if !isIdentRune(r) {
+			break
+		}
+		end += size
+	}
+	return start, end
+}
+
+func isIdentRune(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+// Replace the placeholder variable within e with a hole. The (possibly replaced) root expression will be returned, along with
+// a flag indicating if the placeholder was found.
+func replaceHole(e ast.Expr, hole ast.Expr) (ast.Expr, bool) {
+	if v, ok := e.(*ast.Var); ok && v.Name == holeName {
+		return hole, true
+	}
+	found := false
+	replace := func(child *ast.Expr) {
+		if !found {
+			*child, found = replaceHole(*child, hole)
+		}
+	}
+	switch e := e.(type) {
+	case *ast.Deref:
+		replace(&e.Ref)
+	case *ast.DerefAssign:
+		replace(&e.Ref)
+		replace(&e.Value)
+	case *ast.Pipe:
+		replace(&e.Source)
+		for i := range e.Sequence {
+			replace(&e.Sequence[i])
+		}
+	case *ast.Call:
+		replace(&e.Func)
+		for i := range e.Args {
+			replace(&e.Args[i])
+		}
+	case *ast.Func:
+		replace(&e.Body)
+	case *ast.Let:
+		replace(&e.Value)
+		replace(&e.Body)
+	case *ast.LetGroup:
+		for i := range e.Vars {
+			replace(&e.Vars[i].Value)
+		}
+		replace(&e.Body)
+	case *ast.RecordSelect:
+		replace(&e.Record)
+	case *ast.RecordExtend:
+		for i := range e.Labels {
+			replace(&e.Labels[i].Value)
+		}
+		replace(&e.Record)
+	case *ast.RecordRestrict:
+		replace(&e.Record)
+	case *ast.Variant:
+		replace(&e.Value)
+	case *ast.Match:
+		replace(&e.Value)
+		for i := range e.Cases {
+			replace(&e.Cases[i].Value)
+		}
+		if e.Default != nil {
+			replace(&e.Default.Value)
+		}
+	case *ast.Pack:
+		replace(&e.Value)
+	case *ast.Unpack:
+		replace(&e.Value)
+		replace(&e.Body)
+	}
+	return e, found
+}
@@ -0,0 +1,247 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package lsp
+
+import (
+	"github.com/wdamron/poly"
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/syntax"
+	"github.com/wdamron/poly/types"
+)
+
+// document is an open text document, with the results of type-checking its most recent version.
+type document struct {
+	uri     string
+	version int
+	text    string
+	// type-annotated expression, or nil if the document could not be parsed
+	root ast.Expr
+	// source map for the type-annotated expression
+	sm          *syntax.SourceMap
+	diagnostics []Diagnostic
+}
+
+// Parse and type-check a document.
+func (s *Server) analyze(uri, text string) *document {
+	doc := &document{uri: uri, text: text, diagnostics: []Diagnostic{}}
+	env := s.newEnv()
+	expr, sm, err := s.frontend.Parse(text, env)
+	if err != nil {
+		span := syntax.Span{Start: 0, End: len(text)}
+		if serr, ok := err.(*syntax.Error); ok {
+			span = serr.Span
+		}
+		doc.diagnostics = append(doc.diagnostics, doc.diagnostic(span, err.Error()))
+		return doc
+	}
+	ctx := poly.NewContext()
+	annotated, err := ctx.Annotate(expr, env)
+	// annotated expressions are copies, so spans must be mapped from the parsed expressions:
+	doc.root, doc.sm = annotated, syntax.NewSourceMap()
+	mapSource(sm, doc.sm, expr, annotated)
+	if err != nil {
+		span, ok := doc.sm.Spans[ctx.InvalidExpr()]
+		if !ok {
+			span = syntax.Span{Start: 0, End: len(text)}
+		}
+		doc.diagnostics = append(doc.diagnostics, doc.diagnostic(span, err.Error()))
+	}
+	return doc
+}
+
+// Copy source map entries for parsed expressions to the corresponding expressions within a copy.
+func mapSource(from, to *syntax.SourceMap, parsed, copied ast.Expr) {
+	if parsed == nil || copied == nil {
+		return
+	}
+	if span, ok := from.Spans[parsed]; ok {
+		to.Spans[copied] = span
+	}
+	if binders, ok := from.Binders[parsed]; ok {
+		to.Binders[copied] = binders
+	}
+	parsedChildren, copiedChildren := syntax.Children(parsed), syntax.Children(copied)
+	for i := 0; i < len(parsedChildren) && i < len(copiedChildren); i++ {
+		mapSource(from, to, parsedChildren[i], copiedChildren[i])
+	}
+}
+
+func (doc *document) diagnostic(span syntax.Span, msg string) Diagnostic {
+	return Diagnostic{Range: doc.rangeOf(span), Severity: SeverityError, Source: "poly", Message: msg}
+}
+
+func (doc *document) rangeOf(span syntax.Span) Range {
+	return Range{Start: OffsetToPosition(doc.text, span.Start), End: OffsetToPosition(doc.text, span.End)}
+}
+
+func (doc *document) location(span syntax.Span) Location {
+	return Location{URI: doc.uri, Range: doc.rangeOf(span)}
+}
+
+// symbol identifies the binding site of a variable. Predeclared variables have no binding expression.
+type symbol struct {
+	name   string
+	scope  ast.Expr
+	binder syntax.Binder
+}
+
+// Find the binding site of a variable.
+func (doc *document) resolve(v *ast.Var) (symbol, bool) {
+	scope := v.Scope()
+	if scope == nil {
+		return symbol{}, false
+	}
+	if scope.Expr == nil {
+		return symbol{name: v.Name}, true
+	}
+	binder, ok := doc.sm.Binder(scope.Expr, v.Name, doc.sm.Spans[v])
+	return symbol{name: v.Name, scope: scope.Expr, binder: binder}, ok
+}
+
+// Find the symbol at an offset, either at a variable or at its binding site.
+func (doc *document) symbolAt(offset int) (symbol, bool) {
+	path := doc.sm.PathAt(doc.root, offset)
+	for i := len(path) - 1; i >= 0; i-- {
+		if v, ok := path[i].(*ast.Var); ok {
+			return doc.resolve(v)
+		}
+		for _, binder := range doc.sm.Binders[path[i]] {
+			if binder.Span.Contains(offset) {
+				return symbol{name: binder.Name, scope: path[i], binder: binder}, true
+			}
+		}
+	}
+	return symbol{}, false
+}
+
+func (doc *document) hover(offset int) *Hover {
+	if doc.root == nil {
+		return nil
+	}
+	path := doc.sm.PathAt(doc.root, offset)
+	// binding sites are not expressions, so the types of bound variables are found through their scopes:
+	for i := len(path) - 1; i >= 0; i-- {
+		for j, binder := range doc.sm.Binders[path[i]] {
+			if binder.Span.Contains(offset) {
+				return doc.hoverType(binder.Name, binderType(path[i], j), binder.Span)
+			}
+		}
+	}
+	if len(path) == 0 {
+		return nil
+	}
+	e := path[len(path)-1]
+	name := ""
+	if v, ok := e.(*ast.Var); ok {
+		name = v.Name
+	}
+	return doc.hoverType(name, exprType(e), doc.sm.Spans[e])
+}
+
+func (doc *document) hoverType(name string, t types.Type, span syntax.Span) *Hover {
+	if t == nil {
+		return nil
+	}
+	value := types.TypeString(t)
+	if name != "" {
+		value = name + " : " + value
+	}
+	r := doc.rangeOf(span)
+	return &Hover{Contents: MarkupContent{Kind: "plaintext", Value: value}, Range: &r}
+}
+
+// Get the inferred type of the variable bound at the given index within a scope, or nil if the type is not available.
+// Binders are recorded in the order of bindings within the scope expression.
+func binderType(scope ast.Expr, index int) types.Type {
+	switch e := scope.(type) {
+	case *ast.Let:
+		return exprType(e.Value)
+	case *ast.LetGroup:
+		if index < len(e.Vars) {
+			return exprType(e.Vars[index].Value)
+		}
+	case *ast.Func:
+		if exprType(e) != nil && index < len(e.ArgNames) {
+			return e.ArgType(index)
+		}
+	case *ast.Pipe:
+		return exprType(e.Source)
+	case *ast.Match:
+		if index < len(e.Cases) {
+			return e.Cases[index].VariantType()
+		}
+	}
+	return nil
+}
+
+func (doc *document) definition(offset int) *Location {
+	if doc.root == nil {
+		return nil
+	}
+	sym, ok := doc.symbolAt(offset)
+	if !ok || sym.scope == nil {
+		return nil
+	}
+	loc := doc.location(sym.binder.Span)
+	return &loc
+}
+
+func (doc *document) references(offset int, includeDeclaration bool) []Location {
+	locs := []Location{}
+	if doc.root == nil {
+		return locs
+	}
+	sym, ok := doc.symbolAt(offset)
+	if !ok {
+		return locs
+	}
+	if includeDeclaration && sym.scope != nil {
+		locs = append(locs, doc.location(sym.binder.Span))
+	}
+	ast.WalkExpr(doc.root, func(e ast.Expr) {
+		v, ok := e.(*ast.Var)
+		if !ok || v.Name != sym.name {
+			return
+		}
+		if ref, ok := doc.resolve(v); ok && ref == sym {
+			locs = append(locs, doc.location(doc.sm.Spans[v]))
+		}
+	})
+	return locs
+}
+
+// Get the inferred type of an expression, or nil if the expression was not annotated.
+func exprType(e ast.Expr) types.Type {
+	// expressions with composite types return typed nil pointers before annotation:
+	switch t := e.Type().(type) {
+	case *types.Arrow:
+		if t == nil {
+			return nil
+		}
+	case *types.Record:
+		if t == nil {
+			return nil
+		}
+	}
+	return e.Type()
+}
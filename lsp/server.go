@@ -0,0 +1,265 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package lsp implements a language server for expressions which are type-checked with poly.
+//
+// The server communicates over JSON-RPC (with Content-Length framing, as in the Language Server Protocol), and supports:
+//
+//   Diagnostics:    syntax errors and type errors, published when documents are opened or changed
+//   Hover:          the inferred type of the innermost expression at a position
+//   Definition:     the binding site of a variable
+//   References:     all uses of a variable, within the scope of its binding site
+//   Completion:     variables in scope, filtered by the type expected at a position
+//
+// Source text is parsed by a pluggable front-end, which produces expressions and a source map. The server type-checks
+// each document within a new type environment, so declarations are never shared across documents.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/wdamron/poly"
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/syntax"
+	"github.com/wdamron/poly/types"
+)
+
+// Frontend parses source text into an expression and a source map. Type-variables (in type annotations) should be created within env.
+type Frontend interface {
+	Parse(text string, env types.TypeEnv) (ast.Expr, *syntax.SourceMap, error)
+}
+
+// FrontendFunc is an adapter to allow the use of ordinary functions (such as syntax.Parse) as front-ends.
+type FrontendFunc func(text string, env types.TypeEnv) (ast.Expr, *syntax.SourceMap, error)
+
+// Parse text by calling f(text, env).
+func (f FrontendFunc) Parse(text string, env types.TypeEnv) (ast.Expr, *syntax.SourceMap, error) {
+	return f(text, env)
+}
+
+// Config contains options for a language server.
+type Config struct {
+	// Front-end for parsing documents. The syntax package will be used if Frontend is nil.
+	Frontend Frontend
+	// Create a type environment for type-checking a document. Predeclared bindings, type-classes, and instances
+	// should be declared within the new environment. An empty environment will be used if NewEnv is nil.
+	NewEnv func() *poly.TypeEnv
+}
+
+// Server is a language server. Requests are handled sequentially, in the order they are received.
+type Server struct {
+	frontend Frontend
+	newEnv   func() *poly.TypeEnv
+	docs     map[string]*document
+	shutdown bool
+	mu       sync.Mutex // guards writes
+	w        io.Writer
+}
+
+// Create a language server.
+func NewServer(config Config) *Server {
+	s := &Server{frontend: config.Frontend, newEnv: config.NewEnv, docs: make(map[string]*document)}
+	if s.frontend == nil {
+		s.frontend = FrontendFunc(syntax.Parse)
+	}
+	if s.newEnv == nil {
+		s.newEnv = func() *poly.TypeEnv { return poly.NewTypeEnv(nil) }
+	}
+	return s
+}
+
+// Serve requests read from r, writing responses and notifications to w, until an exit notification is received or r is closed.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.w = w
+	br := bufio.NewReader(r)
+	for {
+		msg, err := ReadMessage(br)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if rerr, ok := err.(*ResponseError); ok {
+				s.write(&Message{ID: nullID, Error: rerr})
+				continue
+			}
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(msg)
+		if msg.ID == nil {
+			continue
+		}
+		if rerr != nil {
+			s.write(&Message{ID: msg.ID, Error: rerr})
+		} else {
+			if result == nil {
+				result = json.RawMessage("null")
+			}
+			s.write(&Message{ID: msg.ID, Result: result})
+		}
+	}
+}
+
+var nullID = func() *json.RawMessage { id := json.RawMessage("null"); return &id }()
+
+func (s *Server) write(msg *Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	WriteMessage(s.w, msg)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	s.write(&Message{Method: method, Params: raw})
+}
+
+func (s *Server) handle(msg *Message) (interface{}, *ResponseError) {
+	if s.shutdown && msg.Method != "exit" {
+		return nil, &ResponseError{Code: InvalidRequest, Message: "Server is shutting down"}
+	}
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"completionProvider": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "poly-lsp"},
+		}, nil
+
+	case "initialized":
+		return nil, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			// full synchronization; the last change contains the entire document:
+			s.update(params.TextDocument.URI, params.TextDocument.Version, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		return nil, nil
+
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		doc, offset, rerr := s.position(msg, &params)
+		if rerr != nil || doc == nil {
+			return nil, rerr
+		}
+		return doc.hover(offset), nil
+
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		doc, offset, rerr := s.position(msg, &params)
+		if rerr != nil || doc == nil {
+			return nil, rerr
+		}
+		return doc.definition(offset), nil
+
+	case "textDocument/references":
+		var params ReferenceParams
+		doc, offset, rerr := s.position(msg, &params)
+		if rerr != nil || doc == nil {
+			return nil, rerr
+		}
+		return doc.references(offset, params.Context.IncludeDeclaration), nil
+
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		doc, offset, rerr := s.position(msg, &params)
+		if rerr != nil || doc == nil {
+			return nil, rerr
+		}
+		return s.complete(doc, offset), nil
+	}
+
+	if msg.ID == nil {
+		// unknown notifications are ignored
+		return nil, nil
+	}
+	return nil, &ResponseError{Code: MethodNotFound, Message: "Method not found: " + msg.Method}
+}
+
+type positionParams interface {
+	uri() string
+	position() Position
+}
+
+func (p *TextDocumentPositionParams) uri() string        { return p.TextDocument.URI }
+func (p *TextDocumentPositionParams) position() Position { return p.Position }
+
+// Decode the parameters of a request at a position within a document. The document will be nil if it is not open.
+func (s *Server) position(msg *Message, params positionParams) (*document, int, *ResponseError) {
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return nil, 0, invalidParams(err)
+	}
+	doc := s.docs[params.uri()]
+	if doc == nil {
+		return nil, 0, nil
+	}
+	return doc, PositionToOffset(doc.text, params.position()), nil
+}
+
+func invalidParams(err error) *ResponseError {
+	return &ResponseError{Code: InvalidParams, Message: err.Error()}
+}
+
+// Re-analyze a document and publish diagnostics.
+func (s *Server) update(uri string, version int, text string) {
+	doc := s.analyze(uri, text)
+	doc.version = version
+	s.docs[uri] = doc
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Version: version, Diagnostics: doc.diagnostics})
+}
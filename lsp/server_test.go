@@ -0,0 +1,281 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/wdamron/poly"
+	"github.com/wdamron/poly/syntax"
+)
+
+// client is an in-process language client, connected to a server through pipes.
+type client struct {
+	t           *testing.T
+	w           io.Writer
+	messages    chan *Message
+	nextID      int
+	diagnostics map[string][]Diagnostic
+	done        chan error
+}
+
+func newClient(t *testing.T, config Config) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, w: clientOut, messages: make(chan *Message, 16), diagnostics: make(map[string][]Diagnostic), done: make(chan error, 1)}
+	// messages are read concurrently, so the server is never blocked writing notifications:
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			msg, err := ReadMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	go func() {
+		err := NewServer(config).Serve(serverIn, serverOut)
+		serverOut.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+func (c *client) send(method string, id *int, params interface{}) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	msg := &Message{Method: method, Params: raw}
+	if id != nil {
+		rawID := json.RawMessage(strconv.Itoa(*id))
+		msg.ID = &rawID
+	}
+	if err := WriteMessage(c.w, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) notify(method string, params interface{}) { c.send(method, nil, params) }
+
+// Send a request and decode the result, recording any notifications received before the response.
+func (c *client) call(method string, params interface{}, result interface{}) {
+	c.nextID++
+	id := c.nextID
+	c.send(method, &id, params)
+	for {
+		msg, ok := <-c.messages
+		if !ok {
+			c.t.Fatal("connection closed")
+		}
+		if msg.ID == nil {
+			c.record(msg)
+			continue
+		}
+		if string(*msg.ID) != strconv.Itoa(id) {
+			c.t.Fatalf("unexpected response id %s", *msg.ID)
+		}
+		if msg.Error != nil {
+			c.t.Fatalf("%s: %s", method, msg.Error.Message)
+		}
+		raw, _ := json.Marshal(msg.Result)
+		if err := json.Unmarshal(raw, result); err != nil {
+			c.t.Fatal(err)
+		}
+		return
+	}
+}
+
+func (c *client) record(msg *Message) {
+	if msg.Method != "textDocument/publishDiagnostics" {
+		return
+	}
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+	c.diagnostics[params.URI] = params.Diagnostics
+}
+
+func (c *client) open(uri, text string) {
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, LanguageID: "poly", Version: 1, Text: text}})
+}
+
+func (c *client) change(uri, text string, version int) {
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: version},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: text}},
+	})
+}
+
+func (c *client) close() {
+	var result interface{}
+	c.call("shutdown", nil, &result)
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Find the position of the n-th occurrence (from 0) of needle within text, offset by delta bytes.
+func positionOf(text, needle string, n, delta int) Position {
+	offset := -1
+	for i := 0; i <= n; i++ {
+		next := strings.Index(text[offset+1:], needle)
+		if next < 0 {
+			panic("missing " + needle)
+		}
+		offset += next + 1
+	}
+	return OffsetToPosition(text, offset+delta)
+}
+
+func at(uri, text, needle string, n int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: positionOf(text, needle, n, 0)}
+}
+
+func testEnv() *poly.TypeEnv {
+	env := poly.NewTypeEnv(nil)
+	for name, src := range map[string]string{
+		"add":    "(int, int) -> int",
+		"concat": "(string, string) -> string",
+		"answer": "int",
+		"greet":  "string",
+		"ident":  "'a -> 'a",
+	} {
+		t, err := syntax.ParseType(src, env)
+		if err != nil {
+			panic(err)
+		}
+		env.Declare(name, t)
+	}
+	return env
+}
+
+func TestServer(t *testing.T) {
+	c := newClient(t, Config{Frontend: FrontendFunc(syntax.Parse), NewEnv: testEnv})
+	var init map[string]interface{}
+	c.call("initialize", map[string]interface{}{}, &init)
+	if _, ok := init["capabilities"]; !ok {
+		t.Fatalf("missing capabilities: %v", init)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	const uri = "file:///test.poly"
+	text := "let f(x) = add(x, answer) in\nlet g = fn (y) -> y in\nmatch :A f(1) { :A a -> g(a) | :B a -> a }"
+	c.open(uri, text)
+
+	// Hover:
+	var hover Hover
+	c.call("textDocument/hover", at(uri, text, "f(1)", 0), &hover)
+	if hover.Contents.Value != "f : int -> int" {
+		t.Fatalf("hover: %q", hover.Contents.Value)
+	}
+	c.call("textDocument/hover", at(uri, text, "x", 0), &hover)
+	if hover.Contents.Value != "x : int" {
+		t.Fatalf("hover binder: %q", hover.Contents.Value)
+	}
+	c.call("textDocument/hover", at(uri, text, "g(a)", 0), &hover)
+	if hover.Contents.Value != "g : int -> int" {
+		t.Fatalf("hover instance: %q", hover.Contents.Value)
+	}
+	c.call("textDocument/hover", at(uri, text, "match", 0), &hover)
+	if hover.Contents.Value != "int" {
+		t.Fatalf("hover match: %q", hover.Contents.Value)
+	}
+
+	// Diagnostics:
+	if diags := c.diagnostics[uri]; len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+
+	// Go-to-definition, distinguishing match cases which bind the same name:
+	var loc *Location
+	c.call("textDocument/definition", at(uri, text, "a)", 0), &loc)
+	if loc == nil || loc.Range.Start != positionOf(text, "a ->", 0, 0) {
+		t.Fatalf("definition: %+v", loc)
+	}
+	c.call("textDocument/definition", at(uri, text, "a }", 0), &loc)
+	if loc == nil || loc.Range.Start != positionOf(text, "a ->", 1, 0) {
+		t.Fatalf("definition: %+v", loc)
+	}
+	c.call("textDocument/definition", at(uri, text, "answer", 0), &loc)
+	if loc != nil {
+		t.Fatalf("definition of predeclared variable: %+v", loc)
+	}
+
+	// References:
+	var refs []Location
+	params := ReferenceParams{TextDocumentPositionParams: at(uri, text, "f", 0)}
+	params.Context.IncludeDeclaration = true
+	c.call("textDocument/references", params, &refs)
+	if len(refs) != 2 || refs[0].Range.Start != positionOf(text, "f", 0, 0) || refs[1].Range.Start != positionOf(text, "f(1)", 0, 0) {
+		t.Fatalf("references: %+v", refs)
+	}
+
+	// Type errors:
+	bad := "let f(x) = add(x, greet) in f"
+	c.change(uri, bad, 2)
+	c.call("textDocument/hover", at(uri, bad, "f", 0), &hover)
+	diags := c.diagnostics[uri]
+	if len(diags) != 1 || diags[0].Severity != SeverityError {
+		t.Fatalf("diagnostics: %+v", diags)
+	}
+
+	// Syntax errors:
+	c.change(uri, "let f(x) = in f", 3)
+	c.call("textDocument/hover", at(uri, bad, "f", 0), &hover)
+	diags = c.diagnostics[uri]
+	if len(diags) != 1 || diags[0].Range.Start != (Position{Line: 0, Character: 11}) {
+		t.Fatalf("syntax diagnostics: %+v", diags)
+	}
+
+	// Completion filtered by the expected type:
+	complete := func(text string, pos Position) string {
+		c.change(uri, text, 4)
+		var list CompletionList
+		c.call("textDocument/completion", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: pos}, &list)
+		var labels []string
+		for _, item := range list.Items {
+			labels = append(labels, item.Label)
+		}
+		return strings.Join(labels, ",")
+	}
+	partial := "let an = 1 in add(a, 2)"
+	if labels := complete(partial, positionOf(partial, "a,", 0, 1)); labels != "an,answer" {
+		t.Fatalf("completion: %s", labels)
+	}
+	partial = "let f(s) = concat(s, ) in f"
+	if labels := complete(partial, positionOf(partial, ")", 1, 0)); labels != "greet,s" {
+		t.Fatalf("completion: %s", labels)
+	}
+
+	c.close()
+}
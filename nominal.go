@@ -0,0 +1,120 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"errors"
+
+	"github.com/wdamron/poly/types"
+)
+
+// Declare a nominal type (newtype) with a representation type within the type environment. The nominal type will not unify
+// with its representation type.
+//
+// A wrap function will be declared with the name of the nominal type, and an unwrap function will be declared with
+// an "un" prefix. For example, declaring `UserId` as a nominal type for `int` will declare `UserId : int -> UserId` and
+// `unUserId : UserId -> int`.
+//
+// params should contain generic type-variables which may occur within the representation type.
+func (e *TypeEnv) DeclareNewtype(name string, params []*types.Var, representation types.Type) (*types.App, error) {
+	t, err := e.declareNominal(name, params, representation)
+	if err != nil {
+		return nil, err
+	}
+	e.Declare(name, &types.Arrow{Args: []types.Type{representation}, Return: t})
+	e.Declare("un"+name, &types.Arrow{Args: []types.Type{t}, Return: representation})
+	return t, nil
+}
+
+// Declare an opaque (abstract) type with an underlying type within the type environment. The returned type is an alias for
+// the underlying type.
+//
+// The underlying type of an opaque type is visible within the declaring type-environment, its child environments within the
+// same module, and all type-environments of the same (named) module. Outside of the module, the opaque type will only unify
+// with itself.
+//
+// params should contain generic type-variables which may occur within the underlying type.
+func (e *TypeEnv) DeclareOpaque(name string, params []*types.Var, underlying types.Type) (*types.App, error) {
+	t, err := e.declareNominal(name, params, underlying)
+	if err != nil {
+		return nil, err
+	}
+	if e.opaque == nil {
+		e.opaque = make(map[string]bool)
+	}
+	e.opaque[name] = true
+	t.Underlying = underlying
+	return GeneralizeRefs(t).(*types.App), nil
+}
+
+// Check if the underlying type of a type constructor is hidden within the type environment.
+func (e *TypeEnv) IsOpaque(name string) bool {
+	declaring := e.typeConstructorEnv(name, make(map[*TypeEnv]bool))
+	if declaring == nil || !declaring.opaque[name] {
+		return false
+	}
+	module := declaring.ModuleName()
+	if module != e.ModuleName() {
+		return true
+	}
+	// Outside of a named module, the underlying type is only visible within the declaring environment and its child environments:
+	if module == "" {
+		for env := e; env != nil; env = env.Parent {
+			if env == declaring {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (e *TypeEnv) declareNominal(name string, params []*types.Var, underlying types.Type) (*types.App, error) {
+	if e.frozen {
+		return nil, errFrozen
+	}
+	if e.LookupKind(name) != nil {
+		return nil, errors.New("Type " + name + " is already declared")
+	}
+	kc := newKindChecker(e)
+	paramKinds := make([]types.Kind, len(params))
+	appParams := make([]types.Type, len(params))
+	for i, tv := range params {
+		kind, err := kc.infer(tv)
+		if err != nil {
+			return nil, err
+		}
+		paramKinds[i], appParams[i] = kind, tv
+	}
+	if err := kc.check(underlying, types.Star); err != nil {
+		return nil, err
+	}
+	var kind types.Kind = types.Star
+	if len(params) != 0 {
+		for i, param := range paramKinds {
+			paramKinds[i] = defaultKind(param)
+		}
+		kind = types.NewConstructorKind(paramKinds...)
+	}
+	return &types.App{Const: e.DeclareKind(name, kind), Params: appParams}, nil
+}
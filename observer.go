@@ -0,0 +1,109 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/types"
+)
+
+// InferenceObserver receives events during inference, for tracing or debugging. Events are received in the order they
+// occur; events for sub-expressions are received between the events for entering and leaving their parent expression.
+//
+// Types passed to an observer may be modified by later unification. Observers which retain types should print or copy
+// them when each event is received.
+type InferenceObserver interface {
+	// EnterExpr is called before the type of an expression is inferred at a binding-level.
+	EnterExpr(e ast.Expr, level uint)
+	// LeaveExpr is called after the type of an expression is inferred. t may be nil if inference failed.
+	LeaveExpr(e ast.Expr, t types.Type, err error)
+	// Lookup is called after the type of a variable is found within the type-environment.
+	Lookup(name string, t types.Type)
+	// EnterUnify is called before two types are unified.
+	EnterUnify(a, b types.Type)
+	// LeaveUnify is called after two types are unified. err is nil if unification succeeded.
+	LeaveUnify(a, b types.Type, err error)
+	// Instantiate is called after a type is instantiated at a binding-level.
+	Instantiate(level uint, generic, instance types.Type)
+	// Generalize is called after a type is generalized at a binding-level.
+	Generalize(level uint, t types.Type)
+	// SelectInstance is called after an instance of a type-class is selected for a type.
+	SelectInstance(tc *types.TypeClass, t types.Type, inst *types.Instance)
+	// DeferConstraint is called when multiple instances of a type-class match a type, and instance matching for the type
+	// is deferred until after inference. e is the expression being inferred.
+	DeferConstraint(tc *types.TypeClass, t types.Type, e ast.Expr)
+}
+
+// NopObserver ignores all inference events. NopObserver may be embedded within observers which handle a subset of events.
+type NopObserver struct{}
+
+func (NopObserver) EnterExpr(e ast.Expr, level uint)                                       {}
+func (NopObserver) LeaveExpr(e ast.Expr, t types.Type, err error)                          {}
+func (NopObserver) Lookup(name string, t types.Type)                                       {}
+func (NopObserver) EnterUnify(a, b types.Type)                                             {}
+func (NopObserver) LeaveUnify(a, b types.Type, err error)                                  {}
+func (NopObserver) Instantiate(level uint, generic, instance types.Type)                   {}
+func (NopObserver) Generalize(level uint, t types.Type)                                    {}
+func (NopObserver) SelectInstance(tc *types.TypeClass, t types.Type, inst *types.Instance) {}
+func (NopObserver) DeferConstraint(tc *types.TypeClass, t types.Type, e ast.Expr)          {}
+
+// Set an observer which receives events during inference, or nil to remove the observer.
+//
+// Grouped let-bindings are inferred sequentially while an observer is set (see EnableParallelInference).
+func (ti *InferenceContext) SetObserver(observer InferenceObserver) { ti.observer = observer }
+
+func (ti *InferenceContext) unify(env *TypeEnv, a, b types.Type) error {
+	if ti.observer == nil {
+		return env.common.Unify(a, b)
+	}
+	ti.observer.EnterUnify(a, b)
+	err := env.common.Unify(a, b)
+	ti.observer.LeaveUnify(a, b, err)
+	return err
+}
+
+func (ti *InferenceContext) coerce(env *TypeEnv, expected, actual types.Type) error {
+	if ti.observer == nil {
+		return env.common.Coerce(expected, actual)
+	}
+	ti.observer.EnterUnify(expected, actual)
+	err := env.common.Coerce(expected, actual)
+	ti.observer.LeaveUnify(expected, actual, err)
+	return err
+}
+
+func (ti *InferenceContext) instantiate(env *TypeEnv, level uint, t types.Type) types.Type {
+	instance := env.common.Instantiate(level, t)
+	if ti.observer != nil {
+		ti.observer.Instantiate(level, t, instance)
+	}
+	return instance
+}
+
+func (ti *InferenceContext) generalize(level uint, t types.Type) types.Type {
+	t = GeneralizeAtLevel(level, t)
+	if ti.observer != nil {
+		ti.observer.Generalize(level, t)
+	}
+	return t
+}
@@ -0,0 +1,249 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"sync"
+
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/internal/astutil"
+	"github.com/wdamron/poly/internal/typeutil"
+)
+
+// Independent strongly-connected components of grouped let-bindings may be inferred in parallel by up to
+// workers goroutines. Each worker infers a component within its own type-environment and context, allocating
+// type-variables within a disjoint range of ids. Generalized types are merged in dependency order, and type-variables
+// are renumbered as if the components were inferred sequentially, so inferred types are identical to sequential inference.
+//
+// Only components of function bindings, which do not refer to variables with unbound type-variables, are inferred in
+// parallel. Let-groups nested within a let-group which is inferred in parallel are inferred sequentially.
+//
+// By default (or when workers is less than 2), grouped let-bindings are inferred sequentially.
+func (ti *InferenceContext) EnableParallelInference(workers int) { ti.workers = workers }
+
+// A strongly-connected component of grouped let-bindings.
+type component struct {
+	scc        []int
+	wave       int  // components within the same wave are independent of each other
+	start, end uint // range of ids allocated while inferring the component
+	renumbered uint // first id after renumbering
+	deferred   []typeutil.DeferredConstraint
+	env        *TypeEnv          // worker type-environment, or nil for components inferred sequentially
+	ti         *InferenceContext // worker context, or nil for components inferred sequentially
+	err        error
+}
+
+// Infer the strongly-connected components of a let-group in waves of independent components. Components which
+// cannot be inferred in parallel are inferred sequentially at the beginning of each wave.
+func (ti *InferenceContext) inferComponentsParallel(env *TypeEnv, level uint, e *ast.LetGroup, graph *astutil.Graph, sccs [][]int, stashed *int) error {
+	ti.parallel = true
+	defer func() { ti.parallel = false }()
+	common := &env.common
+	// Each component allocates type-variables within a disjoint range of ids:
+	base, marked := common.VarTracker.NextId, common.VarTracker.Len()
+	stride := (^uint(0) - base) / uint(len(sccs)+1)
+	comps, compNums := make([]component, len(sccs)), make([]int, len(e.Vars))
+	for i, scc := range sccs {
+		comps[i].scc, comps[i].start = scc, base+uint(i+1)*stride
+		for _, bindNum := range scc {
+			compNums[bindNum] = i
+		}
+	}
+	// Components are sorted in dependency order; each component follows the waves of its dependencies:
+	waves := 1
+	for i := range comps {
+		for _, from := range comps[i].scc {
+			for _, to := range graph.Edges[from] {
+				if c := &comps[compNums[to]]; c != &comps[i] && c.wave <= comps[i].wave {
+					c.wave = comps[i].wave + 1
+					if c.wave >= waves {
+						waves = c.wave + 1
+					}
+				}
+			}
+		}
+	}
+
+	failed := len(comps) // the first component (in dependency order) which could not be inferred
+	checked := make(map[string]bool)
+	sem := make(chan struct{}, ti.workers)
+	var wg sync.WaitGroup
+	for wave := 0; wave < waves; wave++ {
+		// Components which cannot be inferred in parallel modify the shared type-environment, so they are inferred
+		// before workers are started:
+		parallel := 0
+		for i := 0; i < failed; i++ {
+			c := &comps[i]
+			if c.wave != wave {
+				continue
+			}
+			if ti.canInferInParallel(env, e, graph, c.scc, checked) {
+				c.ti, c.env = ti.newWorker(env, c.start)
+				parallel++
+				continue
+			}
+			deferred := len(common.DeferredConstraints)
+			common.VarTracker.NextId = c.start
+			if err := ti.inferComponent(env, level, e, graph.Nested, c.scc, stashed); err != nil {
+				c.err, failed = err, i
+				break
+			}
+			c.end = common.VarTracker.NextId
+			c.deferred = append([]typeutil.DeferredConstraint(nil), common.DeferredConstraints[deferred:]...)
+			common.DeferredConstraints = common.DeferredConstraints[:deferred]
+		}
+		if parallel == 0 {
+			continue
+		}
+		for i := 0; i < failed; i++ {
+			if c := &comps[i]; c.wave == wave && c.ti != nil {
+				wg.Add(1)
+				sem <- struct{}{}
+				go func() {
+					defer func() { <-sem; wg.Done() }()
+					wstashed := 0
+					c.err = c.ti.inferComponent(c.env, level, e, graph.Nested, c.scc, &wstashed)
+					c.end = c.env.common.VarTracker.NextId
+				}()
+			}
+		}
+		wg.Wait()
+		// Merge generalized types from workers in dependency order:
+		for i := 0; i < failed; i++ {
+			c := &comps[i]
+			if c.wave != wave || c.ti == nil {
+				continue
+			}
+			wcommon := &c.env.common
+			common.UnifySteps += wcommon.UnifySteps
+			common.Interrupted = common.Interrupted || wcommon.Interrupted
+			if c.err != nil {
+				ti.invalid, ti.err, ti.interrupted = c.ti.invalid, c.ti.err, c.ti.interrupted
+				failed = i
+				break
+			}
+			common.VarTracker.Append(&wcommon.VarTracker)
+			c.deferred = wcommon.DeferredConstraints
+			for _, bindNum := range c.scc {
+				name := e.Vars[bindNum].Var
+				*stashed += common.Stash(env, name)
+				env.Assign(name, c.env.Types[name])
+			}
+			c.env, c.ti = nil, nil
+		}
+	}
+	if failed < len(comps) {
+		return comps[failed].err
+	}
+	// Renumber type-variables as if each component was inferred sequentially:
+	next := base
+	for i := range comps {
+		comps[i].renumbered = next
+		next += comps[i].end - comps[i].start
+	}
+	common.VarTracker.RenumberSince(marked, func(id uint) uint {
+		if id < base+stride {
+			return id
+		}
+		c := &comps[(id-base)/stride-1]
+		return c.renumbered + (id - c.start)
+	})
+	common.VarTracker.NextId = next
+	for i := range comps {
+		common.DeferredConstraints = append(common.DeferredConstraints, comps[i].deferred...)
+	}
+	return nil
+}
+
+// Create a worker context and type-environment for inferring a component in parallel. Type-variables allocated
+// within the worker type-environment will begin at start.
+func (ti *InferenceContext) newWorker(env *TypeEnv, start uint) (*InferenceContext, *TypeEnv) {
+	wti := &InferenceContext{
+		annotate:      ti.annotate,
+		canDeferMatch: ti.canDeferMatch,
+		equiRecursive: ti.equiRecursive,
+		trackEffects:  ti.trackEffects,
+		analyzed:      true,
+		parallel:      true,
+		rootExpr:      ti.rootExpr,
+		analysis:      ti.analysis,
+		effects:       ti.effects,
+		limits:        ti.limits,
+		ctx:           ti.ctx,
+	}
+	wenv := NewTypeEnv(env)
+	common, wcommon := &env.common, &wenv.common
+	wcommon.VarTracker.NextId = start
+	wcommon.TrackScopes, wcommon.DeferredConstraintsEnabled = common.TrackScopes, common.DeferredConstraintsEnabled
+	wcommon.EquiRecursiveTypes, wcommon.TrackEffects, wcommon.Done = common.EquiRecursiveTypes, common.TrackEffects, common.Done
+	if common.MaxUnifySteps > 0 {
+		wcommon.MaxUnifySteps = common.MaxUnifySteps - common.UnifySteps
+	}
+	if common.TrackScopes {
+		wcommon.ScopeStack = append([]*ast.Scope(nil), common.ScopeStack...)
+		for name, scopes := range common.VarScopes {
+			wcommon.VarScopes[name] = append([]*ast.Scope(nil), scopes...)
+		}
+	}
+	return wti, wenv
+}
+
+// Check if a component may be inferred in parallel. Types of variables referenced within the component must not
+// contain unbound type-variables, which could be modified during inference.
+func (ti *InferenceContext) canInferInParallel(env *TypeEnv, e *ast.LetGroup, graph *astutil.Graph, scc []int, checked map[string]bool) bool {
+	for _, bindNum := range scc {
+		if _, isFunc := e.Vars[bindNum].Value.(*ast.Func); !isFunc {
+			return false
+		}
+	}
+	ok := true
+	check := func(name string) {
+		if !ok {
+			return
+		}
+		// Types of grouped bindings are assigned as components are inferred, so they are not cached:
+		_, grouped := graph.Verts[name]
+		if safe, seen := checked[name]; seen && !grouped {
+			ok = safe
+			return
+		}
+		t := env.Lookup(name)
+		ok = t == nil || !hasUnboundVars(t)
+		if !grouped {
+			checked[name] = ok
+		}
+	}
+	for _, bindNum := range scc {
+		ast.WalkExpr(e.Vars[bindNum].Value, func(sub ast.Expr) {
+			switch sub := sub.(type) {
+			case *ast.Var:
+				check(sub.Name)
+			case *ast.Literal:
+				for _, name := range sub.Using {
+					check(name)
+				}
+			}
+		})
+	}
+	return ok
+}
@@ -32,12 +32,29 @@
 //   * Extensible records and variants with scoped labels
 //   * Generic type classes, constructor classes, and parametric overloading
 //   * Limited/explicit (type class) subtyping with multiple inheritance
+//   * Structurally derived type class instances
+//   * Module-scoped type class instances with orphan and coherence checking
 //   * Mutually-recursive (generic) function expressions within grouped let bindings
-//   * Mutually-recursive (generic) data types
+//   * Mutually-recursive (generic) data types, with structural equivalence
+//   * Optional equi-recursive types
+//   * Algebraic data type declarations with generated constructors
 //   * Transparently aliased (generic) types
+//   * Nominal (newtype) and opaque types
+//   * Kind checking for type constructors and higher-kinded types
 //   * Control-flow graph expressions
-//   * Mutable references with the value restriction
-//   * Size-bound type variables
+//   * Mutable references with the relaxed value restriction and declared variances
+//   * Read-only references with coercion from mutable references
+//   * Existential types with pack and unpack expressions
+//   * Size-bound type variables with linear size arithmetic and inequality bounds
+//   * Units of measure with unit type variables
+//   * Effect rows on function types for references and effectful builtins
+//   * Cancellation and resource limits for inference of untrusted expressions
+//   * Immutable (frozen) type-environments which may be shared across threads
+//   * Optional parallel inference of independent components within grouped let bindings
+//   * Optional interning (hash-consing) of ground types
+//   * Indexing of type-class instances by the structure of their type-parameters
+//   * Observer hooks for tracing inference, with indented-log and JSON tracers
+//   * Optional typing derivation trees, exported as JSON, LaTeX or Markdown
 //
 //
 // Links:
@@ -51,4 +68,6 @@
 // Hindley-Milner type system: https://en.wikipedia.org/wiki/Hindley–Milner_type_system
 //
 // Value restriction: https://en.wikipedia.org/wiki/Value_restriction
+//
+// Relaxing the Value Restriction (Garrigue, 2004): https://caml.inria.fr/pub/papers/garrigue-value_restriction-fiflp04.pdf
 package poly
@@ -0,0 +1,221 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package syntax
+
+import (
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/types"
+)
+
+// Decl is a top-level declaration within a source file.
+//
+// The following declarations are supported:
+//
+//   LetDecl:       let f(x) = e1 and g(y) = e2
+//   SigDecl:       f : (Eq 'a) => ('a, 'a) -> bool
+//   ClassDecl:     class Ord 'a extends Eq { lt : ('a, 'a) -> bool }
+//   InstanceDecl:  instance Ord int { lt = ltInt }
+//   ExprDecl:      f(1)
+type Decl interface {
+	// Span of the declaration within the source text
+	DeclSpan() Span
+}
+
+// LetDecl declares top-level (possibly mutually-recursive) bindings.
+type LetDecl struct {
+	Bindings []ast.LetBinding
+	// Binding sites of the declared variables
+	Names []Binder
+	Span  Span
+}
+
+// SigDecl declares the type of a predeclared variable.
+type SigDecl struct {
+	Name string
+	Type types.Type
+	Span Span
+}
+
+// ClassDecl declares a type-class with a single type-parameter.
+type ClassDecl struct {
+	Name string
+	// Name of the type-parameter, including the leading quote (`'a`)
+	Param string
+	// Names of super-classes
+	Super   []string
+	Methods []MethodDecl
+	Span    Span
+}
+
+// MethodDecl declares a method of a type-class. Method types are parsed when the type-class is declared,
+// since the type-parameter is created by the type environment (see ParseTypeWithVars).
+type MethodDecl struct {
+	Name string
+	// Source text of the method type
+	Type string
+	// Span of the method type within the source text
+	TypeSpan Span
+}
+
+// InstanceDecl declares an instance of a type-class.
+type InstanceDecl struct {
+	Class string
+	Type  types.Type
+	// Methods maps method names to names of their implementations within the type environment
+	Methods map[string]string
+	Span    Span
+}
+
+// ExprDecl is a top-level expression.
+type ExprDecl struct {
+	Expr ast.Expr
+	Span Span
+}
+
+func (d *LetDecl) DeclSpan() Span      { return d.Span }
+func (d *SigDecl) DeclSpan() Span      { return d.Span }
+func (d *ClassDecl) DeclSpan() Span    { return d.Span }
+func (d *InstanceDecl) DeclSpan() Span { return d.Span }
+func (d *ExprDecl) DeclSpan() Span     { return d.Span }
+
+// Parse a sequence of top-level declarations. Spans of expressions within declarations are recorded in a single source map.
+//
+// Let-bindings followed by `in` are parsed as expressions rather than declarations.
+func ParseFile(src string, env types.TypeEnv) ([]Decl, *SourceMap, error) {
+	p := newParser(src, env)
+	var decls []Decl
+	for p.err == nil && p.peek().kind != tokEOF {
+		if d := p.parseDecl(); d != nil {
+			decls = append(decls, d)
+		}
+	}
+	if p.err != nil {
+		return decls, p.sm, p.err
+	}
+	return decls, p.sm, nil
+}
+
+func (p *parser) atIdent(text string) bool {
+	tok := p.peek()
+	return tok.kind == tokIdent && tok.text == text
+}
+
+func (p *parser) parseDecl() Decl {
+	// type-variables are scoped to each declaration:
+	p.typeVars = nil
+	start := p.peek().span.Start
+	next := p.peekAt(1)
+	switch {
+	case p.acceptKeyword("let"):
+		names, values := p.parseLetBindings()
+		if p.err != nil {
+			return nil
+		}
+		if p.acceptKeyword("in") {
+			e := p.finishLet(start, names, values)
+			if p.err != nil {
+				return nil
+			}
+			return &ExprDecl{Expr: e, Span: Span{start, p.end()}}
+		}
+		d := &LetDecl{Span: Span{start, p.end()}}
+		for i, name := range names {
+			d.Bindings = append(d.Bindings, ast.LetBinding{Var: name.text, Value: values[i]})
+			// top-level bindings are visible within all subsequent declarations:
+			d.Names = append(d.Names, Binder{Name: name.text, Span: name.span, Scope: Span{names[0].span.Start, len(p.text)}})
+		}
+		return d
+
+	case p.peek().kind == tokIdent && next.kind == tokPunct && next.text == ":":
+		name := p.advance()
+		p.advance()
+		t := p.parseQualifiedType()
+		if p.err != nil {
+			return nil
+		}
+		return &SigDecl{Name: name.text, Type: t, Span: Span{start, p.end()}}
+
+	case p.atIdent("class") && next.kind == tokIdent:
+		p.advance()
+		d := &ClassDecl{Name: p.advance().text}
+		if p.peek().kind != tokTypeVar {
+			p.fail(p.peek().span, "expected type-variable, found "+describe(p.peek()))
+			return nil
+		}
+		d.Param = p.advance().text
+		if p.atIdent("extends") {
+			p.advance()
+			for p.err == nil {
+				d.Super = append(d.Super, p.expectIdent().text)
+				if !p.accept(",") {
+					break
+				}
+			}
+		}
+		p.expect("{")
+		for p.peek().kind == tokIdent && p.err == nil {
+			name := p.advance()
+			p.expect(":")
+			typeStart := p.peek().span.Start
+			// method types are re-parsed when the type-class is declared:
+			p.parseQualifiedType()
+			typeSpan := Span{typeStart, p.end()}
+			d.Methods = append(d.Methods, MethodDecl{Name: name.text, Type: p.text[typeSpan.Start:typeSpan.End], TypeSpan: typeSpan})
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect("}")
+		if p.err != nil {
+			return nil
+		}
+		d.Span = Span{start, p.end()}
+		return d
+
+	case p.atIdent("instance") && next.kind == tokIdent:
+		p.advance()
+		d := &InstanceDecl{Class: p.advance().text, Methods: make(map[string]string)}
+		d.Type = p.parseType()
+		p.expect("{")
+		for p.peek().kind == tokIdent && p.err == nil {
+			name := p.advance()
+			p.expect("=")
+			d.Methods[name.text] = p.expectIdent().text
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect("}")
+		if p.err != nil {
+			return nil
+		}
+		d.Span = Span{start, p.end()}
+		return d
+	}
+
+	e := p.parseExpr()
+	if p.err != nil {
+		return nil
+	}
+	return &ExprDecl{Expr: e, Span: Span{start, p.end()}}
+}
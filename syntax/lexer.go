@@ -0,0 +1,179 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package syntax
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokTypeVar // 'a
+	tokInt
+	tokFloat
+	tokString
+	tokPunct
+	tokKeyword
+	tokInvalid
+)
+
+var keywords = map[string]bool{
+	"let":    true,
+	"and":    true,
+	"in":     true,
+	"fn":     true,
+	"match":  true,
+	"pipe":   true,
+	"pack":   true,
+	"as":     true,
+	"unpack": true,
+	"exists": true,
+}
+
+// multi-byte punctuation, matched before single-byte punctuation:
+var punctuation = []string{"->", "|>", "=>", "(", ")", "{", "}", "[", "]", ",", ".", ":", "=", "|", "*", "-", "+", ";", "!", "<", ">"}
+
+type token struct {
+	kind tokenKind
+	text string
+	span Span
+}
+
+type lexer struct {
+	src    string
+	offset int
+}
+
+func (l *lexer) skipSpace() {
+	for l.offset < len(l.src) {
+		c := l.src[l.offset]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.offset++
+		case c == '/' && l.offset+1 < len(l.src) && l.src[l.offset+1] == '/':
+			for l.offset < len(l.src) && l.src[l.offset] != '\n' {
+				l.offset++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isIdentStart(r rune) bool { return r == '_' || unicode.IsLetter(r) }
+func isIdentPart(r rune) bool  { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+func (l *lexer) identEnd(start int) int {
+	end := start
+	for end < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[end:])
+		if !isIdentPart(r) {
+			break
+		}
+		end += size
+	}
+	return end
+}
+
+func (l *lexer) next() token {
+	l.skipSpace()
+	start := l.offset
+	if start >= len(l.src) {
+		return token{kind: tokEOF, span: Span{start, start}}
+	}
+	r, size := utf8.DecodeRuneInString(l.src[start:])
+	switch {
+	case isIdentStart(r):
+		end := l.identEnd(start + size)
+		l.offset = end
+		text := l.src[start:end]
+		if keywords[text] {
+			return token{kind: tokKeyword, text: text, span: Span{start, end}}
+		}
+		return token{kind: tokIdent, text: text, span: Span{start, end}}
+
+	case r == '\'':
+		end := l.identEnd(start + 1)
+		l.offset = end
+		if end == start+1 {
+			return token{kind: tokInvalid, text: "'", span: Span{start, end}}
+		}
+		return token{kind: tokTypeVar, text: l.src[start:end], span: Span{start, end}}
+
+	case r >= '0' && r <= '9':
+		end, kind := start, tokInt
+		for end < len(l.src) && l.src[end] >= '0' && l.src[end] <= '9' {
+			end++
+		}
+		if end+1 < len(l.src) && l.src[end] == '.' && l.src[end+1] >= '0' && l.src[end+1] <= '9' {
+			kind = tokFloat
+			end++
+			for end < len(l.src) && l.src[end] >= '0' && l.src[end] <= '9' {
+				end++
+			}
+		}
+		l.offset = end
+		return token{kind: kind, text: l.src[start:end], span: Span{start, end}}
+
+	case r == '"':
+		end := start + 1
+		for end < len(l.src) && l.src[end] != '"' && l.src[end] != '\n' {
+			if l.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(l.src) || l.src[end] != '"' {
+			l.offset = end
+			return token{kind: tokInvalid, text: l.src[start:end], span: Span{start, end}}
+		}
+		l.offset = end + 1
+		return token{kind: tokString, text: l.src[start : end+1], span: Span{start, end + 1}}
+	}
+
+	for _, p := range punctuation {
+		if len(l.src)-start >= len(p) && l.src[start:start+len(p)] == p {
+			l.offset = start + len(p)
+			return token{kind: tokPunct, text: p, span: Span{start, l.offset}}
+		}
+	}
+	l.offset = start + size
+	return token{kind: tokInvalid, text: l.src[start:l.offset], span: Span{start, l.offset}}
+}
+
+// Split source text into tokens. The final token will always be tokEOF.
+func tokenize(src string) []token {
+	l := &lexer{src: src}
+	var toks []token
+	for {
+		tok := l.next()
+		toks = append(toks, tok)
+		if tok.kind == tokEOF {
+			return toks
+		}
+	}
+}
@@ -0,0 +1,533 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package syntax
+
+import (
+	"strconv"
+
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/types"
+)
+
+var (
+	intType    = &types.Const{Name: "int"}
+	floatType  = &types.Const{Name: "float"}
+	stringType = &types.Const{Name: "string"}
+)
+
+// Parse an expression in the syntax printed by ast.ExprString. Type annotations (for pack expressions) are parsed with ParseType,
+// and type-variables within annotations will be created within env.
+//
+// Integer, float, and string literals will be parsed as literals of type `int`, `float`, and `string`, respectively.
+func Parse(src string, env types.TypeEnv) (ast.Expr, *SourceMap, error) {
+	p := newParser(src, env)
+	e := p.parseExpr()
+	if p.err == nil && p.peek().kind != tokEOF {
+		p.fail(p.peek().span, "unexpected "+describe(p.peek()))
+	}
+	if p.err != nil {
+		return nil, p.sm, p.err
+	}
+	return e, p.sm, nil
+}
+
+type namedVar struct {
+	name string
+	tv   *types.Var
+}
+
+type parser struct {
+	text     string
+	toks     []token
+	pos      int
+	env      types.TypeEnv
+	sm       *SourceMap
+	typeVars []namedVar
+	err      *Error
+}
+
+func newParser(src string, env types.TypeEnv) *parser {
+	return &parser{text: src, toks: tokenize(src), env: env, sm: NewSourceMap()}
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+n]
+}
+
+func (p *parser) advance() token {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// End offset of the previous token
+func (p *parser) end() int {
+	if p.pos == 0 {
+		return 0
+	}
+	return p.toks[p.pos-1].span.End
+}
+
+func (p *parser) at(punct string) bool {
+	tok := p.peek()
+	return tok.kind == tokPunct && tok.text == punct
+}
+
+func (p *parser) accept(punct string) bool {
+	if p.err == nil && p.at(punct) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	tok := p.peek()
+	if p.err == nil && tok.kind == tokKeyword && tok.text == kw {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) {
+	if p.err != nil {
+		return
+	}
+	if !p.accept(punct) {
+		p.fail(p.peek().span, "expected "+punct+", found "+describe(p.peek()))
+	}
+}
+
+func (p *parser) expectKeyword(kw string) {
+	if p.err != nil {
+		return
+	}
+	if !p.acceptKeyword(kw) {
+		p.fail(p.peek().span, "expected "+kw+", found "+describe(p.peek()))
+	}
+}
+
+func (p *parser) expectIdent() token {
+	if p.err != nil {
+		return token{}
+	}
+	tok := p.peek()
+	if tok.kind != tokIdent {
+		p.fail(tok.span, "expected identifier, found "+describe(tok))
+		return token{}
+	}
+	return p.advance()
+}
+
+func (p *parser) fail(span Span, msg string) {
+	if p.err == nil {
+		p.err = &Error{Span: span, Message: msg}
+	}
+}
+
+func describe(tok token) string {
+	switch tok.kind {
+	case tokEOF:
+		return "end of input"
+	case tokInvalid:
+		return "invalid token " + strconv.Quote(tok.text)
+	}
+	return strconv.Quote(tok.text)
+}
+
+// Record the span of e, from start to the end of the previous token.
+func (p *parser) span(e ast.Expr, start int) ast.Expr {
+	p.sm.Spans[e] = Span{start, p.end()}
+	return e
+}
+
+func (p *parser) bind(scope ast.Expr, name token, visible Span) {
+	p.sm.Binders[scope] = append(p.sm.Binders[scope], Binder{Name: name.text, Span: name.span, Scope: visible})
+}
+
+func (p *parser) parseExpr() ast.Expr {
+	if p.err != nil {
+		return nil
+	}
+	tok := p.peek()
+	start := tok.span.Start
+	switch {
+	case tok.kind == tokKeyword && tok.text == "let":
+		return p.parseLet()
+
+	case tok.kind == tokKeyword && tok.text == "fn":
+		p.advance()
+		p.expect("(")
+		var names []token
+		for p.peek().kind == tokIdent && p.err == nil {
+			names = append(names, p.advance())
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect(")")
+		p.expect("->")
+		return p.parseFuncBody(start, names)
+
+	case tok.kind == tokKeyword && tok.text == "pipe":
+		p.advance()
+		as := p.expectIdent()
+		p.expect("=")
+		source := p.parsePostfix()
+		pipe := &ast.Pipe{Source: source, As: as.text}
+		seqStart := p.peek().span.Start
+		for p.accept("|>") {
+			pipe.Sequence = append(pipe.Sequence, p.parsePostfix())
+		}
+		if p.err != nil {
+			return nil
+		}
+		p.bind(pipe, as, Span{seqStart, p.end()})
+		return p.span(pipe, start)
+
+	case tok.kind == tokKeyword && tok.text == "unpack":
+		p.advance()
+		name := p.expectIdent()
+		p.expect("=")
+		value := p.parseExpr()
+		p.expectKeyword("in")
+		bodyStart := p.peek().span.Start
+		body := p.parseExpr()
+		if p.err != nil {
+			return nil
+		}
+		unpack := &ast.Unpack{Var: name.text, Value: value, Body: body}
+		p.bind(unpack, name, Span{bodyStart, p.end()})
+		return p.span(unpack, start)
+
+	case tok.kind == tokKeyword && tok.text == "pack":
+		p.advance()
+		value := p.parsePostfix()
+		p.expectKeyword("as")
+		typeStart := p.peek().span
+		t := p.parseType()
+		if p.err != nil {
+			return nil
+		}
+		ex, ok := t.(*types.Existential)
+		if !ok {
+			p.fail(Span{typeStart.Start, p.end()}, "expected existential type after as")
+			return nil
+		}
+		return p.span(&ast.Pack{Value: value, As: ex}, start)
+
+	case tok.kind == tokPunct && tok.text == ":":
+		p.advance()
+		label := p.expectIdent()
+		value := p.parsePostfix()
+		if p.err != nil {
+			return nil
+		}
+		return p.span(&ast.Variant{Label: label.text, Value: value}, start)
+
+	case tok.kind == tokPunct && tok.text == "*":
+		p.advance()
+		ref := p.parsePostfix()
+		if p.err != nil {
+			return nil
+		}
+		if !p.accept("=") {
+			return p.span(&ast.Deref{Ref: ref}, start)
+		}
+		value := p.parseExpr()
+		if p.err != nil {
+			return nil
+		}
+		return p.span(&ast.DerefAssign{Ref: ref, Value: value}, start)
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parseFuncBody(start int, names []token) ast.Expr {
+	bodyStart := p.peek().span.Start
+	body := p.parseExpr()
+	if p.err != nil {
+		return nil
+	}
+	fn := &ast.Func{ArgNames: make([]string, len(names)), Body: body}
+	for i, name := range names {
+		fn.ArgNames[i] = name.text
+		p.bind(fn, name, Span{bodyStart, p.end()})
+	}
+	return p.span(fn, start)
+}
+
+// Parse a binding: `x = e` or `f(x, y) = e`
+func (p *parser) parseBinding() (token, ast.Expr) {
+	name := p.expectIdent()
+	if !p.at("(") {
+		p.expect("=")
+		return name, p.parseExpr()
+	}
+	start := p.advance().span.Start
+	var args []token
+	for p.peek().kind == tokIdent && p.err == nil {
+		args = append(args, p.advance())
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(")")
+	p.expect("=")
+	if p.err != nil {
+		return name, nil
+	}
+	return name, p.parseFuncBody(start, args)
+}
+
+func (p *parser) parseLet() ast.Expr {
+	start := p.advance().span.Start
+	names, values := p.parseLetBindings()
+	p.expectKeyword("in")
+	return p.finishLet(start, names, values)
+}
+
+// Parse one or more bindings separated by `and`.
+func (p *parser) parseLetBindings() (names []token, values []ast.Expr) {
+	for {
+		name, value := p.parseBinding()
+		names, values = append(names, name), append(values, value)
+		if !p.acceptKeyword("and") {
+			return names, values
+		}
+	}
+}
+
+// Parse the body of a let-expression, after `in`.
+func (p *parser) finishLet(start int, names []token, values []ast.Expr) ast.Expr {
+	bodyStart := p.peek().span.Start
+	body := p.parseExpr()
+	if p.err != nil {
+		return nil
+	}
+	if len(names) == 1 {
+		let := &ast.Let{Var: names[0].text, Value: values[0], Body: body}
+		visible := Span{bodyStart, p.end()}
+		if _, ok := values[0].(*ast.Func); ok {
+			// functions may refer to themselves:
+			visible.Start = names[0].span.End
+		}
+		p.bind(let, names[0], visible)
+		return p.span(let, start)
+	}
+	group := &ast.LetGroup{Vars: make([]ast.LetBinding, len(names)), Body: body}
+	for i, name := range names {
+		group.Vars[i] = ast.LetBinding{Var: name.text, Value: values[i]}
+		p.bind(group, name, Span{names[0].span.Start, p.end()})
+	}
+	return p.span(group, start)
+}
+
+func (p *parser) parsePostfix() ast.Expr {
+	start := p.peek().span.Start
+	e := p.parsePrimary()
+	for p.err == nil {
+		switch {
+		case p.accept("("):
+			call := &ast.Call{Func: e}
+			for !p.at(")") && p.err == nil {
+				call.Args = append(call.Args, p.parseExpr())
+				if !p.accept(",") {
+					break
+				}
+			}
+			p.expect(")")
+			e = p.span(call, start)
+		case p.accept("."):
+			label := p.expectIdent()
+			e = p.span(&ast.RecordSelect{Record: e, Label: label.text}, start)
+		default:
+			return e
+		}
+	}
+	return nil
+}
+
+func (p *parser) parsePrimary() ast.Expr {
+	tok := p.peek()
+	start := tok.span.Start
+	switch tok.kind {
+	case tokIdent:
+		p.advance()
+		return p.span(&ast.Var{Name: tok.text}, start)
+
+	case tokInt, tokFloat, tokString:
+		p.advance()
+		t := types.Type(intType)
+		switch tok.kind {
+		case tokFloat:
+			t = floatType
+		case tokString:
+			t = stringType
+		}
+		lit := &ast.Literal{Syntax: tok.text, Construct: func(types.TypeEnv, uint, []types.Type) (types.Type, error) { return t, nil }}
+		return p.span(lit, start)
+
+	case tokKeyword:
+		if tok.text == "match" {
+			return p.parseMatch()
+		}
+		// nested scope expressions may be used as arguments without parentheses:
+		switch tok.text {
+		case "let", "fn", "pipe", "unpack", "pack":
+			return p.parseExpr()
+		}
+
+	case tokPunct:
+		switch tok.text {
+		case "(":
+			p.advance()
+			e := p.parseExpr()
+			p.expect(")")
+			if p.err != nil {
+				return nil
+			}
+			// parentheses extend the span of the enclosed expression:
+			p.sm.Spans[e] = Span{start, p.end()}
+			return e
+		case "{":
+			return p.parseRecord()
+		case ":", "*":
+			return p.parseExpr()
+		}
+	}
+	p.fail(tok.span, "expected expression, found "+describe(tok))
+	return nil
+}
+
+// Check if the tokens at the current position begin a record field: `a = e` or `f(x, y) = e`
+func (p *parser) atField() bool {
+	if p.peek().kind != tokIdent {
+		return false
+	}
+	next := p.peekAt(1)
+	if next.kind != tokPunct {
+		return false
+	}
+	switch next.text {
+	case "=":
+		return true
+	case "(":
+		for n := 2; ; n++ {
+			tok := p.peekAt(n)
+			switch {
+			case tok.kind == tokIdent:
+			case tok.kind == tokPunct && tok.text == ",":
+			case tok.kind == tokPunct && tok.text == ")":
+				after := p.peekAt(n + 1)
+				return after.kind == tokPunct && after.text == "="
+			default:
+				return false
+			}
+		}
+	}
+	return false
+}
+
+func (p *parser) parseRecord() ast.Expr {
+	start := p.advance().span.Start
+	if p.accept("}") {
+		return p.span(&ast.RecordEmpty{}, start)
+	}
+	if !p.atField() {
+		record := p.parseExpr()
+		p.expect("-")
+		label := p.expectIdent()
+		p.expect("}")
+		if p.err != nil {
+			return nil
+		}
+		return p.span(&ast.RecordRestrict{Record: record, Label: label.text}, start)
+	}
+	extend := &ast.RecordExtend{}
+	for p.err == nil {
+		name, value := p.parseBinding()
+		extend.Labels = append(extend.Labels, ast.LabelValue{Label: name.text, Value: value})
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.accept("|") {
+		extend.Record = p.parseExpr()
+	} else {
+		extend.Record = &ast.RecordEmpty{}
+	}
+	p.expect("}")
+	if p.err != nil {
+		return nil
+	}
+	return p.span(extend, start)
+}
+
+func (p *parser) parseMatch() ast.Expr {
+	start := p.advance().span.Start
+	value := p.parseExpr()
+	p.expect("{")
+	match := &ast.Match{Value: value}
+	for p.err == nil {
+		if p.accept(":") {
+			label := p.expectIdent()
+			name := p.expectIdent()
+			p.expect("->")
+			caseStart := p.peek().span.Start
+			caseValue := p.parseExpr()
+			if p.err != nil {
+				return nil
+			}
+			match.Cases = append(match.Cases, ast.MatchCase{Label: label.text, Var: name.text, Value: caseValue})
+			p.bind(match, name, Span{caseStart, p.end()})
+		} else {
+			name := p.expectIdent()
+			p.expect("->")
+			caseStart := p.peek().span.Start
+			caseValue := p.parseExpr()
+			if p.err != nil {
+				return nil
+			}
+			match.Default = &ast.MatchCase{Var: name.text, Value: caseValue}
+			p.bind(match, name, Span{caseStart, p.end()})
+			break
+		}
+		if !p.accept("|") {
+			break
+		}
+	}
+	p.expect("}")
+	if p.err != nil {
+		return nil
+	}
+	return p.span(match, start)
+}
@@ -0,0 +1,194 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package syntax parses expressions and types in the concrete syntax printed by ast.ExprString and types.TypeString.
+//
+// Parsed expressions are accompanied by a source map, which records the source span of each expression and the binding site
+// of each variable introduced by a scope expression (such as a let-binding or function).
+//
+// Expressions:
+//
+//   Var:             x
+//   Literal:         1, 1.5, "text"
+//   Deref:           *x
+//   DerefAssign:     *x = y
+//   Pipe:            pipe x = xs |> f(x) |> g(x)
+//   Call:            f(x, y)
+//   Func:            fn (x, y) -> e
+//   Let:             let f(x) = e1 in e2
+//   LetGroup:        let f(x) = e1 and g(y) = e2 in e3
+//   RecordSelect:    r.a
+//   RecordExtend:    {a = 1, b = 2 | r}
+//   RecordRestrict:  {r - a}
+//   RecordEmpty:     {}
+//   Variant:         :A x
+//   Match:           match e { :A a -> e1 | :B b -> e2 | z -> e3 }
+//   Pack:            pack e as exists 'a. {x : 'a}
+//   Unpack:          unpack p = e1 in e2
+//
+// Comments begin with `//` and continue to the end of the line.
+package syntax
+
+import (
+	"strconv"
+
+	"github.com/wdamron/poly/ast"
+)
+
+// Span is a range of byte offsets within source text, from Start (inclusive) to End (exclusive).
+type Span struct {
+	Start, End int
+}
+
+// Check if the span contains the given byte offset. The end of the span is included, so a cursor
+// placed directly after an identifier is considered to be within the identifier.
+func (s Span) Contains(offset int) bool { return s.Start <= offset && offset <= s.End }
+
+// Check if the span encloses another span.
+func (s Span) Encloses(other Span) bool { return s.Start <= other.Start && other.End <= s.End }
+
+// Binder is the binding site of a variable introduced by a scope expression.
+type Binder struct {
+	Name string
+	// Span of the variable name at the binding site
+	Span Span
+	// Span of the source text where the variable is visible
+	Scope Span
+}
+
+// SourceMap records source spans for parsed expressions.
+type SourceMap struct {
+	// Spans of parsed expressions
+	Spans map[ast.Expr]Span
+	// Binding sites of variables introduced by scope expressions (Let, LetGroup, Func, Pipe, Match, Unpack)
+	Binders map[ast.Expr][]Binder
+}
+
+// Create an empty source map.
+func NewSourceMap() *SourceMap {
+	return &SourceMap{Spans: make(map[ast.Expr]Span), Binders: make(map[ast.Expr][]Binder)}
+}
+
+// Find the innermost expression with a span containing the given byte offset, within root.
+// The path from root to the innermost expression will be returned, or nil if no expression contains the offset.
+//
+// Sub-expressions which strictly contain the offset are preferred over sub-expressions which end at the offset.
+func (m *SourceMap) PathAt(root ast.Expr, offset int) []ast.Expr {
+	var path []ast.Expr
+	for e := root; e != nil; {
+		span, ok := m.Spans[e]
+		if !ok || !span.Contains(offset) {
+			break
+		}
+		path = append(path, e)
+		var next ast.Expr
+		for _, child := range Children(e) {
+			span, ok := m.Spans[child]
+			if !ok || !span.Contains(offset) {
+				continue
+			}
+			next = child
+			if offset < span.End {
+				break
+			}
+		}
+		e = next
+	}
+	return path
+}
+
+// Find the binding site of a variable with the given name and source span, introduced by the scope expression.
+func (m *SourceMap) Binder(scope ast.Expr, name string, span Span) (Binder, bool) {
+	for _, b := range m.Binders[scope] {
+		if b.Name == name && b.Scope.Encloses(span) {
+			return b, true
+		}
+	}
+	return Binder{}, false
+}
+
+// Children returns the direct sub-expressions of e.
+func Children(e ast.Expr) []ast.Expr {
+	switch e := e.(type) {
+	case *ast.Deref:
+		return []ast.Expr{e.Ref}
+	case *ast.DerefAssign:
+		return []ast.Expr{e.Ref, e.Value}
+	case *ast.Pipe:
+		return append([]ast.Expr{e.Source}, e.Sequence...)
+	case *ast.Call:
+		return append([]ast.Expr{e.Func}, e.Args...)
+	case *ast.Func:
+		return []ast.Expr{e.Body}
+	case *ast.Let:
+		return []ast.Expr{e.Value, e.Body}
+	case *ast.LetGroup:
+		children := make([]ast.Expr, 0, len(e.Vars)+1)
+		for _, v := range e.Vars {
+			children = append(children, v.Value)
+		}
+		return append(children, e.Body)
+	case *ast.RecordSelect:
+		return []ast.Expr{e.Record}
+	case *ast.RecordExtend:
+		children := make([]ast.Expr, 0, len(e.Labels)+1)
+		for _, v := range e.Labels {
+			children = append(children, v.Value)
+		}
+		return append(children, e.Record)
+	case *ast.RecordRestrict:
+		return []ast.Expr{e.Record}
+	case *ast.Variant:
+		return []ast.Expr{e.Value}
+	case *ast.Match:
+		children := []ast.Expr{e.Value}
+		for _, c := range e.Cases {
+			children = append(children, c.Value)
+		}
+		if e.Default != nil {
+			children = append(children, e.Default.Value)
+		}
+		return children
+	case *ast.Pack:
+		return []ast.Expr{e.Value}
+	case *ast.Unpack:
+		return []ast.Expr{e.Value, e.Body}
+	case *ast.ControlFlow:
+		var children []ast.Expr
+		children = append(children, e.Entry.Sequence...)
+		for _, block := range e.Blocks {
+			children = append(children, block.Sequence...)
+		}
+		return append(children, e.Return.Sequence...)
+	}
+	return nil
+}
+
+// Error is a syntax error at a position within source text.
+type Error struct {
+	Span    Span
+	Message string
+}
+
+func (err *Error) Error() string {
+	return "Syntax error at offset " + strconv.Itoa(err.Span.Start) + ": " + err.Message
+}
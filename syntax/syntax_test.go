@@ -0,0 +1,112 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package syntax
+
+import (
+	"testing"
+
+	"github.com/wdamron/poly"
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/types"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	env := poly.NewTypeEnv(nil)
+	for _, src := range []string{
+		"let id(x) = x in id(1)",
+		"let f(x) = g(x) and g(y) = f(y) in f",
+		"fn (r) -> {a = 1, f(x) = x | {r - b}}.a",
+		"match :A 1 { :A a -> a | :B b -> b | z -> 2 }",
+		"pipe x = 1 |> add(x, 2) |> x",
+		"let r = ref(\"s\") in *r = *r",
+		"unpack p = pack {s = 1.5} as exists 'a. {s : 'a} in p.s",
+	} {
+		e, _, err := Parse(src, env)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		if s := ast.ExprString(e); s != src {
+			t.Fatalf("expected %s, found %s", src, s)
+		}
+	}
+
+	_, _, err := Parse("let x = in x", env)
+	if serr, ok := err.(*Error); !ok || serr.Span != (Span{8, 10}) {
+		t.Fatalf("expected syntax error at 8, found %v", err)
+	}
+}
+
+func TestParseType(t *testing.T) {
+	env := poly.NewTypeEnv(nil)
+	for _, src := range []string{
+		"(int, 'a) -> 'a ! <read, write | 'b>",
+		"{a : int, a : bool | 'a}",
+		"exists 'a 'b. [A : 'a -> 'b] -> ref[int]",
+		"array[int, 8]",
+		"() -> ()",
+	} {
+		ty, err := ParseType(src, env)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		if s := types.TypeString(poly.Generalize(ty)); s != src {
+			t.Fatalf("expected %s, found %s", src, s)
+		}
+	}
+	ty, _ := ParseType("ref['a]", env)
+	if app, ok := ty.(*types.App); !ok || !types.IsRefType(app) || !app.HasRefs() {
+		t.Fatalf("expected reference-type, found %s", types.TypeString(ty))
+	}
+}
+
+func TestParseFileTypeVars(t *testing.T) {
+	env := poly.NewTypeEnv(nil)
+	decls, _, err := ParseFile("ref : 'a -> ref['a]\nchoose : ('a, 'a) -> 'a", env)
+	if err != nil || len(decls) != 2 {
+		t.Fatalf("expected 2 declarations, found %d: %v", len(decls), err)
+	}
+	// Type-variables are scoped to each declaration:
+	ref, choose := decls[0].(*SigDecl).Type.(*types.Arrow), decls[1].(*SigDecl).Type.(*types.Arrow)
+	if ref.Args[0] == choose.Args[0] {
+		t.Fatalf("expected separate type-variables for each declaration")
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	env := poly.NewTypeEnv(nil)
+	src := "let f(x) = x in match f(1) { :A x -> x | x -> x }"
+	e, sm, err := Parse(src, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := sm.PathAt(e, len(src)-3)
+	v, ok := path[len(path)-1].(*ast.Var)
+	if !ok || sm.Spans[v] != (Span{len(src) - 3, len(src) - 2}) {
+		t.Fatalf("unexpected path: %v", path)
+	}
+	match := path[len(path)-2]
+	binder, ok := sm.Binder(match, "x", sm.Spans[v])
+	if !ok || binder.Span != (Span{41, 42}) {
+		t.Fatalf("unexpected binder: %+v", binder)
+	}
+}
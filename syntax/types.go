@@ -0,0 +1,322 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package syntax
+
+import (
+	"strconv"
+
+	"github.com/wdamron/poly/types"
+)
+
+// Parse a type in the syntax printed by types.TypeString.
+//
+// Each distinct type-variable name will be bound to a new (unbound) type-variable, created within env at the level above
+// the top-level, so parsed types will be generalized when declared within a type environment. Type-variables quantified by
+// existential types are bound only within the body of the existential type.
+//
+// The following types are supported:
+//
+//   Unit:         ()
+//   Var:          'a
+//   Const:        int
+//   Size:         8
+//   App:          array[int, 8]
+//   Arrow:        (int, 'a) -> 'a ! <read, write | 'e>
+//   Record:       {a : int, b : bool | 'r}
+//   Variant:      [A : int, B : () | 'r]
+//   Existential:  exists 'a. {state : 'a, step : 'a -> 'a}
+//   Qualified:    (Eq 'a, Show 'a) => 'a -> string
+//
+// Type-classes named by predicates are looked up within env, if env implements `LookupTypeClass(name string) *types.TypeClass`
+// (as *poly.TypeEnv does).
+//
+// Mutable and read-only reference-types (`ref[int]` and `readref[int]`) are constructed with types.NewRef and types.NewReadRef.
+func ParseType(src string, env types.TypeEnv) (types.Type, error) {
+	return ParseTypeWithVars(src, env, nil)
+}
+
+// Parse a type, binding type-variable names to the given type-variables. Free type-variables which are not found in vars
+// will be created within env and added to vars, if vars is not nil. Names of type-variables include the leading quote (`'a`).
+func ParseTypeWithVars(src string, env types.TypeEnv, vars map[string]*types.Var) (types.Type, error) {
+	p := newParser(src, env)
+	for name, tv := range vars {
+		p.typeVars = append(p.typeVars, namedVar{name, tv})
+	}
+	t := p.parseQualifiedType()
+	if p.err == nil && p.peek().kind != tokEOF {
+		p.fail(p.peek().span, "unexpected "+describe(p.peek())+" after type")
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if vars != nil {
+		for _, v := range p.typeVars {
+			vars[v.name] = v.tv
+		}
+	}
+	return t, nil
+}
+
+type typeClassEnv interface {
+	LookupTypeClass(name string) *types.TypeClass
+}
+
+// Parse a type with optional type-class predicates: `(Eq 'a, Ord 'b) => t` or `Eq 'a => t`
+func (p *parser) parseQualifiedType() types.Type {
+	start := p.pos
+	type pred struct {
+		class token
+		name  string
+	}
+	var preds []pred
+	parens := p.accept("(")
+	for p.peek().kind == tokIdent && p.peekAt(1).kind == tokTypeVar {
+		class, tv := p.advance(), p.advance()
+		preds = append(preds, pred{class, tv.text})
+		if !parens || !p.accept(",") {
+			break
+		}
+	}
+	if len(preds) == 0 || (parens && !p.accept(")")) || !p.accept("=>") {
+		// not a qualified type:
+		p.pos = start
+		return p.parseType()
+	}
+	for _, pred := range preds {
+		var tc *types.TypeClass
+		if env, ok := p.env.(typeClassEnv); ok {
+			tc = env.LookupTypeClass(pred.class.text)
+		}
+		if tc == nil {
+			p.fail(pred.class.span, "Type-class "+pred.class.text+" is not declared")
+			return nil
+		}
+		p.typeVar(pred.name).AddConstraint(types.InstanceConstraint{TypeClass: tc})
+	}
+	return p.parseType()
+}
+
+func (p *parser) typeVar(name string) *types.Var {
+	for i := len(p.typeVars) - 1; i >= 0; i-- {
+		if p.typeVars[i].name == name {
+			return p.typeVars[i].tv
+		}
+	}
+	tv := p.env.NewVar(types.TopLevel + 1)
+	// free type-variables are visible across the entire parse:
+	p.typeVars = append([]namedVar{{name, tv}}, p.typeVars...)
+	return tv
+}
+
+func (p *parser) parseType() types.Type {
+	if p.acceptKeyword("exists") {
+		var vars []*types.Var
+		for p.peek().kind == tokTypeVar {
+			tok := p.advance()
+			tv := p.env.NewVar(types.TopLevel + 1)
+			vars = append(vars, tv)
+			p.typeVars = append(p.typeVars, namedVar{tok.text, tv})
+		}
+		if len(vars) == 0 {
+			p.fail(p.peek().span, "expected type-variable after exists")
+			return nil
+		}
+		p.expect(".")
+		body := p.parseType()
+		// quantified type-variables are kept at the end of the list, after free type-variables:
+		p.typeVars = p.typeVars[:len(p.typeVars)-len(vars)]
+		if p.err != nil {
+			return nil
+		}
+		return types.NewExistential(vars, body)
+	}
+
+	var args []types.Type
+	if p.accept("(") {
+		for !p.at(")") && p.err == nil {
+			args = append(args, p.parseType())
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect(")")
+		if p.err != nil {
+			return nil
+		}
+		if !p.at("->") {
+			switch len(args) {
+			case 0:
+				return types.NewUnit()
+			case 1:
+				return args[0]
+			default:
+				p.fail(p.peek().span, "expected -> after argument types")
+				return nil
+			}
+		}
+	} else {
+		arg := p.parseSimpleType()
+		if p.err != nil || !p.at("->") {
+			return arg
+		}
+		args = []types.Type{arg}
+	}
+
+	p.expect("->")
+	ret := p.parseType()
+	if p.err != nil {
+		return nil
+	}
+	arrow := &types.Arrow{Args: args, Return: ret}
+	if p.accept("!") {
+		arrow.Effects = p.parseEffects()
+	}
+	return arrow
+}
+
+func (p *parser) parseEffects() types.Type {
+	p.expect("<")
+	var effects []string
+	for p.peek().kind == tokIdent && p.err == nil {
+		effects = append(effects, p.advance().text)
+		if !p.accept(",") {
+			break
+		}
+	}
+	var rest types.Type
+	if p.accept("|") {
+		rest = p.parseType()
+	}
+	p.expect(">")
+	if p.err != nil {
+		return nil
+	}
+	return types.NewEffectRow(rest, effects...)
+}
+
+func (p *parser) parseSimpleType() types.Type {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokTypeVar:
+		p.advance()
+		return p.typeVar(tok.text)
+
+	case tok.kind == tokInt:
+		p.advance()
+		size, err := strconv.Atoi(tok.text)
+		if err != nil {
+			p.fail(tok.span, "invalid size "+tok.text)
+			return nil
+		}
+		return types.Size(size)
+
+	case tok.kind == tokIdent:
+		p.advance()
+		var c *types.Const
+		switch tok.text {
+		case types.RefType.Name:
+			c = types.RefType
+		case types.ReadRefType.Name:
+			c = types.ReadRefType
+		default:
+			c = &types.Const{Name: tok.text}
+		}
+		if !p.accept("[") {
+			return c
+		}
+		var params []types.Type
+		for !p.at("]") && p.err == nil {
+			params = append(params, p.parseType())
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect("]")
+		if p.err != nil {
+			return nil
+		}
+		switch {
+		case c == types.RefType && len(params) == 1:
+			return types.NewRef(params[0])
+		case c == types.ReadRefType && len(params) == 1:
+			return types.NewReadRef(params[0])
+		}
+		return &types.App{Const: c, Params: params}
+
+	case tok.kind == tokPunct && tok.text == "{":
+		p.advance()
+		row := p.parseRow("}")
+		if p.err != nil {
+			return nil
+		}
+		return &types.Record{Row: row}
+
+	case tok.kind == tokPunct && tok.text == "[":
+		p.advance()
+		row := p.parseRow("]")
+		if p.err != nil {
+			return nil
+		}
+		return &types.Variant{Row: row}
+	}
+	p.fail(tok.span, "expected type, found "+describe(tok))
+	return nil
+}
+
+// Parse labeled types and an optional row-extension, up to the closing delimiter. Labels may be repeated (scoped).
+func (p *parser) parseRow(closing string) types.Type {
+	var order []string
+	labels := make(map[string][]types.Type)
+	for p.peek().kind == tokIdent && p.err == nil {
+		label := p.advance().text
+		p.expect(":")
+		t := p.parseType()
+		if _, ok := labels[label]; !ok {
+			order = append(order, label)
+		}
+		labels[label] = append(labels[label], t)
+		if !p.accept(",") {
+			break
+		}
+	}
+	var rest types.Type = types.RowEmptyPointer
+	if p.accept("|") {
+		rest = p.parseType()
+	}
+	p.expect(closing)
+	if p.err != nil {
+		return nil
+	}
+	if len(order) == 0 {
+		return rest
+	}
+	mb := types.NewTypeMapBuilder()
+	for _, label := range order {
+		lb := types.NewTypeListBuilder()
+		for _, t := range labels[label] {
+			lb.Append(t)
+		}
+		mb.Set(label, lb.Build())
+	}
+	return &types.RowExtend{Row: rest, Labels: mb.Build()}
+}
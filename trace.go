@@ -0,0 +1,240 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/wdamron/poly/ast"
+	"github.com/wdamron/poly/types"
+)
+
+var _ InferenceObserver = (*Tracer)(nil)
+
+// Tracer is an inference observer which writes a readable, indented log of inference events, or a stream of JSON events.
+//
+// Each line of the log describes one event, indented by the depth of the expression being inferred:
+//
+//   Call: show(id(one)) (level 1)
+//     Var: show (level 1)
+//       lookup show : Show 'a => 'a -> string
+//       instantiate Show 'a => 'a -> string => Show '_7 => '_7 -> string
+//     Var : Show '_7 => '_7 -> string
+//     ...
+//     unify Show '_7 => '_7 ~ int
+//     select Show instance int for int
+//       => int
+//   Call : string
+//
+// Instantiation of types which are not generic is not logged.
+//
+// JSON events are written as one object per line, with an "event" field (one of "enter", "leave", "lookup", "unify",
+// "unified", "instantiate", "generalize", "instance" or "defer") and a "depth" field. Types and expressions are printed as strings.
+type Tracer struct {
+	// MaxExprLength is the maximum length of printed expressions, or 0 for no limit. Longer expressions are truncated.
+	MaxExprLength int
+
+	w     io.Writer
+	enc   *json.Encoder // JSON event encoder, or nil
+	depth int
+	err   error
+	buf   []byte
+}
+
+// Create a tracer which writes a readable, indented log of inference events to w.
+func NewTracer(w io.Writer) *Tracer { return &Tracer{w: w, MaxExprLength: 60} }
+
+// Create a tracer which writes a stream of JSON inference events to w, as one object per line.
+func NewJSONTracer(w io.Writer) *Tracer {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &Tracer{w: w, MaxExprLength: 60, enc: enc}
+}
+
+// Get the first error which occurred while writing events, or nil.
+func (tr *Tracer) Err() error { return tr.err }
+
+// A JSON inference event
+type traceEvent struct {
+	Event    string `json:"event"`
+	Depth    int    `json:"depth"`
+	Expr     string `json:"expr,omitempty"`
+	Syntax   string `json:"syntax,omitempty"`
+	Level    *uint  `json:"level,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Class    string `json:"class,omitempty"`
+	Generic  string `json:"generic,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	A        string `json:"a,omitempty"`
+	B        string `json:"b,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (tr *Tracer) EnterExpr(e ast.Expr, level uint) {
+	if tr.enc != nil {
+		tr.event(traceEvent{Event: "enter", Expr: e.ExprName(), Syntax: tr.exprString(e), Level: &level})
+	} else {
+		tr.line(e.ExprName(), ": ", tr.exprString(e), " (level ", strconv.Itoa(int(level)), ")")
+	}
+	tr.depth++
+}
+
+func (tr *Tracer) LeaveExpr(e ast.Expr, t types.Type, err error) {
+	tr.depth--
+	switch {
+	case tr.enc != nil:
+		tr.event(traceEvent{Event: "leave", Expr: e.ExprName(), Type: typeString(t), Error: errorString(err)})
+	case err != nil:
+		tr.line(e.ExprName(), " failed: ", err.Error())
+	default:
+		tr.line(e.ExprName(), " : ", typeString(t))
+	}
+}
+
+func (tr *Tracer) Lookup(name string, t types.Type) {
+	if tr.enc != nil {
+		tr.event(traceEvent{Event: "lookup", Name: name, Type: typeString(t)})
+	} else {
+		tr.line("lookup ", name, " : ", typeString(t))
+	}
+}
+
+func (tr *Tracer) EnterUnify(a, b types.Type) {
+	if tr.enc != nil {
+		tr.event(traceEvent{Event: "unify", A: typeString(a), B: typeString(b)})
+	} else {
+		tr.line("unify ", typeString(a), " ~ ", typeString(b))
+	}
+}
+
+func (tr *Tracer) LeaveUnify(a, b types.Type, err error) {
+	switch {
+	case tr.enc != nil:
+		event := traceEvent{Event: "unified", Error: errorString(err)}
+		if err == nil {
+			event.Type = typeString(a)
+		}
+		tr.event(event)
+	case err != nil:
+		tr.line("  failed: ", err.Error())
+	default:
+		tr.line("  => ", typeString(a))
+	}
+}
+
+func (tr *Tracer) Instantiate(level uint, generic, instance types.Type) {
+	if generic == instance {
+		// the type was not generic
+		return
+	}
+	if tr.enc != nil {
+		tr.event(traceEvent{Event: "instantiate", Level: &level, Generic: typeString(generic), Type: typeString(instance)})
+	} else {
+		tr.line("instantiate ", typeString(generic), " => ", typeString(instance))
+	}
+}
+
+func (tr *Tracer) Generalize(level uint, t types.Type) {
+	if tr.enc != nil {
+		tr.event(traceEvent{Event: "generalize", Level: &level, Type: typeString(t)})
+	} else {
+		tr.line("generalize at level ", strconv.Itoa(int(level)), ": ", typeString(t))
+	}
+}
+
+func (tr *Tracer) SelectInstance(tc *types.TypeClass, t types.Type, inst *types.Instance) {
+	if tr.enc != nil {
+		tr.event(traceEvent{Event: "instance", Class: tc.Name, Type: typeString(t), Instance: typeString(inst.Param)})
+	} else {
+		tr.line("select ", inst.TypeClass.Name, " instance ", typeString(inst.Param), " for ", typeString(t))
+	}
+}
+
+func (tr *Tracer) DeferConstraint(tc *types.TypeClass, t types.Type, e ast.Expr) {
+	if tr.enc != nil {
+		tr.event(traceEvent{Event: "defer", Class: tc.Name, Type: typeString(t), Syntax: tr.exprString(e)})
+	} else {
+		tr.line("defer instance matching for ", tc.Name, " ", typeString(t))
+	}
+}
+
+func (tr *Tracer) exprString(e ast.Expr) string {
+	if e == nil {
+		return ""
+	}
+	s := ast.ExprString(e)
+	if tr.MaxExprLength <= 0 || utf8.RuneCountInString(s) <= tr.MaxExprLength {
+		return s
+	}
+	runes := 0
+	for i := range s {
+		if runes == tr.MaxExprLength {
+			return s[:i] + "..."
+		}
+		runes++
+	}
+	return s
+}
+
+func (tr *Tracer) line(parts ...string) {
+	tr.buf = tr.buf[:0]
+	for i := 0; i < tr.depth; i++ {
+		tr.buf = append(tr.buf, "  "...)
+	}
+	for _, part := range parts {
+		tr.buf = append(tr.buf, part...)
+	}
+	tr.write(append(tr.buf, '\n'))
+}
+
+func (tr *Tracer) event(event traceEvent) {
+	event.Depth = tr.depth
+	if tr.err == nil {
+		tr.err = tr.enc.Encode(&event)
+	}
+}
+
+func (tr *Tracer) write(b []byte) {
+	if tr.err != nil {
+		return
+	}
+	_, tr.err = tr.w.Write(b)
+}
+
+func typeString(t types.Type) string {
+	if t == nil {
+		return ""
+	}
+	return types.TypeString(t)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
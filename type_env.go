@@ -25,6 +25,7 @@ package poly
 import (
 	"errors"
 
+	"github.com/benbjohnson/immutable"
 	"github.com/wdamron/poly/ast"
 	"github.com/wdamron/poly/internal/typeutil"
 	"github.com/wdamron/poly/internal/util"
@@ -34,8 +35,8 @@ import (
 // TypeEnv is a type-enviroment containing mappings from identifiers to declared types.
 //
 // A type-environment cannot be used concurrently for inference; to share a type-environment
-// across threads, create a new type-environment for each thread which inherits from the
-// shared environment.
+// across threads, freeze the shared environment (see Freeze) and create a new type-environment
+// for each thread which inherits from the frozen environment.
 type TypeEnv struct {
 	// Mappings from identifiers to declared types in the current type-environment
 	Types map[string]types.Type
@@ -43,31 +44,82 @@ type TypeEnv struct {
 	TypeClasses map[string]*types.TypeClass
 	// Predeclared types in the parent of the current type-environment
 	Parent *TypeEnv
+	// Module which declares the current type-environment. If Module is empty, the module of the parent
+	// type-environment will be inherited. Orphan instances will be rejected within named modules.
+	Module string
 
-	common typeutil.CommonContext
+	typeConstructors map[string]bool
+	kinds            map[string]types.Kind
+	opaque           map[string]bool
+	dataTypes        map[string]*DataType
+	units            map[string]*types.Measure
+	variances        map[string][]types.Variance
+	imports          []*TypeEnv
+	derivers         map[*types.TypeClass]Deriver
+	recursives       *types.RecursiveRegistry
+	interner         *types.Interner
+	overlay          *types.ClassOverlay // instances and sub-classes added to type-classes shared with frozen environments
+	cachedVisibility *envVisibility      // environments and overlays visible through parent environments or imports
+	common           typeutil.CommonContext
+
+	frozen        bool
+	frozenTypes   *immutable.Map // bindings of the frozen type-environment and its parent environment(s)
+	frozenClasses *immutable.Map // type-classes of the frozen type-environment and its parent environment(s)
 }
 
 // Create a type-environment. The new environment will inherit bindings from the parent, if the parent is not nil.
 //
 // A type-environment cannot be used concurrently for inference; to share a type-environment
-// across threads, create a new type-environment for each thread which inherits from the
-// shared environment.
+// across threads, freeze the shared environment (see Freeze) and create a new type-environment
+// for each thread which inherits from the frozen environment.
 func NewTypeEnv(parent *TypeEnv) *TypeEnv {
 	env := &TypeEnv{
 		Parent: parent,
 		Types:  make(map[string]types.Type),
 	}
 	env.common.Init()
+	env.common.InstanceVisible, env.common.IsOpaque = env.InstanceVisible, env.IsOpaque
+	env.common.Variance, env.common.ClassOverlays = env.LookupVariance, env.classOverlays
 	if parent != nil {
 		env.common.VarTracker.NextId = parent.common.VarTracker.NextId
+		env.interner = parent.interner
 	}
 	return env
 }
 
+// Intern ground types declared or inferred within the type-environment, so structurally equal ground types share
+// a single instance (and unify without being traversed). Type-environments created from the type-environment will
+// inherit the interner. An interner may be shared by multiple type-environments.
+//
+// By default, ground types are not interned.
+func (e *TypeEnv) SetInterner(interner *types.Interner) {
+	e.checkMutable()
+	e.interner = interner
+}
+
+// Get the interner for ground types within the type-environment, or nil if ground types are not interned.
+func (e *TypeEnv) Interner() *types.Interner { return e.interner }
+
+func (e *TypeEnv) intern(t types.Type) types.Type {
+	if e.interner == nil {
+		return t
+	}
+	return e.interner.Intern(t)
+}
+
+// Intern t if t is ground. Inferred types which contain type-variables are not interned, since interning would copy them.
+func (e *TypeEnv) internGround(t types.Type) types.Type {
+	if e.interner == nil || !types.IsGround(t) {
+		return t
+	}
+	return e.interner.Intern(t)
+}
+
 // Get the id which will be assigned to the next type-variable generated within the type-environment.
 func (e *TypeEnv) NextVarId() uint { return e.common.VarTracker.NextId }
 
 func (e *TypeEnv) freshId() uint {
+	e.checkMutable()
 	id := e.common.VarTracker.NextId
 	e.common.VarTracker.NextId++
 	return id
@@ -99,6 +151,9 @@ func (e *TypeEnv) NewQualifiedVar(constraints ...types.InstanceConstraint) *type
 //
 // The bind function should add aliased types with underlying types which are recursively linked
 // to one or more types in the Recursive.
+//
+// The new type-group will be interned (see InternRecursive), so links to structurally equivalent type-groups
+// declared within the type-environment or its parent environment(s) will unify.
 func (e *TypeEnv) NewRecursive(params []*types.Var, bind func(recursive *types.Recursive)) *types.Recursive {
 	rec := &types.Recursive{Params: params, Bind: bind, Flags: types.NeedsGeneralization}
 	for i, tv := range rec.Params {
@@ -108,9 +163,32 @@ func (e *TypeEnv) NewRecursive(params []*types.Var, bind func(recursive *types.R
 	for i, alias := range rec.Types {
 		rec.Types[i] = Generalize(alias).(*types.App)
 	}
+	e.InternRecursive(rec)
 	return rec
 }
 
+// Intern the root of a recursive type-group within the type-environment. If a structurally equivalent type-group
+// was interned within the type-environment or its parent environment(s), the root will share its canonical
+// type-group. The canonical type-group will be returned.
+//
+// Type-groups are compared up to renaming of type-variables; see types.RecursiveEquivalent.
+func (e *TypeEnv) InternRecursive(rec *types.Recursive) *types.Recursive {
+	e.checkMutable()
+	for env := e; env != nil; env = env.Parent {
+		if env.recursives == nil {
+			continue
+		}
+		if canonical := env.recursives.Find(rec); canonical != nil {
+			rec.Root().Canonical = canonical
+			return canonical
+		}
+	}
+	if e.recursives == nil {
+		e.recursives = types.NewRecursiveRegistry()
+	}
+	return e.recursives.Intern(rec)
+}
+
 // Create a new recursive type.
 //
 // The bindSelf function should add a single aliased type with an underlying type which is recursively linked
@@ -125,34 +203,51 @@ func (e *TypeEnv) NewSimpleRecursive(params []*types.Var, bindSelf func(*types.R
 //
 // Type-variables contained within mutable reference-types will be generalized.
 func (e *TypeEnv) Declare(name string, t types.Type) {
-	e.Types[name] = GeneralizeRefs(t)
+	e.checkMutable()
+	e.Types[name] = e.intern(GeneralizeRefs(t))
 }
 
 // Declare a weakly-polymorphic type for an identifier within the type environment.
 //
 // Type-variables contained within mutable reference-types will not be generalized.
 func (e *TypeEnv) DeclareWeak(name string, t types.Type) {
-	e.Types[name] = Generalize(t)
+	e.checkMutable()
+	e.Types[name] = e.intern(Generalize(t))
 }
 
 // Declare a type for an identifier within the type environment.
 //
 // Type-variables will not be generalized.
-func (e *TypeEnv) DeclareInvariant(name string, t types.Type) { e.Types[name] = t }
+func (e *TypeEnv) DeclareInvariant(name string, t types.Type) {
+	e.checkMutable()
+	e.Types[name] = t
+}
 
 // Declare a type for an identifier within the type environment.
 //
 // Type-variables will not be generalized.
 //
 // Assign is an alias for DeclareInvariant.
-func (e *TypeEnv) Assign(name string, t types.Type) { e.Types[name] = t }
+func (e *TypeEnv) Assign(name string, t types.Type) {
+	e.checkMutable()
+	e.Types[name] = t
+}
 
 // Remove the assigned type for an identifier within the type environment. Parent environment(s) will not be affected,
 // and the identifier's type will still be visible if defined in a parent environment.
-func (e *TypeEnv) Remove(name string) { delete(e.Types, name) }
+func (e *TypeEnv) Remove(name string) {
+	e.checkMutable()
+	delete(e.Types, name)
+}
 
 // Lookup the type for an identifier in the environment or its parent environment(s).
 func (e *TypeEnv) Lookup(name string) types.Type {
+	if e.frozen {
+		if t, ok := e.frozenTypes.Get(name); ok {
+			return t.(types.Type)
+		}
+		return nil
+	}
 	if t, ok := e.Types[name]; ok {
 		return t
 	}
@@ -163,6 +258,12 @@ func (e *TypeEnv) Lookup(name string) types.Type {
 }
 
 func (e *TypeEnv) scopeLookup(name string) (types.Type, *ast.Scope) {
+	if e.frozen {
+		if t := e.Lookup(name); t != nil {
+			return t, ast.PredeclaredScope
+		}
+		return nil, nil
+	}
 	if t, ok := e.Types[name]; ok {
 		scopes := e.common.VarScopes[name]
 		if len(scopes) == 0 {
@@ -180,16 +281,36 @@ func (e *TypeEnv) scopeLookup(name string) (types.Type, *ast.Scope) {
 //
 // Literal expressions may need to instantiate types at the level they are being instantiated at.
 func (e *TypeEnv) Instantiate(level uint, t types.Type) types.Type {
+	if e.frozen {
+		return NewTypeEnv(e).Instantiate(level, t)
+	}
 	return e.common.Instantiate(level, t)
 }
 
+// Check if a and b can be unified within the type environment. Neither type will be modified.
+//
+// Tools such as editors may use speculative unification to filter candidate bindings by an expected type.
+func (e *TypeEnv) CanUnify(a, b types.Type) bool {
+	if e.frozen {
+		return NewTypeEnv(e).CanUnify(a, b)
+	}
+	return e.common.CanUnify(a, b)
+}
+
 // Declare a parameterized type-class within the type environment.
 //
 // If the type-parameter is not linked within the bind function, an instance constraint will be added to the parameter.
 //
+// The kind of the type-parameter will be inferred from the method declarations, and must match the kinds of all super-classes.
+// Instances of the type-class must match the kind of the type-parameter.
+//
 // Each super-class which the type-class implements will be modified to add a sub-class entry; changes will be visible across all uses
-// of the super-classes, and changes must not be made to type-classes concurrently.
+// of the super-classes. Within child environments of a frozen type-environment, sub-class entries are added to an overlay which is
+// only visible within the child environment, and the super-classes will not be modified.
 func (e *TypeEnv) DeclareTypeClass(name string, bind func(*types.Var) types.MethodSet, implements ...*types.TypeClass) (*types.TypeClass, error) {
+	if e.frozen {
+		return nil, errFrozen
+	}
 	if existing := e.LookupTypeClass(name); existing != nil {
 		return nil, errors.New("Type-class " + name + " is already declared")
 	}
@@ -200,8 +321,13 @@ func (e *TypeEnv) DeclareTypeClass(name string, bind func(*types.Var) types.Meth
 			return nil, errors.New("Unsupported function parameter for type-class " + name)
 		}
 	}
+	paramKind, err := e.inferParamKind(param, methods, implements)
+	if err != nil {
+		return nil, err
+	}
 	generalizedMethods := make(types.MethodSet, len(methods))
 	tc := types.NewTypeClass(e.freshId(), name, GeneralizeRefs(param), generalizedMethods)
+	tc.ParamKind = paramKind
 	for name, arrow := range methods {
 		arrow = GeneralizeRefs(arrow).(*types.Arrow)
 		generalizedMethods[name] = arrow
@@ -216,8 +342,13 @@ func (e *TypeEnv) DeclareTypeClass(name string, bind func(*types.Var) types.Meth
 		e.TypeClasses = make(map[string]*types.TypeClass)
 	}
 	e.TypeClasses[name] = tc
+	overlay := e.writableOverlay()
 	for _, super := range implements {
-		super.AddSubClass(tc)
+		if overlay != nil {
+			overlay.AddSubClass(super, tc)
+		} else {
+			super.AddSubClass(tc)
+		}
 	}
 	return tc, nil
 }
@@ -237,7 +368,8 @@ func (e *TypeEnv) DeclareTypeClass(name string, bind func(*types.Var) types.Meth
 // Match expressions may offer less flexibility compared to (unification-driven) function overloading with instance constraints.
 //
 // Each super-class which the type-class implements will be modified to add a sub-class entry; changes will be visible across all uses
-// of the super-classes, and changes must not be made to type-classes concurrently.
+// of the super-classes. Within child environments of a frozen type-environment, sub-class entries are added to an overlay which is
+// only visible within the child environment, and the super-classes will not be modified.
 func (e *TypeEnv) DeclareUnionTypeClass(name string, bind func(*types.Var), instances map[string]types.Type) (*types.TypeClass, error) {
 	bindMethods := func(param *types.Var) types.MethodSet {
 		if bind != nil {
@@ -269,6 +401,12 @@ func (e *TypeEnv) DeclareUnionTypeClass(name string, bind func(*types.Var), inst
 
 // Lookup a declared type-class in the environment or its parent environment(s).
 func (e *TypeEnv) LookupTypeClass(name string) *types.TypeClass {
+	if e.frozen {
+		if tc, ok := e.frozenClasses.Get(name); ok {
+			return tc.(*types.TypeClass)
+		}
+		return nil
+	}
 	if e.TypeClasses != nil {
 		if tc, ok := e.TypeClasses[name]; ok {
 			return tc
@@ -282,32 +420,34 @@ func (e *TypeEnv) LookupTypeClass(name string) *types.TypeClass {
 
 // Declare an instance for a parameterized type-class within the type environment. The instance must implement
 // all methods for the type-class and all parents of the type-class. The instance type must not overlap with (i.e. unify with)
-// any other instances for the type-class.
+// any other instances for the type-class which are visible within the type environment.
+//
+// Instances are only visible within the declaring type-environment, its child environments, and environments which import it.
+// Within a named module, the type-class or the type constructor of the instance type must be declared within the same module.
 //
 // methodNames must map from method names to names of their implementations within the type-environment.
 //
-// The type-class which the instance implements will be modified to add an instance entry; changes will be visible across all uses
-// of the type-class, and changes must not be made to type-classes concurrently.
+// The type-class which the instance implements will be modified to add an instance entry. Within child environments of a frozen
+// type-environment, the instance entry is added to an overlay which is only visible within the child environment, and the
+// type-class will not be modified.
 func (e *TypeEnv) DeclareInstance(tc *types.TypeClass, param types.Type, methodNames map[string]string) (*types.Instance, error) {
+	if e.frozen {
+		return nil, errFrozen
+	}
 	switch param.(type) {
 	case *types.Const, *types.App, *types.Record, *types.Variant:
 		// ok
 	default:
 		return nil, errors.New("Type-class instance must be a type constant, type application, record type, or variant type")
 	}
+	if err := e.checkInstanceKind(tc, param); err != nil {
+		return nil, err
+	}
+	if e.isOrphanInstance(tc, param) {
+		return nil, errors.New("Orphan instance " + types.TypeString(param) + " for type-class " + tc.Name + " must be declared within the module of the type-class or type")
+	}
 	// prevent overlapping instances:
-	var conflict *types.Instance
-	tc.FindInstanceFromRoots(func(inst *types.Instance) bool {
-		if !e.common.CanUnify(e.common.Instantiate(0, param), e.common.Instantiate(0, inst.Param)) {
-			return false
-		}
-		if inst.TypeClass.HasSuperClass(tc) || tc.HasSuperClass(inst.TypeClass) {
-			return false
-		}
-		conflict = inst
-		return true
-	})
-	if conflict != nil {
+	if conflict := e.findOverlappingInstance(tc, param, e.InstanceVisible); conflict != nil {
 		return nil, errors.New("Found overlapping instance for type-class " + tc.Name + " at " + conflict.TypeClass.Name + " instance " + types.TypeString(conflict.Param))
 	}
 
@@ -324,30 +464,65 @@ func (e *TypeEnv) DeclareInstance(tc *types.TypeClass, param types.Type, methodN
 		impls[name] = arrow
 	}
 	param = GeneralizeRefs(param)
-	inst := tc.AddInstance(param, impls, methodNames)
+	var inst *types.Instance
+	overlay := e.writableOverlay()
+	if overlay != nil {
+		inst = overlay.AddInstance(tc, e, param, impls, methodNames)
+	} else {
+		inst = tc.AddEnvInstance(e, param, impls, methodNames)
+	}
 	seen := util.NewUintDedupeMap()
 	err := e.checkSatisfies(tc, param, impls, seen)
 	seen.Release()
 	e.common.VarTracker.FlattenLinks()
 	e.common.VarTracker.Reset()
 	if err != nil {
-		tc.Instances = tc.Instances[:len(tc.Instances)-1]
+		if overlay != nil {
+			overlay.RemoveInstance(inst)
+		} else {
+			tc.RemoveInstance(inst)
+		}
 		return nil, err
 	}
 	return inst, nil
 }
 
+// Find an instance which overlaps with param, visiting all instances for each of the type-class's top-most parents.
+func (e *TypeEnv) findOverlappingInstance(tc *types.TypeClass, param types.Type, visible func(*types.Instance) bool) *types.Instance {
+	var conflict *types.Instance
+	e.classOverlays().FindInstanceFromRoots(tc, func(inst *types.Instance) bool {
+		if !visible(inst) {
+			return false
+		}
+		if !e.common.CanUnify(e.common.Instantiate(0, param), e.common.Instantiate(0, inst.Param)) {
+			return false
+		}
+		if inst.TypeClass.HasSuperClass(tc) || tc.HasSuperClass(inst.TypeClass) {
+			return false
+		}
+		conflict = inst
+		return true
+	})
+	return conflict
+}
+
 // Find the type-class instance which implements a called function's underlying method.
 //
 // arrow should be the function-type assigned to a Call expression during inference.
 // If the Call expression was not inferred to be a method call, a nil instance will be returned.
 func (e *TypeEnv) FindMethodInstance(arrow *types.Arrow) *types.Instance {
+	if e.frozen {
+		return NewTypeEnv(e).FindMethodInstance(arrow)
+	}
 	method := arrow.Method
 	if method == nil {
 		return nil
 	}
 	var match *types.Instance
-	method.TypeClass.FindInstance(func(inst *types.Instance) bool {
+	e.classOverlays().FindInstance(method.TypeClass, func(inst *types.Instance) bool {
+		if !e.InstanceVisible(inst) {
+			return false
+		}
 		if !e.common.CanUnify(e.common.Instantiate(0, arrow), e.common.Instantiate(0, inst.Methods[method.Name])) {
 			return false
 		}
@@ -368,8 +543,8 @@ func (e *TypeEnv) checkSatisfies(tc *types.TypeClass, param types.Type, methodIm
 		}
 	}
 	seen[tc.Id] = true
-	for superId, super := range tc.Super {
-		if seen[superId] {
+	for _, super := range tc.SuperClasses() {
+		if seen[super.Id] {
 			continue
 		}
 		if err := e.checkSatisfies(super, param, methodImpls, seen); err != nil {
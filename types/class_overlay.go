@@ -0,0 +1,194 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package types
+
+import (
+	"sort"
+
+	"github.com/wdamron/poly/internal/util"
+)
+
+// ClassOverlay contains instances and sub-classes which are added to shared type-classes without modifying the type-classes.
+// Lookups through a list of overlays (see ClassOverlays) will visit the relations of each type-class, followed by the relations
+// added within each overlay.
+//
+// An overlay cannot be modified concurrently; an overlay may be read concurrently while it is not modified.
+type ClassOverlay struct {
+	relations map[*TypeClass]*classRelations
+}
+
+// ClassOverlays is a list of overlays which extend the relations of type-classes during lookups.
+type ClassOverlays []*ClassOverlay
+
+// Create an empty overlay of type-class relations.
+func NewClassOverlay() *ClassOverlay {
+	return &ClassOverlay{relations: make(map[*TypeClass]*classRelations)}
+}
+
+func (o *ClassOverlay) load(tc *TypeClass) *classRelations {
+	if r, ok := o.relations[tc]; ok {
+		return r
+	}
+	return emptyClassRelation
+}
+
+func (o *ClassOverlay) update(tc *TypeClass, f func(r *classRelations)) {
+	if o.relations == nil {
+		o.relations = make(map[*TypeClass]*classRelations)
+	}
+	r := *o.load(tc)
+	f(&r)
+	o.relations[tc] = &r
+}
+
+// Add an instance of a type-class to the overlay, with param as the type-parameter. The instance is only visible within env
+// and type-environments which see env. The type-class will not be modified.
+//
+// methodNames must map from method names to names of their implementations within the type-environment.
+func (o *ClassOverlay) AddInstance(tc *TypeClass, env TypeEnv, param Type, methods MethodSet, methodNames map[string]string) *Instance {
+	inst := &Instance{TypeClass: tc, Param: param, Methods: methods, MethodNames: methodNames, Env: env}
+	o.update(tc, func(r *classRelations) { r.addInstance(inst) })
+	return inst
+}
+
+// Remove an instance which was added to the overlay.
+func (o *ClassOverlay) RemoveInstance(inst *Instance) {
+	o.update(inst.TypeClass, func(r *classRelations) { r.removeInstance(inst) })
+}
+
+// Add a sub-class to a type-class within the overlay. The super-class will not be modified; the super-class will be added
+// to the sub-class, which should not be shared.
+func (o *ClassOverlay) AddSubClass(super, sub *TypeClass) {
+	if _, ok := o.load(super).sub.Get(int(sub.Id)); ok {
+		return
+	}
+	sub.update(func(r *classRelations) {
+		r.addSuper(super)
+		sub.Super = classMap(r.super)
+	})
+	o.update(super, func(r *classRelations) { r.addSub(sub) })
+}
+
+// Get the sub-classes of a type-class and the sub-classes added within the overlays, ordered by id.
+func (overlays ClassOverlays) SubClasses(tc *TypeClass) []*TypeClass {
+	subs := tc.SubClasses()
+	for _, o := range overlays {
+		subs = append(subs, classList(o.load(tc).sub)...)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Id < subs[j].Id })
+	return subs
+}
+
+// Get the instances declared for a type-class, followed by the instances added within each overlay.
+func (overlays ClassOverlays) InstanceList(tc *TypeClass) []*Instance {
+	instances := tc.InstanceList()
+	for _, o := range overlays {
+		eachInstance(o.load(tc).instances, func(inst *Instance) bool {
+			instances = append(instances, inst)
+			return false
+		})
+	}
+	return instances
+}
+
+// Visit all instances for a type-class and all sub-classes, including instances and sub-classes added within the overlays.
+// Sub-classes will be visited first.
+func (overlays ClassOverlays) FindInstance(tc *TypeClass, found func(*Instance) bool) bool {
+	seen := util.NewUintDedupeMap()
+	ok, _ := overlays.findInstance(tc, seen, found)
+	seen.Release()
+	return ok
+}
+
+// Visit all instances for a type-class and all sub-classes, including instances and sub-classes added within the overlays,
+// filtered by a type-parameter. Sub-classes will be visited first. See TypeClass.MatchInstance.
+func (overlays ClassOverlays) MatchInstance(tc *TypeClass, param Type, found func(*Instance) bool) (matched bool) {
+	seen := util.NewUintDedupeMap()
+	var visit func(r *classRelations) bool
+	if c, ok := param.(*Const); ok {
+		visit = func(r *classRelations) bool { return eachInstance(instanceGroup(r.tconst, c.Name), found) }
+	} else {
+		visit = func(r *classRelations) bool { return r.index(param).match(param, found) }
+	}
+	matched, _ = overlays.matchInstance(tc, seen, visit)
+	seen.Release()
+	return
+}
+
+// Visit all instances for each of a type-class's top-most parents and all their (transitive) sub-classes, including instances
+// and sub-classes added within the overlays. Sub-classes will be visited first.
+func (overlays ClassOverlays) FindInstanceFromRoots(tc *TypeClass, found func(*Instance) bool) bool {
+	roots := make(map[uint]*TypeClass, 16)
+	tc.findRoots(roots)
+	var (
+		ok             bool
+		shouldContinue bool
+	)
+	seen := util.NewUintDedupeMap()
+	for _, root := range roots {
+		if root == nil {
+			// not a root
+			continue
+		}
+		if ok, shouldContinue = overlays.findInstance(root, seen, found); !shouldContinue {
+			break
+		}
+	}
+	seen.Release()
+	return ok
+}
+
+func (overlays ClassOverlays) findInstance(tc *TypeClass, seen util.UintDedupeMap, found func(*Instance) bool) (ok, shouldContinue bool) {
+	return overlays.matchInstance(tc, seen, func(r *classRelations) bool { return eachInstance(r.instances, found) })
+}
+
+// Visit the instances of each sub-class and then the type-class, until visit returns true.
+func (overlays ClassOverlays) matchInstance(tc *TypeClass, seen util.UintDedupeMap, visit func(*classRelations) bool) (ok, shouldContinue bool) {
+	if seen[tc.Id] {
+		return false, true
+	}
+	seen[tc.Id] = true
+	r := tc.load()
+	shouldContinue = true
+	visitSub := func(sub *TypeClass) bool {
+		ok, shouldContinue = overlays.matchInstance(sub, seen, visit)
+		return !shouldContinue
+	}
+	if eachSubClass(r, visitSub) {
+		return ok, false
+	}
+	for _, o := range overlays {
+		if eachSubClass(o.load(tc), visitSub) {
+			return ok, false
+		}
+	}
+	if visit(r) {
+		return true, false
+	}
+	for _, o := range overlays {
+		if visit(o.load(tc)) {
+			return true, false
+		}
+	}
+	return false, true
+}
@@ -0,0 +1,74 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package types
+
+// Effect labels for operations on mutable references
+const (
+	// Effect for dereferencing a mutable reference: `!r`
+	ReadEffect = "read"
+	// Effect for assigning to a mutable reference: `r := v`
+	WriteEffect = "write"
+)
+
+// Create an effect row containing the given effect labels, extending rest. If rest is nil, the row will be closed.
+//
+// Effect rows are row extensions, where each label is an effect and each labeled type is the unit type.
+func NewEffectRow(rest Type, effects ...string) Type {
+	if rest == nil {
+		rest = RowEmptyPointer
+	}
+	if len(effects) == 0 {
+		return rest
+	}
+	b := NewTypeMapBuilder()
+	for _, effect := range effects {
+		b.Set(effect, SingletonTypeList(UnitPointer))
+	}
+	return &RowExtend{Row: rest, Labels: b.Build()}
+}
+
+// Get the effect labels within an effect row, with the rest of the row (an empty row or type-variable).
+func EffectLabels(row Type) (effects []string, rest Type) {
+	labels, rest, err := FlattenRowType(row)
+	if err != nil {
+		return nil, row
+	}
+	labels.Range(func(label string, ts TypeList) bool {
+		effects = append(effects, label)
+		return true
+	})
+	return effects, rest
+}
+
+// Check if a function-type has function-typed arguments or results.
+func IsHigherOrder(t *Arrow) bool {
+	if _, ok := RealType(t.Return).(*Arrow); ok {
+		return true
+	}
+	for _, arg := range t.Args {
+		if _, ok := RealType(arg).(*Arrow); ok {
+			return true
+		}
+	}
+	return false
+}
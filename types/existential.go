@@ -0,0 +1,89 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package types
+
+var (
+	_ Type = (*Existential)(nil)
+	_ Type = (*Skolem)(nil)
+)
+
+// Existentially quantified type: `exists 'a. {state : 'a, step : 'a -> 'a}`
+//
+// Values of existential types are created with Pack expressions, which hide the types bound to the quantified type-variables.
+// Unpack expressions bind the packed value within a scope, where each quantified type-variable is replaced by a distinct
+// skolem constant which may not escape the scope.
+type Existential struct {
+	// Generic type-variables which are quantified by the existential type
+	Vars []*Var
+	Body Type
+	// Source which this type was instantiated from, or nil
+	Source *Existential
+	Flags  TypeFlags
+}
+
+// Create an existential type which quantifies vars within body. Quantified type-variables will be marked as generic.
+func NewExistential(vars []*Var, body Type) *Existential {
+	for _, tv := range vars {
+		tv.SetGeneric()
+	}
+	return &Existential{Vars: vars, Body: body, Flags: ContainsGenericVars}
+}
+
+// "Existential"
+func (t *Existential) TypeName() string { return "Existential" }
+
+// Check if t contains generic type-variables. Existential types always contain their quantified (generic) type-variables.
+func (t *Existential) IsGeneric() bool { return true }
+
+// Check if t contains mutable reference-types.
+func (t *Existential) HasRefs() bool { return t.Flags&ContainsRefs != 0 }
+
+// Check if the generic type-variable with the given id is quantified by t.
+func (t *Existential) Binds(id uint) bool {
+	for _, tv := range t.Vars {
+		if tv.Id() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Skolem constant: a rigid type which stands for the hidden type of an unpacked existential type.
+//
+// Skolem constants only unify with themselves, and may only occur within type-variables with binding-levels
+// at or above the level of the skolem constant.
+type Skolem struct {
+	// Unique identifier of the skolem constant
+	Id uint
+	// Binding-level of the scope where the skolem constant is defined
+	Level uint
+}
+
+// "Skolem"
+func (t *Skolem) TypeName() string { return "Skolem" }
+
+// Skolem constants are never generic.
+func (t *Skolem) IsGeneric() bool { return false }
+
+// Skolem constants never contain mutable reference-types.
+func (t *Skolem) HasRefs() bool { return false }
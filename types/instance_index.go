@@ -0,0 +1,309 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package types
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/benbjohnson/immutable"
+)
+
+// instanceIndex is a persistent discrimination tree over the type-parameters of instances. Each path from the root
+// is a pre-order traversal of an instance's type-parameter; type-variables (and types which may unify with types of
+// a different shape, such as aliases and recursive types) are indexed as wildcards. Rows are indexed by their sorted
+// labels and whether they are extensible.
+//
+// Lookups return every instance which may unify with a type, though some instances may not unify.
+type instanceIndex struct {
+	sym       string
+	arity     int  // number of sub-terms following the symbol
+	open      bool // for rows, whether the row is extensible
+	label     string
+	edges     *immutable.SortedMap // sym -> *instanceIndex
+	instances *immutable.List      // *Instance
+}
+
+var emptyInstanceIndex = &instanceIndex{edges: emptyClassMap, instances: emptyInstanceList}
+
+// A symbol within the pre-order traversal of a type
+type indexKey struct {
+	sym   string
+	arity int
+	open  bool
+	label string
+}
+
+const wildcardSym = "*"
+
+// Flatten t into a pre-order traversal of symbols. Aliases are only indexed as wildcards below the root, since
+// the index is partitioned by the shape of the root.
+func indexKeys(keys []indexKey, t Type, root bool) []indexKey {
+	t = RealType(t)
+	switch t := t.(type) {
+	case *Unit:
+		return append(keys, indexKey{sym: "()"})
+	case *Const:
+		return append(keys, indexKey{sym: "c:" + t.Name})
+	case Size:
+		return append(keys, indexKey{sym: "s:" + strconv.Itoa(int(t))})
+	case *App:
+		if t.Underlying != nil && !root {
+			break
+		}
+		n := len(t.Params)
+		keys = append(keys, indexKey{sym: "a/" + strconv.Itoa(n), arity: n + 1})
+		keys = indexKeys(keys, t.Const, false)
+		for _, param := range t.Params {
+			keys = indexKeys(keys, param, false)
+		}
+		return keys
+	case *Arrow:
+		n := len(t.Args)
+		keys = append(keys, indexKey{sym: "f/" + strconv.Itoa(n), arity: n + 1})
+		for _, arg := range t.Args {
+			keys = indexKeys(keys, arg, false)
+		}
+		return indexKeys(keys, t.Return, false)
+	case *Record:
+		return indexKeys(append(keys, indexKey{sym: "{}", arity: 1}), t.Row, false)
+	case *Variant:
+		return indexKeys(append(keys, indexKey{sym: "[]", arity: 1}), t.Row, false)
+	case *RowExtend, *RowEmpty:
+		labels, open, ok := indexRow(t)
+		if !ok {
+			break
+		}
+		sym := "r/" + strconv.Itoa(labels.Len())
+		if open {
+			sym += "+"
+		}
+		keys = append(keys, indexKey{sym: sym, arity: labels.Len(), open: open})
+		labels.Range(func(label string, ts TypeList) bool {
+			keys = append(keys, indexKey{sym: "l:" + label + "/" + strconv.Itoa(ts.Len()), arity: ts.Len(), label: label})
+			ts.Range(func(i int, t Type) bool {
+				keys = indexKeys(keys, t, false)
+				return true
+			})
+			return true
+		})
+		return keys
+	}
+	return append(keys, indexKey{sym: wildcardSym})
+}
+
+// Flatten a row into its labels. ok will be false if the row is not extended from a type-variable or the empty row.
+func indexRow(t Type) (labels TypeMap, open, ok bool) {
+	if t == RecordEmptyPointer {
+		return EmptyTypeMap, false, true
+	}
+	labels, rest, err := FlattenRowType(t)
+	if err != nil {
+		return labels, false, false
+	}
+	switch RealType(rest).(type) {
+	case nil, *RowEmpty:
+		return labels, false, true
+	case *Var:
+		return labels, true, true
+	}
+	return labels, false, false
+}
+
+// Add an instance to a copy of the index.
+func (idx *instanceIndex) insert(keys []indexKey, inst *Instance) *instanceIndex {
+	next := *idx
+	if len(keys) == 0 {
+		next.instances = next.instances.Append(inst)
+		return &next
+	}
+	key := keys[0]
+	child := &instanceIndex{sym: key.sym, arity: key.arity, open: key.open, label: key.label, edges: emptyClassMap, instances: emptyInstanceList}
+	if existing, ok := idx.edges.Get(key.sym); ok {
+		child = existing.(*instanceIndex)
+	}
+	next.edges = idx.edges.Set(key.sym, child.insert(keys[1:], inst))
+	return &next
+}
+
+// Remove an instance from a copy of the index.
+func (idx *instanceIndex) remove(keys []indexKey, inst *Instance) *instanceIndex {
+	next := *idx
+	if len(keys) == 0 {
+		next.instances = removeInstance(next.instances, inst)
+		return &next
+	}
+	existing, ok := idx.edges.Get(keys[0].sym)
+	if !ok {
+		return idx
+	}
+	next.edges = idx.edges.Set(keys[0].sym, existing.(*instanceIndex).remove(keys[1:], inst))
+	return &next
+}
+
+func (idx *instanceIndex) edge(sym string) *instanceIndex {
+	if child, ok := idx.edges.Get(sym); ok {
+		return child.(*instanceIndex)
+	}
+	return nil
+}
+
+func (idx *instanceIndex) eachEdge(f func(child *instanceIndex)) {
+	for itr := idx.edges.Iterator(); !itr.Done(); {
+		_, child := itr.Next()
+		f(child.(*instanceIndex))
+	}
+}
+
+// Visit instances which may unify with t, in order of declaration, until f returns true. True will be returned
+// if f returned true.
+func (idx *instanceIndex) match(t Type, f func(*Instance) bool) bool {
+	var found []*Instance
+	idx.matchTerm(t, true, func(leaf *instanceIndex) {
+		eachInstance(leaf.instances, func(inst *Instance) bool {
+			found = append(found, inst)
+			return false
+		})
+	})
+	sort.Slice(found, func(i, j int) bool { return found[i].seq < found[j].seq })
+	for _, inst := range found {
+		if f(inst) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match a single term, calling k with each node reached after the term.
+func (idx *instanceIndex) matchTerm(t Type, root bool, k func(*instanceIndex)) {
+	t = RealType(t)
+	if isWildcardQuery(t, root) {
+		idx.skip(1, k)
+		return
+	}
+	if child := idx.edge(wildcardSym); child != nil {
+		k(child)
+	}
+	switch t := t.(type) {
+	case *Unit:
+		if child := idx.edge("()"); child != nil {
+			k(child)
+		}
+	case *Const:
+		if child := idx.edge("c:" + t.Name); child != nil {
+			k(child)
+		}
+	case Size:
+		if child := idx.edge("s:" + strconv.Itoa(int(t))); child != nil {
+			k(child)
+		}
+	case *App:
+		if child := idx.edge("a/" + strconv.Itoa(len(t.Params))); child != nil {
+			child.matchTerm(t.Const, false, func(next *instanceIndex) { next.matchTerms(t.Params, k) })
+		}
+	case *Arrow:
+		if child := idx.edge("f/" + strconv.Itoa(len(t.Args))); child != nil {
+			child.matchTerms(t.Args, func(next *instanceIndex) { next.matchTerm(t.Return, false, k) })
+		}
+	case *Record:
+		if child := idx.edge("{}"); child != nil {
+			child.matchTerm(t.Row, false, k)
+		}
+	case *Variant:
+		if child := idx.edge("[]"); child != nil {
+			child.matchTerm(t.Row, false, k)
+		}
+	case *RowExtend, *RowEmpty:
+		labels, open, _ := indexRow(t)
+		idx.eachEdge(func(child *instanceIndex) {
+			if child.sym[0] == 'r' {
+				child.matchLabels(labels, open, child.open, child.arity, 0, k)
+			}
+		})
+	}
+}
+
+func (idx *instanceIndex) matchTerms(ts []Type, k func(*instanceIndex)) {
+	if len(ts) == 0 {
+		k(idx)
+		return
+	}
+	idx.matchTerm(ts[0], false, func(next *instanceIndex) { next.matchTerms(ts[1:], k) })
+}
+
+func (idx *instanceIndex) matchList(ts TypeList, i int, k func(*instanceIndex)) {
+	if i == ts.Len() {
+		k(idx)
+		return
+	}
+	idx.matchTerm(ts.Get(i), false, func(next *instanceIndex) { next.matchList(ts, i+1, k) })
+}
+
+// Match the remaining labels of an indexed row with the labels of a row. Labels which are missing from either row
+// may only be matched by the other row's extension.
+func (idx *instanceIndex) matchLabels(labels TypeMap, open, indexOpen bool, remaining, matched int, k func(*instanceIndex)) {
+	if remaining == 0 {
+		if indexOpen || matched == labels.Len() {
+			k(idx)
+		}
+		return
+	}
+	idx.eachEdge(func(child *instanceIndex) {
+		next := func(node *instanceIndex, matched int) {
+			node.matchLabels(labels, open, indexOpen, remaining-1, matched, k)
+		}
+		ts, ok := labels.Get(child.label)
+		switch {
+		case ok && ts.Len() == child.arity:
+			child.matchList(ts, 0, func(node *instanceIndex) { next(node, matched+1) })
+		case ok && (open || indexOpen):
+			// Scoped labels may be split between a row and its extension:
+			child.skip(child.arity, func(node *instanceIndex) { next(node, matched+1) })
+		case !ok && open:
+			child.skip(child.arity, func(node *instanceIndex) { next(node, matched) })
+		}
+	})
+}
+
+// Skip n terms, calling k with each node reached after the terms.
+func (idx *instanceIndex) skip(n int, k func(*instanceIndex)) {
+	if n == 0 {
+		k(idx)
+		return
+	}
+	idx.eachEdge(func(child *instanceIndex) { child.skip(n-1+child.arity, k) })
+}
+
+// Types which may unify with types of a different shape match any indexed term.
+func isWildcardQuery(t Type, root bool) bool {
+	switch t := t.(type) {
+	case *Unit, *Const, Size, *Arrow, *Record, *Variant:
+		return false
+	case *App:
+		return t.Underlying != nil && !root
+	case *RowExtend, *RowEmpty:
+		_, _, ok := indexRow(t)
+		return !ok
+	}
+	return true
+}
@@ -0,0 +1,531 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package types
+
+import (
+	"sync"
+)
+
+// Interner hash-conses ground types (types which do not contain type-variables), so structurally equal ground types
+// share a single instance. Interned types must not be modified. An interner may be used concurrently.
+//
+// Sources of interned types are not retained; the first instance of each distinct ground type is returned for all
+// structurally equal types.
+type Interner struct {
+	mu      sync.Mutex
+	buckets map[uint64][]Type
+	count   int
+}
+
+// Create an empty interner.
+func NewInterner() *Interner { return &Interner{buckets: make(map[uint64][]Type)} }
+
+// Get the number of distinct ground types which have been interned.
+func (in *Interner) Len() int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.count
+}
+
+// Get the canonical instance of a ground type which is structurally equal to t.
+//
+// If t is not ground, ground types nested within t are replaced by their canonical instances. t will not be modified;
+// if any nested types are replaced, a copy of t is returned.
+func (in *Interner) Intern(t Type) Type {
+	t = RealType(t)
+	if IsGround(t) {
+		return in.intern(t)
+	}
+	return in.internChildren(t, false)
+}
+
+func (in *Interner) intern(t Type) Type {
+	h := TypeHash(t)
+	if existing := in.lookup(h, t); existing != nil {
+		return existing
+	}
+	// Types nested within a new canonical instance are also interned:
+	t = in.internChildren(t, true)
+	// Flags are updated before the canonical instance is shared, so generalization will not modify it:
+	updateGroundFlags(t)
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.buckets == nil {
+		in.buckets = make(map[uint64][]Type)
+	}
+	bucket := in.buckets[h]
+	for _, existing := range bucket {
+		if groundEqual(existing, t) {
+			return existing
+		}
+	}
+	in.buckets[h] = append(bucket, t)
+	in.count++
+	return t
+}
+
+func (in *Interner) lookup(h uint64, t Type) Type {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, existing := range in.buckets[h] {
+		if groundEqual(existing, t) {
+			return existing
+		}
+	}
+	return nil
+}
+
+// Replace types nested within t by their canonical instances. If t is ground, all nested types are ground.
+//
+// t may be shared (e.g. declared within a frozen type-environment), so t is copied before any nested types are replaced.
+func (in *Interner) internChildren(t Type, ground bool) Type {
+	intern := in.Intern
+	if ground {
+		intern = func(t Type) Type { return in.intern(RealType(t)) }
+	}
+	switch t := t.(type) {
+	case *App:
+		c, params, changed := intern(t.Const), t.Params, false
+		for i, param := range t.Params {
+			if interned := intern(param); interned != param {
+				if !changed {
+					params, changed = append([]Type(nil), t.Params...), true
+				}
+				params[i] = interned
+			}
+		}
+		underlying := t.Underlying
+		if underlying != nil {
+			underlying = intern(underlying)
+		}
+		if c != t.Const || changed || underlying != t.Underlying {
+			next := *t
+			next.Const, next.Params, next.Underlying = c, params, underlying
+			return &next
+		}
+	case *Arrow:
+		args, changed := internList(intern, t.Args)
+		ret, effects := intern(t.Return), t.Effects
+		if effects != nil {
+			effects = intern(effects)
+		}
+		if changed || ret != t.Return || effects != t.Effects {
+			next := *t
+			next.Args, next.Return, next.Effects = args, ret, effects
+			return &next
+		}
+	case *Record:
+		if row := intern(t.Row); row != t.Row {
+			next := *t
+			next.Row = row
+			return &next
+		}
+	case *Variant:
+		if row := intern(t.Row); row != t.Row {
+			next := *t
+			next.Row = row
+			return &next
+		}
+	case *RowExtend:
+		var mb TypeMapBuilder
+		changed := false
+		labelsOf(t).Range(func(label string, ts TypeList) bool {
+			lb, listChanged := ts.Builder(), false
+			ts.Range(func(i int, t Type) bool {
+				if interned := intern(t); interned != t {
+					lb.Set(i, interned)
+					listChanged = true
+				}
+				return true
+			})
+			if listChanged {
+				if !changed {
+					mb, changed = labelsOf(t).Builder(), true
+				}
+				mb.Set(label, lb.Build())
+			}
+			return true
+		})
+		row := t.Row
+		if row != nil {
+			row = intern(row)
+		}
+		if changed || row != t.Row {
+			next := *t
+			next.Row = row
+			if changed {
+				next.Labels = mb.Build()
+			}
+			return &next
+		}
+	case *SizeExpr:
+		if args, changed := internList(intern, t.Args); changed {
+			next := *t
+			next.Args = args
+			return &next
+		}
+	case *Measure:
+		var factors []MeasureFactor
+		for i, f := range t.Factors {
+			if unit := intern(f.Unit); unit != f.Unit {
+				if factors == nil {
+					factors = append([]MeasureFactor(nil), t.Factors...)
+				}
+				factors[i].Unit = unit
+			}
+		}
+		if factors != nil {
+			next := *t
+			next.Factors = factors
+			return &next
+		}
+	}
+	return t
+}
+
+// Intern each type within a list. The list will be copied if any types are replaced.
+func internList(intern func(Type) Type, ts []Type) ([]Type, bool) {
+	changed := false
+	for i, t := range ts {
+		if interned := intern(t); interned != t {
+			if !changed {
+				ts, changed = append([]Type(nil), ts...), true
+			}
+			ts[i] = interned
+		}
+	}
+	return ts, changed
+}
+
+// Update the flags of a ground type from its (interned) nested types.
+func updateGroundFlags(t Type) {
+	var flags *TypeFlags
+	refs := false
+	switch t := t.(type) {
+	case *App:
+		flags, refs = &t.Flags, IsRefType(t) || t.Const.HasRefs() || (t.Underlying != nil && t.Underlying.HasRefs())
+		for _, param := range t.Params {
+			refs = refs || param.HasRefs()
+		}
+	case *Arrow:
+		flags, refs = &t.Flags, t.Return.HasRefs() || (t.Effects != nil && t.Effects.HasRefs())
+		for _, arg := range t.Args {
+			refs = refs || arg.HasRefs()
+		}
+	case *Record:
+		flags, refs = &t.Flags, t.Row.HasRefs()
+	case *Variant:
+		flags, refs = &t.Flags, t.Row.HasRefs()
+	case *RowExtend:
+		flags, refs = &t.Flags, t.Row != nil && t.Row.HasRefs()
+		labelsOf(t).Range(func(label string, ts TypeList) bool {
+			ts.Range(func(i int, t Type) bool {
+				refs = refs || t.HasRefs()
+				return !refs
+			})
+			return !refs
+		})
+	}
+	if refs && *flags&ContainsRefs == 0 {
+		*flags |= ContainsRefs
+	}
+}
+
+// Check if t is a ground type, which does not contain type-variables, recursive types, existential types,
+// skolem constants, or type-class methods.
+func IsGround(t Type) bool {
+	switch t := RealType(t).(type) {
+	case *Unit, *Const, Size, *RowEmpty:
+		return true
+	case *App:
+		if !IsGround(t.Const) || (t.Underlying != nil && !IsGround(t.Underlying)) {
+			return false
+		}
+		for _, param := range t.Params {
+			if !IsGround(param) {
+				return false
+			}
+		}
+		return true
+	case *Arrow:
+		if !IsGround(t.Return) || (t.Effects != nil && !IsGround(t.Effects)) {
+			return false
+		}
+		for _, arg := range t.Args {
+			if !IsGround(arg) {
+				return false
+			}
+		}
+		return true
+	case *Record:
+		return IsGround(t.Row)
+	case *Variant:
+		return IsGround(t.Row)
+	case *RowExtend:
+		ground := IsGround(t.Row)
+		labelsOf(t).Range(func(label string, ts TypeList) bool {
+			ts.Range(func(i int, t Type) bool {
+				ground = ground && IsGround(t)
+				return ground
+			})
+			return ground
+		})
+		return ground
+	case *SizeExpr:
+		for _, arg := range t.Args {
+			if !IsGround(arg) {
+				return false
+			}
+		}
+		return true
+	case *Measure:
+		for _, f := range t.Factors {
+			if !IsGround(f.Unit) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Compute a structural hash for t. Hashes are stable across processes; type-variables are hashed by kind only,
+// so types which are equal up to renaming of type-variables have equal hashes.
+func TypeHash(t Type) uint64 {
+	h := typeHash(fnvOffset)
+	h.visit(t)
+	return uint64(h)
+}
+
+// 64-bit FNV-1a
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+type typeHash uint64
+
+func (h *typeHash) byte(b byte) { *h = (*h ^ typeHash(b)) * fnvPrime }
+
+func (h *typeHash) int(n int) {
+	for i := 0; i < 64; i += 8 {
+		h.byte(byte(uint64(n) >> uint(i)))
+	}
+}
+
+func (h *typeHash) string(s string) {
+	for i := 0; i < len(s); i++ {
+		h.byte(s[i])
+	}
+	h.byte(0)
+}
+
+func (h *typeHash) visit(t Type) {
+	switch t := RealType(t).(type) {
+	case nil:
+		h.byte(0)
+	case *Unit:
+		h.byte(1)
+	case *Const:
+		h.byte(2)
+		h.string(t.Name)
+	case Size:
+		h.byte(3)
+		h.int(int(t))
+	case *RowEmpty:
+		h.byte(4)
+	case *Var:
+		h.byte(5)
+	case *App:
+		h.byte(6)
+		h.int(len(t.Params))
+		h.visit(t.Const)
+		for _, param := range t.Params {
+			h.visit(param)
+		}
+		h.visit(t.Underlying)
+	case *Arrow:
+		h.byte(7)
+		h.int(len(t.Args))
+		for _, arg := range t.Args {
+			h.visit(arg)
+		}
+		h.visit(t.Return)
+		h.visit(t.Effects)
+		if t.Method != nil {
+			h.string(t.Method.Name)
+		}
+	case *Record:
+		h.byte(8)
+		h.visit(t.Row)
+	case *Variant:
+		h.byte(9)
+		h.visit(t.Row)
+	case *RowExtend:
+		h.byte(10)
+		labelsOf(t).Range(func(label string, ts TypeList) bool {
+			h.string(label)
+			h.int(ts.Len())
+			ts.Range(func(i int, t Type) bool {
+				h.visit(t)
+				return true
+			})
+			return true
+		})
+		h.visit(t.Row)
+	case *SizeExpr:
+		h.byte(11)
+		h.byte(byte(t.Op))
+		h.int(len(t.Args))
+		for _, arg := range t.Args {
+			h.visit(arg)
+		}
+	case *Measure:
+		h.byte(12)
+		h.int(len(t.Factors))
+		for _, f := range t.Factors {
+			h.visit(f.Unit)
+			h.int(f.Exponent)
+		}
+	case *RecursiveLink:
+		h.byte(13)
+		if t.Index < len(t.Recursive.Names) {
+			h.string(t.Recursive.Names[t.Index])
+		}
+	case *Existential:
+		h.byte(14)
+		h.int(len(t.Vars))
+		h.visit(t.Body)
+	case *Skolem:
+		h.byte(15)
+	case *Method:
+		h.byte(16)
+		h.string(t.Name)
+	}
+}
+
+// Check if ground types a and b are structurally equal. Reference-types are compared by identity.
+func groundEqual(a, b Type) bool {
+	a, b = RealType(a), RealType(b)
+	if a == b {
+		return true
+	}
+	switch a := a.(type) {
+	case *Const:
+		b, ok := b.(*Const)
+		return ok && a.Name == b.Name && a != RefType && a != ReadRefType && b != RefType && b != ReadRefType
+	case Size:
+		b, ok := b.(Size)
+		return ok && a == b
+	case *App:
+		b, ok := b.(*App)
+		if !ok || a.Flags != b.Flags || len(a.Params) != len(b.Params) || !groundEqual(a.Const, b.Const) {
+			return false
+		}
+		if (a.Underlying == nil) != (b.Underlying == nil) || (a.Underlying != nil && !groundEqual(a.Underlying, b.Underlying)) {
+			return false
+		}
+		for i := range a.Params {
+			if !groundEqual(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+		return true
+	case *Arrow:
+		b, ok := b.(*Arrow)
+		if !ok || a.Flags != b.Flags || a.Method != b.Method || len(a.Args) != len(b.Args) || !groundEqual(a.Return, b.Return) {
+			return false
+		}
+		if (a.Effects == nil) != (b.Effects == nil) || (a.Effects != nil && !groundEqual(a.Effects, b.Effects)) {
+			return false
+		}
+		for i := range a.Args {
+			if !groundEqual(a.Args[i], b.Args[i]) {
+				return false
+			}
+		}
+		return true
+	case *Record:
+		b, ok := b.(*Record)
+		return ok && a.Flags == b.Flags && groundEqual(a.Row, b.Row)
+	case *Variant:
+		b, ok := b.(*Variant)
+		return ok && a.Flags == b.Flags && groundEqual(a.Row, b.Row)
+	case *RowExtend:
+		b, ok := b.(*RowExtend)
+		if !ok || a.Flags != b.Flags || labelsOf(a).Len() != labelsOf(b).Len() || !groundEqual(a.Row, b.Row) {
+			return false
+		}
+		equal := true
+		labelsOf(a).Range(func(label string, ts TypeList) bool {
+			other, ok := labelsOf(b).Get(label)
+			if !ok || ts.Len() != other.Len() {
+				equal = false
+				return false
+			}
+			ts.Range(func(i int, t Type) bool {
+				equal = groundEqual(t, other.Get(i))
+				return equal
+			})
+			return equal
+		})
+		return equal
+	case *SizeExpr:
+		b, ok := b.(*SizeExpr)
+		if !ok || a.Flags != b.Flags || a.Op != b.Op || len(a.Args) != len(b.Args) {
+			return false
+		}
+		for i := range a.Args {
+			if !groundEqual(a.Args[i], b.Args[i]) {
+				return false
+			}
+		}
+		return true
+	case *Measure:
+		b, ok := b.(*Measure)
+		if !ok || a.Flags != b.Flags || len(a.Factors) != len(b.Factors) {
+			return false
+		}
+		for i := range a.Factors {
+			if a.Factors[i].Exponent != b.Factors[i].Exponent || !groundEqual(a.Factors[i].Unit, b.Factors[i].Unit) {
+				return false
+			}
+		}
+		return true
+	case *Unit:
+		_, ok := b.(*Unit)
+		return ok
+	case *RowEmpty:
+		_, ok := b.(*RowEmpty)
+		return ok
+	}
+	return false
+}
+
+// Labels of a row extension; the labels of RecordEmptyPointer are not initialized.
+func labelsOf(t *RowExtend) TypeMap {
+	if t.Labels.m == nil {
+		return EmptyTypeMap
+	}
+	return t.Labels
+}
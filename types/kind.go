@@ -0,0 +1,176 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package types
+
+import (
+	"strconv"
+	"strings"
+)
+
+var (
+	_ Kind = (*StarKind)(nil)
+	_ Kind = (*SizeKind)(nil)
+	_ Kind = (*RowKind)(nil)
+	_ Kind = (*MeasureKind)(nil)
+	_ Kind = (*EffectKind)(nil)
+	_ Kind = (*ArrowKind)(nil)
+	_ Kind = (*KindVar)(nil)
+)
+
+// Kind is the base for all kinds (the types of types).
+//
+// The following kinds are supported:
+//
+//   StarKind:     kind of value types: `*`
+//   SizeKind:     kind of size types: `size`
+//   RowKind:      kind of rows within records and variants: `row`
+//   MeasureKind:  kind of units of measure: `measure`
+//   EffectKind:   kind of effect rows within function types: `effect`
+//   ArrowKind:    kind of type constructors: `* -> *`, `(*, size) -> *`
+//   KindVar:      kind-variable
+type Kind interface {
+	KindName() string
+}
+
+// Kind of value types: `*`
+type StarKind struct{}
+
+// Kind of size types: `size`
+type SizeKind struct{}
+
+// Kind of rows within records and variants: `row`
+type RowKind struct{}
+
+// Kind of units of measure: `measure`
+type MeasureKind struct{}
+
+// Kind of effect rows within function types: `effect`
+type EffectKind struct{}
+
+// Kind of type constructors: `* -> *`
+type ArrowKind struct {
+	Params []Kind
+	Result Kind
+}
+
+// Kind-variable
+type KindVar struct {
+	Id   uint
+	Link Kind
+}
+
+var (
+	// Kind of value types: `*`
+	Star = &StarKind{}
+	// Kind of size types: `size`
+	SizeKindPointer = &SizeKind{}
+	// Kind of rows within records and variants: `row`
+	RowKindPointer = &RowKind{}
+	// Kind of units of measure: `measure`
+	MeasureKindPointer = &MeasureKind{}
+	// Kind of effect rows within function types: `effect`
+	EffectKindPointer = &EffectKind{}
+)
+
+// Create a kind for type constructors with the given parameter kinds, constructing value types.
+func NewConstructorKind(params ...Kind) *ArrowKind {
+	return &ArrowKind{Params: params, Result: Star}
+}
+
+// "Star"
+func (k *StarKind) KindName() string { return "Star" }
+
+// "Size"
+func (k *SizeKind) KindName() string { return "Size" }
+
+// "Row"
+func (k *RowKind) KindName() string { return "Row" }
+
+// "Measure"
+func (k *MeasureKind) KindName() string { return "Measure" }
+
+// "Effect"
+func (k *EffectKind) KindName() string { return "Effect" }
+
+// "Arrow"
+func (k *ArrowKind) KindName() string { return "Arrow" }
+
+// "Var"
+func (k *KindVar) KindName() string { return "Var" }
+
+// Find the real kind of a kind-variable, following links.
+func RealKind(k Kind) Kind {
+	for {
+		kv, ok := k.(*KindVar)
+		if !ok || kv.Link == nil {
+			return k
+		}
+		k = kv.Link
+	}
+}
+
+// Get the string representation of a kind.
+func KindString(k Kind) string {
+	var sb strings.Builder
+	kindString(&sb, false, k)
+	return sb.String()
+}
+
+func kindString(sb *strings.Builder, simple bool, k Kind) {
+	switch k := RealKind(k).(type) {
+	case *StarKind:
+		sb.WriteByte('*')
+	case *SizeKind:
+		sb.WriteString("size")
+	case *RowKind:
+		sb.WriteString("row")
+	case *MeasureKind:
+		sb.WriteString("measure")
+	case *EffectKind:
+		sb.WriteString("effect")
+	case *KindVar:
+		sb.WriteString("'k")
+		sb.WriteString(strconv.Itoa(int(k.Id)))
+	case *ArrowKind:
+		if simple {
+			sb.WriteByte('(')
+		}
+		if len(k.Params) == 1 {
+			kindString(sb, true, k.Params[0])
+		} else {
+			sb.WriteByte('(')
+			for i, param := range k.Params {
+				if i > 0 {
+					sb.WriteString(", ")
+				}
+				kindString(sb, false, param)
+			}
+			sb.WriteByte(')')
+		}
+		sb.WriteString(" -> ")
+		kindString(sb, false, k.Result)
+		if simple {
+			sb.WriteByte(')')
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package types
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+var _ Type = (*Measure)(nil)
+
+// Unit of measure: `float[m/s]`, `float[kg*m/s^2]`
+//
+// A unit of measure is a product of base units and unit type-variables, each raised to an integer exponent.
+// Units of measure form an abelian group, and are unified modulo the group's equations: `m/s * s = m`.
+type Measure struct {
+	Factors []MeasureFactor
+	// Source which this type was instantiated from, or nil
+	Source *Measure
+	Flags  TypeFlags
+}
+
+// MeasureFactor is a base unit or unit type-variable raised to an integer exponent.
+type MeasureFactor struct {
+	// Base unit (type constant) or unit type-variable
+	Unit     Type
+	Exponent int
+}
+
+// Create a unit of measure from the given factors.
+func NewMeasure(factors ...MeasureFactor) *Measure {
+	m := &Measure{Factors: factors}
+	for _, f := range factors {
+		if f.Unit.IsGeneric() {
+			m.Flags |= ContainsGenericVars
+		}
+	}
+	return m
+}
+
+// "Measure"
+func (t *Measure) TypeName() string { return "Measure" }
+
+// Check if t contains generic types.
+func (t *Measure) IsGeneric() bool { return t.Flags&ContainsGenericVars != 0 }
+
+// Measure never contains mutable reference-types.
+func (t *Measure) HasRefs() bool { return false }
+
+// Check if t is dimensionless (after normalization).
+func (t *Measure) IsDimensionless() bool { return len(t.Normalize().Factors) == 0 }
+
+// Multiply t by other.
+func (t *Measure) Mul(other *Measure) *Measure {
+	factors := make([]MeasureFactor, 0, len(t.Factors)+len(other.Factors))
+	return NewMeasure(append(append(factors, t.Factors...), other.Factors...)...)
+}
+
+// Raise t to an integer power. Negative powers invert t.
+func (t *Measure) Pow(n int) *Measure {
+	factors := make([]MeasureFactor, len(t.Factors))
+	for i, f := range t.Factors {
+		factors[i] = MeasureFactor{f.Unit, f.Exponent * n}
+	}
+	return NewMeasure(factors...)
+}
+
+// Normalize t, expanding linked unit type-variables and combining the exponents of equal units. Units with a zero
+// exponent are removed. Base units are ordered by name, followed by unit type-variables ordered by id.
+func (t *Measure) Normalize() *Measure {
+	var factors []MeasureFactor
+	addMeasureFactors(&factors, t, 1)
+	sort.SliceStable(factors, func(i, j int) bool {
+		ci, iconst := factors[i].Unit.(*Const)
+		cj, jconst := factors[j].Unit.(*Const)
+		switch {
+		case iconst && jconst:
+			return ci.Name < cj.Name
+		case iconst != jconst:
+			return iconst
+		}
+		return factors[i].Unit.(*Var).Id() < factors[j].Unit.(*Var).Id()
+	})
+	return NewMeasure(factors...)
+}
+
+func addMeasureFactors(factors *[]MeasureFactor, t *Measure, n int) {
+	for _, f := range t.Factors {
+		unit := RealType(f.Unit)
+		if m, ok := unit.(*Measure); ok {
+			addMeasureFactors(factors, m, f.Exponent*n)
+			continue
+		}
+		exponent := f.Exponent * n
+		found := false
+		for i, existing := range *factors {
+			if sameMeasureUnit(existing.Unit, unit) {
+				(*factors)[i].Exponent += exponent
+				if (*factors)[i].Exponent == 0 {
+					*factors = append((*factors)[:i], (*factors)[i+1:]...)
+				}
+				found = true
+				break
+			}
+		}
+		if !found && exponent != 0 {
+			*factors = append(*factors, MeasureFactor{unit, exponent})
+		}
+	}
+}
+
+func sameMeasureUnit(a, b Type) bool {
+	if a == b {
+		return true
+	}
+	ca, ok := a.(*Const)
+	if !ok {
+		return false
+	}
+	cb, ok := b.(*Const)
+	return ok && ca.Name == cb.Name
+}
+
+// Parse a unit of measure, such as `kg*m/s^2`. Names of base units and unit type-variables are resolved with lookup;
+// lookup may return a base unit (type constant), a unit type-variable, or another unit of measure.
+//
+// Products (`*`), quotients (`/`), integer exponents (`^`), parentheses, and the dimensionless unit `1` are supported.
+func ParseMeasure(s string, lookup func(name string) Type) (*Measure, error) {
+	p := measureParser{s: s, lookup: lookup}
+	m, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, errors.New("Unexpected character in unit of measure at offset " + strconv.Itoa(p.pos))
+	}
+	return m, nil
+}
+
+type measureParser struct {
+	s      string
+	pos    int
+	lookup func(name string) Type
+}
+
+func (p *measureParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *measureParser) accept(c byte) bool {
+	if p.skipSpace(); p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *measureParser) product() (*Measure, error) {
+	m, err := p.power()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept('*'):
+			rhs, err := p.power()
+			if err != nil {
+				return nil, err
+			}
+			m = m.Mul(rhs)
+		case p.accept('/'):
+			rhs, err := p.power()
+			if err != nil {
+				return nil, err
+			}
+			m = m.Mul(rhs.Pow(-1))
+		default:
+			return m, nil
+		}
+	}
+}
+
+func (p *measureParser) power() (*Measure, error) {
+	m, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept('^') {
+		return m, nil
+	}
+	start := p.pos
+	if p.pos < len(p.s) && p.s[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(p.s[start:p.pos])
+	if err != nil {
+		return nil, errors.New("Invalid exponent in unit of measure at offset " + strconv.Itoa(start))
+	}
+	return m.Pow(n), nil
+}
+
+func (p *measureParser) atom() (*Measure, error) {
+	if p.accept('(') {
+		m, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(')') {
+			return nil, errors.New("Expected closing parenthesis in unit of measure at offset " + strconv.Itoa(p.pos))
+		}
+		return m, nil
+	}
+	if p.accept('1') {
+		return NewMeasure(), nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) && isMeasureIdentChar(p.s[p.pos]) {
+		p.pos++
+	}
+	name := p.s[start:p.pos]
+	if name == "" {
+		return nil, errors.New("Expected unit at offset " + strconv.Itoa(p.pos))
+	}
+	switch t := p.lookup(name).(type) {
+	case *Measure:
+		return t, nil
+	case *Const, *Var:
+		return NewMeasure(MeasureFactor{t, 1}), nil
+	}
+	return nil, errors.New("Unknown unit " + name)
+}
+
+func isMeasureIdentChar(c byte) bool {
+	return c == '\'' || c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
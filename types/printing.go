@@ -32,8 +32,11 @@ import (
 var printerPool = sync.Pool{
 	New: func() interface{} {
 		p := &typePrinter{
-			idNames: make(map[uint]string, 16),
-			preds:   make(map[uint][]string, 16),
+			idNames:  make(map[uint]string, 16),
+			preds:    make(map[uint][]string, 16),
+			recNames: make(map[*Recursive]string),
+			recScope: make(map[*Recursive]bool),
+			effects:  make(map[uint]*Arrow),
 		}
 		p.order = p._order[:0]
 		return p
@@ -49,7 +52,19 @@ func (p *typePrinter) Release() {
 	for k := range p.preds {
 		delete(p.preds, k)
 	}
-	p.order = p._order[:0]
+	for k := range p.recNames {
+		delete(p.recNames, k)
+	}
+	for k := range p.recScope {
+		delete(p.recScope, k)
+	}
+	for k := range p.effects {
+		delete(p.effects, k)
+	}
+	for i := range p.bounds {
+		p.bounds[i] = nil
+	}
+	p.order, p.bounds = p._order[:0], p.bounds[:0]
 	p.sb.Reset()
 	printerPool.Put(p)
 }
@@ -57,9 +72,17 @@ func (p *typePrinter) Release() {
 // TypeString returns a string representation of a Type.
 func TypeString(t Type) string {
 	p := newTypePrinter()
+	p.countEffects(t)
 	typeString(p, false, t)
-	if len(p.preds) == 0 {
-		s := p.sb.String()
+	s := p.sb.String()
+	// size bounds are printed after predicates, and may name additional type-variables:
+	var bounds []string
+	for i := 0; i < len(p.bounds); i++ {
+		p.sb.Reset()
+		sizeBoundString(p, p.bounds[i])
+		bounds = append(bounds, p.sb.String())
+	}
+	if len(p.preds) == 0 && len(bounds) == 0 {
 		p.Release()
 		return s
 	}
@@ -70,7 +93,7 @@ func TypeString(t Type) string {
 	}
 	sort.Slice(order, func(i, j int) bool { return p.idNames[order[i]] < p.idNames[order[j]] })
 	var sb strings.Builder
-	multiplePreds := len(order) > 1 || len(p.preds[order[0]]) > 1
+	multiplePreds := len(order)+len(bounds) > 1 || (len(order) == 1 && len(p.preds[order[0]]) > 1)
 	if multiplePreds {
 		sb.WriteByte('(')
 	}
@@ -88,22 +111,32 @@ func TypeString(t Type) string {
 			sb.WriteString(idName)
 		}
 	}
+	for i, bound := range bounds {
+		if i > 0 || len(order) > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(bound)
+	}
 	if multiplePreds {
 		sb.WriteByte(')')
 	}
 
 	sb.WriteString(" => ")
-	sb.WriteString(p.sb.String())
+	sb.WriteString(s)
 	p.Release()
 	return sb.String()
 }
 
 type typePrinter struct {
-	idNames map[uint]string
-	preds   map[uint][]string
-	order   []uint
-	_order  [16]uint
-	sb      strings.Builder
+	idNames  map[uint]string
+	preds    map[uint][]string
+	recNames map[*Recursive]string // names for equi-recursive types
+	recScope map[*Recursive]bool   // equi-recursive types bound within the current `(... as 'a)` form
+	effects  map[uint]*Arrow       // functions with each effect row type-variable, or nil if it is shared
+	bounds   []*SizeBound          // size bounds for printed type-variables
+	order    []uint
+	_order   [16]uint
+	sb       strings.Builder
 }
 
 var _names [128]string
@@ -139,7 +172,67 @@ func getUnboundVarName(i uint) string {
 }
 
 func (p *typePrinter) nextName() string {
-	return getVarName(uint(len(p.idNames)))
+	return getVarName(uint(len(p.idNames) + len(p.recNames)))
+}
+
+// Find effect row type-variables which are shared between functions within t.
+func (p *typePrinter) countEffects(t Type) {
+	switch t := RealType(t).(type) {
+	case *App:
+		for _, param := range t.Params {
+			p.countEffects(param)
+		}
+	case *Arrow:
+		for _, arg := range t.Args {
+			p.countEffects(arg)
+		}
+		p.countEffects(t.Return)
+		if t.Effects == nil {
+			return
+		}
+		if _, rest := EffectLabels(t.Effects); rest != nil {
+			if tv, ok := RealType(rest).(*Var); ok {
+				if arrow, ok := p.effects[tv.Id()]; ok && arrow != t {
+					t = nil
+				}
+				p.effects[tv.Id()] = t
+			}
+		}
+	case *Record:
+		p.countEffects(t.Row)
+	case *Variant:
+		p.countEffects(t.Row)
+	case *RowExtend:
+		labelsOf(t).Range(func(label string, ts TypeList) bool {
+			ts.Range(func(i int, t Type) bool {
+				p.countEffects(t)
+				return true
+			})
+			return true
+		})
+		p.countEffects(t.Row)
+	case *RecursiveLink:
+		// only equi-recursive types are printed with their underlying types:
+		if t.Recursive.IsEquiRecursive() && !p.recScope[t.Recursive] {
+			p.recScope[t.Recursive] = true
+			p.countEffects(t.Link().(*App).Underlying)
+			delete(p.recScope, t.Recursive)
+		}
+	case *Existential:
+		p.countEffects(t.Body)
+	}
+}
+
+func (p *typePrinter) addBounds(bounds []*SizeBound) {
+nextBound:
+	for _, bound := range bounds {
+		for _, existing := range p.bounds {
+			if existing == bound {
+				continue nextBound
+			}
+		}
+		p.bounds = append(p.bounds, bound)
+	}
 }
 
 func typeString(p *typePrinter, simple bool, t Type) {
@@ -153,6 +246,27 @@ func typeString(p *typePrinter, simple bool, t Type) {
 	case Size:
 		p.sb.WriteString(strconv.Itoa(int(t)))
 
+	case *SizeExpr:
+		if size, ok := EvalSize(t); ok {
+			p.sb.WriteString(strconv.Itoa(int(size)))
+			return
+		}
+		// size expressions are printed in normal form, when possible:
+		if l, err := Linearize(t); err == nil {
+			if normal, ok := l.Type(); ok {
+				if normal, ok := normal.(*SizeExpr); ok {
+					t = normal
+				} else {
+					typeString(p, simple, normal)
+					return
+				}
+			}
+		}
+		sizeExprString(p, simple, t)
+
+	case *Measure:
+		measureString(p, t.Normalize())
+
 	case *Var:
 		switch {
 		case t.IsUnboundVar():
@@ -168,6 +282,7 @@ func typeString(p *typePrinter, simple bool, t Type) {
 
 		case t.IsLinkVar():
 			typeString(p, simple, t.Link())
+			return
 
 		case t.IsGenericVar():
 			if len(p.idNames) == 0 {
@@ -180,9 +295,10 @@ func typeString(p *typePrinter, simple bool, t Type) {
 			p.idNames[t.Id()] = name
 			p.sb.WriteString(name)
 		}
-		if len(t.constraints) == 0 && !t.IsWeakVar() && !t.IsRestrictedVar() {
+		if len(t.constraints) == 0 && len(t.bounds) == 0 && !t.IsWeakVar() && !t.IsRestrictedVar() {
 			return
 		}
+		p.addBounds(t.bounds)
 		if p.preds != nil && len(p.preds[t.Id()]) > 0 {
 			return
 		} else if p.preds == nil {
@@ -197,6 +313,8 @@ func typeString(p *typePrinter, simple bool, t Type) {
 			preds = append(preds, "size")
 		case t.IsConstVar():
 			preds = append(preds, "const")
+		case t.IsMeasureVar():
+			preds = append(preds, "measure")
 		}
 		for _, c := range t.constraints {
 			preds = append(preds, c.TypeClass.Name)
@@ -204,7 +322,28 @@ func typeString(p *typePrinter, simple bool, t Type) {
 		p.preds[t.Id()] = preds
 
 	case *RecursiveLink:
-		typeString(p, false, t.Link())
+		if !t.Recursive.IsEquiRecursive() {
+			typeString(p, false, t.Link())
+			return
+		}
+		// equi-recursive types are printed as `(... as 'a)`:
+		name, ok := p.recNames[t.Recursive]
+		if ok && p.recScope[t.Recursive] {
+			p.sb.WriteString(name)
+			return
+		}
+		// names are only bound within the `(... as 'a)` form, so later occurrences are printed in the same form:
+		if !ok {
+			name = p.nextName()
+			p.recNames[t.Recursive] = name
+		}
+		p.recScope[t.Recursive] = true
+		p.sb.WriteByte('(')
+		typeString(p, false, t.Link().(*App).Underlying)
+		p.sb.WriteString(" as ")
+		p.sb.WriteString(name)
+		p.sb.WriteByte(')')
+		delete(p.recScope, t.Recursive)
 
 	case *App:
 		typeString(p, true, t.Const)
@@ -224,10 +363,15 @@ func typeString(p *typePrinter, simple bool, t Type) {
 		if simple {
 			p.sb.WriteByte('(')
 		}
+		// effect rows are only printed if they contain effects:
+		var effects []string
+		var rest Type
+		if t.Effects != nil {
+			effects, rest = EffectLabels(t.Effects)
+		}
 		if len(t.Args) == 1 {
 			typeString(p, true, t.Args[0])
 			p.sb.WriteString(" -> ")
-			typeString(p, false, t.Return)
 		} else {
 			p.sb.WriteByte('(')
 			for i, arg := range t.Args {
@@ -237,12 +381,50 @@ func typeString(p *typePrinter, simple bool, t Type) {
 				typeString(p, false, arg)
 			}
 			p.sb.WriteString(") -> ")
-			typeString(p, false, t.Return)
 		}
+		// effect rows without effects are printed if they are shared with other functions:
+		shared := false
+		if tv, ok := RealType(rest).(*Var); ok && len(effects) == 0 {
+			arrow, ok := p.effects[tv.Id()]
+			shared = ok && arrow == nil
+		}
+		typeString(p, len(effects) != 0 || shared, t.Return)
+		if shared {
+			p.sb.WriteString(" ! <| ")
+			typeString(p, false, rest)
+			p.sb.WriteByte('>')
+		} else if len(effects) != 0 {
+			p.sb.WriteString(" ! <")
+			p.sb.WriteString(strings.Join(effects, ", "))
+			if _, ok := RealType(rest).(*Var); ok {
+				p.sb.WriteString(" | ")
+				typeString(p, false, rest)
+			}
+			p.sb.WriteByte('>')
+		}
+		if simple {
+			p.sb.WriteByte(')')
+		}
+
+	case *Existential:
+		if simple {
+			p.sb.WriteByte('(')
+		}
+		p.sb.WriteString("exists")
+		for _, tv := range t.Vars {
+			p.sb.WriteByte(' ')
+			typeString(p, false, tv)
+		}
+		p.sb.WriteString(". ")
+		typeString(p, false, t.Body)
 		if simple {
 			p.sb.WriteByte(')')
 		}
 
+	case *Skolem:
+		p.sb.WriteByte('#')
+		p.sb.WriteString(strconv.Itoa(int(t.Id)))
+
 	case *Method:
 		arrow := t.TypeClass.Methods[t.Name]
 		typeString(p, false, arrow)
@@ -294,3 +476,78 @@ func typeString(p *typePrinter, simple bool, t Type) {
 		}
 	}
 }
+
+func sizeExprString(p *typePrinter, simple bool, t *SizeExpr) {
+	switch t.Op {
+	case SizeAdd:
+		if simple {
+			p.sb.WriteByte('(')
+		}
+		for i, arg := range t.Args {
+			if i > 0 {
+				p.sb.WriteString(" + ")
+			}
+			typeString(p, false, arg)
+		}
+		if simple {
+			p.sb.WriteByte(')')
+		}
+	case SizeMul:
+		typeString(p, true, t.Args[0])
+		p.sb.WriteString(" * ")
+		typeString(p, true, t.Args[1])
+	case SizeMax:
+		p.sb.WriteString("max(")
+		for i, arg := range t.Args {
+			if i > 0 {
+				p.sb.WriteString(", ")
+			}
+			typeString(p, false, arg)
+		}
+		p.sb.WriteByte(')')
+	}
+}
+
+// Units of measure are printed as a quotient of products: `kg*m/s^2`, `1/s`, `kg/(m*s)`
+func measureString(p *typePrinter, t *Measure) {
+	if len(t.Factors) == 1 && t.Factors[0].Exponent == 1 {
+		typeString(p, true, t.Factors[0].Unit)
+		return
+	}
+	var numerator, denominator []MeasureFactor
+	for _, f := range t.Factors {
+		if f.Exponent > 0 {
+			numerator = append(numerator, f)
+		} else {
+			denominator = append(denominator, MeasureFactor{f.Unit, -f.Exponent})
+		}
+	}
+	if len(numerator) == 0 {
+		p.sb.WriteByte('1')
+	}
+	measureFactorsString(p, numerator)
+	if len(denominator) == 0 {
+		return
+	}
+	p.sb.WriteByte('/')
+	if len(denominator) > 1 {
+		p.sb.WriteByte('(')
+	}
+	measureFactorsString(p, denominator)
+	if len(denominator) > 1 {
+		p.sb.WriteByte(')')
+	}
+}
+
+func measureFactorsString(p *typePrinter, factors []MeasureFactor) {
+	for i, f := range factors {
+		if i > 0 {
+			p.sb.WriteByte('*')
+		}
+		typeString(p, true, f.Unit)
+		if f.Exponent != 1 {
+			p.sb.WriteByte('^')
+			p.sb.WriteString(strconv.Itoa(f.Exponent))
+		}
+	}
+}
@@ -58,6 +58,9 @@ type Recursive struct {
 	// parameters require instantiation.
 	Bind  func(instance *Recursive)
 	Flags TypeFlags
+	// Canonical is a structurally equivalent recursive type-group which this type-group is interned as, or nil.
+	// Canonical should only be set for root type-groups (which are not instantiated from another type-group).
+	Canonical *Recursive
 }
 
 // Add a type to the recursive type-group. The index of the type will be returned.
@@ -65,12 +68,18 @@ type Recursive struct {
 // Each type in the recursive type-group must be assigned a unique name, which may be used for looking
 // up the type's index within the group. The name is not printed or included with the type.
 func (r *Recursive) AddType(name string, aliased *App) int {
-	r.Types, r.Names = append(r.Types, aliased), append(r.Names, name)
+	index := len(r.Types)
+	r.Types = append(r.Types, aliased)
+	// Instances of a type-group share names and indexes with their source, which must not be modified:
+	if index < len(r.Names) && r.Names[index] == name {
+		return index
+	}
+	r.Names = append(r.Names, name)
 	if r.Indexes == nil {
 		r.Indexes = make(map[string]int)
 	}
-	r.Indexes[name] = len(r.Types) - 1
-	return len(r.Types) - 1
+	r.Indexes[name] = index
+	return index
 }
 
 // Lookup a type within the recursive type-group by its unique name.
@@ -86,25 +95,30 @@ func (r *Recursive) GetType(name string) *App {
 
 // Check if r is declared as an instance of source.
 func (r *Recursive) IsInstanceOf(source *Recursive) bool {
-	if r == source {
-		return true
-	}
-	for source := r.Source; source != nil; source = source.Source {
-		if r == source {
+	for s := r; s != nil; s = s.Source {
+		if s == source {
 			return true
 		}
 	}
 	return false
 }
 
-// Check if r and other are instantiated from the same root.
-func (r *Recursive) Matches(other *Recursive) bool {
-	var rootA, rootB *Recursive
-	for rootA = r; rootA != nil; rootA = rootA.Source {
+// Get the root type-group which r is instantiated from.
+func (r *Recursive) Root() *Recursive {
+	root := r
+	for root.Source != nil {
+		root = root.Source
 	}
-	for rootB = other; rootB != nil; rootB = rootB.Source {
+	return root
+}
+
+// Check if r and other are instantiated from the same root, or from roots which are interned as the same canonical type-group.
+func (r *Recursive) Matches(other *Recursive) bool {
+	rootA, rootB := r.Root(), other.Root()
+	if rootA == rootB {
+		return true
 	}
-	return rootA == rootB
+	return rootA.Canonical != nil && rootA.Canonical == rootB.Canonical
 }
 
 // Check if any type parameters for r contain generic types.
@@ -113,6 +127,9 @@ func (r *Recursive) IsGeneric() bool { return r.Flags&ContainsGenericVars != 0 }
 // Check if any type parameters for r contain mutable reference-types.
 func (r *Recursive) HasRefs() bool { return r.Flags&ContainsRefs != 0 }
 
+// Check if r is an (inferred) equi-recursive type, which is equivalent to its unrolled type.
+func (r *Recursive) IsEquiRecursive() bool { return r.Flags&EquiRecursive != 0 }
+
 // Check if r needs to be generalized.
 func (r *Recursive) NeedsGeneralization() bool { return r.Flags&NeedsGeneralization != 0 }
 
@@ -0,0 +1,359 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package types
+
+import (
+	"hash"
+	"hash/fnv"
+	"strconv"
+)
+
+// Check if two recursive type-groups are structurally equivalent, up to renaming of type-variables (alpha-equivalence).
+// Type-parameters are matched by position, and type names within the type-groups are ignored.
+func RecursiveEquivalent(a, b *Recursive) bool {
+	q := recEquiv{vars: make(map[uint]uint), rvars: make(map[uint]uint)}
+	return q.recursive(a, b)
+}
+
+type recEquiv struct {
+	vars, rvars map[uint]uint // bijection between type-variable ids
+	assumed     [][2]*Recursive
+}
+
+func (q *recEquiv) recursive(a, b *Recursive) bool {
+	if a == b {
+		return true
+	}
+	for _, pair := range q.assumed {
+		if pair[0] == a && pair[1] == b {
+			return true
+		}
+	}
+	if len(a.Types) != len(b.Types) || len(a.Params) != len(b.Params) || a.Flags&EquiRecursive != b.Flags&EquiRecursive {
+		return false
+	}
+	q.assumed = append(q.assumed, [2]*Recursive{a, b})
+	for i, param := range a.Params {
+		if !q.equal(param, b.Params[i]) {
+			return false
+		}
+	}
+	for i, alias := range a.Types {
+		if !q.equal(alias, b.Types[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *recEquiv) equal(a, b Type) bool {
+	a, b = RealType(a), RealType(b)
+	switch a := a.(type) {
+	case *Unit:
+		_, ok := b.(*Unit)
+		return ok
+	case *RowEmpty:
+		_, ok := b.(*RowEmpty)
+		return ok
+	case Size:
+		b, ok := b.(Size)
+		return ok && a == b
+	case *Const:
+		b, ok := b.(*Const)
+		return ok && a.Name == b.Name
+	case *Measure:
+		b, ok := b.(*Measure)
+		if !ok {
+			return false
+		}
+		na, nb := a.Normalize(), b.Normalize()
+		if len(na.Factors) != len(nb.Factors) {
+			return false
+		}
+		for i, f := range na.Factors {
+			if f.Exponent != nb.Factors[i].Exponent || !q.equal(f.Unit, nb.Factors[i].Unit) {
+				return false
+			}
+		}
+		return true
+	case *SizeExpr:
+		b, ok := b.(*SizeExpr)
+		if !ok || a.Op != b.Op || len(a.Args) != len(b.Args) {
+			return false
+		}
+		for i, arg := range a.Args {
+			if !q.equal(arg, b.Args[i]) {
+				return false
+			}
+		}
+		return true
+	case *Skolem:
+		return a == b
+	case *Existential:
+		b, ok := b.(*Existential)
+		if !ok || len(a.Vars) != len(b.Vars) {
+			return false
+		}
+		for i, tv := range a.Vars {
+			if !q.equal(tv, b.Vars[i]) {
+				return false
+			}
+		}
+		return q.equal(a.Body, b.Body)
+	case *Var:
+		b, ok := b.(*Var)
+		if !ok || a.RestrictedLevel() != b.RestrictedLevel() || len(a.constraints) != len(b.constraints) {
+			return false
+		}
+		for i, c := range a.constraints {
+			if c.TypeClass != b.constraints[i].TypeClass {
+				return false
+			}
+		}
+		idA, idB := a.Id(), b.Id()
+		mappedB, okA := q.vars[idA]
+		mappedA, okB := q.rvars[idB]
+		switch {
+		case !okA && !okB:
+			q.vars[idA], q.rvars[idB] = idB, idA
+			return true
+		case okA && okB:
+			return mappedB == idB && mappedA == idA
+		default:
+			return false
+		}
+	case *App:
+		b, ok := b.(*App)
+		if !ok || len(a.Params) != len(b.Params) || (a.Underlying == nil) != (b.Underlying == nil) || !q.equal(a.Const, b.Const) {
+			return false
+		}
+		for i, param := range a.Params {
+			if !q.equal(param, b.Params[i]) {
+				return false
+			}
+		}
+		return a.Underlying == nil || q.equal(a.Underlying, b.Underlying)
+	case *Arrow:
+		b, ok := b.(*Arrow)
+		if !ok || len(a.Args) != len(b.Args) {
+			return false
+		}
+		for i, arg := range a.Args {
+			if !q.equal(arg, b.Args[i]) {
+				return false
+			}
+		}
+		if (a.Effects == nil) != (b.Effects == nil) || (a.Effects != nil && !q.equal(a.Effects, b.Effects)) {
+			return false
+		}
+		return q.equal(a.Return, b.Return)
+	case *Method:
+		b, ok := b.(*Method)
+		return ok && a.TypeClass == b.TypeClass && a.Name == b.Name
+	case *Record:
+		b, ok := b.(*Record)
+		return ok && q.equal(a.Row, b.Row)
+	case *Variant:
+		b, ok := b.(*Variant)
+		return ok && q.equal(a.Row, b.Row)
+	case *RowExtend:
+		b, ok := b.(*RowExtend)
+		if !ok || a.Labels.Len() != b.Labels.Len() {
+			return false
+		}
+		equal := true
+		a.Labels.Range(func(label string, ts TypeList) bool {
+			other, ok := b.Labels.Get(label)
+			if !ok || ts.Len() != other.Len() {
+				equal = false
+				return false
+			}
+			ts.Range(func(i int, t Type) bool {
+				equal = q.equal(t, other.Get(i))
+				return equal
+			})
+			return equal
+		})
+		return equal && q.equal(a.Row, b.Row)
+	case *RecursiveLink:
+		b, ok := b.(*RecursiveLink)
+		return ok && a.Index == b.Index && q.recursive(a.Recursive, b.Recursive)
+	}
+	return false
+}
+
+// Compute a structural hash for a recursive type-group. Structurally equivalent type-groups (see RecursiveEquivalent)
+// will have equal hashes.
+func HashRecursive(r *Recursive) uint64 {
+	h := recHasher{h: fnv.New64a(), vars: make(map[uint]int)}
+	h.h.Write([]byte{byte(len(r.Params)), byte(len(r.Types))})
+	for _, param := range r.Params {
+		h.hash(param)
+	}
+	for _, alias := range r.Types {
+		h.hash(alias)
+	}
+	return h.h.Sum64()
+}
+
+type recHasher struct {
+	h    hash.Hash64
+	vars map[uint]int // type-variables numbered by first occurrence
+}
+
+func (h *recHasher) tag(tag byte)         { h.h.Write([]byte{tag}) }
+func (h *recHasher) writeString(s string) { h.h.Write([]byte(s)); h.tag(0) }
+func (h *recHasher) writeInt(i int)       { h.writeString(strconv.Itoa(i)) }
+
+func (h *recHasher) hash(t Type) {
+	switch t := RealType(t).(type) {
+	case *Unit:
+		h.tag('u')
+	case *RowEmpty:
+		h.tag('e')
+	case Size:
+		h.tag('s')
+		h.writeInt(int(t))
+	case *Const:
+		h.tag('c')
+		h.writeString(t.Name)
+	case *Measure:
+		h.tag('u')
+		for _, f := range t.Normalize().Factors {
+			h.hash(f.Unit)
+			h.writeInt(f.Exponent)
+		}
+	case *SizeExpr:
+		h.tag('z')
+		h.writeInt(int(t.Op))
+		h.writeInt(len(t.Args))
+		for _, arg := range t.Args {
+			h.hash(arg)
+		}
+	case *Skolem:
+		h.tag('k')
+		h.writeInt(int(t.Id))
+	case *Existential:
+		h.tag('x')
+		h.writeInt(len(t.Vars))
+		for _, tv := range t.Vars {
+			h.hash(tv)
+		}
+		h.hash(t.Body)
+	case *Var:
+		h.tag('v')
+		n, ok := h.vars[t.Id()]
+		if !ok {
+			n = len(h.vars)
+			h.vars[t.Id()] = n
+		}
+		h.writeInt(n)
+	case *App:
+		h.tag('a')
+		h.hash(t.Const)
+		h.writeInt(len(t.Params))
+		for _, param := range t.Params {
+			h.hash(param)
+		}
+		if t.Underlying != nil {
+			h.hash(t.Underlying)
+		}
+	case *Arrow:
+		h.tag('f')
+		h.writeInt(len(t.Args))
+		for _, arg := range t.Args {
+			h.hash(arg)
+		}
+		h.hash(t.Return)
+		if t.Effects != nil {
+			h.tag('!')
+			h.hash(t.Effects)
+		}
+	case *Method:
+		h.tag('m')
+		h.writeString(t.TypeClass.Name)
+		h.writeString(t.Name)
+	case *Record:
+		h.tag('r')
+		h.hash(t.Row)
+	case *Variant:
+		h.tag('t')
+		h.hash(t.Row)
+	case *RowExtend:
+		h.tag('x')
+		t.Labels.Range(func(label string, ts TypeList) bool {
+			h.writeString(label)
+			ts.Range(func(i int, t Type) bool {
+				h.hash(t)
+				return true
+			})
+			return true
+		})
+		h.hash(t.Row)
+	case *RecursiveLink:
+		// Links are not followed, to break cycles:
+		h.tag('l')
+		h.writeInt(t.Index)
+		h.writeInt(len(t.Recursive.Types))
+	}
+}
+
+// RecursiveRegistry interns structurally equivalent recursive type-groups as a single canonical type-group.
+//
+// A registry cannot be used concurrently.
+type RecursiveRegistry struct {
+	buckets map[uint64][]*Recursive
+}
+
+// Create a new registry for interning recursive type-groups.
+func NewRecursiveRegistry() *RecursiveRegistry {
+	return &RecursiveRegistry{buckets: make(map[uint64][]*Recursive)}
+}
+
+// Find a canonical type-group which is structurally equivalent to the root of r, without interning r.
+func (reg *RecursiveRegistry) Find(r *Recursive) *Recursive {
+	root := r.Root()
+	if root.Canonical != nil {
+		return root.Canonical
+	}
+	for _, canonical := range reg.buckets[HashRecursive(root)] {
+		if RecursiveEquivalent(canonical, root) {
+			return canonical
+		}
+	}
+	return nil
+}
+
+// Intern the root of a recursive type-group. The canonical type-group for the root will be returned, and assigned
+// to the root's Canonical field. Links to recursive type-groups with the same canonical type-group will unify.
+func (reg *RecursiveRegistry) Intern(r *Recursive) *Recursive {
+	root := r.Root()
+	if canonical := reg.Find(root); canonical != nil {
+		root.Canonical = canonical
+		return canonical
+	}
+	root.Canonical = root
+	hash := HashRecursive(root)
+	reg.buckets[hash] = append(reg.buckets[hash], root)
+	return root
+}
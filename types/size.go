@@ -0,0 +1,360 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package types
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var _ Type = (*SizeExpr)(nil)
+
+// SizeOp is an arithmetic operation within a size expression.
+type SizeOp uint8
+
+// Operations for size expressions
+const (
+	// Sum of sizes: `n + m + 1`
+	SizeAdd SizeOp = iota
+	// Product of a size constant and a size: `2 * n`
+	SizeMul
+	// Maximum of sizes: `max(n, m)`
+	SizeMax
+)
+
+// Size expression: `array[int, n + m]`
+//
+// Size expressions may contain size constants, size type-variables, and nested size expressions. Equalities between
+// size expressions are solved as linear equations during unification.
+type SizeExpr struct {
+	Op SizeOp
+	// Operands of the expression. For SizeMul, the first operand must be a size constant.
+	Args []Type
+	// Source which this type was instantiated from, or nil
+	Source *SizeExpr
+	Flags  TypeFlags
+}
+
+// Create a size expression for the sum of the given sizes.
+func NewSizeAdd(args ...Type) *SizeExpr { return newSizeExpr(SizeAdd, args) }
+
+// Create a size expression for the product of a size constant and a size.
+func NewSizeMul(factor int, arg Type) *SizeExpr {
+	return newSizeExpr(SizeMul, []Type{Size(factor), arg})
+}
+
+// Create a size expression for the maximum of the given sizes.
+func NewSizeMax(args ...Type) *SizeExpr { return newSizeExpr(SizeMax, args) }
+
+func newSizeExpr(op SizeOp, args []Type) *SizeExpr {
+	e := &SizeExpr{Op: op, Args: args}
+	for _, arg := range args {
+		if arg.IsGeneric() {
+			e.Flags |= ContainsGenericVars
+		}
+	}
+	return e
+}
+
+// "SizeExpr"
+func (t *SizeExpr) TypeName() string { return "SizeExpr" }
+
+// Check if t contains generic types.
+func (t *SizeExpr) IsGeneric() bool { return t.Flags&ContainsGenericVars != 0 }
+
+// SizeExpr never contains mutable reference-types.
+func (t *SizeExpr) HasRefs() bool { return false }
+
+// Evaluate a size type. If t contains unbound size type-variables, false will be returned.
+func EvalSize(t Type) (Size, bool) {
+	switch t := RealType(t).(type) {
+	case Size:
+		return t, true
+	case *SizeExpr:
+		var result Size
+		for i, arg := range t.Args {
+			size, ok := EvalSize(arg)
+			if !ok {
+				return 0, false
+			}
+			switch {
+			case i == 0:
+				result = size
+			case t.Op == SizeAdd:
+				result += size
+			case t.Op == SizeMul:
+				result *= size
+			case t.Op == SizeMax && size > result:
+				result = size
+			}
+		}
+		return result, true
+	}
+	return 0, false
+}
+
+// LinearSize is the normal form of a size type, as a linear combination of unknown sizes with a constant offset.
+//
+// Unknown sizes are either unbound type-variables, or size expressions which cannot be represented linearly
+// (i.e. the maximum of unknown sizes).
+type LinearSize struct {
+	Terms    []LinearTerm
+	Constant int
+}
+
+// LinearTerm is an unknown size multiplied by a coefficient.
+type LinearTerm struct {
+	// Unbound type-variable or size expression
+	Unknown     Type
+	Coefficient int
+}
+
+// Normalize a size type as a linear combination of unknown sizes.
+func Linearize(t Type) (LinearSize, error) {
+	var l LinearSize
+	err := l.add(1, t)
+	return l, err
+}
+
+func (l *LinearSize) add(factor int, t Type) error {
+	t = RealType(t)
+	switch t := t.(type) {
+	case Size:
+		l.Constant += factor * int(t)
+		return nil
+	case *Var:
+		if t.IsRestrictedVar() && !t.IsSizeVar() {
+			return errors.New("Failed to unify size expression with restricted type-variable")
+		}
+		l.addTerm(factor, t)
+		return nil
+	case *SizeExpr:
+		switch t.Op {
+		case SizeAdd:
+			for _, arg := range t.Args {
+				if err := l.add(factor, arg); err != nil {
+					return err
+				}
+			}
+			return nil
+		case SizeMul:
+			k, ok := RealType(t.Args[0]).(Size)
+			if !ok || len(t.Args) != 2 {
+				return errors.New("Size expressions may only be multiplied by size constants")
+			}
+			return l.add(factor*int(k), t.Args[1])
+		case SizeMax:
+			if size, ok := EvalSize(t); ok {
+				l.Constant += factor * int(size)
+				return nil
+			}
+			l.addTerm(factor, t)
+			return nil
+		}
+	}
+	return errors.New("Failed to unify size with " + TypeName(t))
+}
+
+func (l *LinearSize) addTerm(factor int, unknown Type) {
+	for i, term := range l.Terms {
+		if term.Unknown == unknown {
+			l.Terms[i].Coefficient += factor
+			if l.Terms[i].Coefficient == 0 {
+				l.Terms = append(l.Terms[:i], l.Terms[i+1:]...)
+			}
+			return
+		}
+	}
+	if factor != 0 {
+		l.Terms = append(l.Terms, LinearTerm{unknown, factor})
+	}
+}
+
+// Subtract other from l.
+func (l LinearSize) Sub(other LinearSize) LinearSize {
+	result := LinearSize{Terms: append([]LinearTerm(nil), l.Terms...), Constant: l.Constant - other.Constant}
+	for _, term := range other.Terms {
+		result.addTerm(-term.Coefficient, term.Unknown)
+	}
+	return result
+}
+
+// Convert l to a size type. If l contains negative coefficients or a negative constant, false will be returned.
+func (l LinearSize) Type() (Type, bool) {
+	if l.Constant < 0 {
+		return nil, false
+	}
+	if len(l.Terms) == 0 {
+		return Size(l.Constant), true
+	}
+	if len(l.Terms) == 1 && l.Constant == 0 && l.Terms[0].Coefficient == 1 {
+		return l.Terms[0].Unknown, true
+	}
+	args := make([]Type, 0, len(l.Terms)+1)
+	for _, term := range l.Terms {
+		switch {
+		case term.Coefficient < 0:
+			return nil, false
+		case term.Coefficient == 1:
+			args = append(args, term.Unknown)
+		default:
+			args = append(args, NewSizeMul(term.Coefficient, term.Unknown))
+		}
+	}
+	if l.Constant > 0 {
+		args = append(args, Size(l.Constant))
+	}
+	if len(args) == 1 {
+		return args[0], true
+	}
+	return NewSizeAdd(args...), true
+}
+
+// Parse a size expression, such as `2 * n + max(m, 4)`. Names of size type-variables are resolved with lookup,
+// excluding the leading quote (if any).
+//
+// Sums, products with size constants, and the max function are supported. Products are parsed with a higher
+// precedence than sums, and parentheses may be used for grouping.
+func ParseSize(s string, lookup func(name string) Type) (Type, error) {
+	p := sizeParser{s: s, lookup: lookup}
+	t, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, errors.New("Unexpected character in size expression at offset " + strconv.Itoa(p.pos))
+	}
+	return t, nil
+}
+
+type sizeParser struct {
+	s      string
+	pos    int
+	lookup func(name string) Type
+}
+
+func (p *sizeParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *sizeParser) accept(c byte) bool {
+	if p.skipSpace(); p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sizeParser) sum() (Type, error) {
+	t, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	args := []Type{t}
+	for p.accept('+') {
+		if t, err = p.product(); err != nil {
+			return nil, err
+		}
+		args = append(args, t)
+	}
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	return NewSizeAdd(args...), nil
+}
+
+func (p *sizeParser) product() (Type, error) {
+	t, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept('*') {
+		rhs, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		k, ok := t.(Size)
+		if !ok {
+			if k, ok = rhs.(Size); !ok {
+				return nil, errors.New("Size expressions may only be multiplied by size constants")
+			}
+			rhs = t
+		}
+		t = NewSizeMul(int(k), rhs)
+	}
+	return t, nil
+}
+
+func (p *sizeParser) operand() (Type, error) {
+	if p.accept('(') {
+		t, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(')') {
+			return nil, errors.New("Expected closing parenthesis in size expression at offset " + strconv.Itoa(p.pos))
+		}
+		return t, nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) && isSizeIdentChar(p.s[p.pos]) {
+		p.pos++
+	}
+	token := p.s[start:p.pos]
+	switch {
+	case token == "":
+		return nil, errors.New("Expected size operand at offset " + strconv.Itoa(p.pos))
+	case token[0] >= '0' && token[0] <= '9':
+		n, err := strconv.Atoi(token)
+		if err != nil {
+			return nil, errors.New("Invalid size constant " + token)
+		}
+		return Size(n), nil
+	case token == "max" && p.accept('('):
+		var args []Type
+		for {
+			t, err := p.sum()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, t)
+			if p.accept(')') {
+				return NewSizeMax(args...), nil
+			}
+			if !p.accept(',') {
+				return nil, errors.New("Expected comma in size expression at offset " + strconv.Itoa(p.pos))
+			}
+		}
+	}
+	if t := p.lookup(strings.TrimPrefix(token, "'")); t != nil {
+		return t, nil
+	}
+	return nil, errors.New("Unknown size variable " + token)
+}
+
+func isSizeIdentChar(c byte) bool {
+	return c == '\'' || c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,143 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package types
+
+// SizeRelation is a relation between sizes within a size bound.
+type SizeRelation uint8
+
+// Relations for size bounds
+const (
+	// Strict inequality: `m < n`
+	SizeLess SizeRelation = iota
+	// Non-strict inequality: `n <= 64`
+	SizeLessOrEqual
+)
+
+// SizeBound is an inequality between sizes which constrains size type-variables: `n <= 64`, `m < n`
+//
+// A size bound is attached to each unknown size type-variable within the bound. Bounds are checked when
+// sizes become concrete during unification, and propagated to type-variables which bound sizes are linked to.
+type SizeBound struct {
+	Relation    SizeRelation
+	Left, Right Type
+}
+
+// Create a size bound between sizes, and attach the bound to each size type-variable within the sizes.
+func NewSizeBound(relation SizeRelation, left, right Type) *SizeBound {
+	bound := &SizeBound{Relation: relation, Left: left, Right: right}
+	for _, tv := range bound.Vars() {
+		tv.AddSizeBound(bound)
+	}
+	return bound
+}
+
+// Vars returns the unbound or generic type-variables within the size bound.
+func (b *SizeBound) Vars() []*Var {
+	var vars []*Var
+	visitSizeVars(b.Left, &vars)
+	visitSizeVars(b.Right, &vars)
+	return vars
+}
+
+// AttachedTo checks if the size bound is attached to a type-variable.
+func (b *SizeBound) AttachedTo(tv *Var) bool {
+	for _, bound := range tv.bounds {
+		if bound == b {
+			return true
+		}
+	}
+	return false
+}
+
+func visitSizeVars(t Type, vars *[]*Var) {
+	switch t := RealType(t).(type) {
+	case *Var:
+		*vars = append(*vars, t)
+	case *SizeExpr:
+		for _, arg := range t.Args {
+			visitSizeVars(arg, vars)
+		}
+	}
+}
+
+// Check if the size bound is satisfied. If the bound contains unknown sizes and may be satisfied, known will be false.
+func (b *SizeBound) Check() (satisfied, known bool, err error) {
+	left, err := Linearize(b.Left)
+	if err != nil {
+		return false, false, err
+	}
+	right, err := Linearize(b.Right)
+	if err != nil {
+		return false, false, err
+	}
+	// the bound is satisfied if left - right < 0 (or <= 0):
+	diff := left.Sub(right)
+	limit := 0
+	if b.Relation == SizeLess {
+		limit = -1
+	}
+	if len(diff.Terms) == 0 {
+		return diff.Constant <= limit, true, nil
+	}
+	// Unknown sizes are non-negative, so the constant is a lower limit for diff if all coefficients are non-negative,
+	// or an upper limit for diff if all coefficients are non-positive:
+	nonNegative, nonPositive := true, true
+	for _, term := range diff.Terms {
+		nonNegative, nonPositive = nonNegative && term.Coefficient > 0, nonPositive && term.Coefficient < 0
+	}
+	switch {
+	case nonNegative && diff.Constant > limit:
+		return false, true, nil
+	case nonPositive && diff.Constant <= limit:
+		return true, true, nil
+	}
+	return false, false, nil
+}
+
+// String representation of the size bound, such as `'a <= 64`.
+func (b *SizeBound) String() string {
+	p := newTypePrinter()
+	sizeBoundString(p, b)
+	s := p.sb.String()
+	p.Release()
+	return s
+}
+
+func sizeBoundString(p *typePrinter, b *SizeBound) {
+	typeString(p, false, b.Left)
+	if b.Relation == SizeLess {
+		p.sb.WriteString(" < ")
+	} else {
+		p.sb.WriteString(" <= ")
+	}
+	typeString(p, false, b.Right)
+}
+
+// SizeBoundError is returned when a size bound is not satisfied.
+type SizeBoundError struct {
+	Bound *SizeBound
+}
+
+func (e *SizeBoundError) Error() string {
+	return "Size bound is not satisfied: " + e.Bound.String()
+}
@@ -23,6 +23,10 @@
 package types
 
 import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/benbjohnson/immutable"
 	"github.com/wdamron/poly/internal/util"
 )
 
@@ -30,29 +34,71 @@ import (
 type MethodSet map[string]*Arrow
 
 // Parameterized type-class
+//
+// Super-classes, sub-classes, and instances of a type-class are stored within immutable snapshots; changes replace the current
+// snapshot, so type-classes may be shared across threads while instances and sub-classes are added.
 type TypeClass struct {
 	// Id should uniquely identify the type-class
 	Id uint
 	// Name should uniquely identify the type-class
-	Name      string
-	Param     Type
+	Name  string
+	Param Type
+	// ParamKind is the kind of the type-parameter, or nil if the kind is unknown
+	ParamKind Kind
 	Methods   MethodSet
-	Super     map[uint]*TypeClass
-	Sub       map[uint]*TypeClass
+	// Super-classes and sub-classes of the type-class, mapped by id.
+	//
+	// Deprecated: Super and Sub are replaced when the type-class is modified; use SuperClasses and SubClasses, which may be
+	// called while the type-class is modified concurrently.
+	Super map[uint]*TypeClass
+	Sub   map[uint]*TypeClass
+	// Instances declared for the type-class, in order of declaration.
+	//
+	// Deprecated: Instances is replaced when the type-class is modified; use InstanceList, which may be called while the
+	// type-class is modified concurrently.
 	Instances []*Instance
 	// Union type-classes may be cast to a tagged (ad-hoc) variant from their labelled instances
 	Union        map[string]*Instance
 	UnionVariant *Variant
 
-	// partially-grouped instances for faster lookups:
+	mu        sync.Mutex   // serializes changes to relations
+	relations atomic.Value // *classRelations
+}
+
+// classRelations is an immutable snapshot of the super-classes, sub-classes, and instances of a type-class.
+type classRelations struct {
+	super     *immutable.SortedMap // id -> *TypeClass
+	sub       *immutable.SortedMap // id -> *TypeClass
+	superList []*TypeClass         // super-classes ordered by id, visited during lookups
+	subList   []*TypeClass         // sub-classes ordered by id, visited during lookups
+	instances *immutable.List      // *Instance
 
-	tconst    map[string]*Instance   // mapped by name
-	tappconst map[string][]*Instance // grouped by constructor name
-	trecord   []*Instance
-	tvariant  []*Instance
-	tmisc     []*Instance // instances not in the above groups
+	nextSeq uint64 // declaration order of the next instance
+
+	// grouped and indexed instances for faster lookups:
+
+	tconst    *immutable.SortedMap // grouped by name (instances may be declared within separate type-environments)
+	tappconst *immutable.SortedMap // grouped by constructor name, then indexed by type-parameters -> *instanceIndex
+	trecord   *instanceIndex
+	tvariant  *instanceIndex
+	tmisc     *instanceIndex // instances not in the above groups
 }
 
+var (
+	emptyClassMap      = immutable.NewSortedMap(nil)
+	emptyInstanceList  = immutable.NewList()
+	emptyClassRelation = &classRelations{
+		super:     emptyClassMap,
+		sub:       emptyClassMap,
+		instances: emptyInstanceList,
+		tconst:    emptyClassMap,
+		tappconst: emptyClassMap,
+		trecord:   emptyInstanceIndex,
+		tvariant:  emptyInstanceIndex,
+		tmisc:     emptyInstanceIndex,
+	}
+)
+
 // Instance of a parameterized type-class
 type Instance struct {
 	TypeClass *TypeClass
@@ -62,6 +108,10 @@ type Instance struct {
 	Strict bool
 	// MethodNames maps method names to names of their implementations within the type-environment.
 	MethodNames map[string]string
+	// Env is the type-environment which declared the instance, or nil if the instance is visible within all type-environments.
+	Env TypeEnv
+
+	seq uint64 // declaration order within the type-class
 }
 
 func (inst *Instance) SetStrict(strict bool) { inst.Strict = strict }
@@ -76,252 +126,293 @@ func NewTypeClass(id uint, name string, param Type, methods MethodSet) *TypeClas
 	return &TypeClass{Id: id, Name: name, Param: param, Methods: methods}
 }
 
+func (tc *TypeClass) load() *classRelations {
+	if r, ok := tc.relations.Load().(*classRelations); ok {
+		return r
+	}
+	return emptyClassRelation
+}
+
+// Replace the current snapshot of relations with an updated copy.
+func (tc *TypeClass) update(f func(r *classRelations)) {
+	tc.mu.Lock()
+	r := *tc.load()
+	f(&r)
+	tc.relations.Store(&r)
+	tc.mu.Unlock()
+}
+
+// Get the super-classes of the type-class, ordered by id.
+func (tc *TypeClass) SuperClasses() []*TypeClass { return classList(tc.load().super) }
+
+// Get the sub-classes of the type-class, ordered by id.
+func (tc *TypeClass) SubClasses() []*TypeClass { return classList(tc.load().sub) }
+
+// Get the instances declared for the type-class, in order of declaration.
+func (tc *TypeClass) InstanceList() []*Instance {
+	l := tc.load().instances
+	instances := make([]*Instance, 0, l.Len())
+	eachInstance(l, func(inst *Instance) bool {
+		instances = append(instances, inst)
+		return false
+	})
+	return instances
+}
+
 // Add a super-class to the type-class. This is an alias for `super.AddSubClass(sub)`.
 func (sub *TypeClass) AddSuperClass(super *TypeClass) { super.AddSubClass(sub) }
 
 // Add a sub-class to the type-class.
 func (super *TypeClass) AddSubClass(sub *TypeClass) {
-	if super.Sub != nil && super.Sub[sub.Id] != nil {
+	if _, ok := super.load().sub.Get(int(sub.Id)); ok {
 		return
 	}
-	if sub.Super == nil {
-		sub.Super = make(map[uint]*TypeClass)
-	}
-	if super.Sub == nil {
-		super.Sub = make(map[uint]*TypeClass)
-	}
-	sub.Super[super.Id] = super
-	super.Sub[sub.Id] = sub
+	sub.update(func(r *classRelations) {
+		r.addSuper(super)
+		sub.Super = classMap(r.super)
+	})
+	super.update(func(r *classRelations) {
+		r.addSub(sub)
+		super.Sub = classMap(r.sub)
+	})
 }
 
 // Add an instance to the type-class with param as the type-parameter.
 //
 // methodNames must map from method names to names of their implementations within the type-environment.
 func (tc *TypeClass) AddInstance(param Type, methods MethodSet, methodNames map[string]string) *Instance {
-	inst := &Instance{TypeClass: tc, Param: param, Methods: methods, MethodNames: methodNames}
-	switch param := param.(type) {
-	case *Const:
-		if tc.tconst == nil {
-			tc.tconst = make(map[string]*Instance)
-		}
-		tc.tconst[param.Name] = inst
-	case *App:
-		if c, ok := param.Const.(*Const); ok {
-			if tc.tappconst == nil {
-				tc.tappconst = make(map[string][]*Instance)
+	return tc.AddEnvInstance(nil, param, methods, methodNames)
+}
+
+// Add an instance to the type-class with param as the type-parameter, which is only visible within env and type-environments
+// which see env.
+//
+// methodNames must map from method names to names of their implementations within the type-environment.
+func (tc *TypeClass) AddEnvInstance(env TypeEnv, param Type, methods MethodSet, methodNames map[string]string) *Instance {
+	inst := &Instance{TypeClass: tc, Param: param, Methods: methods, MethodNames: methodNames, Env: env}
+	tc.update(func(r *classRelations) {
+		r.addInstance(inst)
+		tc.Instances = append(tc.Instances, inst)
+	})
+	return inst
+}
+
+// Remove an instance from the type-class.
+func (tc *TypeClass) RemoveInstance(inst *Instance) {
+	tc.update(func(r *classRelations) {
+		r.removeInstance(inst)
+		instances := make([]*Instance, 0, len(tc.Instances))
+		for _, existing := range tc.Instances {
+			if existing != inst {
+				instances = append(instances, existing)
 			}
-			tc.tappconst[c.Name] = append(tc.tappconst[c.Name], inst)
-			break
 		}
-		tc.tmisc = append(tc.tmisc, inst)
-	case *Record:
-		tc.trecord = append(tc.trecord, inst)
-	case *Variant:
-		tc.tvariant = append(tc.tvariant, inst)
-	default:
-		tc.tmisc = append(tc.tmisc, inst)
-	}
-	tc.Instances = append(tc.Instances, inst)
-	return inst
+		tc.Instances = instances
+	})
 }
 
-// Check if a type-class is declared as a sub-class of another type-class.
-func (tc *TypeClass) HasSuperClass(super *TypeClass) bool {
-	seen := util.NewUintDedupeMap()
-	found := tc.hasSuperClass(seen, super.Id)
-	seen.Release()
-	return found
+func (r *classRelations) addSuper(super *TypeClass) {
+	r.super = r.super.Set(int(super.Id), super)
+	r.superList = classList(r.super)
 }
 
-func (tc *TypeClass) hasSuperClass(seen util.UintDedupeMap, id uint) bool {
-	seen[tc.Id] = true
-	for superId, super := range tc.Super {
-		switch {
-		case seen[superId]:
-			return false
-		case superId == id, super.hasSuperClass(seen, id):
-			return true
-		}
+func (r *classRelations) addSub(sub *TypeClass) {
+	r.sub = r.sub.Set(int(sub.Id), sub)
+	r.subList = classList(r.sub)
+}
+
+func (r *classRelations) addInstance(inst *Instance) {
+	inst.seq = r.nextSeq
+	r.nextSeq++
+	if c, ok := inst.Param.(*Const); ok {
+		r.tconst = appendGroup(r.tconst, c.Name, inst)
+	} else {
+		keys := indexKeys(nil, inst.Param, true)
+		r.updateIndex(inst.Param, func(idx *instanceIndex) *instanceIndex { return idx.insert(keys, inst) })
 	}
-	return false
+	r.instances = r.instances.Append(inst)
 }
 
-// Visit all instances for the type-class and all sub-classes. Sub-classes will be visited first.
-func (tc *TypeClass) FindInstance(found func(*Instance) bool) bool {
-	seen := util.NewUintDedupeMap()
-	ok, _ := tc.findInstance(seen, found)
-	seen.Release()
-	return ok
+func (r *classRelations) removeInstance(inst *Instance) {
+	if c, ok := inst.Param.(*Const); ok {
+		r.tconst = removeGroup(r.tconst, c.Name, inst)
+	} else {
+		keys := indexKeys(nil, inst.Param, true)
+		r.updateIndex(inst.Param, func(idx *instanceIndex) *instanceIndex { return idx.remove(keys, inst) })
+	}
+	r.instances = removeInstance(r.instances, inst)
 }
 
-// Visit all instances for the type-class and all sub-classes, filtered by a type-parameter. Sub-classes will be visited first.
-//
-// The type-parameter may reduce the number of instances visited in some cases, filtering out obvious non-matches.
-func (tc *TypeClass) MatchInstance(param Type, found func(*Instance) bool) (matched bool) {
-	seen := util.NewUintDedupeMap()
+// Get the index which instances with the (non-constant) type-parameter are grouped into.
+func (r *classRelations) index(param Type) *instanceIndex {
 	switch param := param.(type) {
-	case *Const:
-		matched, _ = tc.matchConstInstance(param.Name, seen, found)
 	case *App:
 		if c, ok := param.Const.(*Const); ok {
-			matched, _ = tc.matchAppConstInstance(c.Name, seen, found)
-		} else {
-			matched, _ = tc.matchInstance(seen, found)
+			if idx, ok := r.tappconst.Get(c.Name); ok {
+				return idx.(*instanceIndex)
+			}
+			return emptyInstanceIndex
 		}
 	case *Record:
-		matched, _ = tc.matchRecordInstance(seen, found)
+		return r.trecord
 	case *Variant:
-		matched, _ = tc.matchVariantInstance(seen, found)
-	default:
-		matched, _ = tc.matchInstance(seen, found)
+		return r.tvariant
 	}
-	seen.Release()
-	return
+	return r.tmisc
 }
 
-// Visit all instances for each of the type-class's top-most parents and all their (transitive) sub-classes. Sub-classes will be visited first.
-func (tc *TypeClass) FindInstanceFromRoots(found func(*Instance) bool) bool {
-	roots := make(map[uint]*TypeClass, 16)
-	tc.findRoots(roots)
-	var (
-		ok             bool
-		shouldContinue bool
-	)
-	seen := util.NewUintDedupeMap()
-	for _, root := range roots {
-		if root == nil {
-			// not a root
-			continue
-		}
-		if ok, shouldContinue = root.findInstance(seen, found); !shouldContinue {
-			break
+// Replace the index which instances with the (non-constant) type-parameter are grouped into.
+func (r *classRelations) updateIndex(param Type, f func(*instanceIndex) *instanceIndex) {
+	switch param := param.(type) {
+	case *App:
+		if c, ok := param.Const.(*Const); ok {
+			r.tappconst = r.tappconst.Set(c.Name, f(r.index(param)))
+			return
 		}
-	}
-	seen.Release()
-	return ok
-}
-
-func (tc *TypeClass) findRoots(roots map[uint]*TypeClass) {
-	if _, seen := roots[tc.Id]; seen {
+	case *Record:
+		r.trecord = f(r.trecord)
 		return
-	}
-	if len(tc.Super) == 0 {
-		roots[tc.Id] = tc
+	case *Variant:
+		r.tvariant = f(r.tvariant)
 		return
 	}
-	roots[tc.Id] = nil
-	for _, super := range tc.Super {
-		super.findRoots(roots)
-	}
+	r.tmisc = f(r.tmisc)
 }
 
-func (tc *TypeClass) findInstance(seen util.UintDedupeMap, found func(*Instance) bool) (ok, shouldContinue bool) {
-	if seen[tc.Id] {
-		return false, true
-	}
-	seen[tc.Id] = true
-	for _, sub := range tc.Sub {
-		if ok, shouldContinue = sub.findInstance(seen, found); !shouldContinue {
-			return ok, false
-		}
+func appendGroup(groups *immutable.SortedMap, name string, inst *Instance) *immutable.SortedMap {
+	group := emptyInstanceList
+	if existing, ok := groups.Get(name); ok {
+		group = existing.(*immutable.List)
 	}
-	for _, inst := range tc.Instances {
-		if found(inst) {
-			return true, false
-		}
-	}
-	return false, true
+	return groups.Set(name, group.Append(inst))
 }
 
-func (tc *TypeClass) matchInstance(seen util.UintDedupeMap, found func(*Instance) bool) (ok, shouldContinue bool) {
-	if seen[tc.Id] {
-		return false, true
-	}
-	seen[tc.Id] = true
-	for _, sub := range tc.Sub {
-		if ok, shouldContinue = sub.matchInstance(seen, found); !shouldContinue {
-			return ok, false
-		}
+func removeGroup(groups *immutable.SortedMap, name string, inst *Instance) *immutable.SortedMap {
+	if existing, ok := groups.Get(name); ok {
+		return groups.Set(name, removeInstance(existing.(*immutable.List), inst))
 	}
-	for _, inst := range tc.tmisc {
-		if found(inst) {
-			return true, false
-		}
-	}
-	return false, true
+	return groups
 }
 
-func (tc *TypeClass) matchConstInstance(name string, seen util.UintDedupeMap, found func(*Instance) bool) (ok, shouldContinue bool) {
-	if seen[tc.Id] {
-		return false, true
-	}
-	seen[tc.Id] = true
-	for _, sub := range tc.Sub {
-		if ok, shouldContinue = sub.matchConstInstance(name, seen, found); !shouldContinue {
-			return ok, false
+func removeInstance(instances *immutable.List, inst *Instance) *immutable.List {
+	b := immutable.NewListBuilder(emptyInstanceList)
+	eachInstance(instances, func(existing *Instance) bool {
+		if existing != inst {
+			b.Append(existing)
 		}
+		return false
+	})
+	return b.List()
+}
+
+func classList(classes *immutable.SortedMap) []*TypeClass {
+	list := make([]*TypeClass, 0, classes.Len())
+	eachClass(classes, func(tc *TypeClass) bool {
+		list = append(list, tc)
+		return false
+	})
+	return list
+}
+
+func classMap(classes *immutable.SortedMap) map[uint]*TypeClass {
+	m := make(map[uint]*TypeClass, classes.Len())
+	eachClass(classes, func(tc *TypeClass) bool {
+		m[tc.Id] = tc
+		return false
+	})
+	return m
+}
+
+// Visit type-classes in order of their ids, until f returns true. True will be returned if f returned true.
+func eachClass(classes *immutable.SortedMap, f func(*TypeClass) bool) bool {
+	if classes.Len() == 0 {
+		return false
 	}
-	if tc.tconst != nil {
-		inst := tc.tconst[name]
-		if inst != nil && found(inst) {
-			return true, false
+	for itr := classes.Iterator(); !itr.Done(); {
+		_, tc := itr.Next()
+		if f(tc.(*TypeClass)) {
+			return true
 		}
 	}
-	return false, true
+	return false
 }
 
-func (tc *TypeClass) matchAppConstInstance(name string, seen util.UintDedupeMap, found func(*Instance) bool) (ok, shouldContinue bool) {
-	if seen[tc.Id] {
-		return false, true
-	}
-	seen[tc.Id] = true
-	for _, sub := range tc.Sub {
-		if ok, shouldContinue = sub.matchAppConstInstance(name, seen, found); !shouldContinue {
-			return ok, false
+// Visit sub-classes in order of id, until f returns true. True will be returned if f returned true.
+func eachSubClass(r *classRelations, f func(*TypeClass) bool) bool {
+	for _, sub := range r.subList {
+		if f(sub) {
+			return true
 		}
 	}
-	if tc.tappconst != nil {
-		for _, inst := range tc.tappconst[name] {
-			if found(inst) {
-				return true, false
-			}
+	return false
+}
+
+// Visit instances in order, until f returns true. True will be returned if f returned true.
+func eachInstance(instances *immutable.List, f func(*Instance) bool) bool {
+	// Instances are visited by index, since iterators would be allocated for each lookup:
+	for i, n := 0, instances.Len(); i < n; i++ {
+		if f(instances.Get(i).(*Instance)) {
+			return true
 		}
 	}
-	return false, true
+	return false
 }
 
-func (tc *TypeClass) matchRecordInstance(seen util.UintDedupeMap, found func(*Instance) bool) (ok, shouldContinue bool) {
-	if seen[tc.Id] {
-		return false, true
-	}
+// Check if a type-class is declared as a sub-class of another type-class.
+func (tc *TypeClass) HasSuperClass(super *TypeClass) bool {
+	seen := util.NewUintDedupeMap()
+	found := tc.hasSuperClass(seen, super.Id)
+	seen.Release()
+	return found
+}
+
+func (tc *TypeClass) hasSuperClass(seen util.UintDedupeMap, id uint) bool {
 	seen[tc.Id] = true
-	for _, sub := range tc.Sub {
-		if ok, shouldContinue = sub.matchRecordInstance(seen, found); !shouldContinue {
-			return ok, false
+	for _, super := range tc.load().superList {
+		if !seen[super.Id] && (super.Id == id || super.hasSuperClass(seen, id)) {
+			return true
 		}
 	}
-	for _, inst := range tc.trecord {
-		if found(inst) {
-			return true, false
-		}
+	return false
+}
+
+// Visit all instances for the type-class and all sub-classes. Sub-classes will be visited first.
+func (tc *TypeClass) FindInstance(found func(*Instance) bool) bool {
+	return ClassOverlays(nil).FindInstance(tc, found)
+}
+
+// Visit all instances for the type-class and all sub-classes, filtered by a type-parameter. Sub-classes will be visited first,
+// and instances of each type-class will be visited in order of declaration.
+//
+// Instances are indexed by the full structure of their type-parameters (including nested constructors and record/variant labels),
+// filtering out most non-matches; some instances visited may not unify with the type-parameter.
+func (tc *TypeClass) MatchInstance(param Type, found func(*Instance) bool) (matched bool) {
+	return ClassOverlays(nil).MatchInstance(tc, param, found)
+}
+
+func instanceGroup(groups *immutable.SortedMap, name string) *immutable.List {
+	if group, ok := groups.Get(name); ok {
+		return group.(*immutable.List)
 	}
-	return false, true
+	return emptyInstanceList
 }
 
-func (tc *TypeClass) matchVariantInstance(seen util.UintDedupeMap, found func(*Instance) bool) (ok, shouldContinue bool) {
-	if seen[tc.Id] {
-		return false, true
+// Visit all instances for each of the type-class's top-most parents and all their (transitive) sub-classes. Sub-classes will be visited first.
+func (tc *TypeClass) FindInstanceFromRoots(found func(*Instance) bool) bool {
+	return ClassOverlays(nil).FindInstanceFromRoots(tc, found)
+}
+
+func (tc *TypeClass) findRoots(roots map[uint]*TypeClass) {
+	if _, seen := roots[tc.Id]; seen {
+		return
 	}
-	seen[tc.Id] = true
-	for _, sub := range tc.Sub {
-		if ok, shouldContinue = sub.matchVariantInstance(seen, found); !shouldContinue {
-			return ok, false
-		}
+	supers := tc.load().superList
+	if len(supers) == 0 {
+		roots[tc.Id] = tc
+		return
 	}
-	for _, inst := range tc.tvariant {
-		if found(inst) {
-			return true, false
-		}
+	roots[tc.Id] = nil
+	for _, super := range supers {
+		super.findRoots(roots)
 	}
-	return false, true
 }
@@ -31,8 +31,9 @@ const (
 	WeakVarLevel = 1 << 29
 
 	// Restricted levels (0x01...0x1f) << 24:
-	SizeVarLevel  = 1 << 24
-	ConstVarLevel = 2 << 24
+	SizeVarLevel    = 1 << 24
+	ConstVarLevel   = 2 << 24
+	MeasureVarLevel = 3 << 24
 
 	RestrictedVarLevelsMask = 0x1f << 24
 )
@@ -42,6 +43,7 @@ var _ Type = (*Var)(nil)
 // Type-variable
 type Var struct {
 	constraints []InstanceConstraint
+	bounds      []*SizeBound
 	link        Type
 	id          uint
 	level       uint32
@@ -78,6 +80,7 @@ func (tv *Var) IsGenericVar() bool    { return tv.level&GenericVarLevel != 0 }
 func (tv *Var) IsWeakVar() bool       { return tv.level&WeakVarLevel != 0 }
 func (tv *Var) IsSizeVar() bool       { return tv.level&RestrictedVarLevelsMask == SizeVarLevel }
 func (tv *Var) IsConstVar() bool      { return tv.level&RestrictedVarLevelsMask == ConstVarLevel }
+func (tv *Var) IsMeasureVar() bool    { return tv.level&RestrictedVarLevelsMask == MeasureVarLevel }
 func (tv *Var) IsRestrictedVar() bool { return tv.level&RestrictedVarLevelsMask != 0 }
 
 // Set the binding-level of the type-variable to the generic level.
@@ -120,6 +123,11 @@ func (tv *Var) RestrictConstVar() {
 	tv.level = (tv.level &^ RestrictedVarLevelsMask) | ConstVarLevel
 }
 
+// Restrict t as a unit type-variable. Unit type-variables may only unify with units of measure.
+func (tv *Var) RestrictMeasureVar() {
+	tv.level = (tv.level &^ RestrictedVarLevelsMask) | MeasureVarLevel
+}
+
 // Restrict t as a constructor/constant type-variable. Constructor/constant type-variables may only unify with type constants.
 func (tv *Var) Restrict(restrictedLevel uint) {
 	tv.level = (tv.level &^ RestrictedVarLevelsMask) | (uint32(restrictedLevel) & RestrictedVarLevelsMask)
@@ -145,6 +153,21 @@ func (tv *Var) AddConstraint(constraint InstanceConstraint) {
 	tv.constraints = append(tv.constraints, constraint)
 }
 
+// Set the size bounds which the (size) type-variable must satisfy.
+func (tv *Var) SetSizeBounds(bounds []*SizeBound) { tv.bounds = bounds }
+
+// Constrain the (size) type-variable with a size bound. Bounds which are already attached will be ignored.
+func (tv *Var) AddSizeBound(bound *SizeBound) {
+	if bound.AttachedTo(tv) {
+		return
+	}
+	// don't modify the existing slice of bounds, which may be shared with a stashed copy of the type-variable:
+	tv.bounds = append(tv.bounds[:len(tv.bounds):len(tv.bounds)], bound)
+}
+
+// SizeBounds returns the size bounds attached to the type-variable. Bounds attached to linked type-variables are not included.
+func (tv *Var) SizeBounds() []*SizeBound { return tv.bounds }
+
 // Constraints returns the set of type-classes which the type-variable must implement.
 func (tv *Var) Constraints() []InstanceConstraint {
 	for {
@@ -26,6 +26,8 @@
 //   Var:            type-variable
 //   Const:          type constant
 //   Size:           size constant
+//   SizeExpr:       size expression
+//   Measure:        unit of measure
 //   App:            type application
 //   Arrow:          function type
 //   Method:         type-class method type
@@ -34,6 +36,8 @@
 //   RowExtend:      row extension
 //   RowEmpty:       empty row
 //   RecursiveLink:  recursive link to a type
+//   Existential:    existentially quantified type
+//   Skolem:         rigid type within the scope of an unpacked existential type
 package types
 
 import (
@@ -45,6 +49,8 @@ var (
 	_ Type = (*Var)(nil)
 	_ Type = (*Const)(nil)
 	_ Type = Size(0)
+	_ Type = (*SizeExpr)(nil)
+	_ Type = (*Measure)(nil)
 	_ Type = (*App)(nil)
 	_ Type = (*Arrow)(nil)
 	_ Type = (*Method)(nil)
@@ -63,6 +69,8 @@ var (
 //   Var:            type-variable
 //   Const:          type constant
 //   Size:           size constant
+//   SizeExpr:       size expression
+//   Measure:        unit of measure
 //   App:            type application
 //   Arrow:          function type
 //   Method:         type-class method type
@@ -71,6 +79,8 @@ var (
 //   RowExtend:      row extension
 //   RowEmpty:       empty row
 //   RecursiveLink:  recursive link to a type
+//   Existential:    existentially quantified type
+//   Skolem:         rigid type within the scope of an unpacked existential type
 type Type interface {
 	TypeName() string
 	// Check if a type is a generic type-variable or contains generic type-variables.
@@ -103,6 +113,8 @@ const (
 	ContainsRefs TypeFlags = 2
 	// TypeFlags for a recursive type which is neither being generalized nor already generalized (to break cycles).
 	NeedsGeneralization = 4
+	// TypeFlags for an (inferred) equi-recursive type, which is equivalent to its unrolled type.
+	EquiRecursive = 8
 )
 
 // Unit/empty type: `()`
@@ -129,6 +141,21 @@ func NewRef(deref Type) *App {
 	return &App{Const: RefType, Params: []Type{deref}, Flags: ContainsRefs}
 }
 
+// Read-only references are applications of ReadRefType (a read-only reference-type) with a single referenced type-parameter.
+// Read-only references may be dereferenced but not assigned, and mutable references may be coerced to read-only references.
+var ReadRefType = &Const{"readref"}
+
+// Check if a type application is a read-only reference-type.
+func IsReadRefType(app *App) bool {
+	c, _ := app.Const.(*Const)
+	return c == ReadRefType
+}
+
+// Create an application of ReadRefType (a read-only reference-type) with a single referenced type-parameter.
+func NewReadRef(deref Type) *App {
+	return &App{Const: ReadRefType, Params: []Type{deref}}
+}
+
 // Type constant: `int`, `bool`, etc
 type Const struct {
 	Name string
@@ -154,6 +181,9 @@ type App struct {
 type Arrow struct {
 	Args   []Type
 	Return Type
+	// Effect row (row extension, empty row, or type-variable), or nil if effects are not tracked for the function.
+	// Untracked effects are instantiated as an effect row which is shared with functions in the argument and return types.
+	Effects Type
 	// Method which the function instantiates, or nil
 	Method *Method
 	// Source which this type was instantiated from, or nil
@@ -0,0 +1,92 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package types
+
+// Variance of a type-parameter within a type constructor, or of a type-variable occurrence within a type.
+//
+// The following variances are supported:
+//
+//   Bivariant:      the parameter does not occur within values of the type (phantom): `*`
+//   Covariant:      values of the parameter type may be produced (read) but not consumed: `+`
+//   Contravariant:  values of the parameter type may be consumed but not produced: `-`
+//   Invariant:      values of the parameter type may be both produced and consumed (written): `=`
+type Variance uint8
+
+const (
+	Bivariant     Variance = 0
+	Covariant     Variance = 1
+	Contravariant Variance = 2
+	Invariant     Variance = Covariant | Contravariant
+)
+
+// Get the opposite variance, for occurrences within a contravariant position (such as an argument of a function type).
+func (v Variance) Flip() Variance {
+	switch v {
+	case Covariant:
+		return Contravariant
+	case Contravariant:
+		return Covariant
+	}
+	return v
+}
+
+// Get the variance of an occurrence with variance inner, within a position with variance v.
+func (v Variance) Compose(inner Variance) Variance {
+	switch v {
+	case Covariant:
+		return inner
+	case Contravariant:
+		return inner.Flip()
+	case Invariant:
+		if inner == Bivariant {
+			return Bivariant
+		}
+		return Invariant
+	}
+	return Bivariant
+}
+
+// Combine the variances of separate occurrences.
+func (v Variance) Join(other Variance) Variance { return v | other }
+
+// Check if a position with variance v allows values to be consumed (written). Type-variables which occur within such positions
+// may not be generalized for expansive expressions under the relaxed value restriction.
+func (v Variance) IsConsumed() bool { return v&Contravariant != 0 }
+
+func (v Variance) String() string {
+	switch v {
+	case Covariant:
+		return "+"
+	case Contravariant:
+		return "-"
+	case Invariant:
+		return "="
+	}
+	return "*"
+}
+
+// Variance of the referenced type-parameter of mutable reference-types
+var RefVariance = []Variance{Invariant}
+
+// Variance of the referenced type-parameter of read-only reference-types
+var ReadRefVariance = []Variance{Covariant}
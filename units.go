@@ -0,0 +1,109 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/wdamron/poly/types"
+)
+
+// Declare a base unit of measure within the type environment, such as `m` or `s`. The base unit will be declared
+// as a type constructor with the `measure` kind.
+func (e *TypeEnv) DeclareBaseUnit(name string) (*types.Measure, error) {
+	if e.frozen {
+		return nil, errFrozen
+	}
+	if e.units[name] != nil {
+		return nil, errors.New("Unit of measure " + name + " is already declared")
+	}
+	c := e.DeclareKind(name, types.MeasureKindPointer)
+	m := types.NewMeasure(types.MeasureFactor{Unit: c, Exponent: 1})
+	e.declareUnit(name, m)
+	return m, nil
+}
+
+// Declare a derived unit of measure within the type environment, as an abbreviation for a product of other units,
+// such as `N = kg*m/s^2`. Derived units are equivalent to their definitions during unification.
+func (e *TypeEnv) DeclareUnit(name string, m *types.Measure) error {
+	if e.frozen {
+		return errFrozen
+	}
+	if e.units[name] != nil {
+		return errors.New("Unit of measure " + name + " is already declared")
+	}
+	if m.IsGeneric() {
+		return errors.New("Derived unit of measure " + name + " may not contain unit type-variables")
+	}
+	e.declareUnit(name, m)
+	return nil
+}
+
+func (e *TypeEnv) declareUnit(name string, m *types.Measure) {
+	if e.units == nil {
+		e.units = make(map[string]*types.Measure)
+	}
+	e.units[name] = m
+}
+
+// Lookup a base unit or derived unit of measure in the environment or its parent environment(s). If the unit
+// is not declared, nil will be returned.
+func (e *TypeEnv) LookupUnit(name string) *types.Measure {
+	for env := e; env != nil; env = env.Parent {
+		if m, ok := env.units[name]; ok {
+			return m
+		}
+	}
+	return nil
+}
+
+// Parse a unit of measure within the type environment, such as `kg*m/s^2` or `'u/s`.
+//
+// Names with a leading quote are unit type-variables, which will be resolved with vars. If vars is not nil, missing
+// unit type-variables will be created as generic type-variables and added to vars. All other names are resolved with
+// LookupUnit.
+func (e *TypeEnv) ParseUnit(s string, vars map[string]*types.Var) (*types.Measure, error) {
+	m, err := types.ParseMeasure(s, func(name string) types.Type {
+		if !strings.HasPrefix(name, "'") {
+			if m := e.LookupUnit(name); m != nil {
+				return m
+			}
+			return nil
+		}
+		if tv, ok := vars[name]; ok {
+			return tv
+		}
+		if vars == nil {
+			return nil
+		}
+		tv := e.NewGenericVar()
+		tv.RestrictMeasureVar()
+		vars[name] = tv
+		return tv
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
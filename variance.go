@@ -0,0 +1,68 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2019 West Damron
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package poly
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/wdamron/poly/types"
+)
+
+// Declare the variances of the parameters of a named type constructor within the type environment.
+//
+// Under the relaxed value restriction, type-variables within the types of expansive expressions (such as function calls) are
+// generalized when they only occur within covariant positions. Parameters of type constructors without declared variances are
+// assumed to be covariant; type constructors which contain mutable state should declare their parameters as invariant.
+func (e *TypeEnv) DeclareVariance(name string, variances ...types.Variance) error {
+	if e.frozen {
+		return errFrozen
+	}
+	if name == types.RefType.Name || name == types.ReadRefType.Name {
+		return errors.New("Variance cannot be declared for type " + name)
+	}
+	if kind, ok := e.LookupKind(name).(*types.ArrowKind); ok && len(kind.Params) != len(variances) {
+		return errors.New("Type " + name + " expects " + strconv.Itoa(len(kind.Params)) + " parameters, found " + strconv.Itoa(len(variances)) + " variances")
+	}
+	if e.variances == nil {
+		e.variances = make(map[string][]types.Variance)
+	}
+	e.variances[name] = variances
+	e.DeclareTypeConstructor(name)
+	return nil
+}
+
+// Lookup the declared variances of the parameters of a type constructor in the environment or its parent environment(s).
+// If the type constructor has no declared variances, nil will be returned.
+func (e *TypeEnv) LookupVariance(name string) []types.Variance {
+	switch name {
+	case types.RefType.Name:
+		return types.RefVariance
+	case types.ReadRefType.Name:
+		return types.ReadRefVariance
+	}
+	if env := e.typeConstructorEnv(name, make(map[*TypeEnv]bool)); env != nil {
+		return env.variances[name]
+	}
+	return nil
+}